@@ -0,0 +1,117 @@
+package einox
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+)
+
+// SelectionStrategyAdaptiveWeight 自适应权重：凭证出错时有效权重按比例衰减，成功后逐步恢复
+const SelectionStrategyAdaptiveWeight = "adaptive_weight"
+
+// minAdaptiveWeightFactor 有效权重系数的下限，出错的凭证仍保留少量流量，以便通过成功请求恢复
+const minAdaptiveWeightFactor = 0.05
+
+var (
+	adaptiveWeightMu sync.Mutex
+	// adaptiveWeightDecay 每次出错后有效权重系数乘以的比例
+	adaptiveWeightDecay = 0.5
+	// adaptiveWeightRecovery 每次成功后有效权重系数增加的量，最多恢复到1
+	adaptiveWeightRecovery = 0.1
+	// adaptiveWeightFactors 各凭证的有效权重系数，按scope和凭证名称记录，未记录时为1
+	adaptiveWeightFactors = map[string]map[string]float64{}
+)
+
+// SetAdaptiveWeightRates 设置自适应权重的衰减和恢复速度
+// decay为每次出错后权重系数乘以的比例，取值(0,1)；recovery为每次成功后系数增加的量，取值(0,1]
+func SetAdaptiveWeightRates(decay, recovery float64) error {
+	if decay <= 0 || decay >= 1 {
+		return fmt.Errorf("衰减比例必须在(0,1)之间: %v", decay)
+	}
+	if recovery <= 0 || recovery > 1 {
+		return fmt.Errorf("恢复量必须在(0,1]之间: %v", recovery)
+	}
+	adaptiveWeightMu.Lock()
+	defer adaptiveWeightMu.Unlock()
+	adaptiveWeightDecay = decay
+	adaptiveWeightRecovery = recovery
+	return nil
+}
+
+// ReportCredentialResult 报告凭证一次请求的结果，供自适应权重策略调整有效权重
+// provider为供应商名称（如"azure"），name为凭证名称，err为nil表示成功。
+// 通过CreateChatCompletion等统一入口发起的请求会自动报告
+func ReportCredentialResult(provider, name string, err error) {
+	reportCredentialResult(provider+":"+ENV, name, err)
+}
+
+// reportCredentialResult 按scope记录凭证的请求结果
+func reportCredentialResult(scope, name string, err error) {
+	if name == "" {
+		return
+	}
+	adaptiveWeightMu.Lock()
+	defer adaptiveWeightMu.Unlock()
+
+	factors, ok := adaptiveWeightFactors[scope]
+	if !ok {
+		factors = map[string]float64{}
+		adaptiveWeightFactors[scope] = factors
+	}
+	factor, ok := factors[name]
+	if !ok {
+		factor = 1
+	}
+
+	if err != nil {
+		factor *= adaptiveWeightDecay
+		if factor < minAdaptiveWeightFactor {
+			factor = minAdaptiveWeightFactor
+		}
+	} else {
+		factor += adaptiveWeightRecovery
+	}
+	if factor >= 1 {
+		// 完全恢复后不再记录
+		delete(factors, name)
+		return
+	}
+	factors[name] = factor
+}
+
+// adaptiveWeightFactor 获取凭证当前的有效权重系数
+func adaptiveWeightFactor(scope, name string) float64 {
+	adaptiveWeightMu.Lock()
+	defer adaptiveWeightMu.Unlock()
+	if factor, ok := adaptiveWeightFactors[scope][name]; ok {
+		return factor
+	}
+	return 1
+}
+
+// adaptiveWeightStrategy 按有效权重（基础权重乘以权重系数）随机选择一个候选，权重不大于0的凭证按1处理
+func adaptiveWeightStrategy(scope, key string, candidates []CredentialCandidate) []CredentialCandidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, candidate := range candidates {
+		weight := candidate.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		weights[i] = float64(weight) * adaptiveWeightFactor(scope, candidate.Name)
+		total += weights[i]
+	}
+
+	target := rand.Float64() * total
+	current := 0.0
+	for i, weight := range weights {
+		current += weight
+		if target < current {
+			return candidates[i : i+1]
+		}
+	}
+	return candidates[len(candidates)-1:]
+}
@@ -0,0 +1,74 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 统计多次选择中某个凭证被选中的比例
+func adaptiveSelectionShare(scope, name string, candidates []CredentialCandidate, rounds int) float64 {
+	hits := 0
+	for i := 0; i < rounds; i++ {
+		if adaptiveWeightStrategy(scope, "", candidates)[0].Name == name {
+			hits++
+		}
+	}
+	return float64(hits) / float64(rounds)
+}
+
+// 测试凭证出错后选中比例下降，成功后逐步恢复
+func TestAdaptiveWeightDecayAndRecovery(t *testing.T) {
+	scope := "azure:test-adaptive"
+	candidates := []CredentialCandidate{{Name: "a", Weight: 50}, {Name: "b", Weight: 50}}
+
+	share := adaptiveSelectionShare(scope, "a", candidates, 4000)
+	assert.InDelta(t, 0.5, share, 0.08, "未报告结果时按基础权重选择")
+
+	errUpstream := errors.New("上游错误")
+	for i := 0; i < 3; i++ {
+		reportCredentialResult(scope, "a", errUpstream)
+	}
+	assert.InDelta(t, 0.125, adaptiveWeightFactor(scope, "a"), 1e-9)
+	share = adaptiveSelectionShare(scope, "a", candidates, 4000)
+	assert.Less(t, share, 0.2, "出错后选中比例应下降")
+
+	for i := 0; i < 10; i++ {
+		reportCredentialResult(scope, "a", nil)
+	}
+	assert.Equal(t, 1.0, adaptiveWeightFactor(scope, "a"), "成功后应恢复到基础权重")
+	share = adaptiveSelectionShare(scope, "a", candidates, 4000)
+	assert.InDelta(t, 0.5, share, 0.08, "恢复后按基础权重选择")
+}
+
+// 测试权重系数有下限，并按scope隔离
+func TestAdaptiveWeightFloorAndScope(t *testing.T) {
+	scope := "azure:test-adaptive-floor"
+	for i := 0; i < 20; i++ {
+		reportCredentialResult(scope, "a", errors.New("上游错误"))
+	}
+	assert.Equal(t, minAdaptiveWeightFactor, adaptiveWeightFactor(scope, "a"))
+	assert.Equal(t, 1.0, adaptiveWeightFactor("claude:test-adaptive-floor", "a"))
+
+	// 未选中凭证的请求不记录
+	reportCredentialResult(scope, "", errors.New("上游错误"))
+	assert.Equal(t, 1.0, adaptiveWeightFactor(scope, ""))
+}
+
+// 测试设置衰减和恢复速度
+func TestSetAdaptiveWeightRates(t *testing.T) {
+	defer SetAdaptiveWeightRates(0.5, 0.1)
+
+	assert.Error(t, SetAdaptiveWeightRates(0, 0.1))
+	assert.Error(t, SetAdaptiveWeightRates(1, 0.1))
+	assert.Error(t, SetAdaptiveWeightRates(0.5, 0))
+	assert.Error(t, SetAdaptiveWeightRates(0.5, 1.5))
+
+	assert.NoError(t, SetAdaptiveWeightRates(0.2, 0.5))
+	scope := "azure:test-adaptive-rates"
+	reportCredentialResult(scope, "a", errors.New("上游错误"))
+	assert.InDelta(t, 0.2, adaptiveWeightFactor(scope, "a"), 1e-9)
+	reportCredentialResult(scope, "a", nil)
+	assert.InDelta(t, 0.7, adaptiveWeightFactor(scope, "a"), 1e-9)
+}
@@ -0,0 +1,140 @@
+package einox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// AESKeyEnvVar 环境变量，内容为Base64编码的AES密钥（16、24或32字节）
+	AESKeyEnvVar = "EINOX_AES_KEY"
+	// aesCipherPrefix AES-GCM加密的凭证前缀，不带此前缀的凭证按RSA解密
+	aesCipherPrefix = "aes:"
+)
+
+// ErrAESKeyNotConfigured 未设置AES密钥时加解密AES凭证返回的错误
+var ErrAESKeyNotConfigured = errors.New("未配置AES密钥")
+
+// AESKeyProvider 提供加解密凭证使用的AES密钥，用于从KMS等外部系统获取密钥
+type AESKeyProvider interface {
+	// AESKey 返回env环境使用的AES密钥，长度为16、24或32字节
+	AESKey(env string) ([]byte, error)
+}
+
+// AESKeyProviderFunc 函数形式的AESKeyProvider
+type AESKeyProviderFunc func(env string) ([]byte, error)
+
+// AESKey 实现AESKeyProvider
+func (f AESKeyProviderFunc) AESKey(env string) ([]byte, error) {
+	return f(env)
+}
+
+var (
+	aesKeyProviderMu sync.RWMutex
+	aesKeyProvider   AESKeyProvider
+)
+
+// SetAESKeyProvider 设置全局的AES密钥来源，传入nil表示使用 $EINOX_AES_KEY
+// 设置后会清空已缓存的解密后的凭证
+func SetAESKeyProvider(provider AESKeyProvider) {
+	aesKeyProviderMu.Lock()
+	aesKeyProvider = provider
+	aesKeyProviderMu.Unlock()
+
+	clearConfigFileCache()
+}
+
+// aesKeyForEnv 获取env环境使用的AES密钥
+func aesKeyForEnv(env string) ([]byte, error) {
+	aesKeyProviderMu.RLock()
+	provider := aesKeyProvider
+	aesKeyProviderMu.RUnlock()
+	if provider != nil {
+		key, err := provider.AESKey(env)
+		if err != nil {
+			return nil, fmt.Errorf("获取AES密钥失败: %w", err)
+		}
+		return key, nil
+	}
+
+	encoded := os.Getenv(AESKeyEnvVar)
+	if encoded == "" {
+		return nil, fmt.Errorf("%w: 请设置环境变量 %s 或调用SetAESKeyProvider", ErrAESKeyNotConfigured, AESKeyEnvVar)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s 不是合法的Base64: %v", ErrInvalidKey, AESKeyEnvVar, err)
+	}
+	return key, nil
+}
+
+// isAESCipherText 凭证是否为AES-GCM加密
+func isAESCipherText(cipherText string) bool {
+	return strings.HasPrefix(cipherText, aesCipherPrefix)
+}
+
+// newAESGCM 使用密钥创建AES-GCM
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return gcm, nil
+}
+
+// EncryptWithAESKey 使用AES-GCM加密数据，返回 "aes:<Base64(nonce+密文)>"，长度不受RSA密钥长度限制
+func EncryptWithAESKey(key []byte, data string) (string, error) {
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成nonce失败: %v", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(data), nil)
+	return aesCipherPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptWithAESKey 解密EncryptWithAESKey生成的数据
+func DecryptWithAESKey(key []byte, encryptedData string) (string, error) {
+	if !isAESCipherText(encryptedData) {
+		return "", fmt.Errorf("%w: 缺少%s前缀", ErrInvalidData, aesCipherPrefix)
+	}
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encryptedData, aesCipherPrefix))
+	if err != nil {
+		return "", fmt.Errorf("%w: Base64解码失败: %v", ErrInvalidData, err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("%w: 密文长度不足", ErrInvalidData)
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// decryptAESForEnv 使用env环境的AES密钥解密凭证
+func decryptAESForEnv(env, encryptedData string) (string, error) {
+	key, err := aesKeyForEnv(env)
+	if err != nil {
+		return "", err
+	}
+	return DecryptWithAESKey(key, encryptedData)
+}
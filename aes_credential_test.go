@@ -0,0 +1,121 @@
+package einox
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAESKey 生成32字节的测试密钥
+func newTestAESKey(seed byte) []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = seed + byte(i)
+	}
+	return key
+}
+
+// 测试AES-GCM加解密长凭证
+func TestEncryptWithAESKey(t *testing.T) {
+	key := newTestAESKey(1)
+	longSecret := `{"type":"service_account","private_key":"` + strings.Repeat("x", 4096) + `"}`
+
+	cipherText, err := EncryptWithAESKey(key, longSecret)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(cipherText, "aes:"))
+	plainText, err := DecryptWithAESKey(key, cipherText)
+	assert.NoError(t, err)
+	assert.Equal(t, longSecret, plainText)
+
+	_, err = DecryptWithAESKey(newTestAESKey(2), cipherText)
+	assert.Error(t, err, "密钥不同不能解密")
+	_, err = DecryptWithAESKey(key, "aes:AAAA")
+	assert.ErrorIs(t, err, ErrInvalidData)
+	_, err = DecryptWithAESKey(key, strings.TrimPrefix(cipherText, "aes:"))
+	assert.ErrorIs(t, err, ErrInvalidData)
+	_, err = EncryptWithAESKey([]byte("short"), "data")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+// 测试同一配置中AES和RSA加密的凭证按前缀分别解密
+func TestCachedDecryptFuncDispatch(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	t.Setenv(AESKeyEnvVar, base64.StdEncoding.EncodeToString(newTestAESKey(1)))
+	defer ReloadConfig()
+
+	aesCipher, err := EncryptSecretAESForEnv("production", "sk-aes")
+	assert.NoError(t, err)
+	rsaCipher, err := EncryptSecretForEnv("production", "sk-rsa")
+	assert.NoError(t, err)
+
+	plainText, err := DecryptSecretForEnv("production", aesCipher)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-aes", plainText)
+	plainText, err = DecryptSecretForEnv("production", rsaCipher)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-rsa", plainText)
+}
+
+// 测试只使用AES凭证时无需配置RSA密钥
+func TestGetAzureConfigWithAESCredential(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, "")
+	t.Setenv(RSAPrivateKeyEnvVar, "")
+	t.Setenv(RSAPrivateKeyFileEnvVar, "")
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "production"
+	defer ReloadConfig()
+
+	var requested []string
+	SetAESKeyProvider(AESKeyProviderFunc(func(env string) ([]byte, error) {
+		requested = append(requested, env)
+		return newTestAESKey(3), nil
+	}))
+	defer SetAESKeyProvider(nil)
+
+	cipherText, err := EncryptSecretAES("key-aes")
+	if !assert.NoError(t, err) {
+		return
+	}
+	configContent := fmt.Sprintf(`
+environments:
+  production:
+    credentials:
+      - name: production
+        api_key: %s
+        endpoint: https://production.example.com
+        enabled: true
+        weight: 1
+`, cipherText)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	conf, err := (&Config{}).getAzureConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "key-aes", conf.APIKey)
+	}
+	assert.Equal(t, []string{"production", "production"}, requested)
+
+	// RSA加密的凭证在未配置RSA密钥时返回错误而不是panic
+	_, err = DecryptSecretForEnv("production", "bm90LWFlcw==")
+	assert.ErrorContains(t, err, RSAKeysEnvVar)
+}
+
+// 测试未配置AES密钥时的错误
+func TestAESKeyNotConfigured(t *testing.T) {
+	t.Setenv(AESKeyEnvVar, "")
+	_, err := EncryptSecretAESForEnv("production", "sk-aes")
+	assert.ErrorIs(t, err, ErrAESKeyNotConfigured)
+
+	t.Setenv(AESKeyEnvVar, "不是Base64")
+	_, err = EncryptSecretAESForEnv("production", "sk-aes")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,127 @@
+package einox
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 需要特定Azure API版本的请求特性
+const (
+	APIFeatureVision     = "vision"      // 图片输入
+	APIFeatureTools      = "tools"       // 工具调用
+	APIFeatureJSONSchema = "json_schema" // 结构化输出
+)
+
+var (
+	azureAPIVersionRequirementsMu sync.RWMutex
+	// azureAPIVersionRequirements 各特性所需的最低Azure API版本
+	azureAPIVersionRequirements = map[string]string{
+		APIFeatureVision:     "2023-12-01-preview",
+		APIFeatureTools:      "2023-12-01-preview",
+		APIFeatureJSONSchema: "2024-08-01-preview",
+	}
+)
+
+// SetAzureAPIVersionRequirements 设置特性到最低Azure API版本的映射，会替换默认映射
+// 请求使用的特性需要比凭证配置更新的API版本时，会自动升级到满足所有特性的最低版本
+func SetAzureAPIVersionRequirements(requirements map[string]string) error {
+	copied := make(map[string]string, len(requirements))
+	for feature, version := range requirements {
+		if _, _, err := parseAzureAPIVersion(version); err != nil {
+			return fmt.Errorf("特性 %s 的API版本无效: %v", feature, err)
+		}
+		copied[feature] = version
+	}
+
+	azureAPIVersionRequirementsMu.Lock()
+	defer azureAPIVersionRequirementsMu.Unlock()
+	azureAPIVersionRequirements = copied
+	return nil
+}
+
+// requestAPIFeatures 检测请求使用的、需要特定API版本的特性
+func requestAPIFeatures(req ChatRequest) []string {
+	var features []string
+
+	for _, msg := range req.Messages {
+		if hasImagePart(msg) {
+			features = append(features, APIFeatureVision)
+			break
+		}
+	}
+	if len(req.Tools) > 0 || len(req.Functions) > 0 {
+		features = append(features, APIFeatureTools)
+	}
+	if req.ResponseFormat != nil && req.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONSchema {
+		features = append(features, APIFeatureJSONSchema)
+	}
+	return features
+}
+
+// hasImagePart 判断消息是否包含图片内容
+func hasImagePart(msg openai.ChatCompletionMessage) bool {
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateAzureAPIVersion 根据请求特性协商API版本
+// 返回当前版本与各特性所需版本中最新的一个，未配置要求的特性不影响结果
+func negotiateAzureAPIVersion(current string, features []string) string {
+	azureAPIVersionRequirementsMu.RLock()
+	defer azureAPIVersionRequirementsMu.RUnlock()
+
+	negotiated := current
+	for _, feature := range features {
+		required, ok := azureAPIVersionRequirements[feature]
+		if !ok {
+			continue
+		}
+		if compareAzureAPIVersion(required, negotiated) > 0 {
+			negotiated = required
+		}
+	}
+	return negotiated
+}
+
+// parseAzureAPIVersion 解析形如 2024-08-01 或 2024-08-01-preview 的版本号
+func parseAzureAPIVersion(version string) (date string, preview bool, err error) {
+	date, suffix, _ := strings.Cut(version, "-preview")
+	if suffix != "" || len(date) != len("2006-01-02") || date[4] != '-' || date[7] != '-' {
+		return "", false, fmt.Errorf("无法识别的API版本: %s", version)
+	}
+	return date, strings.HasSuffix(version, "-preview"), nil
+}
+
+// compareAzureAPIVersion 比较两个API版本，a较新时返回正数
+// 日期相同时正式版比预览版新；空版本或无法识别的版本视为最旧
+func compareAzureAPIVersion(a, b string) int {
+	dateA, previewA, errA := parseAzureAPIVersion(a)
+	dateB, previewB, errB := parseAzureAPIVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+
+	if cmp := strings.Compare(dateA, dateB); cmp != 0 {
+		return cmp
+	}
+	switch {
+	case previewA == previewB:
+		return 0
+	case previewA:
+		return -1
+	default:
+		return 1
+	}
+}
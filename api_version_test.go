@@ -0,0 +1,109 @@
+package einox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试API版本比较
+func TestCompareAzureAPIVersion(t *testing.T) {
+	assert.Positive(t, compareAzureAPIVersion("2024-08-01-preview", "2024-02-01"))
+	assert.Positive(t, compareAzureAPIVersion("2024-02-01", "2024-02-01-preview"), "正式版应比同日期的预览版新")
+	assert.Zero(t, compareAzureAPIVersion("2024-02-01", "2024-02-01"))
+	assert.Negative(t, compareAzureAPIVersion("", "2023-05-15"), "空版本应视为最旧")
+}
+
+// 测试请求特性检测
+func TestRequestAPIFeatures(t *testing.T) {
+	req := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{
+			Role: openai.ChatMessageRoleUser,
+			MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "这是什么"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png"}},
+			},
+		}},
+		Tools:          []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "f"}}},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONSchema},
+	}}
+	assert.Equal(t, []string{APIFeatureVision, APIFeatureTools, APIFeatureJSONSchema}, requestAPIFeatures(req))
+
+	plain := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+	}}
+	assert.Empty(t, requestAPIFeatures(plain))
+}
+
+// 测试视觉请求会升级API版本，普通请求保持凭证的默认版本
+func TestGetAzureConfigNegotiatesAPIVersion(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("test-key")
+	assert.NoError(t, err)
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: dev
+        api_key: %s
+        endpoint: https://dev.example.com
+        api_version: 2023-05-15
+        enabled: true
+        weight: 1
+`, cipher)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	plain := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+	}}
+	conf, err := (&Config{RequiredFeatures: requestAPIFeatures(plain)}).getAzureConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-05-15", conf.APIVersion)
+
+	vision := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{
+			Role: openai.ChatMessageRoleUser,
+			MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png"}},
+			},
+		}},
+	}}
+	conf, err = (&Config{RequiredFeatures: requestAPIFeatures(vision)}).getAzureConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-12-01-preview", conf.APIVersion)
+}
+
+// 测试自定义特性版本映射
+func TestSetAzureAPIVersionRequirements(t *testing.T) {
+	assert.Error(t, SetAzureAPIVersionRequirements(map[string]string{APIFeatureVision: "latest"}))
+
+	azureAPIVersionRequirementsMu.RLock()
+	original := azureAPIVersionRequirements
+	azureAPIVersionRequirementsMu.RUnlock()
+	defer func() {
+		azureAPIVersionRequirementsMu.Lock()
+		azureAPIVersionRequirements = original
+		azureAPIVersionRequirementsMu.Unlock()
+	}()
+
+	assert.NoError(t, SetAzureAPIVersionRequirements(map[string]string{APIFeatureTools: "2024-06-01"}))
+	assert.Equal(t, "2024-06-01", negotiateAzureAPIVersion("2024-02-01", []string{APIFeatureTools}))
+	// 已经足够新的版本保持不变
+	assert.Equal(t, "2024-10-21", negotiateAzureAPIVersion("2024-10-21", []string{APIFeatureTools}))
+	// 移除映射后的特性不影响版本
+	assert.Equal(t, "2024-02-01", negotiateAzureAPIVersion("2024-02-01", []string{APIFeatureVision}))
+}
@@ -0,0 +1,140 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// budgetExceededNote 因超出补全token预算提前结束时附带的说明
+const budgetExceededNote = "已达到补全token预算，生成已提前终止"
+
+// errCompletionBudgetReached 超出预算后继续写入流时返回，调用方据此停止读取上游流
+var errCompletionBudgetReached = errors.New("已达到补全token预算")
+
+// estimateTokens 粗略估算文本的token数
+// 中日韩字符按每字1个token，其他字符按每4个字符1个token计算
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// completionBudget 累计流式响应的补全token数
+// 提供商在数据块中返回了用量时以其为准，否则按内容估算
+type completionBudget struct {
+	limit int
+	used  int
+}
+
+// newCompletionBudget 创建预算计数器，limit<=0 表示不限制
+func newCompletionBudget(limit int) *completionBudget {
+	return &completionBudget{limit: limit}
+}
+
+// add 累计一个数据块，返回是否已达到预算
+func (b *completionBudget) add(chunk *openai.ChatCompletionStreamResponse) bool {
+	if b.limit <= 0 || chunk == nil {
+		return false
+	}
+	for _, choice := range chunk.Choices {
+		b.used += estimateTokens(choice.Delta.Content)
+		for _, tc := range choice.Delta.ToolCalls {
+			b.used += estimateTokens(tc.Function.Arguments)
+		}
+	}
+	if chunk.Usage != nil && chunk.Usage.CompletionTokens > b.used {
+		b.used = chunk.Usage.CompletionTokens
+	}
+	return b.used >= b.limit
+}
+
+// budgetWriter 按补全token预算截断SSE输出
+// 达到预算后写入finish_reason为length的结束帧、说明注释和结束标记，之后的写入都返回errCompletionBudgetReached
+type budgetWriter struct {
+	w        io.Writer
+	budget   *completionBudget
+	pending  []byte
+	last     *openai.ChatCompletionStreamResponse
+	exceeded bool
+}
+
+// newBudgetWriter 包装writer，limit<=0 时原样返回
+func newBudgetWriter(w io.Writer, limit int) io.Writer {
+	if limit <= 0 {
+		return w
+	}
+	return &budgetWriter{w: w, budget: newCompletionBudget(limit)}
+}
+
+// Write 实现io.Writer接口
+func (b *budgetWriter) Write(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errCompletionBudgetReached
+	}
+	n, err := b.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	b.pending = append(b.pending, p[:n]...)
+	for {
+		end := bytes.Index(b.pending, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		frame := b.pending[:end]
+		b.pending = b.pending[end+2:]
+		if b.addFrame(frame) {
+			return n, b.finish()
+		}
+	}
+	return n, nil
+}
+
+// addFrame 解析一个SSE帧并累计token，返回是否已达到预算
+func (b *budgetWriter) addFrame(frame []byte) bool {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(frame), []byte("data:"))
+	if !ok {
+		return false
+	}
+	var chunk openai.ChatCompletionStreamResponse
+	if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err != nil {
+		return false
+	}
+	b.last = &chunk
+	return b.budget.add(&chunk)
+}
+
+// finish 写入提前结束的帧
+func (b *budgetWriter) finish() error {
+	b.exceeded = true
+
+	final := openai.ChatCompletionStreamResponse{
+		Object:  "chat.completion.chunk",
+		Choices: []openai.ChatCompletionStreamChoice{{Index: 0, FinishReason: openai.FinishReasonLength}},
+	}
+	if b.last != nil {
+		final.ID, final.Created, final.Model = b.last.ID, b.last.Created, b.last.Model
+	}
+	data, err := json.Marshal(final)
+	if err != nil {
+		return fmt.Errorf("序列化结束帧失败: %v", err)
+	}
+	// 说明以SSE注释的形式写出，不影响客户端解析
+	if _, err := fmt.Fprintf(b.w, "data: %s\n\n: %s\n\ndata: [DONE]\n\n", data, budgetExceededNote); err != nil {
+		return fmt.Errorf("写入结束帧失败: %v", err)
+	}
+	return nil
+}
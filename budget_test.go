@@ -0,0 +1,83 @@
+package einox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试token估算
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, estimateTokens(""))
+	assert.Equal(t, 2, estimateTokens("你好"))
+	assert.Equal(t, 2, estimateTokens("hello"))
+}
+
+// 测试超出预算时流提前结束，done事件的结束原因为length
+func TestPumpStreamEventsBudgetExceeded(t *testing.T) {
+	chunks := make([]*openai.ChatCompletionStreamResponse, 0, 20)
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, newTestStreamChunk("一二三四五", ""))
+	}
+	chunks = append(chunks, newTestStreamChunk("", openai.FinishReasonStop))
+	reader := schema.StreamReaderFromArray(chunks)
+
+	var events []StreamEvent
+	pumpStreamEvents(reader, time.Now(), 12, func(event StreamEvent) bool {
+		events = append(events, event)
+		return true
+	})
+
+	// 每个数据块5个token，第3个数据块后达到12个token的预算
+	if assert.Len(t, events, 4) {
+		done := events[3]
+		assert.Equal(t, StreamEventDone, done.Type)
+		assert.Equal(t, openai.FinishReasonLength, done.FinishReason)
+		assert.Equal(t, budgetExceededNote, done.Note)
+	}
+}
+
+// 测试未设置预算时不截断
+func TestPumpStreamEventsNoBudget(t *testing.T) {
+	reader := schema.StreamReaderFromArray([]*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("一二三四五", ""),
+		newTestStreamChunk("一二三四五", openai.FinishReasonStop),
+	})
+
+	var done StreamEvent
+	pumpStreamEvents(reader, time.Now(), 0, func(event StreamEvent) bool {
+		done = event
+		return true
+	})
+	assert.Equal(t, openai.FinishReasonStop, done.FinishReason)
+	assert.Empty(t, done.Note)
+}
+
+// 测试SSE输出在超出预算后写入结束帧并拒绝后续写入
+func TestBudgetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newBudgetWriter(&buf, 8)
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		for _, part := range []string{"data: ", fmt.Sprintf(`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"一二三四五"}}]}`), "\n\n"} {
+			if _, err = writer.Write([]byte(part)); err != nil {
+				break
+			}
+		}
+	}
+	assert.True(t, errors.Is(err, errCompletionBudgetReached))
+
+	body := buf.String()
+	assert.Equal(t, 2, strings.Count(body, "一二三四五"), "达到预算后不应再输出内容")
+	assert.Contains(t, body, `"finish_reason":"length"`)
+	assert.Contains(t, body, ": "+budgetExceededNote+"\n\n")
+	assert.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"))
+}
@@ -0,0 +1,40 @@
+package einox
+
+import "sync"
+
+// CallInfo 实际处理请求的供应商和凭证，用于排查某个凭证（如某个Azure部署）上的限流等问题
+// 只包含凭证名称和端点，不包含密钥等敏感信息
+type CallInfo struct {
+	Provider   string `json:"provider"`           // 供应商
+	Credential string `json:"credential"`         // 凭证名称，重试或故障转移时为最后一次调用使用的凭证
+	Endpoint   string `json:"endpoint,omitempty"` // 凭证配置的API端点（Bedrock为区域），未配置时为空，表示使用供应商的默认端点
+}
+
+// captureCallInfo 在请求上登记凭证选择回调，返回读取最近一次选中凭证的函数
+// 请求上原有的回调仍会被调用
+func captureCallInfo(req *ChatRequest) func() CallInfo {
+	var mu sync.Mutex
+	var callInfo CallInfo
+	previous := req.onCredentialSelected
+	req.onCredentialSelected = func(info CallInfo) {
+		mu.Lock()
+		callInfo = info
+		mu.Unlock()
+		if previous != nil {
+			previous(info)
+		}
+	}
+	return func() CallInfo {
+		mu.Lock()
+		defer mu.Unlock()
+		return callInfo
+	}
+}
+
+// callInfoOrNil 未选中任何凭证（如自定义供应商）时返回nil
+func callInfoOrNil(info CallInfo) *CallInfo {
+	if info.Credential == "" {
+		return nil
+	}
+	return &info
+}
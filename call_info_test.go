@@ -0,0 +1,81 @@
+package einox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// credentialChunkProvider 打开流之前先选中凭证的测试供应商
+type credentialChunkProvider struct {
+	chunkProvider
+}
+
+func (p *credentialChunkProvider) OpenStream(ctx context.Context, req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	conf := &Config{Vendor: "chunks-cred", onCredentialSelected: req.onCredentialSelected}
+	conf.recordSelectedCredential("eastus", "https://eastus.example.com/")
+	return p.chunkProvider.OpenStream(ctx, req)
+}
+
+// 测试非流式响应返回实际处理请求的凭证，故障转移后为最后一次使用的凭证
+func TestCallInfoNonStream(t *testing.T) {
+	provider := registerRegionalProvider(t, map[string]error{
+		"eastus": &openai.APIError{HTTPStatusCode: 429, Message: "rate limited"},
+	})
+	provider.creds[0].Endpoint = "https://westus.example.com/"
+
+	result, err := CreateChatCompletionWithResolvedConfig(newRegionalRequest(true, 0))
+	if assert.NoError(t, err) && assert.NotNil(t, result.CallInfo) {
+		assert.Equal(t, CallInfo{Provider: "regional", Credential: "japaneast"}, *result.CallInfo)
+		assert.Equal(t, "japaneast", result.ResolvedConfig.Credential)
+	}
+
+	provider.failures["japaneast"] = &openai.APIError{HTTPStatusCode: 503, Message: "unavailable"}
+	result, err = CreateChatCompletionWithResolvedConfig(newRegionalRequest(true, 0))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://westus.example.com/", result.CallInfo.Endpoint)
+	}
+
+	// 没有选择凭证的供应商不返回CallInfo
+	registerFakeProvider(t, "no-credential")
+	result, err = CreateChatCompletionWithResolvedConfig(ChatRequest{Provider: "no-credential"})
+	assert.NoError(t, err)
+	assert.Nil(t, result.CallInfo)
+}
+
+// 测试流式事件的done和error事件携带凭证
+func TestCallInfoStream(t *testing.T) {
+	provider := &credentialChunkProvider{chunkProvider{chunks: []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你好", openai.FinishReasonStop),
+	}}}
+	RegisterProvider("chunks-cred", provider)
+	t.Cleanup(func() { unregisterTestProvider("chunks-cred") })
+
+	req := ChatRequest{Provider: "chunks-cred"}
+	req.Model = "gpt-4o"
+	want := CallInfo{Provider: "chunks-cred", Credential: "eastus", Endpoint: "https://eastus.example.com/"}
+
+	var events []StreamEvent
+	err := StreamChatCompletionWithCallback(req, func(event StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if assert.NoError(t, err) && assert.Len(t, events, 2) {
+		assert.Nil(t, events[0].CallInfo, "chunk事件不携带凭证")
+		assert.Equal(t, StreamEventDone, events[1].Type)
+		assert.Equal(t, &want, events[1].CallInfo)
+	}
+
+	provider.err = assert.AnError
+	channel, err := StreamChatCompletionChannel(context.Background(), req)
+	assert.NoError(t, err)
+	var last StreamEvent
+	for event := range channel {
+		last = event
+	}
+	assert.Equal(t, StreamEventError, last.Type)
+	assert.Equal(t, &want, last.CallInfo)
+}
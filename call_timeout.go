@@ -0,0 +1,117 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrStreamIdleTimeout 流式响应超过超时时间未收到新的数据块时返回的错误
+var ErrStreamIdleTimeout = errors.New("流式响应空闲超时")
+
+// recordCallTimeout 记录本次调用的超时时间，请求指定的超时优先于凭证配置的timeout（秒）
+func (c *Config) recordCallTimeout(credentialSeconds int) {
+	if c.RequestTimeout > 0 {
+		c.callTimeout = c.RequestTimeout
+		return
+	}
+	if credentialSeconds > 0 {
+		c.callTimeout = time.Duration(credentialSeconds) * time.Second
+	}
+}
+
+// withoutClientTimeout 设置了调用超时时返回HTTP客户端不带Timeout的配置副本，
+// 由ctx控制超时，避免http.Client.Timeout限制流式响应的总时长；不修改共享的modelConf和客户端
+func withoutClientTimeout(modelConf *einoopenai.ChatModelConfig, timeout time.Duration) *einoopenai.ChatModelConfig {
+	if timeout <= 0 || modelConf.HTTPClient == nil || modelConf.HTTPClient.Timeout == 0 {
+		return modelConf
+	}
+	conf := *modelConf
+	client := *modelConf.HTTPClient
+	client.Timeout = 0
+	conf.HTTPClient = &client
+	return &conf
+}
+
+// withCallTimeout 为非流式调用设置超时，timeout不大于0时不限制
+func withCallTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// streamWithIdleTimeout 使用空闲超时发起流式调用：建立连接和每两个数据块之间的等待时间都不超过idle，
+// 每收到一个数据块重新计时，不限制流的总时长。超时后中止上游调用并返回ErrStreamIdleTimeout，idle不大于0时不限制
+func streamWithIdleTimeout[T any](ctx context.Context, idle time.Duration,
+	stream func(ctx context.Context) (*schema.StreamReader[T], error)) (*schema.StreamReader[T], error) {
+	if idle <= 0 {
+		return stream(ctx)
+	}
+
+	streamCtx, cancel := context.WithCancelCause(ctx)
+	idleErr := fmt.Errorf("%w: 超过%s未收到数据", ErrStreamIdleTimeout, idle)
+	timer := time.AfterFunc(idle, func() { cancel(idleErr) })
+	streamReader, err := stream(streamCtx)
+	timer.Stop()
+	if err != nil {
+		if errors.Is(context.Cause(streamCtx), ErrStreamIdleTimeout) {
+			err = fmt.Errorf("%w: %v", idleErr, err)
+		}
+		cancel(nil)
+		return nil, err
+	}
+
+	resultReader, resultWriter := schema.Pipe[T](10)
+	go func() {
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				getLogger().Error("流式空闲超时处理发生异常", "panic", panicErr)
+			}
+			cancel(nil)
+			streamReader.Close()
+			resultWriter.Close()
+		}()
+
+		idleTimer := time.NewTimer(idle)
+		defer idleTimer.Stop()
+		received := recvWithContext(streamCtx, streamReader)
+		var zero T
+		for {
+			select {
+			case r := <-received:
+				if errors.Is(r.err, io.EOF) {
+					return
+				}
+				if r.err != nil {
+					_ = resultWriter.Send(zero, r.err)
+					return
+				}
+				if closed := resultWriter.Send(r.value, nil); closed {
+					return
+				}
+				// 下游读取较慢时计时器可能已触发，清空后重新计时
+				if !idleTimer.Stop() {
+					select {
+					case <-idleTimer.C:
+					default:
+					}
+				}
+				idleTimer.Reset(idle)
+			case <-idleTimer.C:
+				cancel(idleErr)
+				_ = resultWriter.Send(zero, idleErr)
+				return
+			case <-streamCtx.Done():
+				_ = resultWriter.Send(zero, context.Cause(streamCtx))
+				return
+			}
+		}
+	}()
+	return resultReader, nil
+}
@@ -0,0 +1,162 @@
+package einox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试请求指定的超时优先于凭证的timeout
+func TestRecordCallTimeout(t *testing.T) {
+	c := &Config{}
+	c.recordCallTimeout(0)
+	assert.Zero(t, c.callTimeout)
+	c.recordCallTimeout(30)
+	assert.Equal(t, 30*time.Second, c.callTimeout)
+
+	c = &Config{RequestTimeout: 500 * time.Millisecond}
+	c.recordCallTimeout(30)
+	assert.Equal(t, 500*time.Millisecond, c.callTimeout)
+}
+
+// 测试凭证的timeout和请求指定的超时传递到调用超时
+func TestAzureCallTimeoutFromCredential(t *testing.T) {
+	conf := &Config{
+		Vendor: "azure",
+		Model:  "gpt-4o",
+		InlineAzureCredential: &AzureCredential{
+			Name:     "vault",
+			ApiKey:   "plain-key",
+			Endpoint: "https://example.openai.azure.com/",
+			Timeout:  20,
+		},
+	}
+	azureConf, err := conf.getAzureConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 20*time.Second, conf.callTimeout)
+		assert.Equal(t, 20*time.Second, azureConf.HTTPClient.Timeout)
+	}
+
+	conf.RequestTimeout = 90 * time.Second
+	_, err = conf.getAzureConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, conf.callTimeout)
+}
+
+// 测试设置调用超时后使用不带Timeout的HTTP客户端副本，不修改共享的客户端
+func TestWithoutClientTimeout(t *testing.T) {
+	shared := &http.Client{Timeout: 20 * time.Second}
+	modelConf := &einoopenai.ChatModelConfig{Model: "gpt-4o", HTTPClient: shared}
+
+	assert.Same(t, modelConf, withoutClientTimeout(modelConf, 0))
+	callConf := withoutClientTimeout(modelConf, 20*time.Second)
+	assert.Zero(t, callConf.HTTPClient.Timeout)
+	assert.Equal(t, "gpt-4o", callConf.Model)
+	assert.Equal(t, 20*time.Second, shared.Timeout)
+	assert.Same(t, shared, modelConf.HTTPClient)
+}
+
+// 测试非流式调用超时
+func TestWithCallTimeout(t *testing.T) {
+	ctx, cancel := withCallTimeout(context.Background(), 0)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+
+	ctx, cancel = withCallTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("超时后ctx应被取消")
+	}
+}
+
+// sendSlowly 每隔interval发送一个数据块，stall为true时发送第一个数据块后停止发送但不关闭流
+func sendSlowly(ctx context.Context, interval time.Duration, stall bool) *schema.StreamReader[string] {
+	reader, writer := schema.Pipe[string](0)
+	go func() {
+		defer writer.Close()
+		for i, chunk := range []string{"a", "b", "c", "d"} {
+			if closed := writer.Send(chunk, nil); closed {
+				return
+			}
+			if stall && i == 0 {
+				<-ctx.Done()
+				return
+			}
+			time.Sleep(interval)
+		}
+	}()
+	return reader
+}
+
+// 测试流式调用的超时为空闲超时：持续收到数据块时不限制总时长，停止发送后返回ErrStreamIdleTimeout
+func TestStreamWithIdleTimeout(t *testing.T) {
+	idle := 150 * time.Millisecond
+	start := time.Now()
+	reader, err := streamWithIdleTimeout(context.Background(), idle, func(ctx context.Context) (*schema.StreamReader[string], error) {
+		return sendSlowly(ctx, 60*time.Millisecond, false), nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var content string
+	for {
+		chunk, err := reader.Recv()
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+		content += chunk
+	}
+	assert.Equal(t, "abcd", content)
+	assert.Greater(t, time.Since(start), idle, "流的总时长超过超时时间仍应正常结束")
+
+	var upstreamCtx context.Context
+	reader, err = streamWithIdleTimeout(context.Background(), idle, func(ctx context.Context) (*schema.StreamReader[string], error) {
+		upstreamCtx = ctx
+		return sendSlowly(ctx, 60*time.Millisecond, true), nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer reader.Close()
+	chunk, err := reader.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", chunk)
+	_, err = reader.Recv()
+	assert.ErrorIs(t, err, ErrStreamIdleTimeout)
+	assert.ErrorIs(t, context.Cause(upstreamCtx), ErrStreamIdleTimeout, "超时后应中止上游调用")
+}
+
+// 测试建立流式连接超时
+func TestStreamWithIdleTimeoutConnect(t *testing.T) {
+	_, err := streamWithIdleTimeout(context.Background(), 20*time.Millisecond, func(ctx context.Context) (*schema.StreamReader[string], error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.ErrorIs(t, err, ErrStreamIdleTimeout)
+
+	// 调用方取消时返回取消错误
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader, err := streamWithIdleTimeout(ctx, time.Second, func(ctx context.Context) (*schema.StreamReader[string], error) {
+		return sendSlowly(ctx, 0, true), nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = reader.Recv()
+	assert.NoError(t, err)
+	cancel()
+	_, err = reader.Recv()
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,99 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrChatStreamClosed 调用Close之后继续读取ChatStream
+var ErrChatStreamClosed = errors.New("流式响应已关闭")
+
+// ChatStream 流式响应的读取句柄，由CreateChatCompletionStream返回
+// 通过Recv逐个读取数据块，读完或不再需要时调用Close释放上游连接和凭证并发槽位。
+// 同一个ChatStream不能在多个goroutine中同时调用Recv
+type ChatStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	events <-chan StreamEvent
+
+	// err 流结束后Recv返回的错误：正常结束为io.EOF
+	err     error
+	summary *StreamEvent
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// CreateChatCompletionStream 发起流式请求，返回逐块读取的ChatStream，数据块不经过SSE编码
+// 需要向HTTP客户端输出SSE时使用CreateChatCompletion/StreamToHTTP等基于io.Writer的接口。
+// ctx被取消或超时后，对供应商的调用被中止，Recv返回ctx的错误
+func CreateChatCompletionStream(ctx context.Context, req ChatRequest) (*ChatStream, error) {
+	ctx, cancel := context.WithCancel(requestContext(ctx))
+	req.ctx = ctx
+	req.Stream = true
+
+	closed := make(chan struct{})
+	events, err := streamEventChannel(req, closed)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &ChatStream{ctx: ctx, cancel: cancel, events: events, closed: closed}, nil
+}
+
+// Recv 读取下一个数据块
+// 流正常结束后返回io.EOF，此后可通过Summary获取结束原因和用量；流异常中断时返回上游的错误，若此时已收到工具调用，则为包装该错误的 *PartialStreamError；
+// ctx被取消时返回ctx的错误，调用Close之后返回ErrChatStreamClosed
+func (s *ChatStream) Recv() (*openai.ChatCompletionStreamResponse, error) {
+	select {
+	case <-s.closed:
+		return nil, ErrChatStreamClosed
+	default:
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	select {
+	case <-s.closed:
+		return nil, ErrChatStreamClosed
+	case <-s.ctx.Done():
+		s.err = s.ctx.Err()
+		return nil, s.err
+	case event, ok := <-s.events:
+		if !ok {
+			// 通道只会在Close之后不发送结束事件就关闭
+			return nil, ErrChatStreamClosed
+		}
+		switch event.Type {
+		case StreamEventDone:
+			s.summary = &event
+			s.err = io.EOF
+			s.cancel()
+			return nil, s.err
+		case StreamEventError:
+			s.err = event.Err
+			s.cancel()
+			return nil, s.err
+		}
+		return event.Chunk, nil
+	}
+}
+
+// Summary 流正常结束（Recv返回io.EOF）后返回done事件，包含结束原因、用量、耗时和实际使用的凭证；尚未结束或异常结束时返回nil
+func (s *ChatStream) Summary() *StreamEvent {
+	return s.summary
+}
+
+// Close 停止读取并关闭上游流，可重复调用
+func (s *ChatStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.cancel()
+	})
+	return nil
+}
@@ -0,0 +1,124 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// newChatStreamRequest 构造读取chunks供应商的请求
+func newChatStreamRequest() ChatRequest {
+	req := ChatRequest{Provider: "chunks"}
+	req.Model = "gpt-4o"
+	req.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+	return req
+}
+
+// 测试逐块读取到流结束并获取结束信息
+func TestChatStreamRecv(t *testing.T) {
+	provider := registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你", ""),
+		newTestStreamChunk("好", openai.FinishReasonStop),
+	}, nil)
+
+	stream, err := CreateChatCompletionStream(context.Background(), newChatStreamRequest())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+	assert.True(t, provider.req.Stream)
+
+	var content string
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	assert.Equal(t, "你好", content)
+	if assert.NotNil(t, stream.Summary()) {
+		assert.Equal(t, openai.FinishReasonStop, stream.Summary().FinishReason)
+	}
+
+	// 结束后继续读取仍返回io.EOF，关闭后返回ErrChatStreamClosed
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.NoError(t, stream.Close())
+	assert.NoError(t, stream.Close(), "可重复关闭")
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, ErrChatStreamClosed)
+}
+
+// 测试提前关闭时中止对供应商的调用
+func TestChatStreamClose(t *testing.T) {
+	chunks := make([]*openai.ChatCompletionStreamResponse, 50)
+	for i := range chunks {
+		chunks[i] = newTestStreamChunk("字", "")
+	}
+	provider := registerChunkProvider(t, chunks, nil)
+
+	stream, err := CreateChatCompletionStream(context.Background(), newChatStreamRequest())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	stream.Close()
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, ErrChatStreamClosed)
+	assert.Nil(t, stream.Summary())
+	assert.ErrorIs(t, provider.ctx.Err(), context.Canceled, "关闭后应取消供应商调用的上下文")
+}
+
+// 测试ctx取消后Recv返回ctx的错误
+func TestChatStreamContextCanceled(t *testing.T) {
+	registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你", ""),
+		newTestStreamChunk("好", openai.FinishReasonStop),
+	}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := CreateChatCompletionStream(ctx, newChatStreamRequest())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	cancel()
+	// 已缓冲的数据块可能先被读到，之后必然返回ctx的错误
+	for i := 0; i < 3; i++ {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// 测试流中断时返回上游的错误
+func TestChatStreamError(t *testing.T) {
+	streamErr := errors.New("连接中断")
+	registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{newTestStreamChunk("你", "")}, streamErr)
+
+	stream, err := CreateChatCompletionStream(context.Background(), newChatStreamRequest())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, streamErr)
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, streamErr, "之后继续返回同一个错误")
+}
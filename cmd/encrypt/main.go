@@ -1,41 +1,101 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/YFGaia/eino-x"
 )
 
-// 执行命令行示例: go run cmd/encrypt/main.go "要加密的字符串"
+// 执行命令行示例:
+//
+//	go run ./cmd/encrypt "要加密的字符串" [环境名]
+//	go run ./cmd/encrypt -env production "sk-xxxx"
+//	echo -n "sk-xxxx" | go run ./cmd/encrypt -env production
+//	go run ./cmd/encrypt -env production -rotate
+//	go run ./cmd/encrypt -aes < service-account.json
+//
+// 指定环境名时，若 $EINOX_RSA_KEYS_DIR/<环境名> 目录存在则使用该环境独立的密钥对。
+// 只向标准输出打印密文，可直接粘贴到YAML配置文件的api_key等字段；
+// 未指定明文参数时从标准输入读取，避免明文留在shell历史中
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("使用方法: encrypt <要加密的字符串>")
-		return
+	env := flag.String("env", einox.ENV, "目标环境名，使用 $EINOX_RSA_KEYS_DIR/<环境名> 下的密钥对（目录不存在时使用默认密钥对）")
+	rotate := flag.Bool("rotate", false, "生成新版本的密钥对，之后的加密使用新密钥，旧密钥保留用于解密")
+	useAES := flag.Bool("aes", false, "使用 $EINOX_AES_KEY 进行AES-GCM加密，适用于较长的凭证")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "使用方法: encrypt [-env 环境名] [-rotate] [-aes] [要加密的字符串] [环境名]")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	keyToEncrypt := os.Args[1]
+	args := flag.Args()
+	if len(args) > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// 兼容旧的用法：第二个参数为环境名
+	if len(args) == 2 {
+		*env = args[1]
+		args = args[:1]
+	}
+
+	if *rotate {
+		keyID, err := einox.RotateRSAKeyForEnv(*env)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "轮换密钥失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "已生成密钥%s，密钥文件存储在: %s\n", keyID, einox.RSAKeysDirForEnv(*env))
+		if len(args) == 0 {
+			return
+		}
+	}
 
-	//打印加密前字符
-	fmt.Printf("加密前字符: %s\n", keyToEncrypt)
+	plaintext, err := readPlaintext(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取待加密内容失败: %v\n", err)
+		os.Exit(1)
+	}
 
-	// 初始化RSA密钥管理器
-	encryptFunc, _, err := einox.InitRSAKeyManager()
+	encrypt := einox.EncryptSecretForEnv
+	if *useAES {
+		encrypt = einox.EncryptSecretAESForEnv
+	}
+	cipherText, err := encrypt(*env, plaintext)
 	if err != nil {
-		fmt.Printf("初始化RSA密钥管理器失败: %v\n", err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// 使用加密函数加密数据
-	encryptedKey, err := encryptFunc(keyToEncrypt)
+	// 确认密文可以按读取配置时的方式解密
+	decrypted, err := einox.DecryptSecretForEnv(*env, cipherText)
+	if err == nil && decrypted != plaintext {
+		err = fmt.Errorf("解密结果与原文不一致")
+	}
 	if err != nil {
-		fmt.Printf("加密失败: %v\n", err)
-		return
+		fmt.Fprintf(os.Stderr, "校验密文失败: %v\n", err)
+		os.Exit(1)
 	}
 
-	fmt.Println("加密结果:")
-	fmt.Println(encryptedKey)
-	fmt.Printf("\n密钥文件存储在: 私钥=%s, 公钥=%s\n",
-		einox.DefaultPrivateKeyPath,
-		einox.DefaultPublicKeyPath)
+	fmt.Println(cipherText)
+	// 使用AES或通过环境变量提供私钥时不使用密钥目录
+	if !*useAES && os.Getenv(einox.RSAPrivateKeyEnvVar) == "" && os.Getenv(einox.RSAPrivateKeyFileEnvVar) == "" {
+		fmt.Fprintf(os.Stderr, "环境: %s，密钥文件存储在: %s\n", *env, einox.RSAKeysDirForEnv(*env))
+	}
+}
+
+// readPlaintext 优先使用命令行参数，否则读取全部标准输入并去掉末尾的换行
+func readPlaintext(args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
 }
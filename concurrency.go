@@ -0,0 +1,94 @@
+package einox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// concurrencyLimiter 单个凭证的并发信号量
+type concurrencyLimiter struct {
+	max int
+	sem chan struct{}
+}
+
+var (
+	concurrencyLimitersMu sync.Mutex
+	// concurrencyLimiters 各凭证的并发信号量，键为"供应商:凭证名称"
+	concurrencyLimiters = map[string]*concurrencyLimiter{}
+)
+
+// getConcurrencyLimiter 获取凭证的并发信号量，配置的上限变化时重新创建
+// 旧信号量上的槽位仍由持有者释放回旧信号量，不影响新信号量的计数
+func getConcurrencyLimiter(key string, max int) chan struct{} {
+	concurrencyLimitersMu.Lock()
+	defer concurrencyLimitersMu.Unlock()
+	limiter, ok := concurrencyLimiters[key]
+	if !ok || limiter.max != max {
+		limiter = &concurrencyLimiter{max: max, sem: make(chan struct{}, max)}
+		concurrencyLimiters[key] = limiter
+	}
+	return limiter.sem
+}
+
+// concurrencySlots 一次调用占用的并发槽位
+// 由统一入口创建，选中凭证后在getXXXConfig中获取槽位，调用结束（流式为流结束）后统一释放。
+// 与凭证的QPS限制相互独立，两者可以同时生效
+type concurrencySlots struct {
+	mu       sync.Mutex
+	releases []func()
+}
+
+// acquire 获取凭证的并发槽位，已满时排队等待，ctx取消或超时后停止等待并返回错误
+func (s *concurrencySlots) acquire(ctx context.Context, key string, max int) error {
+	sem := getConcurrencyLimiter(key, max)
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var once sync.Once
+	s.mu.Lock()
+	s.releases = append(s.releases, func() {
+		once.Do(func() { <-sem })
+	})
+	s.mu.Unlock()
+	return nil
+}
+
+// release 释放已获取的全部槽位，nil时不做任何操作
+func (s *concurrencySlots) release() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	releases := s.releases
+	s.releases = nil
+	s.mu.Unlock()
+	for _, release := range releases {
+		release()
+	}
+}
+
+// acquireConcurrencySlot 凭证配置了MaxConcurrent时获取并发槽位
+// 请求未经过统一入口（没有concurrencySlots）时不做限制，避免槽位无人释放
+// 排队时响应请求的取消，等待时间不超过本次调用的超时
+func (c *Config) acquireConcurrencySlot(name string, maxConcurrent int) error {
+	if maxConcurrent <= 0 || c.concurrencySlots == nil {
+		return nil
+	}
+	ctx, cancel := withCallTimeout(requestContext(c.ctx), c.callTimeout)
+	defer cancel()
+	if err := c.concurrencySlots.acquire(ctx, c.Vendor+":"+name, maxConcurrent); err != nil {
+		return fmt.Errorf("等待凭证 %s 的并发槽位失败: %w", name, err)
+	}
+	return nil
+}
+
+// withConcurrencySlots 为请求创建并发槽位，返回释放函数
+func withConcurrencySlots(req *ChatRequest) func() {
+	slots := &concurrencySlots{}
+	req.concurrencySlots = slots
+	return slots.release
+}
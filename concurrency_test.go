@@ -0,0 +1,192 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 在后台获取槽位，返回获取成功后关闭的通道
+func acquireInBackground(acquire func()) <-chan struct{} {
+	acquired := make(chan struct{})
+	go func() {
+		acquire()
+		close(acquired)
+	}()
+	return acquired
+}
+
+// 测试并发数达到上限后排队，释放后继续
+func TestConcurrencySlotsQueue(t *testing.T) {
+	key := "azure:test-queue"
+	first, second, third := &concurrencySlots{}, &concurrencySlots{}, &concurrencySlots{}
+	assert.NoError(t, first.acquire(context.Background(), key, 2))
+	assert.NoError(t, second.acquire(context.Background(), key, 2))
+
+	acquired := acquireInBackground(func() { assert.NoError(t, third.acquire(context.Background(), key, 2)) })
+	select {
+	case <-acquired:
+		t.Fatal("并发数已满时应排队等待")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("释放槽位后排队的请求应继续")
+	}
+
+	// 重复释放不会多归还槽位
+	first.release()
+	second.release()
+	third.release()
+	var nilSlots *concurrencySlots
+	nilSlots.release()
+}
+
+// 测试排队等待槽位时响应取消和调用超时
+func TestConcurrencySlotsWaitCanceled(t *testing.T) {
+	key := "azure:test-cancel"
+	holder := &concurrencySlots{}
+	assert.NoError(t, holder.acquire(context.Background(), key, 1))
+	defer holder.release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiter := &concurrencySlots{}
+	done := make(chan error, 1)
+	go func() { done <- waiter.acquire(ctx, key, 1) }()
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("取消后应停止等待")
+	}
+	waiter.release()
+
+	// 等待时间不超过本次调用的超时
+	c := &Config{Vendor: "azure", concurrencySlots: &concurrencySlots{}, RequestTimeout: 20 * time.Millisecond}
+	c.recordCallTimeout(0)
+	err := c.acquireConcurrencySlot("test-cancel", 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "test-cancel")
+}
+
+// 测试选中配置了MaxConcurrent的凭证时获取槽位
+func TestAcquireConcurrencySlotFromConfig(t *testing.T) {
+	newConf := func(slots *concurrencySlots) *Config {
+		return &Config{
+			Vendor: "azure",
+			Model:  "gpt-4o",
+			InlineAzureCredential: &AzureCredential{
+				Name:          "limited",
+				ApiKey:        "plain-key",
+				Endpoint:      "https://example.openai.azure.com/",
+				MaxConcurrent: 1,
+			},
+			concurrencySlots: slots,
+		}
+	}
+
+	first := &concurrencySlots{}
+	_, err := newConf(first).getAzureConfig()
+	assert.NoError(t, err)
+
+	second := &concurrencySlots{}
+	acquired := acquireInBackground(func() {
+		_, err := newConf(second).getAzureConfig()
+		assert.NoError(t, err)
+	})
+	select {
+	case <-acquired:
+		t.Fatal("凭证并发数已满时应排队等待")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("释放槽位后排队的请求应继续")
+	}
+	second.release()
+
+	// 没有经过统一入口的请求不做限制
+	for i := 0; i < 2; i++ {
+		_, err = newConf(nil).getAzureConfig()
+		assert.NoError(t, err)
+	}
+}
+
+// limitedStreamProvider 测试用的供应商，凭证的MaxConcurrent为1，前failures次流式请求返回503
+type limitedStreamProvider struct {
+	failures int
+	calls    int
+}
+
+func (p *limitedStreamProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	return nil, errors.New("未实现")
+}
+
+func (p *limitedStreamProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	c := &Config{Vendor: "limited-stream", concurrencySlots: req.concurrencySlots, ctx: req.ctx}
+	if err := c.acquireConcurrencySlot("only", 1); err != nil {
+		return err
+	}
+	p.calls++
+	if p.calls <= p.failures {
+		return &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+	}
+	_, err := fmt.Fprint(writer, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"好\"}}]}\n\ndata: [DONE]\n\n")
+	return err
+}
+
+// 测试流式请求重试时释放上一次请求占用的槽位，并发上限为1的凭证不会被自身阻塞
+func TestStreamRetryReleasesConcurrencySlot(t *testing.T) {
+	provider := &limitedStreamProvider{failures: 1}
+	RegisterProvider("limited-stream", provider)
+	t.Cleanup(func() { unregisterTestProvider("limited-stream") })
+
+	req := ChatRequest{
+		Provider: "limited-stream",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Stream:   true,
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+		},
+		RetryPolicy: &RetryPolicy{MaxRetries: 1, BaseDelayMs: 1},
+	}
+	done := make(chan error, 1)
+	var buf bytes.Buffer
+	go func() {
+		_, err := CreateChatCompletion(req, &buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+		assert.Equal(t, 2, provider.calls)
+		assert.Contains(t, buf.String(), "好")
+	case <-time.After(time.Second):
+		t.Fatal("重试时不应等待上一次请求占用的槽位")
+	}
+
+	// 流结束后槽位全部释放
+	acquired := acquireInBackground(func() {
+		assert.NoError(t, (&concurrencySlots{}).acquire(context.Background(), "limited-stream:only", 1))
+	})
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("流结束后应释放槽位")
+	}
+}
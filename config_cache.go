@@ -0,0 +1,192 @@
+package einox
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configFileCacheEntry 已解析的配置文件及读取时的修改时间和大小
+type configFileCacheEntry struct {
+	modTime time.Time
+	size    int64
+	config  any
+	// secrets 从该配置文件解密出的凭证，配置文件重新解析时随条目一起丢弃
+	secrets *decryptedSecrets
+}
+
+// decryptedSecrets 已解密的凭证，键为密钥来源和密文，可被多个请求并发使用
+type decryptedSecrets struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// newDecryptedSecrets 创建空的解密结果缓存
+func newDecryptedSecrets() *decryptedSecrets {
+	return &decryptedSecrets{values: map[string]string{}}
+}
+
+// get 获取已解密的凭证，s为nil时视为未缓存
+func (s *decryptedSecrets) get(key string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// put 缓存解密后的凭证，s为nil时不缓存
+func (s *decryptedSecrets) put(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+var (
+	configFileCacheMu sync.Mutex
+	// configFileCache 已解析的配置文件，键为文件路径和配置类型
+	configFileCache = map[string]configFileCacheEntry{}
+	// credentialTLSErrors 凭证TLS配置的校验结果，任一配置文件重新解析时清空，避免每次请求重新读取证书文件
+	credentialTLSErrors = map[CredentialTLS]error{}
+
+	decryptCacheMu sync.Mutex
+	// decryptFuncs 各密钥目录的解密函数，避免每次请求重新加载RSA密钥
+	decryptFuncs = map[string]func(string) (string, error){}
+)
+
+// ReloadConfig 清空已缓存的配置文件和解密后的凭证，下次请求时重新读取
+// 配置文件修改后会根据修改时间自动重新读取，密钥文件更换后需要调用此函数
+func ReloadConfig() {
+	clearConfigFileCache()
+
+	decryptCacheMu.Lock()
+	decryptFuncs = map[string]func(string) (string, error){}
+	decryptCacheMu.Unlock()
+}
+
+// clearConfigFileCache 清空已解析的配置文件，解密后的凭证随之丢弃
+func clearConfigFileCache() {
+	configFileCacheMu.Lock()
+	defer configFileCacheMu.Unlock()
+	configFileCache = map[string]configFileCacheEntry{}
+	credentialTLSErrors = map[CredentialTLS]error{}
+}
+
+// loadConfigFile 读取并解析YAML配置文件，文件的修改时间和大小未变化时直接返回缓存的解析结果
+// 返回值在调用之间共享，调用方只能读取，不能修改其中的切片和map；label用于错误信息，如"Azure"。
+// 同时返回该配置文件的解密结果缓存，传给cachedDecryptFunc，文件重新解析后旧的明文凭证随之丢弃
+func loadConfigFile[T any](path, label string) (T, *decryptedSecrets, error) {
+	var config T
+	info, err := os.Stat(path)
+	if err != nil {
+		return config, nil, fmt.Errorf("读取%s配置文件失败: %v", label, err)
+	}
+
+	key := fmt.Sprintf("%s|%T", path, config)
+	configFileCacheMu.Lock()
+	entry, ok := configFileCache[key]
+	configFileCacheMu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.config.(T), entry.secrets, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, nil, fmt.Errorf("读取%s配置文件失败: %v", label, err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, nil, fmt.Errorf("解析%s配置文件失败: %v", label, err)
+	}
+
+	secrets := newDecryptedSecrets()
+	configFileCacheMu.Lock()
+	configFileCache[key] = configFileCacheEntry{modTime: info.ModTime(), size: info.Size(), config: config, secrets: secrets}
+	credentialTLSErrors = map[CredentialTLS]error{}
+	configFileCacheMu.Unlock()
+	return config, secrets, nil
+}
+
+// validateCredentialTLS 校验选中凭证的TLS配置，同一配置只在配置文件未变化期间校验一次
+func validateCredentialTLS(tlsConf CredentialTLS) error {
+	if tlsConf.IsEmpty() {
+		return nil
+	}
+	configFileCacheMu.Lock()
+	err, ok := credentialTLSErrors[tlsConf]
+	configFileCacheMu.Unlock()
+	if ok {
+		return err
+	}
+
+	err = tlsConf.Validate()
+	configFileCacheMu.Lock()
+	credentialTLSErrors[tlsConf] = err
+	configFileCacheMu.Unlock()
+	return err
+}
+
+// cachedDecryptFunc 获取环境对应的解密函数，解密结果保存在secrets中，同一密文只解密一次
+// secrets为nil时不缓存解密结果，用于不属于某个配置文件的密文。
+// 带"aes:"前缀的凭证使用AES密钥解密，其余按RSA解密；只使用AES凭证时无需配置RSA密钥
+func cachedDecryptFunc(env string, secrets *decryptedSecrets) (func(string) (string, error), error) {
+	var keysDir string
+	var rsaDecrypt func(string) (string, error)
+	if rsaKeysConfigured() {
+		keysDir = rsaKeySourceForEnv(env)
+		var err error
+		if rsaDecrypt, err = cachedRSADecryptFunc(env, keysDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(cipherText string) (string, error) {
+		source, decrypt := keysDir, rsaDecrypt
+		if isAESCipherText(cipherText) {
+			source = "aes|" + env
+			decrypt = func(cipherText string) (string, error) {
+				return decryptAESForEnv(env, cipherText)
+			}
+		} else if decrypt == nil {
+			return "", fmt.Errorf("未设置环境变量 %s，无法解密RSA加密的凭证", RSAKeysEnvVar)
+		}
+
+		key := source + "|" + cipherText
+		if plainText, ok := secrets.get(key); ok {
+			return plainText, nil
+		}
+
+		plainText, err := decrypt(cipherText)
+		if err != nil {
+			return "", err
+		}
+		secrets.put(key, plainText)
+		return plainText, nil
+	}, nil
+}
+
+// cachedRSADecryptFunc 获取密钥来源对应的RSA解密函数，避免每次请求重新加载密钥
+func cachedRSADecryptFunc(env, keysDir string) (func(string) (string, error), error) {
+	decryptCacheMu.Lock()
+	decrypt, ok := decryptFuncs[keysDir]
+	decryptCacheMu.Unlock()
+	if ok {
+		return decrypt, nil
+	}
+
+	_, decrypt, err := InitRSAKeyManagerForEnv(env)
+	if err != nil {
+		return nil, err
+	}
+	decryptCacheMu.Lock()
+	decryptFuncs[keysDir] = decrypt
+	decryptCacheMu.Unlock()
+	return decrypt, nil
+}
@@ -0,0 +1,125 @@
+package einox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfigFile struct {
+	Name string `yaml:"name"`
+}
+
+// 测试配置文件未变化时使用缓存，修改后重新读取
+func TestLoadConfigFileCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(content string, modTime time.Time) {
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	write("name: aaa", modTime)
+	config, _, err := loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa", config.Name)
+
+	// 修改时间和大小都未变化时不重新读取
+	write("name: bbb", modTime)
+	config, _, err = loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa", config.Name)
+
+	// 修改时间变化后重新读取
+	write("name: bbb", modTime.Add(time.Second))
+	config, _, err = loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+	assert.Equal(t, "bbb", config.Name)
+
+	// ReloadConfig强制重新读取
+	write("name: ccc", modTime.Add(time.Second))
+	ReloadConfig()
+	config, _, err = loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+	assert.Equal(t, "ccc", config.Name)
+
+	write("name: [", modTime.Add(2*time.Second))
+	_, _, err = loadConfigFile[testConfigFile](path, "测试")
+	assert.ErrorContains(t, err, "解析测试配置文件失败")
+
+	_, _, err = loadConfigFile[testConfigFile](filepath.Join(t.TempDir(), "missing.yaml"), "测试")
+	assert.ErrorContains(t, err, "读取测试配置文件失败")
+}
+
+// 测试同一配置文件中的同一密文只解密一次，配置文件重新解析后丢弃已解密的凭证
+func TestCachedDecryptFunc(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	ReloadConfig()
+	defer ReloadConfig()
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv("development")
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("test-key")
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NoError(t, os.WriteFile(path, []byte("name: aaa"), 0644))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	_, secrets, err := loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+
+	decrypt, err := cachedDecryptFunc("development", secrets)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		plain, err := decrypt(cipher)
+		assert.NoError(t, err)
+		assert.Equal(t, "test-key", plain)
+	}
+	assert.Len(t, secrets.values, 1)
+	assert.Len(t, decryptFuncs, 1)
+
+	_, err = decrypt("not-a-cipher")
+	assert.Error(t, err)
+	assert.Len(t, secrets.values, 1, "解密失败的结果不缓存")
+
+	// 配置文件未变化时共享同一份解密结果，修改后重新解析并丢弃旧的明文凭证
+	_, again, err := loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+	assert.Same(t, secrets, again)
+	assert.NoError(t, os.Chtimes(path, modTime.Add(time.Second), modTime.Add(time.Second)))
+	_, reparsed, err := loadConfigFile[testConfigFile](path, "测试")
+	assert.NoError(t, err)
+	assert.NotSame(t, secrets, reparsed)
+	assert.Empty(t, reparsed.values)
+
+	// 不属于配置文件的密文不缓存解密结果
+	decrypt, err = cachedDecryptFunc("development", nil)
+	assert.NoError(t, err)
+	plain, err := decrypt(cipher)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-key", plain)
+}
+
+// 测试TLS配置的校验结果在配置文件未变化期间缓存，配置文件重新解析后重新校验
+func TestValidateCredentialTLSCache(t *testing.T) {
+	ReloadConfig()
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	tlsConf := CredentialTLS{CACertFile: caFile}
+
+	assert.Error(t, validateCredentialTLS(tlsConf))
+	assert.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0644))
+	assert.ErrorContains(t, validateCredentialTLS(tlsConf), "读取CA证书文件失败", "配置未变化时应使用缓存的校验结果")
+
+	configPath := filepath.Join(dir, "test.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("name: aaa"), 0644))
+	_, _, err := loadConfigFile[testConfigFile](configPath, "测试")
+	assert.NoError(t, err)
+	assert.ErrorContains(t, validateCredentialTLS(tlsConf), "没有有效的PEM证书", "配置文件重新解析后应重新校验")
+
+	assert.NoError(t, validateCredentialTLS(CredentialTLS{}))
+}
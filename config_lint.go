@@ -0,0 +1,113 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// LintConfig 检查供应商配置文件中当前环境的凭证，一次返回发现的所有问题，没有问题时返回nil
+// 检查内容包括：没有启用的凭证、启用凭证的权重之和为0、凭证名称重复、缺少必填字段、
+// 未配置models、API密钥无法用当前环境的密钥解密，以及endpoint、base_url、proxy等URL格式错误。
+// 与LoadAllConfigs不同，LintConfig会实际解密凭证，适合在就绪探针中调用，使错误的部署尽早失败
+func LintConfig(provider string) []error {
+	parse, ok := providerCredentialDescriptors[provider]
+	if !ok {
+		return []error{fmt.Errorf("未知的供应商: %s", provider)}
+	}
+	if err := LoadLLMConfigPathFromEnv(); err != nil {
+		return []error{fmt.Errorf("读取LLM配置路径失败: %v", err)}
+	}
+
+	data, err := os.ReadFile(filepath.Join(LLMConfigPath, provider+".yaml"))
+	if err != nil {
+		return []error{fmt.Errorf("读取%s配置文件失败: %v", provider, err)}
+	}
+	envs, err := parse(data)
+	if err != nil {
+		return []error{err}
+	}
+	env := currentEnv()
+	creds, ok := envs[env]
+	if !ok {
+		return []error{fmt.Errorf("未找到环境 %s 的配置", env)}
+	}
+
+	var errs []error
+	decrypt, err := cachedDecryptFunc(env, nil)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("初始化RSA密钥管理器失败: %v", err))
+	}
+
+	names := make(map[string]bool, len(creds))
+	enabled, totalWeight := 0, 0
+	for i, cred := range creds {
+		name := cred.name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		} else if names[name] {
+			errs = append(errs, fmt.Errorf("环境 %s 中的凭证名称 %s 重复", env, name))
+		}
+		names[name] = true
+		// 只检查启用的凭证
+		if !cred.enabled {
+			continue
+		}
+		enabled++
+
+		credErr := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("环境 %s 的凭证 %s 配置无效: %s", env, name, fmt.Sprintf(format, args...)))
+		}
+		if err := cred.validate(); err != nil {
+			credErr("%v", err)
+		}
+		if cred.weight < 0 {
+			credErr("weight不能为负数: %d", cred.weight)
+		} else {
+			totalWeight += cred.weight
+		}
+		if len(cred.models) == 0 {
+			credErr("未配置models")
+		}
+		for _, field := range cred.urls {
+			if err := lintURL(field.value); err != nil {
+				credErr("%s格式不正确: %v", field.name, err)
+			}
+		}
+		if decrypt == nil {
+			continue
+		}
+		for _, field := range cred.secrets {
+			if field.value == "" {
+				continue
+			}
+			if _, err := decrypt(field.value); err != nil {
+				credErr("%s无法解密: %v", field.name, err)
+			}
+		}
+	}
+
+	if enabled == 0 {
+		errs = append(errs, fmt.Errorf("环境 %s 中没有启用的配置", env))
+	} else if totalWeight == 0 {
+		errs = append(errs, fmt.Errorf("环境 %s 中启用凭证的weight之和为0", env))
+	}
+	return errs
+}
+
+// lintURL 校验可选的URL字段，要求包含协议和主机
+func lintURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return errors.New("缺少协议或主机，应为 https://host 的形式")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package einox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupLintConfig 写入当前环境为production的配置文件，返回用于加密凭证的函数
+func setupLintConfig(t *testing.T) (configDir string, encrypt func(string) string) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir = t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+	originalEnv := ENV
+	t.Cleanup(func() { ENV = originalEnv })
+	ENV = "production"
+	t.Cleanup(ReloadConfig)
+
+	return configDir, func(plaintext string) string {
+		cipherText, err := EncryptSecretForEnv("production", plaintext)
+		if err != nil {
+			t.Fatalf("加密失败: %v", err)
+		}
+		return cipherText
+	}
+}
+
+// lintErrorsText 合并错误信息便于断言
+func lintErrorsText(errs []error) string {
+	texts := make([]string, len(errs))
+	for i, err := range errs {
+		texts[i] = err.Error()
+	}
+	return strings.Join(texts, "\n")
+}
+
+// 测试有效配置没有问题
+func TestLintConfigValid(t *testing.T) {
+	configDir, encrypt := setupLintConfig(t)
+	configContent := fmt.Sprintf(`
+environments:
+  production:
+    credentials:
+      - name: primary
+        api_key: %s
+        endpoint: https://primary.openai.azure.com
+        enabled: true
+        weight: 1
+        models: [gpt-4o]
+      - name: backup
+        api_key: 未加密也不检查
+        endpoint: https://backup.openai.azure.com
+        enabled: false
+`, encrypt("sk-primary"))
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	assert.Empty(t, LintConfig("azure"))
+}
+
+// 测试一次报告所有问题
+func TestLintConfigReportsAllProblems(t *testing.T) {
+	configDir, encrypt := setupLintConfig(t)
+	configContent := fmt.Sprintf(`
+environments:
+  production:
+    credentials:
+      - name: primary
+        api_key: not-encrypted
+        endpoint: primary.openai.azure.com
+        enabled: true
+        weight: 0
+      - name: primary
+        api_key: %s
+        enabled: true
+        proxy: "://bad"
+        models: [gpt-4o]
+`, encrypt("sk-secondary"))
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	errs := LintConfig("azure")
+	text := lintErrorsText(errs)
+	assert.Len(t, errs, 7, text)
+	assert.Contains(t, text, "api_key无法解密")
+	assert.Contains(t, text, "endpoint格式不正确")
+	assert.Contains(t, text, "未配置models")
+	assert.Contains(t, text, "凭证名称 primary 重复")
+	assert.Contains(t, text, "缺少endpoint")
+	assert.Contains(t, text, "proxy格式不正确")
+	assert.Contains(t, text, "weight之和为0")
+}
+
+// 测试没有启用的凭证和配置缺失
+func TestLintConfigNoEnabledCredentials(t *testing.T) {
+	configDir, _ := setupLintConfig(t)
+	configContent := `
+environments:
+  production:
+    credentials:
+      - name: primary
+        api_key: sk
+        enabled: false
+  staging:
+    credentials: []
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "deepseek.yaml"), []byte(configContent), 0644))
+
+	errs := LintConfig("deepseek")
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "没有启用的配置")
+	}
+
+	ENV = "test"
+	errs = LintConfig("deepseek")
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "未找到环境 test 的配置")
+	}
+
+	errs = LintConfig("qwen")
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "读取qwen配置文件失败")
+	}
+	errs = LintConfig("unknown")
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "未知的供应商")
+	}
+}
+
+// 测试Bedrock检查所有加密字段
+func TestLintConfigBedrockSecrets(t *testing.T) {
+	configDir, encrypt := setupLintConfig(t)
+	configContent := fmt.Sprintf(`
+environments:
+  production:
+    credentials:
+      - name: aws
+        access_key: %s
+        secret_access_key: not-encrypted
+        region: us-east-1
+        enabled: true
+        weight: 1
+        models: [claude-3-5-sonnet]
+`, encrypt("AKIA"))
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "bedrock.yaml"), []byte(configContent), 0644))
+
+	errs := LintConfig("bedrock")
+	if assert.Len(t, errs, 1) {
+		assert.ErrorContains(t, errs[0], "secret_access_key无法解密")
+	}
+}
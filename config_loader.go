@@ -0,0 +1,276 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ProviderConfigResult 单个供应商配置文件的加载结果
+type ProviderConfigResult struct {
+	Provider string `json:"provider"` // 供应商名称
+	File     string `json:"file"`     // 配置文件路径
+	Found    bool   `json:"found"`    // 配置文件是否存在
+	// EnabledCredentials 各环境下启用的凭证数量
+	EnabledCredentials map[string]int `json:"enabled_credentials,omitempty"`
+	Errors             []error        `json:"-"` // 解析和校验错误
+}
+
+// OK 判断配置文件是否存在且没有错误
+func (r ProviderConfigResult) OK() bool {
+	return r.Found && len(r.Errors) == 0
+}
+
+// ConfigLoadReport LoadAllConfigs的汇总报告
+type ConfigLoadReport struct {
+	Dir       string                 `json:"dir"`       // 扫描的配置目录
+	Providers []ProviderConfigResult `json:"providers"` // 按供应商名称排序的加载结果
+}
+
+// HasErrors 判断是否有任意供应商配置出错
+func (r *ConfigLoadReport) HasErrors() bool {
+	return r.Err() != nil
+}
+
+// Err 合并所有供应商的错误，没有错误时返回nil
+func (r *ConfigLoadReport) Err() error {
+	var errs []error
+	for _, result := range r.Providers {
+		for _, err := range result.Errors {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(result.File), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// credentialDescriptor 凭证中需要检查的字段，LoadAllConfigs和LintConfig共用同一份描述
+type credentialDescriptor struct {
+	name    string
+	enabled bool
+	weight  int
+	models  []string
+	// required 必填字段
+	required []credentialField
+	// secrets 加密的字段
+	secrets []credentialField
+	// urls 需要是合法URL的字段，值为空表示未配置
+	urls []credentialField
+	// tls 自定义CA/客户端证书，未配置时为空
+	tls CredentialTLS
+}
+
+// credentialField 凭证中的一个字段，name为YAML字段名
+type credentialField struct {
+	name  string
+	value string
+}
+
+// validate 校验必填字段和TLS配置，返回第一个错误
+func (d credentialDescriptor) validate() error {
+	for _, field := range d.required {
+		if err := requireField(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	return d.tls.Validate()
+}
+
+// providerCredentials 解析配置文件，返回各环境的凭证描述
+type providerCredentials func(data []byte) (map[string][]credentialDescriptor, error)
+
+// providerCredentialDescriptors 已知供应商配置文件的凭证描述，键为供应商名称，文件名为 <供应商>.yaml
+var providerCredentialDescriptors = map[string]providerCredentials{
+	"azure": describeProviderCredentials(func(cred AzureCredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"api_key", cred.ApiKey}, {"endpoint", cred.Endpoint}},
+			secrets:  []credentialField{{"api_key", cred.ApiKey}},
+			urls:     []credentialField{{"endpoint", cred.Endpoint}, {"proxy", cred.Proxy}},
+			tls:      cred.TLS,
+		}
+	}),
+	"bedrock": describeProviderCredentials(func(cred BedrockCredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"access_key", cred.AccessKey}, {"secret_access_key", cred.SecretAccessKey}, {"region", cred.Region}},
+			secrets:  []credentialField{{"access_key", cred.AccessKey}, {"secret_access_key", cred.SecretAccessKey}},
+			urls:     []credentialField{{"proxy", cred.Proxy}},
+		}
+	}),
+	"claude": describeProviderCredentials(func(cred ClaudeCredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"api_key", cred.APIKey}},
+			secrets:  []credentialField{{"api_key", cred.APIKey}},
+			urls:     []credentialField{{"base_url", cred.BaseURL}, {"proxy", cred.Proxy}},
+		}
+	}),
+	"deepseek": describeProviderCredentials(func(cred DeepSeekCredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"api_key", cred.APIKey}},
+			secrets:  []credentialField{{"api_key", cred.APIKey}},
+			urls:     []credentialField{{"base_url", cred.BaseURL}, {"proxy", cred.Proxy}},
+		}
+	}),
+	"gemini": describeProviderCredentials(func(cred GeminiCredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"api_key", cred.APIKey}},
+			secrets:  []credentialField{{"api_key", cred.APIKey}},
+			urls:     []credentialField{{"api_endpoint", cred.APIEndpoint}, {"proxy", cred.Proxy}},
+		}
+	}),
+	"openai": describeProviderCredentials(func(cred OpenAICredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"api_key", cred.ApiKey}},
+			secrets:  []credentialField{{"api_key", cred.ApiKey}},
+			urls:     []credentialField{{"base_url", cred.BaseURL}, {"proxy", cred.Proxy}},
+			tls:      cred.TLS,
+		}
+	}),
+	"qwen": describeProviderCredentials(func(cred QwenCredential) credentialDescriptor {
+		return credentialDescriptor{
+			name: cred.Name, enabled: cred.Enabled, weight: cred.Weight, models: cred.Models,
+			required: []credentialField{{"api_key", cred.APIKey}},
+			secrets:  []credentialField{{"api_key", cred.APIKey}},
+			urls:     []credentialField{{"base_url", cred.BaseURL}, {"proxy", cred.Proxy}},
+			tls:      cred.TLS,
+		}
+	}),
+}
+
+// describeProviderCredentials 按凭证类型T解析配置文件，并转换为凭证描述
+func describeProviderCredentials[T any](describe func(cred T) credentialDescriptor) providerCredentials {
+	return func(data []byte) (map[string][]credentialDescriptor, error) {
+		var config struct {
+			Environments map[string]struct {
+				Credentials []T `yaml:"credentials"`
+			} `yaml:"environments"`
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %v", err)
+		}
+
+		envs := make(map[string][]credentialDescriptor, len(config.Environments))
+		for env, envConfig := range config.Environments {
+			creds := make([]credentialDescriptor, len(envConfig.Credentials))
+			for i, cred := range envConfig.Credentials {
+				creds[i] = describe(cred)
+			}
+			envs[env] = creds
+		}
+		return envs, nil
+	}
+}
+
+// LoadAllConfigs 扫描LLMConfigPath目录，一次性解析并校验所有已知供应商的配置文件
+// 返回的报告包含每个供应商的结果，不存在的配置文件不视为错误；
+// 只有配置目录本身无法读取时才返回error，配置内容的错误通过 ConfigLoadReport.Err 获取
+func LoadAllConfigs() (*ConfigLoadReport, error) {
+	if err := LoadLLMConfigPathFromEnv(); err != nil {
+		return nil, fmt.Errorf("读取LLM配置路径失败: %v", err)
+	}
+	return loadAllConfigsFromDir(LLMConfigPath)
+}
+
+// loadAllConfigsFromDir 扫描指定目录下的供应商配置文件
+func loadAllConfigsFromDir(dir string) (*ConfigLoadReport, error) {
+	if _, err := os.ReadDir(dir); err != nil {
+		return nil, fmt.Errorf("读取配置目录失败: %v", err)
+	}
+
+	providers := make([]string, 0, len(providerCredentialDescriptors))
+	for provider := range providerCredentialDescriptors {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	report := &ConfigLoadReport{Dir: dir}
+	for _, provider := range providers {
+		result := ProviderConfigResult{
+			Provider: provider,
+			File:     filepath.Join(dir, provider+".yaml"),
+		}
+
+		data, err := os.ReadFile(result.File)
+		switch {
+		case os.IsNotExist(err):
+			// 未配置该供应商
+		case err != nil:
+			result.Found = true
+			result.Errors = append(result.Errors, fmt.Errorf("读取配置文件失败: %v", err))
+		default:
+			result.Found = true
+			result.EnabledCredentials, result.Errors = validateProviderConfig(data, providerCredentialDescriptors[provider])
+		}
+
+		report.Providers = append(report.Providers, result)
+	}
+	return report, nil
+}
+
+// validateProviderConfig 解析配置文件并逐个校验启用的凭证
+func validateProviderConfig(data []byte, parse providerCredentials) (map[string]int, []error) {
+	config, err := parse(data)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if len(config) == 0 {
+		return nil, []error{errors.New("配置文件中没有environments配置")}
+	}
+
+	envs := make([]string, 0, len(config))
+	for env := range config {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	var errs []error
+	enabled := make(map[string]int, len(envs))
+	for _, env := range envs {
+		enabled[env] = 0
+		for i, cred := range config[env] {
+			// 只校验启用的凭证
+			if !cred.enabled {
+				continue
+			}
+			name := cred.name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			if err := cred.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("环境 %s 的凭证 %s 配置无效: %v", env, name, err))
+				continue
+			}
+			enabled[env]++
+		}
+		if enabled[env] == 0 {
+			errs = append(errs, fmt.Errorf("环境 %s 中没有启用的配置", env))
+		}
+	}
+	return enabled, errs
+}
+
+// requireField 校验必填字段
+func requireField(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("缺少%s", field)
+	}
+	return nil
+}
+
+// firstError 返回第一个非nil的错误
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package einox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试目录中有效和无效的配置文件混合时，报告包含所有错误
+func TestLoadAllConfigsFromDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// 有效配置
+		"azure.yaml": `
+environments:
+  development:
+    credentials:
+      - name: azure-dev
+        api_key: encrypted-key
+        endpoint: https://example.openai.azure.com
+        enabled: true
+        weight: 1
+`,
+		// YAML语法错误
+		"deepseek.yaml": "environments: [\n",
+		// 启用的凭证缺少必填字段，且production没有启用的凭证
+		"bedrock.yaml": `
+environments:
+  development:
+    credentials:
+      - name: bedrock-dev
+        access_key: ak
+        enabled: true
+  production:
+    credentials:
+      - name: bedrock-prod
+        access_key: ak
+        secret_access_key: sk
+        region: us-east-1
+        enabled: false
+`,
+		// 缺少environments
+		"openai.yaml": "foo: bar\n",
+		// 未知文件会被忽略
+		"unknown.yaml": "environments: [\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	report, err := loadAllConfigsFromDir(dir)
+	assert.NoError(t, err)
+
+	results := map[string]ProviderConfigResult{}
+	for _, result := range report.Providers {
+		results[result.Provider] = result
+	}
+	assert.Len(t, results, len(providerCredentialDescriptors))
+
+	assert.True(t, results["azure"].OK())
+	assert.Equal(t, map[string]int{"development": 1}, results["azure"].EnabledCredentials)
+
+	assert.True(t, results["deepseek"].Found)
+	assert.Len(t, results["deepseek"].Errors, 1)
+
+	// 无效的凭证不计入启用数量，因此development也没有可用的凭证
+	if assert.Len(t, results["bedrock"].Errors, 3) {
+		assert.Contains(t, results["bedrock"].Errors[0].Error(), "缺少secret_access_key")
+		assert.Contains(t, results["bedrock"].Errors[1].Error(), "环境 development 中没有启用的配置")
+		assert.Contains(t, results["bedrock"].Errors[2].Error(), "环境 production 中没有启用的配置")
+	}
+
+	assert.Contains(t, results["openai"].Errors[0].Error(), "没有environments配置")
+
+	// 不存在的配置文件不视为错误
+	assert.False(t, results["claude"].Found)
+	assert.Empty(t, results["claude"].Errors)
+
+	assert.True(t, report.HasErrors())
+	combined := report.Err().Error()
+	assert.Contains(t, combined, "deepseek.yaml")
+	assert.Contains(t, combined, "bedrock.yaml")
+	assert.Contains(t, combined, "openai.yaml")
+	assert.NotContains(t, combined, "azure.yaml")
+}
+
+// 测试全部配置有效时没有错误
+func TestLoadAllConfigsFromDirValid(t *testing.T) {
+	dir := t.TempDir()
+	content := `
+environments:
+  development:
+    credentials:
+      - name: claude-dev
+        api_key: encrypted-key
+        enabled: true
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "claude.yaml"), []byte(content), 0644))
+
+	report, err := loadAllConfigsFromDir(dir)
+	assert.NoError(t, err)
+	assert.False(t, report.HasErrors())
+	assert.NoError(t, report.Err())
+}
+
+// 测试配置目录不存在时返回错误
+func TestLoadAllConfigsFromDirMissing(t *testing.T) {
+	_, err := loadAllConfigsFromDir(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+// 测试LoadAllConfigs和LintConfig共用的凭证描述按顺序校验必填字段和TLS配置
+func TestCredentialDescriptorValidate(t *testing.T) {
+	missingCA := CredentialTLS{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}
+
+	cred := credentialDescriptor{required: []credentialField{{"api_key", ""}, {"endpoint", ""}}, tls: missingCA}
+	assert.EqualError(t, cred.validate(), "缺少api_key")
+
+	cred.required = []credentialField{{"api_key", "cipher"}}
+	assert.ErrorContains(t, cred.validate(), "读取CA证书文件失败")
+
+	cred.tls = CredentialTLS{}
+	assert.NoError(t, cred.validate())
+}
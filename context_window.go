@@ -0,0 +1,127 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrContextWindowExceeded 裁剪历史消息后请求仍超过MaxContextTokens
+var ErrContextWindowExceeded = errors.New("请求超过上下文窗口上限")
+
+// TruncationStrategy 请求超过MaxContextTokens时裁剪历史消息的方式
+type TruncationStrategy string
+
+const (
+	// TruncationDropOldest 默认方式：从最早的一轮对话开始丢弃
+	TruncationDropOldest TruncationStrategy = "drop_oldest"
+	// TruncationKeepHeadAndTail 保留第一轮对话（通常是任务说明）和最近一轮，从第二轮开始丢弃
+	TruncationKeepHeadAndTail TruncationStrategy = "keep_head_and_tail"
+)
+
+// TruncationInfo 历史消息的裁剪结果
+type TruncationInfo struct {
+	Strategy       TruncationStrategy `json:"strategy"`        // 使用的裁剪方式
+	DroppedIndices []int              `json:"dropped_indices"` // 被丢弃的消息在原请求Messages中的下标
+	OriginalTokens int                `json:"original_tokens"` // 裁剪前的token数
+	Tokens         int                `json:"tokens"`          // 裁剪后的token数
+	Estimated      bool               `json:"estimated"`       // token数是否为近似估算
+}
+
+// TruncateMessages 按MaxContextTokens裁剪请求的历史消息，返回裁剪后的请求副本
+// 消息按轮次（一条user消息及其后的回复、工具调用和工具结果）整轮丢弃，不会留下没有对应工具调用的工具结果；
+// system消息和最近一轮对话始终保留。未设置MaxContextTokens或无需裁剪时返回的TruncationInfo为nil，
+// 丢弃全部可丢弃的轮次后仍超过上限时返回ErrContextWindowExceeded
+func TruncateMessages(req ChatRequest) (ChatRequest, *TruncationInfo, error) {
+	if req.MaxContextTokens <= 0 {
+		return req, nil, nil
+	}
+
+	count, err := CountTokensDetailed(req)
+	if err != nil {
+		return req, nil, err
+	}
+	if count.Total <= req.MaxContextTokens {
+		return req, nil, nil
+	}
+
+	strategy := req.TruncationStrategy
+	if strategy == "" {
+		strategy = TruncationDropOldest
+	}
+	if strategy != TruncationDropOldest && strategy != TruncationKeepHeadAndTail {
+		return req, nil, fmt.Errorf("不支持的裁剪方式: %s", strategy)
+	}
+
+	// 最近一轮始终保留；keep_head_and_tail时第一轮也保留
+	turns := conversationTurns(req.Messages)
+	droppable := turns
+	if len(droppable) > 0 {
+		droppable = droppable[:len(droppable)-1]
+	}
+	if strategy == TruncationKeepHeadAndTail && len(droppable) > 0 {
+		droppable = droppable[1:]
+	}
+
+	tokens := count.Total
+	dropped := make(map[int]bool)
+	for _, turn := range droppable {
+		if tokens <= req.MaxContextTokens {
+			break
+		}
+		for _, i := range turn {
+			dropped[i] = true
+			tokens -= count.Messages[i]
+		}
+	}
+	if tokens > req.MaxContextTokens {
+		return req, nil, fmt.Errorf("%w: 裁剪历史消息后约%d个token，上限为%d", ErrContextWindowExceeded, tokens, req.MaxContextTokens)
+	}
+
+	info := &TruncationInfo{
+		Strategy:       strategy,
+		OriginalTokens: count.Total,
+		Tokens:         tokens,
+		Estimated:      count.Estimated,
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages)-len(dropped))
+	for i, msg := range req.Messages {
+		if dropped[i] {
+			info.DroppedIndices = append(info.DroppedIndices, i)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	req.Messages = messages
+	return req, info, nil
+}
+
+// conversationTurns 将非system消息按轮次分组，每轮从一条user消息开始，返回各轮消息的下标
+// 第一条user消息之前的非system消息单独作为一轮
+func conversationTurns(messages []openai.ChatCompletionMessage) [][]int {
+	var turns [][]int
+	for i, msg := range messages {
+		role := normalizeMessageRole(msg)
+		if role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		if role == openai.ChatMessageRoleUser || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], i)
+	}
+	return turns
+}
+
+// applyContextWindow 发送前按MaxContextTokens裁剪历史消息，并通知请求方裁剪结果
+func applyContextWindow(req ChatRequest) (ChatRequest, error) {
+	truncated, info, err := TruncateMessages(req)
+	if err != nil {
+		return req, err
+	}
+	if info != nil && req.onTruncated != nil {
+		req.onTruncated(info)
+	}
+	return truncated, nil
+}
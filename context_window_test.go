@@ -0,0 +1,140 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLongConversation 构造多轮对话，测试分词器把每段非空文本计为1个token
+func newLongConversation(t *testing.T) ChatRequest {
+	RegisterTokenizer("context-test", TokenizerFunc(func(text string) int {
+		if text == "" {
+			return 0
+		}
+		return 1
+	}))
+	t.Cleanup(func() { RegisterTokenizer("context-test", nil) })
+
+	req := ChatRequest{}
+	req.Model = "context-test"
+	req.Messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "你是助手"},  // 0
+		{Role: openai.ChatMessageRoleUser, Content: "任务说明"},    // 1 第一轮
+		{Role: openai.ChatMessageRoleAssistant, Content: "好的"}, // 2
+		{Role: openai.ChatMessageRoleUser, Content: "查天气"},     // 3 第二轮
+		{
+			Role: openai.ChatMessageRoleAssistant, // 4
+			ToolCalls: []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "get_weather", Arguments: "{}"}}},
+		},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "晴"}, // 5
+		{Role: openai.ChatMessageRoleAssistant, Content: "晴天"},                 // 6
+		{Role: openai.ChatMessageRoleUser, Content: "谢谢"},                      // 7 第三轮
+		{Role: openai.ChatMessageRoleAssistant, Content: "不客气"},                // 8
+		{Role: openai.ChatMessageRoleUser, Content: "再见"},                      // 9 最近一轮
+	}
+	return req
+}
+
+// 测试从最早的一轮开始整轮丢弃
+func TestTruncateMessagesDropOldest(t *testing.T) {
+	req := newLongConversation(t)
+	count, err := CountTokensDetailed(req)
+	assert.NoError(t, err)
+
+	// 只需丢弃第一轮即可容纳
+	req.MaxContextTokens = count.Total - count.Messages[1]
+	truncated, info, err := TruncateMessages(req)
+	if assert.NoError(t, err) && assert.NotNil(t, info) {
+		assert.Equal(t, TruncationDropOldest, info.Strategy)
+		assert.Equal(t, []int{1, 2}, info.DroppedIndices)
+		assert.Equal(t, count.Total, info.OriginalTokens)
+		assert.Equal(t, count.Total-count.Messages[1]-count.Messages[2], info.Tokens)
+		assert.False(t, info.Estimated)
+		assert.Equal(t, openai.ChatMessageRoleSystem, truncated.Messages[0].Role)
+		assert.Equal(t, "查天气", truncated.Messages[1].Content)
+	}
+	assert.Len(t, req.Messages, 10, "原请求不应被修改")
+
+	// 工具调用和工具结果随所在的一轮一起丢弃
+	req.MaxContextTokens = count.Total - count.Messages[1] - count.Messages[2] - count.Messages[3]
+	truncated, info, err = TruncateMessages(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, info.DroppedIndices)
+		assert.Equal(t, []string{"你是助手", "谢谢", "不客气", "再见"}, messageContents(truncated.Messages))
+	}
+}
+
+// 测试保留第一轮和最近一轮
+func TestTruncateMessagesKeepHeadAndTail(t *testing.T) {
+	req := newLongConversation(t)
+	count, _ := CountTokensDetailed(req)
+	req.TruncationStrategy = TruncationKeepHeadAndTail
+	req.MaxContextTokens = count.Total - count.Messages[3]
+
+	truncated, info, err := TruncateMessages(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{3, 4, 5, 6}, info.DroppedIndices)
+		assert.Equal(t, []string{"你是助手", "任务说明", "好的", "谢谢", "不客气", "再见"}, messageContents(truncated.Messages))
+	}
+
+	// 只剩第一轮和最近一轮仍然超过上限
+	req.MaxContextTokens = 10
+	_, _, err = TruncateMessages(req)
+	assert.ErrorIs(t, err, ErrContextWindowExceeded)
+
+	req.TruncationStrategy = "summarize"
+	req.MaxContextTokens = count.Total - 1
+	_, _, err = TruncateMessages(req)
+	assert.EqualError(t, err, "不支持的裁剪方式: summarize")
+}
+
+// 测试未超过上限或未设置时不裁剪
+func TestTruncateMessagesNotNeeded(t *testing.T) {
+	req := newLongConversation(t)
+	truncated, info, err := TruncateMessages(req)
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+	assert.Equal(t, req.Messages, truncated.Messages)
+
+	req.MaxContextTokens = 100000
+	_, info, err = TruncateMessages(req)
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+// 测试发送前裁剪并在响应中返回裁剪结果
+func TestCreateChatCompletionTruncatesHistory(t *testing.T) {
+	provider := registerFakeProvider(t, "context")
+	req := newLongConversation(t)
+	req.Provider = "context"
+	count, _ := CountTokensDetailed(req)
+	req.MaxContextTokens = count.Total - count.Messages[1]
+
+	result, err := CreateChatCompletionWithResolvedConfig(req)
+	if assert.NoError(t, err) && assert.NotNil(t, result.Truncation) {
+		assert.Equal(t, []int{1, 2}, result.Truncation.DroppedIndices)
+	}
+	assert.Len(t, provider.req.Messages, 8)
+
+	_, warnings, err := SanitizeRequest(ChatRequest{
+		Provider:              "openai",
+		ChatCompletionRequest: req.ChatCompletionRequest,
+		MaxContextTokens:      req.MaxContextTokens,
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, warnings, "超过上下文窗口上限49个token，已丢弃2条较早的历史消息")
+}
+
+// messageContents 返回消息的内容列表
+func messageContents(messages []openai.ChatCompletionMessage) []string {
+	contents := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Content != "" {
+			contents = append(contents, msg.Content)
+		}
+	}
+	return contents
+}
@@ -0,0 +1,72 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrContinuationUnsupported 请求设置了MaxContinuations，但目标供应商不支持assistant消息预填充，无法接着已生成的内容续写
+var ErrContinuationUnsupported = errors.New("供应商不支持assistant消息预填充，无法自动续写")
+
+// prefillProviders 支持assistant消息预填充的供应商：请求以assistant消息结尾时从该消息之后继续生成
+// OpenAI、Azure等会把末尾的assistant消息当作已完成的一轮对话，重新作答而不是接着续写；
+// DeepSeek只在beta接口的消息带有prefix: true时续写，本地的消息结构无法表达，因此不包含在内
+var prefillProviders = map[string]bool{
+	"bedrock": true,
+	"claude":  true,
+}
+
+// checkContinuationSupport 检查目标供应商是否支持自动续写，不支持时返回ErrContinuationUnsupported
+func checkContinuationSupport(provider string, req ChatRequest) error {
+	if req.MaxContinuations <= 0 || prefillProviders[provider] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrContinuationUnsupported, provider)
+}
+
+// continueOnLength 发起非流式请求，并在响应因长度截断时自动续写
+// 续写时将已生成的内容作为assistant消息追加到对话末尾（prefill），只用于prefillProviders中的供应商，
+// 直到结束原因不再是length或达到req.MaxContinuations次；
+// 各次内容拼接为最终回复，用量累加
+func continueOnLength(req ChatRequest, create func(ChatRequest) (*openai.ChatCompletionResponse, error)) (*openai.ChatCompletionResponse, error) {
+	resp, err := create(req)
+	if err != nil || req.MaxContinuations <= 0 {
+		return resp, err
+	}
+
+	for i := 0; i < req.MaxContinuations; i++ {
+		if resp == nil || len(resp.Choices) == 0 ||
+			resp.Choices[0].FinishReason != openai.FinishReasonLength ||
+			len(resp.Choices[0].Message.ToolCalls) > 0 {
+			break
+		}
+
+		// 复制消息列表，避免修改调用方的请求
+		next := req
+		next.Messages = make([]openai.ChatCompletionMessage, len(req.Messages), len(req.Messages)+1)
+		copy(next.Messages, req.Messages)
+		next.Messages = append(next.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: resp.Choices[0].Message.Content,
+		})
+
+		part, err := create(next)
+		if err != nil {
+			return nil, err
+		}
+		if part == nil || len(part.Choices) == 0 {
+			break
+		}
+
+		resp.Choices[0].Message.Content += part.Choices[0].Message.Content
+		resp.Choices[0].Message.ToolCalls = part.Choices[0].Message.ToolCalls
+		resp.Choices[0].FinishReason = part.Choices[0].FinishReason
+		resp.Usage.PromptTokens += part.Usage.PromptTokens
+		resp.Usage.CompletionTokens += part.Usage.CompletionTokens
+		resp.Usage.TotalTokens += part.Usage.TotalTokens
+	}
+
+	return resp, nil
+}
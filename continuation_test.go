@@ -0,0 +1,85 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 模拟提供商：第一次因长度截断，第二次完成
+func newTruncatingCreator(calls *[]ChatRequest) func(ChatRequest) (*openai.ChatCompletionResponse, error) {
+	return func(req ChatRequest) (*openai.ChatCompletionResponse, error) {
+		*calls = append(*calls, req)
+		content, finishReason := "床前明月光，", openai.FinishReasonLength
+		if len(*calls) > 1 {
+			content, finishReason = "疑是地上霜。", openai.FinishReasonStop
+		}
+		return &openai.ChatCompletionResponse{
+			Model: req.Model,
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: "assistant", Content: content},
+				FinishReason: finishReason,
+			}},
+			Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		}, nil
+	}
+}
+
+func newContinuationRequest(maxContinuations int) ChatRequest {
+	return ChatRequest{
+		Provider: "claude",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "背一首静夜思"}},
+		},
+		MaxContinuations: maxContinuations,
+	}
+}
+
+// 测试截断一次后自动续写
+func TestContinueOnLength(t *testing.T) {
+	var calls []ChatRequest
+	req := newContinuationRequest(3)
+
+	resp, err := continueOnLength(req, newTruncatingCreator(&calls))
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2, "截断一次应续写一次")
+
+	// 续写请求应以已生成的内容作为assistant消息结尾
+	followUp := calls[1].Messages
+	assert.Len(t, followUp, 2)
+	assert.Equal(t, openai.ChatMessageRoleAssistant, followUp[1].Role)
+	assert.Equal(t, "床前明月光，", followUp[1].Content)
+	assert.Len(t, req.Messages, 1, "不应修改原请求的消息列表")
+
+	assert.Equal(t, "床前明月光，疑是地上霜。", resp.Choices[0].Message.Content)
+	assert.Equal(t, openai.FinishReasonStop, resp.Choices[0].FinishReason)
+	assert.Equal(t, 20, resp.Usage.PromptTokens)
+	assert.Equal(t, 10, resp.Usage.CompletionTokens)
+	assert.Equal(t, 30, resp.Usage.TotalTokens)
+}
+
+// 测试默认不续写
+func TestContinueOnLengthDisabled(t *testing.T) {
+	var calls []ChatRequest
+	resp, err := continueOnLength(newContinuationRequest(0), newTruncatingCreator(&calls))
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+	assert.Equal(t, openai.FinishReasonLength, resp.Choices[0].FinishReason)
+}
+
+// 测试只有支持assistant消息预填充的供应商可以自动续写
+func TestCheckContinuationSupport(t *testing.T) {
+	req := newContinuationRequest(2)
+	for _, provider := range []string{"claude", "bedrock"} {
+		assert.NoError(t, checkContinuationSupport(provider, req), provider)
+	}
+	for _, provider := range []string{"azure", "openai", "deepseek", "gemini", "qwen"} {
+		assert.ErrorIs(t, checkContinuationSupport(provider, req), ErrContinuationUnsupported, provider)
+		assert.NoError(t, checkContinuationSupport(provider, newContinuationRequest(0)), provider)
+	}
+
+	_, err := prepareProviderRequest("azure", req)
+	assert.ErrorIs(t, err, ErrContinuationUnsupported, "发送前应拒绝")
+}
@@ -0,0 +1,32 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCredentialNotFound 请求的CredentialName在当前环境的配置中不存在
+	ErrCredentialNotFound = errors.New("指定的凭证不存在")
+	// ErrCredentialDisabled 请求的CredentialName对应的凭证未启用
+	ErrCredentialDisabled = errors.New("指定的凭证未启用")
+)
+
+// pinnedCredentials 按Config.CredentialName固定凭证，未指定时原样返回全部凭证
+// describe 返回凭证的名称和是否启用；指定的凭证不存在或未启用时返回错误，不会回退到其他凭证
+func pinnedCredentials[T any](c *Config, env string, credentials []T, describe func(T) (string, bool)) ([]T, error) {
+	if c.CredentialName == "" {
+		return credentials, nil
+	}
+	for _, cred := range credentials {
+		name, enabled := describe(cred)
+		if name != c.CredentialName {
+			continue
+		}
+		if !enabled {
+			return nil, fmt.Errorf("%w: 环境 %s 中的凭证 %s 未启用", ErrCredentialDisabled, env, name)
+		}
+		return []T{cred}, nil
+	}
+	return nil, fmt.Errorf("%w: 环境 %s 中没有名为 %s 的凭证", ErrCredentialNotFound, env, c.CredentialName)
+}
@@ -0,0 +1,135 @@
+package einox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试按CredentialName固定凭证
+func TestPinnedCredentials(t *testing.T) {
+	creds := []QwenCredential{
+		{Name: "eastus", Enabled: true},
+		{Name: "westus", Enabled: false},
+		{Name: "japaneast", Enabled: true},
+	}
+	describe := func(cred QwenCredential) (string, bool) { return cred.Name, cred.Enabled }
+
+	pinned, err := pinnedCredentials(&Config{}, "development", creds, describe)
+	assert.NoError(t, err)
+	assert.Len(t, pinned, 3, "未指定时返回全部凭证")
+
+	pinned, err = pinnedCredentials(&Config{CredentialName: "japaneast"}, "development", creds, describe)
+	if assert.NoError(t, err) && assert.Len(t, pinned, 1) {
+		assert.Equal(t, "japaneast", pinned[0].Name)
+	}
+
+	_, err = pinnedCredentials(&Config{CredentialName: "westus"}, "development", creds, describe)
+	assert.ErrorIs(t, err, ErrCredentialDisabled)
+	assert.EqualError(t, err, "指定的凭证未启用: 环境 development 中的凭证 westus 未启用")
+
+	_, err = pinnedCredentials(&Config{CredentialName: "centralus"}, "development", creds, describe)
+	assert.ErrorIs(t, err, ErrCredentialNotFound)
+}
+
+// 测试确定性选择：同一选择键始终得到同一凭证，与凭证顺序无关
+func TestSelectDeterministicCredential(t *testing.T) {
+	creds := []AzureCredential{
+		{Name: "a", Weight: 1}, {Name: "b", Weight: 1}, {Name: "c", Weight: 1},
+		{Name: "d", Weight: 1}, {Name: "e", Weight: 1},
+	}
+	reversed := []AzureCredential{creds[4], creds[3], creds[2], creds[1], creds[0]}
+	describe := func(cred AzureCredential) (string, int) { return cred.Name, cred.Weight }
+
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		chosen := selectDeterministicCredential(key, creds, describe)
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, chosen.Name, selectDeterministicCredential(key, creds, describe).Name)
+		}
+		assert.Equal(t, chosen.Name, selectDeterministicCredential(key, reversed, describe).Name)
+		seen[chosen.Name] = true
+	}
+	assert.Greater(t, len(seen), 1, "不同的选择键应分散到不同凭证")
+
+	// 未设置选择键时同样稳定
+	assert.Equal(t, selectDeterministicCredential("", creds, describe).Name, selectDeterministicCredential("", reversed, describe).Name)
+
+	// 权重为0的凭证不会被选中
+	weighted := []AzureCredential{{Name: "a", Weight: 0}, {Name: "b", Weight: 5}}
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "b", selectDeterministicCredential(fmt.Sprint(i), weighted, describe).Name)
+	}
+}
+
+// 测试从配置文件读取凭证时固定凭证和确定性选择
+func TestGetQwenConfigPinnedCredential(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("sk-qwen")
+	assert.NoError(t, err)
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: primary
+        api_key: %[1]s
+        enabled: true
+        weight: 100
+      - name: backup
+        api_key: %[1]s
+        enabled: true
+        weight: 1
+      - name: retired
+        api_key: %[1]s
+        enabled: false
+        weight: 1
+`, cipher)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "qwen.yaml"), []byte(configContent), 0644))
+
+	selectCredentialName := func(c *Config) (string, error) {
+		var selected string
+		c.Vendor, c.Model = "qwen", "qwen-max"
+		c.onCredentialSelected = func(info CallInfo) { selected = info.Credential }
+		_, err := c.getQwenConfig()
+		return selected, err
+	}
+
+	name, err := selectCredentialName(&Config{CredentialName: "backup"})
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", name)
+
+	_, err = selectCredentialName(&Config{CredentialName: "retired"})
+	assert.ErrorIs(t, err, ErrCredentialDisabled)
+	_, err = selectCredentialName(&Config{CredentialName: "missing"})
+	assert.ErrorIs(t, err, ErrCredentialNotFound)
+
+	first, err := selectCredentialName(&Config{DeterministicSelection: true, SelectionKey: "user-1"})
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		name, _ := selectCredentialName(&Config{DeterministicSelection: true, SelectionKey: "user-1"})
+		assert.Equal(t, first, name)
+	}
+}
+
+// 测试凭证固定和确定性选择不从请求体解析，客户端无法绕过凭证选择策略
+func TestCredentialPinningNotParsedFromRequest(t *testing.T) {
+	req, err := ParseChatRequest(strings.NewReader(`{"model":"azure/gpt-4o","credential_name":"backup","deterministic_selection":true}`))
+	assert.NoError(t, err)
+	assert.Empty(t, req.CredentialName)
+	assert.False(t, req.DeterministicSelection)
+}
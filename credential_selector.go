@@ -0,0 +1,250 @@
+package einox
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"sync"
+)
+
+// 内置的凭证选择策略名称
+const (
+	// SelectionStrategyWeightedRandom 按权重随机选择
+	SelectionStrategyWeightedRandom = "weighted_random"
+	// SelectionStrategyRoundRobin 平滑加权轮询
+	SelectionStrategyRoundRobin = "round_robin"
+	// SelectionStrategySticky 按选择键（如用户ID）固定到同一凭证，未提供选择键时跳过
+	SelectionStrategySticky = "sticky"
+)
+
+// CredentialCandidate 参与选择的候选凭证
+type CredentialCandidate struct {
+	Name   string // 凭证名称，用于稳定的平局裁决
+	Weight int    // 凭证权重
+}
+
+// SelectionStrategy 凭证选择策略
+// scope 标识当前提供商及环境，key 为请求的选择键（可能为空）
+// 返回收窄后的候选列表：返回空列表表示该策略不适用，交由下一个策略处理；
+// 返回多个候选时，由后续策略继续收窄
+type SelectionStrategy func(scope, key string, candidates []CredentialCandidate) []CredentialCandidate
+
+var (
+	selectionStrategiesMu sync.RWMutex
+
+	// selectionStrategies 已注册的策略
+	selectionStrategies = map[string]SelectionStrategy{
+		SelectionStrategyWeightedRandom: weightedRandomStrategy,
+		SelectionStrategyRoundRobin:     roundRobinStrategy,
+		SelectionStrategySticky:         stickyStrategy,
+		SelectionStrategyAdaptiveWeight: adaptiveWeightStrategy,
+	}
+
+	// selectionStrategyOrder 策略链的执行顺序，默认保持原有的按权重随机选择
+	selectionStrategyOrder = []string{SelectionStrategyWeightedRandom}
+)
+
+// RegisterSelectionStrategy 注册自定义的凭证选择策略（如最少负载）
+// 同名策略会被覆盖
+func RegisterSelectionStrategy(name string, strategy SelectionStrategy) {
+	selectionStrategiesMu.Lock()
+	defer selectionStrategiesMu.Unlock()
+	selectionStrategies[name] = strategy
+}
+
+// SetSelectionStrategyOrder 设置凭证选择策略链的执行顺序
+// 例如: SetSelectionStrategyOrder("sticky", "round_robin") 表示优先按用户固定凭证，
+// 未提供选择键时回退到加权轮询
+func SetSelectionStrategyOrder(names ...string) error {
+	selectionStrategiesMu.Lock()
+	defer selectionStrategiesMu.Unlock()
+
+	if len(names) == 0 {
+		return fmt.Errorf("凭证选择策略链不能为空")
+	}
+	for _, name := range names {
+		if _, ok := selectionStrategies[name]; !ok {
+			return fmt.Errorf("未知的凭证选择策略: %s", name)
+		}
+	}
+	selectionStrategyOrder = append([]string(nil), names...)
+	return nil
+}
+
+// selectCandidate 按策略链从候选凭证中选出一个，返回其在candidates中的下标
+// 候选先按Name排序，策略链结束后仍有多个候选时取Name最小者，保证结果稳定
+func selectCandidate(scope, key string, candidates []CredentialCandidate) int {
+	sorted := make([]CredentialCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	selectionStrategiesMu.RLock()
+	chain := make([]SelectionStrategy, 0, len(selectionStrategyOrder))
+	for _, name := range selectionStrategyOrder {
+		chain = append(chain, selectionStrategies[name])
+	}
+	selectionStrategiesMu.RUnlock()
+
+	remaining := sorted
+	for _, strategy := range chain {
+		if len(remaining) <= 1 {
+			break
+		}
+		narrowed := strategy(scope, key, remaining)
+		if len(narrowed) == 0 {
+			// 策略不适用，交由下一个策略处理
+			continue
+		}
+		remaining = narrowed
+	}
+
+	chosen := remaining[0].Name
+	for i, candidate := range candidates {
+		if candidate.Name == chosen {
+			return i
+		}
+	}
+	return 0
+}
+
+// selectCredential 从启用的凭证中按策略链选择一个
+// describe 返回凭证的名称和权重
+func selectCredential[T any](scope, key string, credentials []T, describe func(T) (string, int)) T {
+	candidates := make([]CredentialCandidate, len(credentials))
+	for i, cred := range credentials {
+		name, weight := describe(cred)
+		candidates[i] = CredentialCandidate{Name: name, Weight: weight}
+	}
+	return credentials[selectCandidate(scope, key, candidates)]
+}
+
+// selectDeterministicCredential 按选择键的哈希值从启用的凭证中选择一个，不经过策略链
+// 候选按Name排序后再计算，凭证配置不变时同一选择键（包括空值）始终得到同一凭证
+func selectDeterministicCredential[T any](key string, credentials []T, describe func(T) (string, int)) T {
+	candidates := make([]CredentialCandidate, len(credentials))
+	for i, cred := range credentials {
+		name, weight := describe(cred)
+		candidates[i] = CredentialCandidate{Name: name, Weight: weight}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	chosen := hashWeightedCandidate(key, candidates)[0].Name
+	for _, cred := range credentials {
+		if name, _ := describe(cred); name == chosen {
+			return cred
+		}
+	}
+	return credentials[0]
+}
+
+// weightedRandomStrategy 按权重随机选择一个候选
+// 所有权重都不大于0时等概率选择；使用math/rand/v2的全局随机源，自动播种且可并发调用
+func weightedRandomStrategy(scope, key string, candidates []CredentialCandidate) []CredentialCandidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+	totalWeight := 0
+	for _, candidate := range candidates {
+		if candidate.Weight > 0 {
+			totalWeight += candidate.Weight
+		}
+	}
+	if totalWeight == 0 {
+		i := rand.IntN(len(candidates))
+		return candidates[i : i+1]
+	}
+
+	randomNum := rand.IntN(totalWeight)
+	currentWeight := 0
+	for i, candidate := range candidates {
+		if candidate.Weight <= 0 {
+			continue
+		}
+		currentWeight += candidate.Weight
+		if randomNum < currentWeight {
+			return candidates[i : i+1]
+		}
+	}
+	return candidates[len(candidates)-1:]
+}
+
+var (
+	roundRobinMu sync.Mutex
+	// roundRobinState 平滑加权轮询的当前权重，按scope和凭证名称记录
+	roundRobinState = map[string]map[string]int{}
+)
+
+// roundRobinStrategy 平滑加权轮询（nginx算法），权重不大于0的凭证按1处理
+func roundRobinStrategy(scope, key string, candidates []CredentialCandidate) []CredentialCandidate {
+	roundRobinMu.Lock()
+	defer roundRobinMu.Unlock()
+
+	state, ok := roundRobinState[scope]
+	if !ok {
+		state = map[string]int{}
+		roundRobinState[scope] = state
+	}
+
+	totalWeight := 0
+	best := -1
+	for i, candidate := range candidates {
+		weight := candidate.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		totalWeight += weight
+		state[candidate.Name] += weight
+		// 严格大于保证当前权重相同时取Name较小者
+		if best < 0 || state[candidate.Name] > state[candidates[best].Name] {
+			best = i
+		}
+	}
+	state[candidates[best].Name] -= totalWeight
+	return candidates[best : best+1]
+}
+
+// stickyStrategy 根据选择键的哈希值按权重固定选择一个候选
+// 候选集合不变时，同一选择键始终得到同一凭证
+func stickyStrategy(scope, key string, candidates []CredentialCandidate) []CredentialCandidate {
+	if key == "" {
+		return nil
+	}
+	return hashWeightedCandidate(key, candidates)
+}
+
+// hashWeightedCandidate 按key的哈希值在候选中按权重选择一个，所有权重都不大于0时等概率选择
+func hashWeightedCandidate(key string, candidates []CredentialCandidate) []CredentialCandidate {
+	totalWeight := 0
+	for _, candidate := range candidates {
+		if candidate.Weight > 0 {
+			totalWeight += candidate.Weight
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	sum := h.Sum32()
+
+	if totalWeight == 0 {
+		i := int(sum % uint32(len(candidates)))
+		return candidates[i : i+1]
+	}
+
+	target := int(sum % uint32(totalWeight))
+	currentWeight := 0
+	for i, candidate := range candidates {
+		if candidate.Weight <= 0 {
+			continue
+		}
+		currentWeight += candidate.Weight
+		if target < currentWeight {
+			return candidates[i : i+1]
+		}
+	}
+	return candidates[len(candidates)-1:]
+}
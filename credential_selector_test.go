@@ -0,0 +1,121 @@
+package einox
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试策略链按顺序执行，并在剩余多个候选时按Name稳定裁决
+func TestSelectionStrategyChainOrder(t *testing.T) {
+	defer SetSelectionStrategyOrder(SelectionStrategyWeightedRandom)
+
+	var calls []string
+	RegisterSelectionStrategy("test_skip", func(scope, key string, candidates []CredentialCandidate) []CredentialCandidate {
+		calls = append(calls, "test_skip")
+		return nil
+	})
+	RegisterSelectionStrategy("test_heavy", func(scope, key string, candidates []CredentialCandidate) []CredentialCandidate {
+		calls = append(calls, "test_heavy")
+		var heavy []CredentialCandidate
+		for _, candidate := range candidates {
+			if candidate.Weight >= 10 {
+				heavy = append(heavy, candidate)
+			}
+		}
+		return heavy
+	})
+
+	err := SetSelectionStrategyOrder("test_skip", "test_heavy")
+	assert.NoError(t, err)
+
+	candidates := []CredentialCandidate{
+		{Name: "charlie", Weight: 10},
+		{Name: "alpha", Weight: 1},
+		{Name: "bravo", Weight: 10},
+	}
+
+	for i := 0; i < 5; i++ {
+		calls = nil
+		index := selectCandidate("test:chain", "", candidates)
+		assert.Equal(t, []string{"test_skip", "test_heavy"}, calls, "策略应按配置顺序执行")
+		assert.Equal(t, "bravo", candidates[index].Name, "剩余多个候选时应取Name最小者")
+	}
+
+	// 未知策略应返回错误
+	assert.Error(t, SetSelectionStrategyOrder("not_exist"))
+	assert.Error(t, SetSelectionStrategyOrder())
+}
+
+// 测试sticky优先、未提供选择键时回退到加权轮询
+func TestSelectionStrategyStickyFallback(t *testing.T) {
+	defer SetSelectionStrategyOrder(SelectionStrategyWeightedRandom)
+
+	err := SetSelectionStrategyOrder(SelectionStrategySticky, SelectionStrategyRoundRobin)
+	assert.NoError(t, err)
+
+	creds := []AzureCredential{
+		{Name: "b", Weight: 1},
+		{Name: "a", Weight: 1},
+	}
+	describe := func(cred AzureCredential) (string, int) { return cred.Name, cred.Weight }
+
+	// 同一选择键始终得到同一凭证
+	first := selectCredential("test:sticky", "user-42", creds, describe)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first.Name, selectCredential("test:sticky", "user-42", creds, describe).Name)
+	}
+
+	// 无选择键时轮询，权重相同时从Name最小者开始
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, selectCredential("test:rr", "", creds, describe).Name)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, names)
+}
+
+// 测试加权随机选择的频率与配置的权重大致相符，并可并发调用
+func TestWeightedRandomStrategyDistribution(t *testing.T) {
+	candidates := []CredentialCandidate{
+		{Name: "a", Weight: 10},
+		{Name: "b", Weight: 30},
+		{Name: "c", Weight: 60},
+	}
+
+	const workers, rounds = 8, 2500
+	var mu sync.Mutex
+	counts := map[string]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := map[string]int{}
+			for i := 0; i < rounds; i++ {
+				local[weightedRandomStrategy("test:distribution", "", candidates)[0].Name]++
+			}
+			mu.Lock()
+			for name, count := range local {
+				counts[name] += count
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	total := float64(workers * rounds)
+	assert.InDelta(t, 0.1, float64(counts["a"])/total, 0.03)
+	assert.InDelta(t, 0.3, float64(counts["b"])/total, 0.03)
+	assert.InDelta(t, 0.6, float64(counts["c"])/total, 0.03)
+}
+
+// 测试权重全为0或没有候选时不会panic
+func TestWeightedRandomStrategyZeroWeight(t *testing.T) {
+	candidates := []CredentialCandidate{{Name: "a"}, {Name: "b", Weight: -1}}
+	for i := 0; i < 20; i++ {
+		assert.Len(t, weightedRandomStrategy("test:zero", "", candidates), 1)
+	}
+	assert.Empty(t, weightedRandomStrategy("test:zero", "", nil))
+	assert.Empty(t, adaptiveWeightStrategy("test:zero", "", nil))
+}
@@ -0,0 +1,115 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// minDedupeDeltaRunes 参与去重的增量内容最少字符数
+// 较短的内容（如"哈"、".."）连续重复可能是正常输出，不做去重
+const minDedupeDeltaRunes = 4
+
+// deltaDeduper 检测并丢弃完全相同的连续增量
+// 只处理仅含文本内容的增量：内容、下标和角色都相同才视为重复，
+// 带有工具调用或结束原因的增量不参与去重，并会重置比较状态
+type deltaDeduper struct {
+	enabled bool
+	last    string
+}
+
+// newDeltaDeduper 创建去重器，enabled为false时不丢弃任何增量
+func newDeltaDeduper(enabled bool) *deltaDeduper {
+	return &deltaDeduper{enabled: enabled}
+}
+
+// shouldDrop 根据增量的比较键判断是否丢弃，key为空表示不参与去重
+func (d *deltaDeduper) shouldDrop(key string) bool {
+	if !d.enabled {
+		return false
+	}
+	if key == "" {
+		d.last = ""
+		return false
+	}
+	if key == d.last {
+		return true
+	}
+	d.last = key
+	return false
+}
+
+// dedupeKey 生成增量的比较键，不满足去重条件时返回空
+// 只含空白、标点或符号的增量（如代码缩进、"----"分隔线）连续重复是正常输出，不参与去重
+func dedupeKey(index int, role, content string, hasToolCalls bool, finishReason string) string {
+	if hasToolCalls || finishReason != "" || utf8.RuneCountInString(content) < minDedupeDeltaRunes ||
+		!strings.ContainsFunc(content, isDedupeTextRune) {
+		return ""
+	}
+	return fmt.Sprintf("%d\x00%s\x00%s", index, role, content)
+}
+
+// isDedupeTextRune 判断字符是否为文字或数字，增量中至少包含一个才参与去重
+func isDedupeTextRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// shouldDropOpenAI 判断openai流式响应是否为重复增量
+func (d *deltaDeduper) shouldDropOpenAI(resp *openai.ChatCompletionStreamResponse) bool {
+	if resp == nil || len(resp.Choices) != 1 {
+		return d.shouldDrop("")
+	}
+	choice := resp.Choices[0]
+	return d.shouldDrop(dedupeKey(choice.Index, choice.Delta.Role, choice.Delta.Content,
+		len(choice.Delta.ToolCalls) > 0 || choice.Delta.FunctionCall != nil, string(choice.FinishReason)))
+}
+
+// shouldDropLocal 判断本地流式响应是否为重复增量
+func (d *deltaDeduper) shouldDropLocal(resp StreamResponse) bool {
+	if len(resp.Choices) != 1 {
+		return d.shouldDrop("")
+	}
+	choice := resp.Choices[0]
+	return d.shouldDrop(dedupeKey(choice.Index, choice.Delta.Role, choice.Delta.Content, false, choice.FinishReason))
+}
+
+// dedupeStreamReader 包装流，丢弃重复的连续增量
+func dedupeStreamReader(streamReader *schema.StreamReader[*openai.ChatCompletionStreamResponse]) *schema.StreamReader[*openai.ChatCompletionStreamResponse] {
+	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](10)
+	deduper := newDeltaDeduper(true)
+
+	go func() {
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				getLogger().Error("流式去重goroutine发生异常", "panic", panicErr)
+			}
+			streamReader.Close()
+			resultWriter.Close()
+		}()
+
+		for {
+			chunk, err := streamReader.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				_ = resultWriter.Send(nil, err)
+				return
+			}
+			if deduper.shouldDropOpenAI(chunk) {
+				continue
+			}
+			if closed := resultWriter.Send(chunk, nil); closed {
+				return
+			}
+		}
+	}()
+
+	return resultReader
+}
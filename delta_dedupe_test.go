@@ -0,0 +1,88 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 模拟网关重复推送同一个增量的流
+func newRepeatingStream() []*openai.ChatCompletionStreamResponse {
+	return []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("今天天气很好，", ""),
+		newTestStreamChunk("适合出门散步。", ""),
+		newTestStreamChunk("适合出门散步。", ""),
+		newTestStreamChunk("", openai.FinishReasonStop),
+	}
+}
+
+// 读取流中的全部内容
+func collectStreamContent(t *testing.T, reader *schema.StreamReader[*openai.ChatCompletionStreamResponse]) string {
+	content := ""
+	for {
+		chunk, err := reader.Recv()
+		if err != nil {
+			break
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	return content
+}
+
+// 测试开启去重时丢弃重复增量
+func TestDedupeStreamReader(t *testing.T) {
+	reader := dedupeStreamReader(schema.StreamReaderFromArray(newRepeatingStream()))
+	assert.Equal(t, "今天天气很好，适合出门散步。", collectStreamContent(t, reader))
+}
+
+// 测试未开启去重时保留全部增量
+func TestDeltaDeduperDisabled(t *testing.T) {
+	deduper := newDeltaDeduper(false)
+	content := ""
+	for _, chunk := range newRepeatingStream() {
+		if !deduper.shouldDropOpenAI(chunk) {
+			content += chunk.Choices[0].Delta.Content
+		}
+	}
+	assert.Equal(t, "今天天气很好，适合出门散步。适合出门散步。", content)
+}
+
+// 测试较短的重复内容和非连续的重复不会被丢弃
+func TestDeltaDeduperConservative(t *testing.T) {
+	deduper := newDeltaDeduper(true)
+
+	// 较短的连续重复可能是正常输出
+	assert.False(t, deduper.shouldDropOpenAI(newTestStreamChunk("哈", "")))
+	assert.False(t, deduper.shouldDropOpenAI(newTestStreamChunk("哈", "")))
+
+	// 中间隔了其他增量的重复不是重复推送
+	assert.False(t, deduper.shouldDropOpenAI(newTestStreamChunk("重复的一句话", "")))
+	assert.False(t, deduper.shouldDropOpenAI(newTestStreamChunk("不同的内容", "")))
+	assert.False(t, deduper.shouldDropOpenAI(newTestStreamChunk("重复的一句话", "")))
+
+	// 本地流式响应结构同样适用
+	local := StreamResponse{Choices: []StreamChoice{{Delta: StreamChoiceDelta{Content: "相同的增量内容"}}}}
+	assert.False(t, deduper.shouldDropLocal(local))
+	assert.True(t, deduper.shouldDropLocal(local))
+}
+
+// 测试流式输出缩进的代码时，连续相同的缩进和分隔线不会被丢弃
+func TestDedupeStreamReaderIndentedCode(t *testing.T) {
+	deltas := []string{
+		"```go\nfunc main() {\n", "    ", "    ", "if ok {\n",
+		"    ", "    ", "    ", "    ", "return\n",
+		"    ", "    ", "}\n}\n```\n", "----", "----", "\n",
+	}
+	chunks := make([]*openai.ChatCompletionStreamResponse, 0, len(deltas)+1)
+	expected := ""
+	for _, delta := range deltas {
+		chunks = append(chunks, newTestStreamChunk(delta, ""))
+		expected += delta
+	}
+	chunks = append(chunks, newTestStreamChunk("", openai.FinishReasonStop))
+
+	reader := dedupeStreamReader(schema.StreamReaderFromArray(chunks))
+	assert.Equal(t, expected, collectStreamContent(t, reader))
+}
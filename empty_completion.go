@@ -0,0 +1,39 @@
+package einox
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrEmptyCompletion 提供商返回了既没有内容也没有工具调用的空回复
+var ErrEmptyCompletion = errors.New("提供商返回了空回复")
+
+// checkEmptyCompletion 检查非流式响应是否为空回复
+// 包含内容、拒绝说明、工具调用或函数调用任意一项的选项均视为非空
+func checkEmptyCompletion(resp *openai.ChatCompletionResponse) error {
+	if resp == nil || len(resp.Choices) == 0 {
+		return ErrEmptyCompletion
+	}
+	for _, choice := range resp.Choices {
+		msg := choice.Message
+		if strings.TrimSpace(msg.Content) != "" || len(msg.MultiContent) > 0 ||
+			msg.Refusal != "" || len(msg.ToolCalls) > 0 || msg.FunctionCall != nil {
+			return nil
+		}
+	}
+	return ErrEmptyCompletion
+}
+
+// applyEmptyCompletionPolicy 按配置处理空回复
+// errorOnEmpty为false时保持原有行为，原样返回空回复
+func applyEmptyCompletionPolicy(resp *openai.ChatCompletionResponse, errorOnEmpty bool) (*openai.ChatCompletionResponse, error) {
+	if !errorOnEmpty {
+		return resp, nil
+	}
+	if err := checkEmptyCompletion(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
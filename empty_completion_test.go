@@ -0,0 +1,53 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造一个模拟的空回复
+func newEmptyCompletionResponse() *openai.ChatCompletionResponse {
+	return &openai.ChatCompletionResponse{
+		Model: "gpt-4o",
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: "assistant"},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}
+}
+
+func TestApplyEmptyCompletionPolicy(t *testing.T) {
+	// 默认保持原有行为，返回空回复
+	resp, err := applyEmptyCompletionPolicy(newEmptyCompletionResponse(), false)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Choices[0].Message.Content)
+
+	// 开启后返回ErrEmptyCompletion
+	resp, err = applyEmptyCompletionPolicy(newEmptyCompletionResponse(), true)
+	assert.Nil(t, resp)
+	assert.True(t, errors.Is(err, ErrEmptyCompletion))
+
+	// 仅包含空白字符同样视为空回复
+	blank := newEmptyCompletionResponse()
+	blank.Choices[0].Message.Content = " \n"
+	_, err = applyEmptyCompletionPolicy(blank, true)
+	assert.ErrorIs(t, err, ErrEmptyCompletion)
+}
+
+func TestApplyEmptyCompletionPolicyToolCalls(t *testing.T) {
+	// 只有工具调用、没有内容的回复不是空回复
+	resp := newEmptyCompletionResponse()
+	resp.Choices[0].Message.ToolCalls = []openai.ToolCall{{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "get_weather", Arguments: "{}"},
+	}}
+	resp.Choices[0].FinishReason = openai.FinishReasonToolCalls
+
+	got, err := applyEmptyCompletionPolicy(resp, true)
+	assert.NoError(t, err)
+	assert.Same(t, resp, got)
+}
@@ -0,0 +1,154 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoFallbackCredential 故障转移时已没有其余可用的凭证
+var ErrNoFallbackCredential = errors.New("没有可供故障转移的凭证")
+
+// credentialFallback 一次请求的凭证故障转移状态，记录已失败的凭证
+// 由统一入口在开启FallbackEnabled时创建，getXXXConfig选择凭证时跳过已失败的凭证
+type credentialFallback struct {
+	mu        sync.Mutex
+	failed    map[string]bool
+	exhausted bool
+}
+
+// markFailed 记录失败的凭证，已记录过时返回false
+func (f *credentialFallback) markFailed(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed[name] {
+		return false
+	}
+	if f.failed == nil {
+		f.failed = map[string]bool{}
+	}
+	f.failed[name] = true
+	return true
+}
+
+// isExhausted 返回是否已没有可供转移的凭证
+func (f *credentialFallback) isExhausted() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.exhausted
+}
+
+// chooseCredential 首次选择凭证：开启DeterministicSelection时按选择键确定性地选择，否则按凭证选择策略链选择
+func chooseCredential[T any](c *Config, scope string, credentials []T, describe func(T) (string, int)) T {
+	if c.DeterministicSelection {
+		return selectDeterministicCredential(c.SelectionKey, credentials, describe)
+	}
+	return selectCredential(scope, c.SelectionKey, credentials, describe)
+}
+
+// selectConfigCredential 从启用的凭证中选择一个
+// 首次选择按凭证选择策略链（开启DeterministicSelection时按选择键）进行；故障转移时跳过已失败的凭证，按权重从高到低选择，权重相同时取Name较小者
+func selectConfigCredential[T any](c *Config, scope string, credentials []T, describe func(T) (string, int)) (T, error) {
+	fallback := c.credentialFallback
+	if fallback == nil {
+		return chooseCredential(c, scope, credentials, describe), nil
+	}
+
+	fallback.mu.Lock()
+	defer fallback.mu.Unlock()
+	if len(fallback.failed) == 0 {
+		return chooseCredential(c, scope, credentials, describe), nil
+	}
+
+	remaining := make([]int, 0, len(credentials))
+	for i, cred := range credentials {
+		if name, _ := describe(cred); !fallback.failed[name] {
+			remaining = append(remaining, i)
+		}
+	}
+	if len(remaining) == 0 {
+		fallback.exhausted = true
+		var zero T
+		return zero, ErrNoFallbackCredential
+	}
+	sort.SliceStable(remaining, func(i, j int) bool {
+		nameI, weightI := describe(credentials[remaining[i]])
+		nameJ, weightJ := describe(credentials[remaining[j]])
+		if weightI != weightJ {
+			return weightI > weightJ
+		}
+		return nameI < nameJ
+	})
+	return credentials[remaining[0]], nil
+}
+
+// callWithCredentialFallback 调用call，开启FallbackEnabled时，凭证出现可重试的错误（429、5xx、超时）后换用其余凭证重新调用
+// call返回本次调用实际使用的凭证名称；全部凭证都失败时返回最后一次调用的错误
+func callWithCredentialFallback[T any](req ChatRequest, call func(req ChatRequest) (T, string, error)) (T, error) {
+	if !req.FallbackEnabled {
+		result, _, err := call(req)
+		return result, err
+	}
+
+	fallback := &credentialFallback{}
+	req.credentialFallback = fallback
+	result, name, err := call(req)
+	for fallbacks := 0; err != nil; fallbacks++ {
+		if req.MaxFallbacks > 0 && fallbacks >= req.MaxFallbacks {
+			break
+		}
+		// 未经过凭证选择（如调用方直接提供凭证）或同一凭证再次失败时不再转移
+		if name == "" || !isFallbackError(req.ctx, err) || !fallback.markFailed(name) {
+			break
+		}
+		next, nextName, nextErr := call(req)
+		if fallback.isExhausted() {
+			break
+		}
+		result, name, err = next, nextName, nextErr
+	}
+	return result, err
+}
+
+// isFallbackError 判断错误是否应换用其他凭证重试：限流(429)、服务端错误(5xx)或超时
+// 请求的上下文已取消或超时、流式请求已输出内容时不再转移
+func isFallbackError(ctx context.Context, err error) bool {
+	if ctx != nil && ctx.Err() != nil {
+		return false
+	}
+	var started *outputStartedError
+	if errors.As(err, &started) {
+		return false
+	}
+
+	if statusCode, ok := errorStatusCode(err); ok {
+		return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	}
+	return isTimeoutError(err)
+}
+
+// writeTracker 记录是否已向writer写入内容，流式请求仅在尚未输出时重试或转移凭证
+type writeTracker struct {
+	w       io.Writer
+	written bool
+	// firstWriteAt 首次写出数据的时间，用于统计首个token耗时
+	firstWriteAt time.Time
+	// onFirstWrite 首次写出数据时调用，可为nil
+	onFirstWrite func()
+}
+
+// Write 实现io.Writer
+func (t *writeTracker) Write(p []byte) (int, error) {
+	if len(p) > 0 && !t.written {
+		t.written = true
+		t.firstWriteAt = time.Now()
+		if t.onFirstWrite != nil {
+			t.onFirstWrite()
+		}
+	}
+	return t.w.Write(p)
+}
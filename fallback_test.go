@@ -0,0 +1,212 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// regionalProvider 测试用的多凭证供应商，按凭证名称返回预设的错误
+type regionalProvider struct {
+	mu       sync.Mutex
+	creds    []AzureCredential
+	failures map[string]error
+	// partial 为true时，流式请求在失败前先输出部分内容
+	partial bool
+	calls   []string
+}
+
+// call 选择凭证并返回该凭证预设的错误
+func (p *regionalProvider) call(req ChatRequest) (string, error) {
+	c := &Config{
+		Vendor:               "regional",
+		onCredentialSelected: req.onCredentialSelected,
+		credentialFallback:   req.credentialFallback,
+		ctx:                  req.ctx,
+	}
+	cred, err := selectConfigCredential(c, "regional:test", p.creds,
+		func(cred AzureCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return "", fmt.Errorf("获取配置失败: %v", err)
+	}
+	c.recordSelectedCredential(cred.Name, cred.Endpoint)
+
+	p.mu.Lock()
+	p.calls = append(p.calls, cred.Name)
+	p.mu.Unlock()
+	return cred.Name, p.failures[cred.Name]
+}
+
+func (p *regionalProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	name, err := p.call(req)
+	if err != nil {
+		return nil, err
+	}
+	return &openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: name},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}, nil
+}
+
+func (p *regionalProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	name, err := p.call(req)
+	if err != nil {
+		if p.partial {
+			fmt.Fprint(writer, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"部分\"}}]}\n\n")
+		}
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\ndata: [DONE]\n\n", name)
+	return err
+}
+
+// registerRegionalProvider 注册三个区域的凭证，只有eastus有正权重，首次总是选中eastus，
+// 故障转移时权重相同的japaneast、westus按名称排序
+func registerRegionalProvider(t *testing.T, failures map[string]error) *regionalProvider {
+	provider := &regionalProvider{
+		creds: []AzureCredential{
+			{Name: "westus", Weight: 0},
+			{Name: "eastus", Weight: 100},
+			{Name: "japaneast", Weight: 0},
+		},
+		failures: failures,
+	}
+	RegisterProvider("regional", provider)
+	t.Cleanup(func() {
+		providerRegistryMu.Lock()
+		defer providerRegistryMu.Unlock()
+		delete(providerRegistry, "regional")
+	})
+	return provider
+}
+
+func newRegionalRequest(fallback bool, maxFallbacks int) ChatRequest {
+	return ChatRequest{
+		Provider: "regional",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+		},
+		FallbackEnabled: fallback,
+		MaxFallbacks:    maxFallbacks,
+	}
+}
+
+// 测试限流时转移到其余凭证
+func TestCredentialFallback(t *testing.T) {
+	throttled := &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"}
+	provider := registerRegionalProvider(t, map[string]error{
+		"eastus":    fmt.Errorf("调用Generate方法失败: %w", throttled),
+		"japaneast": &openai.RequestError{HTTPStatusCode: http.StatusServiceUnavailable},
+	})
+
+	resp, err := CreateChatCompletion(newRegionalRequest(true, 0), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "westus", resp.Choices[0].Message.Content)
+	}
+	assert.Equal(t, []string{"eastus", "japaneast", "westus"}, provider.calls)
+
+	// 未开启时直接返回错误
+	provider.calls = nil
+	_, err = CreateChatCompletion(newRegionalRequest(false, 0), nil)
+	assert.ErrorIs(t, err, throttled)
+	assert.Equal(t, []string{"eastus"}, provider.calls)
+
+	// 最多转移MaxFallbacks次，返回最后一次的错误
+	provider.calls = nil
+	_, err = CreateChatCompletion(newRegionalRequest(true, 1), nil)
+	var requestError *openai.RequestError
+	assert.ErrorAs(t, err, &requestError)
+	assert.Equal(t, []string{"eastus", "japaneast"}, provider.calls)
+}
+
+// 测试全部凭证都失败时返回最后一次调用的错误
+func TestCredentialFallbackExhausted(t *testing.T) {
+	serverError := &openai.APIError{HTTPStatusCode: http.StatusBadGateway, Message: "bad gateway"}
+	provider := registerRegionalProvider(t, map[string]error{
+		"eastus":    serverError,
+		"japaneast": serverError,
+		"westus":    context.DeadlineExceeded,
+	})
+
+	_, err := CreateChatCompletion(newRegionalRequest(true, 0), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrNoFallbackCredential)
+	assert.Equal(t, []string{"eastus", "japaneast", "westus"}, provider.calls)
+}
+
+// 测试不可重试的错误不转移
+func TestCredentialFallbackNonRetryable(t *testing.T) {
+	badRequest := &openai.APIError{HTTPStatusCode: http.StatusBadRequest, Message: "invalid request"}
+	provider := registerRegionalProvider(t, map[string]error{"eastus": badRequest})
+
+	_, err := CreateChatCompletion(newRegionalRequest(true, 0), nil)
+	assert.ErrorIs(t, err, badRequest)
+	assert.Equal(t, []string{"eastus"}, provider.calls)
+}
+
+// 测试流式请求仅在尚未输出内容时转移
+func TestCredentialFallbackStream(t *testing.T) {
+	throttled := &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"}
+	provider := registerRegionalProvider(t, map[string]error{"eastus": throttled})
+
+	req := newRegionalRequest(true, 0)
+	req.Stream = true
+	var buf bytes.Buffer
+	_, err := CreateChatCompletion(req, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "japaneast")
+	assert.Equal(t, []string{"eastus", "japaneast"}, provider.calls)
+
+	// 已输出部分内容后不再转移
+	provider.calls = nil
+	provider.partial = true
+	buf.Reset()
+	_, err = CreateChatCompletion(req, &buf)
+	assert.ErrorIs(t, err, throttled)
+	assert.Contains(t, buf.String(), "部分")
+	assert.Equal(t, []string{"eastus"}, provider.calls)
+}
+
+// 测试可重试错误的判断
+func TestIsFallbackError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"限流", nil, &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}, true},
+		{"服务端错误", nil, fmt.Errorf("调用失败: %w", &openai.APIError{HTTPStatusCode: http.StatusInternalServerError}), true},
+		{"请求错误", nil, &openai.RequestError{HTTPStatusCode: http.StatusGatewayTimeout}, true},
+		{"参数错误", nil, &openai.APIError{HTTPStatusCode: http.StatusBadRequest}, false},
+		{"认证失败", nil, &openai.RequestError{HTTPStatusCode: http.StatusUnauthorized}, false},
+		{"超时", context.Background(), context.DeadlineExceeded, true},
+		{"请求已取消", canceled, &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}, false},
+		{"其他错误", nil, fmt.Errorf("转换消息失败"), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isFallbackError(tt.ctx, tt.err), tt.name)
+	}
+}
+
+// 测试故障转移开关不从请求体解析，客户端无法放大对供应商的调用次数
+func TestFallbackNotParsedFromRequest(t *testing.T) {
+	req, err := ParseChatRequest(strings.NewReader(`{"model":"azure/gpt-4o","fallback_enabled":true,"max_fallbacks":100}`))
+	assert.NoError(t, err)
+	assert.False(t, req.FallbackEnabled)
+	assert.Zero(t, req.MaxFallbacks)
+}
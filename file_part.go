@@ -0,0 +1,290 @@
+package einox
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultFileMIMEType 无法识别文件类型时使用的MIME类型
+const defaultFileMIMEType = "application/octet-stream"
+
+// maxInlineFileBytes 下载远程文件转为内联内容时允许的最大字节数
+const maxInlineFileBytes = 32 << 20
+
+// 音视频无法识别类型时使用的MIME类型
+const (
+	defaultAudioMIMEType = "audio/mpeg"
+	defaultVideoMIMEType = "video/mp4"
+)
+
+// extensionMIMETypes 常见文档和音视频扩展名对应的MIME类型，
+// 标准库内置的映射不含这些类型，系统缺少mime.types时依然能正确识别
+var extensionMIMETypes = map[string]string{
+	".csv":  "text/csv",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".md":   "text/markdown",
+	".txt":  "text/plain",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+var (
+	inlineDocumentProvidersMu sync.RWMutex
+	// inlineDocumentProviders 只接受内联文档（base64）而不接受远程URL的供应商
+	inlineDocumentProviders = map[string]bool{
+		"bedrock": true,
+		"claude":  true,
+	}
+)
+
+// SetInlineDocuments 设置供应商是否要求文档以内联base64的形式发送
+// 开启后，远程URL形式的文件会在发送前下载并编码为data URL
+func SetInlineDocuments(provider string, inline bool) {
+	inlineDocumentProvidersMu.Lock()
+	defer inlineDocumentProvidersMu.Unlock()
+	if !inline {
+		delete(inlineDocumentProviders, provider)
+		return
+	}
+	inlineDocumentProviders[provider] = true
+}
+
+// requiresInlineDocuments 判断供应商是否要求内联文档
+func requiresInlineDocuments(provider string) bool {
+	if provider == "" {
+		provider = "bedrock" // 与CreateChatCompletion的默认供应商保持一致
+	}
+	inlineDocumentProvidersMu.RLock()
+	defer inlineDocumentProvidersMu.RUnlock()
+	return inlineDocumentProviders[provider]
+}
+
+// FilePart 文件类型的消息内容，URL与Data二选一，也用于构造音频和视频内容
+type FilePart struct {
+	URL      string // 远程文件地址或data URL
+	Data     []byte // 文件内容，设置后优先于URL
+	MIMEType string // MIME类型，为空时根据data URL、文件扩展名或内容识别
+	Name     string // 文件名，为空时从URL路径中获取
+}
+
+// MessagePart 转换为可放入消息MultiContent的内容
+// go-openai的消息内容没有文件字段，因此沿用ImageURL字段承载：
+// 文件内容编码为带name参数的data URL，远程URL的文件名和MIME类型放在URL片段中（片段不会发送给服务器）
+func (f FilePart) MessagePart() openai.ChatMessagePart {
+	return f.messagePart(schema.ChatMessagePartTypeFileURL)
+}
+
+// AudioPart 转换为音频类型的消息内容，编码方式与MessagePart相同
+func (f FilePart) AudioPart() openai.ChatMessagePart {
+	return f.messagePart(schema.ChatMessagePartTypeAudioURL)
+}
+
+// VideoPart 转换为视频类型的消息内容，编码方式与MessagePart相同
+func (f FilePart) VideoPart() openai.ChatMessagePart {
+	return f.messagePart(schema.ChatMessagePartTypeVideoURL)
+}
+
+// messagePart 按指定的内容类型构造消息内容
+func (f FilePart) messagePart(partType schema.ChatMessagePartType) openai.ChatMessagePart {
+	var fileURL string
+	if len(f.Data) > 0 {
+		fileURL = buildFileDataURL(f.resolveMIMEType(), f.Name, f.Data)
+	} else {
+		fileURL = f.URL
+		if isURL(fileURL) && (f.Name != "" || f.MIMEType != "") {
+			fragment := url.Values{}
+			if f.Name != "" {
+				fragment.Set("name", f.Name)
+			}
+			if f.MIMEType != "" {
+				fragment.Set("mime_type", f.MIMEType)
+			}
+			fileURL += "#" + fragment.Encode()
+		}
+	}
+	return openai.ChatMessagePart{
+		Type:     openai.ChatMessagePartType(partType),
+		ImageURL: &openai.ChatMessageImageURL{URL: fileURL},
+	}
+}
+
+// parseFilePart 从消息内容中解析文件，是MessagePart的逆过程
+func parseFilePart(part openai.ChatMessagePart) (FilePart, bool) {
+	if part.ImageURL == nil || part.ImageURL.URL == "" {
+		return FilePart{}, false
+	}
+	raw := part.ImageURL.URL
+
+	if strings.HasPrefix(raw, "data:") {
+		header, payload, found := strings.Cut(raw, ",")
+		if !found {
+			return FilePart{}, false
+		}
+		var file FilePart
+		params := strings.Split(strings.TrimPrefix(header, "data:"), ";")
+		file.MIMEType = params[0]
+		isBase64 := false
+		for _, param := range params[1:] {
+			if param == "base64" {
+				isBase64 = true
+				continue
+			}
+			if key, value, ok := strings.Cut(param, "="); ok && key == "name" {
+				file.Name, _ = url.PathUnescape(value)
+			}
+		}
+		if isBase64 {
+			data, err := base64.StdEncoding.DecodeString(payload)
+			if err != nil {
+				return FilePart{}, false
+			}
+			file.Data = data
+		} else {
+			data, err := url.PathUnescape(payload)
+			if err != nil {
+				return FilePart{}, false
+			}
+			file.Data = []byte(data)
+		}
+		file.MIMEType = file.resolveMIMEType()
+		return file, true
+	}
+
+	file := FilePart{URL: raw}
+	if base, fragment, found := strings.Cut(raw, "#"); found && isURL(raw) {
+		file.URL = base
+		if values, err := url.ParseQuery(fragment); err == nil {
+			file.Name = values.Get("name")
+			file.MIMEType = values.Get("mime_type")
+		}
+	}
+	if file.Name == "" {
+		if parsed, err := url.Parse(file.URL); err == nil {
+			if name := path.Base(parsed.Path); name != "." && name != "/" {
+				file.Name = name
+			}
+		}
+	}
+	file.MIMEType = file.resolveMIMEType()
+	return file, true
+}
+
+// resolveMIMEType 依次根据显式设置、文件扩展名和文件内容确定MIME类型
+func (f FilePart) resolveMIMEType() string {
+	if f.MIMEType != "" {
+		return normalizeMIMEType(f.MIMEType)
+	}
+	for _, name := range []string{f.Name, f.URL} {
+		if ext := strings.ToLower(path.Ext(strings.SplitN(name, "?", 2)[0])); ext != "" {
+			if mimeType, ok := extensionMIMETypes[ext]; ok {
+				return mimeType
+			}
+			if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+				return normalizeMIMEType(mimeType)
+			}
+		}
+	}
+	if len(f.Data) > 0 {
+		return normalizeMIMEType(http.DetectContentType(f.Data))
+	}
+	return defaultFileMIMEType
+}
+
+// normalizeMIMEType 去掉MIME类型中的charset等参数
+func normalizeMIMEType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(mimeType, ";")
+		return strings.TrimSpace(mediaType)
+	}
+	return mediaType
+}
+
+// buildFileDataURL 构造base64编码的data URL，name不为空时作为参数写入
+func buildFileDataURL(mimeType, name string, data []byte) string {
+	header := "data:" + mimeType
+	if name != "" {
+		header += ";name=" + url.PathEscape(name)
+	}
+	return header + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// fetchFileURL 下载远程文件，返回文件内容和响应中的Content-Type，测试中可替换
+var fetchFileURL = func(fileURL string) ([]byte, string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fileURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("下载文件失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("下载文件失败，状态码: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxInlineFileBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("读取文件内容失败: %v", err)
+	}
+	if len(data) > maxInlineFileBytes {
+		return nil, "", fmt.Errorf("文件超过%d字节，无法内联发送", maxInlineFileBytes)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// convertMediaPart 将音频或视频内容转换为URL和MIME类型，无法识别类型时使用defaultMIMEType
+// 内联内容编码为data URL，远程URL去掉携带名称和MIME类型的片段后原样保留
+func convertMediaPart(file FilePart, defaultMIMEType string) (string, string) {
+	mimeType := file.resolveMIMEType()
+	if mimeType == defaultFileMIMEType {
+		mimeType = defaultMIMEType
+	}
+	if len(file.Data) > 0 {
+		return buildFileDataURL(mimeType, "", file.Data), mimeType
+	}
+	return file.URL, mimeType
+}
+
+// convertFilePart 将文件转换为schema的文件内容
+// 供应商要求内联文档时，远程文件会被下载并编码为data URL；否则保留原URL
+func convertFilePart(provider string, file FilePart) (*schema.ChatMessageFileURL, error) {
+	if len(file.Data) == 0 && isURL(file.URL) && requiresInlineDocuments(provider) {
+		data, contentType, err := fetchFileURL(file.URL)
+		if err != nil {
+			return nil, err
+		}
+		file.Data = data
+		if file.MIMEType == "" || file.MIMEType == defaultFileMIMEType {
+			file.MIMEType = contentType
+		}
+	}
+
+	mimeType := file.resolveMIMEType()
+	fileURL := file.URL
+	if len(file.Data) > 0 {
+		fileURL = buildFileDataURL(mimeType, "", file.Data)
+	}
+	return &schema.ChatMessageFileURL{
+		URL:      fileURL,
+		MIMEType: mimeType,
+		Name:     file.Name,
+	}, nil
+}
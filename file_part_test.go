@@ -0,0 +1,166 @@
+package einox
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造只包含一个文件的用户消息请求
+func newFilePartRequest(provider string, file FilePart) ChatRequest {
+	return ChatRequest{
+		Provider: provider,
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Messages: []openai.ChatCompletionMessage{{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{
+					{Type: openai.ChatMessagePartTypeText, Text: "总结这个文件"},
+					file.MessagePart(),
+				},
+			}},
+		},
+	}
+}
+
+// 替换文件下载函数，测试结束后恢复
+func stubFetchFileURL(t *testing.T, fetch func(string) ([]byte, string, error)) {
+	original := fetchFileURL
+	fetchFileURL = fetch
+	t.Cleanup(func() { fetchFileURL = original })
+}
+
+// 测试内联的PDF文件保留文件名并识别MIME类型
+func TestConvertPDFFilePart(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n%测试内容\n")
+	req := newFilePartRequest("claude", FilePart{Data: pdf, Name: "报告.pdf"})
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	fileURL := messages[0].MultiContent[1].FileURL
+	if assert.NotNil(t, fileURL) {
+		assert.Equal(t, "application/pdf", fileURL.MIMEType)
+		assert.Equal(t, "报告.pdf", fileURL.Name)
+		assert.Equal(t, "data:application/pdf;base64,"+base64.StdEncoding.EncodeToString(pdf), fileURL.URL)
+	}
+}
+
+// 测试不要求内联的供应商保留CSV文件的远程URL
+func TestConvertCSVFilePartURL(t *testing.T) {
+	stubFetchFileURL(t, func(string) ([]byte, string, error) {
+		t.Fatal("不应下载文件")
+		return nil, "", nil
+	})
+	req := newFilePartRequest("openai", FilePart{URL: "https://example.com/data/sales.csv"})
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	fileURL := messages[0].MultiContent[1].FileURL
+	if assert.NotNil(t, fileURL) {
+		assert.Equal(t, "https://example.com/data/sales.csv", fileURL.URL)
+		assert.Equal(t, "text/csv", fileURL.MIMEType)
+		assert.Equal(t, "sales.csv", fileURL.Name)
+	}
+}
+
+// 测试要求内联的供应商会下载远程CSV文件并编码为base64
+func TestConvertCSVFilePartInline(t *testing.T) {
+	csv := []byte("month,amount\n1,100\n")
+	stubFetchFileURL(t, func(fileURL string) ([]byte, string, error) {
+		assert.Equal(t, "https://example.com/export", fileURL)
+		return csv, "text/plain", nil
+	})
+	req := newFilePartRequest("bedrock", FilePart{URL: "https://example.com/export", Name: "sales.csv", MIMEType: "text/csv"})
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	fileURL := messages[0].MultiContent[1].FileURL
+	if assert.NotNil(t, fileURL) {
+		assert.Equal(t, "data:text/csv;base64,"+base64.StdEncoding.EncodeToString(csv), fileURL.URL)
+		assert.Equal(t, "text/csv", fileURL.MIMEType)
+		assert.Equal(t, "sales.csv", fileURL.Name)
+	}
+}
+
+// 测试下载失败时保留原URL
+func TestConvertFilePartFetchError(t *testing.T) {
+	stubFetchFileURL(t, func(string) ([]byte, string, error) {
+		return nil, "", errors.New("连接超时")
+	})
+	req := newFilePartRequest("claude", FilePart{URL: "https://example.com/a.pdf"})
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	fileURL := messages[0].MultiContent[1].FileURL
+	if assert.NotNil(t, fileURL) {
+		assert.Equal(t, "https://example.com/a.pdf", fileURL.URL)
+		assert.Equal(t, "application/pdf", fileURL.MIMEType)
+		assert.Equal(t, "a.pdf", fileURL.Name)
+	}
+}
+
+// 测试MessagePart与parseFilePart互为逆过程
+func TestFilePartRoundTrip(t *testing.T) {
+	file, ok := parseFilePart(FilePart{Data: []byte("a,b\n"), Name: "my data.csv"}.MessagePart())
+	assert.True(t, ok)
+	assert.Equal(t, "my data.csv", file.Name)
+	assert.Equal(t, "text/csv", file.MIMEType)
+	assert.Equal(t, []byte("a,b\n"), file.Data)
+
+	file, ok = parseFilePart(FilePart{URL: "https://example.com/download?id=1", Name: "x.pdf", MIMEType: "application/pdf"}.MessagePart())
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/download?id=1", file.URL)
+	assert.Equal(t, "x.pdf", file.Name)
+	assert.Equal(t, "application/pdf", file.MIMEType)
+
+	_, ok = parseFilePart(openai.ChatMessagePart{Type: "file_url"})
+	assert.False(t, ok)
+}
+
+// 测试关闭内联后不再下载远程文件
+func TestSetInlineDocuments(t *testing.T) {
+	SetInlineDocuments("claude", false)
+	defer SetInlineDocuments("claude", true)
+	assert.False(t, requiresInlineDocuments("claude"))
+	assert.True(t, requiresInlineDocuments(""))
+}
+
+// 测试音频和视频内容携带各自的URL和MIME类型
+func TestConvertAudioVideoParts(t *testing.T) {
+	wav := append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), make([]byte, 16)...)
+	req := ChatRequest{
+		Provider: "bedrock",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Messages: []openai.ChatCompletionMessage{{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{
+					FilePart{Data: wav, Name: "录音.wav"}.AudioPart(),
+					FilePart{URL: "https://example.com/media/clip.ogg"}.AudioPart(),
+					FilePart{URL: "https://example.com/media/stream", MIMEType: "audio/flac"}.AudioPart(),
+					FilePart{URL: "https://example.com/media/demo.webm"}.VideoPart(),
+					FilePart{URL: "https://example.com/media/unknown"}.VideoPart(),
+				},
+			}},
+		},
+	}
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	parts := messages[0].MultiContent
+
+	assert.Equal(t, "audio/wav", parts[0].AudioURL.MIMEType)
+	assert.Equal(t, "data:audio/wav;base64,"+base64.StdEncoding.EncodeToString(wav), parts[0].AudioURL.URL)
+
+	assert.Equal(t, "https://example.com/media/clip.ogg", parts[1].AudioURL.URL)
+	assert.Equal(t, "audio/ogg", parts[1].AudioURL.MIMEType)
+
+	assert.Equal(t, "https://example.com/media/stream", parts[2].AudioURL.URL, "携带MIME类型的片段不应发送")
+	assert.Equal(t, "audio/flac", parts[2].AudioURL.MIMEType)
+
+	assert.Equal(t, "https://example.com/media/demo.webm", parts[3].VideoURL.URL)
+	assert.Equal(t, "video/webm", parts[3].VideoURL.MIMEType)
+
+	assert.Equal(t, defaultVideoMIMEType, parts[4].VideoURL.MIMEType, "无法识别时使用默认类型")
+}
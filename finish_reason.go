@@ -0,0 +1,54 @@
+package einox
+
+import (
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// normalizeFinishReason 将各供应商的结束原因统一为OpenAI格式
+// 调用了工具的回合统一为tool_calls（如Bedrock/Claude的tool_use），因长度截断时保留length；
+// 无法识别的结束原因原样返回
+func normalizeFinishReason(raw string, hasToolCalls bool) openai.FinishReason {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "tool_calls", "tool_use", "tool_call", "function_call":
+		return openai.FinishReasonToolCalls
+	case "length", "max_tokens":
+		return openai.FinishReasonLength
+	case "content_filter", "safety", "recitation":
+		return openai.FinishReasonContentFilter
+	case "", "stop", "end_turn", "stop_sequence":
+		if hasToolCalls {
+			return openai.FinishReasonToolCalls
+		}
+		if raw == "" {
+			return ""
+		}
+		return openai.FinishReasonStop
+	default:
+		return openai.FinishReason(raw)
+	}
+}
+
+// rawFinishReasonFromMessage 获取模型返回的消息中供应商原始的结束原因
+func rawFinishReasonFromMessage(msg *schema.Message) string {
+	if msg == nil || msg.ResponseMeta == nil {
+		return ""
+	}
+	return msg.ResponseMeta.FinishReason
+}
+
+// recordRawFinishReason 将供应商原始的结束原因通知请求方，便于排查归一化前的值
+func (req ChatRequest) recordRawFinishReason(raw string) {
+	if req.onRawFinishReason != nil && raw != "" {
+		req.onRawFinishReason(raw)
+	}
+}
+
+// recordRawFinishReason 将供应商原始的结束原因通知请求方，便于排查归一化前的值
+func (req ChatCompletionRequest) recordRawFinishReason(raw string) {
+	if req.onRawFinishReason != nil && raw != "" {
+		req.onRawFinishReason(raw)
+	}
+}
@@ -0,0 +1,57 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试各供应商的结束原因统一为OpenAI格式
+func TestNormalizeFinishReason(t *testing.T) {
+	tests := []struct {
+		raw          string
+		hasToolCalls bool
+		want         openai.FinishReason
+	}{
+		{"tool_calls", true, openai.FinishReasonToolCalls},
+		{"tool_use", true, openai.FinishReasonToolCalls},
+		{"tool_use", false, openai.FinishReasonToolCalls},
+		{"TOOL_CALLS", false, openai.FinishReasonToolCalls},
+		{"function_call", false, openai.FinishReasonToolCalls},
+		{"end_turn", false, openai.FinishReasonStop},
+		{"stop_sequence", false, openai.FinishReasonStop},
+		{"stop", true, openai.FinishReasonToolCalls},
+		{"end_turn", true, openai.FinishReasonToolCalls},
+		{"", true, openai.FinishReasonToolCalls},
+		{"", false, ""},
+		{"max_tokens", true, openai.FinishReasonLength},
+		{"length", false, openai.FinishReasonLength},
+		{"content_filter", false, openai.FinishReasonContentFilter},
+		{"refusal", false, "refusal"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, normalizeFinishReason(tt.raw, tt.hasToolCalls), "raw=%q hasToolCalls=%v", tt.raw, tt.hasToolCalls)
+	}
+}
+
+// 测试记录供应商原始的结束原因
+func TestRecordRawFinishReason(t *testing.T) {
+	var raw string
+	req := ChatRequest{onRawFinishReason: func(reason string) { raw = reason }}
+
+	req.recordRawFinishReason(rawFinishReasonFromMessage(&schema.Message{
+		Role:         schema.Assistant,
+		ResponseMeta: &schema.ResponseMeta{FinishReason: "tool_use"},
+	}))
+	assert.Equal(t, "tool_use", raw)
+
+	// 未返回结束原因时不覆盖
+	req.recordRawFinishReason(rawFinishReasonFromMessage(&schema.Message{Role: schema.Assistant}))
+	assert.Equal(t, "tool_use", raw)
+
+	// 未设置回调时不做任何处理
+	assert.NotPanics(t, func() { ChatRequest{}.recordRawFinishReason("end_turn") })
+	assert.NotPanics(t, func() { ChatCompletionRequest{}.recordRawFinishReason("end_turn") })
+}
@@ -0,0 +1,316 @@
+package einox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHealthCacheTTL 健康检查结果的默认缓存时间
+const defaultHealthCacheTTL = 10 * time.Second
+
+// healthProbeTimeout 单个凭证探测的超时时间
+const healthProbeTimeout = 10 * time.Second
+
+// CredentialHealth 单个凭证的健康检查结果
+type CredentialHealth struct {
+	Provider   string        `json:"provider"`        // 供应商
+	Credential string        `json:"credential"`      // 凭证名称
+	Healthy    bool          `json:"healthy"`         // 是否健康
+	Error      string        `json:"error,omitempty"` // 不健康的原因
+	Latency    time.Duration `json:"latency"`         // 探测耗时
+	CheckedAt  time.Time     `json:"checked_at"`      // 探测时间
+	Cached     bool          `json:"cached"`          // 是否为缓存结果
+}
+
+// healthTarget 待探测的凭证
+type healthTarget struct {
+	name  string
+	probe func(ctx context.Context) error
+}
+
+type healthCacheEntry struct {
+	result  CredentialHealth
+	expires time.Time
+}
+
+var (
+	healthCacheMu  sync.Mutex
+	healthCache    = map[string]healthCacheEntry{}
+	healthCacheTTL = defaultHealthCacheTTL
+)
+
+// SetHealthCacheTTL 设置健康检查结果的缓存时间，ttl<=0 表示不缓存
+func SetHealthCacheTTL(ttl time.Duration) {
+	healthCacheMu.Lock()
+	defer healthCacheMu.Unlock()
+	healthCacheTTL = ttl
+}
+
+// CheckProvider 检查供应商当前环境下所有启用凭证的连通性
+// 结果按凭证缓存一段时间（见 SetHealthCacheTTL），避免负载均衡器频繁检查时反复请求供应商；
+// force为true时忽略缓存重新探测。
+// 探测使用各供应商的模型列表接口，不消耗token
+func CheckProvider(ctx context.Context, provider string, force bool) ([]CredentialHealth, error) {
+	targets, err := providerHealthTargets(provider)
+	if err != nil {
+		return nil, err
+	}
+	return checkHealthTargets(ctx, provider+":"+currentEnv(), provider, targets, force), nil
+}
+
+// checkHealthTargets 探测凭证，优先使用未过期的缓存结果
+func checkHealthTargets(ctx context.Context, scope, provider string, targets []healthTarget, force bool) []CredentialHealth {
+	results := make([]CredentialHealth, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		key := scope + ":" + target.name
+		if !force {
+			if cached, ok := cachedHealth(key); ok {
+				results[i] = cached
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, target healthTarget) {
+			defer wg.Done()
+			results[i] = probeHealthTarget(ctx, provider, target)
+			storeHealth(key, results[i])
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// probeHealthTarget 探测单个凭证
+func probeHealthTarget(ctx context.Context, provider string, target healthTarget) CredentialHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := target.probe(ctx)
+	result := CredentialHealth{
+		Provider:   provider,
+		Credential: target.name,
+		Healthy:    err == nil,
+		Latency:    time.Since(start),
+		CheckedAt:  start,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// cachedHealth 获取未过期的缓存结果
+func cachedHealth(key string) (CredentialHealth, bool) {
+	healthCacheMu.Lock()
+	defer healthCacheMu.Unlock()
+	entry, ok := healthCache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return CredentialHealth{}, false
+	}
+	result := entry.result
+	result.Cached = true
+	return result, true
+}
+
+// storeHealth 缓存探测结果
+func storeHealth(key string, result CredentialHealth) {
+	healthCacheMu.Lock()
+	defer healthCacheMu.Unlock()
+	if healthCacheTTL <= 0 {
+		return
+	}
+	healthCache[key] = healthCacheEntry{result: result, expires: time.Now().Add(healthCacheTTL)}
+}
+
+// currentEnv 返回当前环境，未设置时为development
+func currentEnv() string {
+	if ENV == "" {
+		return "development"
+	}
+	return ENV
+}
+
+// providerHealthTargets 读取供应商配置并为每个启用的凭证构造探测
+func providerHealthTargets(provider string) ([]healthTarget, error) {
+	switch provider {
+	case "azure":
+		return loadHealthTargets(provider, func(cred AzureCredential, decrypt func(string) (string, error)) (string, bool, func(context.Context) error) {
+			return cred.Name, cred.Enabled, func(ctx context.Context) error {
+				apiKey, err := decrypt(cred.ApiKey)
+				if err != nil {
+					return err
+				}
+				version := cred.ApiVersion
+				if version == "" {
+					version = "2024-02-01"
+				}
+				endpoint := strings.TrimRight(cred.Endpoint, "/") + "/openai/models?api-version=" + url.QueryEscape(version)
+				return probeHTTP(ctx, endpoint, map[string]string{"api-key": apiKey}, cred.Proxy, cred.TLS)
+			}
+		})
+	case "openai":
+		return loadHealthTargets(provider, func(cred OpenAICredential, decrypt func(string) (string, error)) (string, bool, func(context.Context) error) {
+			return cred.Name, cred.Enabled, func(ctx context.Context) error {
+				apiKey, err := decrypt(cred.ApiKey)
+				if err != nil {
+					return err
+				}
+				baseURL := "https://api.openai.com/v1"
+				if cred.BaseURL != "" {
+					baseURL = cred.BaseURL
+				}
+				headers := map[string]string{"Authorization": "Bearer " + apiKey}
+				if cred.OrganizationID != "" {
+					headers["OpenAI-Organization"] = cred.OrganizationID
+				}
+				return probeHTTP(ctx, strings.TrimRight(baseURL, "/")+"/models", headers, cred.Proxy, cred.TLS)
+			}
+		})
+	case "deepseek":
+		return loadHealthTargets(provider, func(cred DeepSeekCredential, decrypt func(string) (string, error)) (string, bool, func(context.Context) error) {
+			return cred.Name, cred.Enabled, func(ctx context.Context) error {
+				apiKey, err := decrypt(cred.APIKey)
+				if err != nil {
+					return err
+				}
+				baseURL := "https://api.deepseek.com"
+				if cred.BaseURL != "" {
+					baseURL = cred.BaseURL
+				}
+				return probeHTTP(ctx, strings.TrimRight(baseURL, "/")+"/models",
+					map[string]string{"Authorization": "Bearer " + apiKey}, cred.Proxy, CredentialTLS{})
+			}
+		})
+	case "claude":
+		return loadHealthTargets(provider, func(cred ClaudeCredential, decrypt func(string) (string, error)) (string, bool, func(context.Context) error) {
+			return cred.Name, cred.Enabled, func(ctx context.Context) error {
+				apiKey, err := decrypt(cred.APIKey)
+				if err != nil {
+					return err
+				}
+				baseURL := "https://api.anthropic.com"
+				if cred.BaseURL != "" {
+					baseURL = cred.BaseURL
+				}
+				return probeHTTP(ctx, strings.TrimRight(baseURL, "/")+"/v1/models",
+					map[string]string{"x-api-key": apiKey, "anthropic-version": "2023-06-01"}, cred.Proxy, CredentialTLS{})
+			}
+		})
+	case "gemini":
+		return loadHealthTargets(provider, func(cred GeminiCredential, decrypt func(string) (string, error)) (string, bool, func(context.Context) error) {
+			return cred.Name, cred.Enabled, func(ctx context.Context) error {
+				apiKey, err := decrypt(cred.APIKey)
+				if err != nil {
+					return err
+				}
+				baseURL := "https://generativelanguage.googleapis.com"
+				if cred.APIEndpoint != "" {
+					baseURL = cred.APIEndpoint
+				}
+				return probeHTTP(ctx, strings.TrimRight(baseURL, "/")+"/v1beta/models",
+					map[string]string{"x-goog-api-key": apiKey}, cred.Proxy, CredentialTLS{})
+			}
+		})
+	case "qwen":
+		return loadHealthTargets(provider, func(cred QwenCredential, decrypt func(string) (string, error)) (string, bool, func(context.Context) error) {
+			return cred.Name, cred.Enabled, func(ctx context.Context) error {
+				apiKey, err := decrypt(cred.APIKey)
+				if err != nil {
+					return err
+				}
+				baseURL := defaultQwenBaseURL
+				if cred.BaseURL != "" {
+					baseURL = cred.BaseURL
+				}
+				return probeHTTP(ctx, strings.TrimRight(baseURL, "/")+"/models",
+					map[string]string{"Authorization": "Bearer " + apiKey}, cred.Proxy, cred.TLS)
+			}
+		})
+	default:
+		// bedrock需要AWS签名，暂不支持
+		return nil, fmt.Errorf("供应商 %s 暂不支持健康检查", provider)
+	}
+}
+
+// loadHealthTargets 读取供应商配置文件中当前环境启用的凭证
+// describe返回凭证名称、是否启用以及探测函数，decrypt用于解密API密钥
+func loadHealthTargets[T any](provider string,
+	describe func(cred T, decrypt func(string) (string, error)) (string, bool, func(context.Context) error)) ([]healthTarget, error) {
+	if err := LoadLLMConfigPathFromEnv(); err != nil {
+		return nil, fmt.Errorf("读取LLM配置路径失败: %v", err)
+	}
+	config, secrets, err := loadConfigFile[struct {
+		Environments map[string]struct {
+			Credentials []T `yaml:"credentials"`
+		} `yaml:"environments"`
+	}](filepath.Join(LLMConfigPath, provider+".yaml"), provider)
+	if err != nil {
+		return nil, err
+	}
+
+	env := currentEnv()
+	envConfig, ok := config.Environments[env]
+	if !ok {
+		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
+	}
+
+	decrypt, err := cachedDecryptFunc(env, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
+	}
+
+	var targets []healthTarget
+	for _, cred := range envConfig.Credentials {
+		name, enabled, probe := describe(cred, decrypt)
+		if enabled {
+			targets = append(targets, healthTarget{name: name, probe: probe})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
+	}
+	return targets, nil
+}
+
+// probeHTTP 发送GET请求，2xx视为健康
+func probeHTTP(ctx context.Context, endpoint string, headers map[string]string, proxy string, tlsConf CredentialTLS) error {
+	client := &http.Client{}
+	transport, err := newCredentialTransport(proxy, tlsConf)
+	if err != nil {
+		return fmt.Errorf("创建HTTP传输失败: %v", err)
+	}
+	if transport != nil {
+		client.Transport = transport
+		defer transport.CloseIdleConnections()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("创建探测请求失败: %v", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("探测请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("探测请求返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
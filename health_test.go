@@ -0,0 +1,86 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试缓存有效期内的重复检查使用缓存结果，强制检查会重新探测
+func TestCheckHealthTargetsCache(t *testing.T) {
+	SetHealthCacheTTL(time.Minute)
+	defer SetHealthCacheTTL(defaultHealthCacheTTL)
+
+	var probes atomic.Int32
+	targets := []healthTarget{{
+		name: "primary",
+		probe: func(ctx context.Context) error {
+			probes.Add(1)
+			return nil
+		},
+	}}
+	scope := "test-cache:" + t.Name()
+
+	first := checkHealthTargets(context.Background(), scope, "azure", targets, false)
+	assert.Equal(t, int32(1), probes.Load())
+	assert.True(t, first[0].Healthy)
+	assert.False(t, first[0].Cached)
+
+	second := checkHealthTargets(context.Background(), scope, "azure", targets, false)
+	assert.Equal(t, int32(1), probes.Load(), "缓存有效期内不应重新探测")
+	assert.True(t, second[0].Cached)
+	assert.Equal(t, first[0].CheckedAt, second[0].CheckedAt)
+
+	forced := checkHealthTargets(context.Background(), scope, "azure", targets, true)
+	assert.Equal(t, int32(2), probes.Load(), "强制检查应重新探测")
+	assert.False(t, forced[0].Cached)
+}
+
+// 测试缓存过期后重新探测，失败结果也会被缓存
+func TestCheckHealthTargetsExpired(t *testing.T) {
+	SetHealthCacheTTL(20 * time.Millisecond)
+	defer SetHealthCacheTTL(defaultHealthCacheTTL)
+
+	var probes atomic.Int32
+	targets := []healthTarget{{
+		name: "primary",
+		probe: func(ctx context.Context) error {
+			probes.Add(1)
+			return errors.New("连接被拒绝")
+		},
+	}}
+	scope := "test-cache:" + t.Name()
+
+	result := checkHealthTargets(context.Background(), scope, "openai", targets, false)
+	assert.False(t, result[0].Healthy)
+	assert.Equal(t, "连接被拒绝", result[0].Error)
+
+	checkHealthTargets(context.Background(), scope, "openai", targets, false)
+	assert.Equal(t, int32(1), probes.Load())
+
+	time.Sleep(30 * time.Millisecond)
+	checkHealthTargets(context.Background(), scope, "openai", targets, false)
+	assert.Equal(t, int32(2), probes.Load())
+}
+
+// 测试HTTP探测的状态码判断
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, probeHTTP(ctx, server.URL+"/models", map[string]string{"Authorization": "Bearer ok"}, "", CredentialTLS{}))
+	assert.EqualError(t, probeHTTP(ctx, server.URL+"/models", nil, "", CredentialTLS{}), "探测请求返回状态码 401")
+}
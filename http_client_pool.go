@@ -0,0 +1,112 @@
+package einox
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// httpClientKey 共享HTTP客户端的键，供应商、代理、TLS和超时都相同的请求复用同一个客户端
+type httpClientKey struct {
+	provider string
+	proxy    string
+	tls      CredentialTLS
+	timeout  int
+}
+
+// transportKey 共享Transport的键，连接池在代理和TLS配置相同的请求间复用
+type transportKey struct {
+	proxy string
+	tls   CredentialTLS
+}
+
+var (
+	httpClientPoolMu sync.Mutex
+	httpClientPool   = make(map[httpClientKey]*http.Client)
+	transportPool    = make(map[transportKey]*http.Transport)
+)
+
+// sharedCredentialTransport 返回代理和TLS配置对应的共享Transport
+// 只用于凭证配置中的代理和TLS，取值有限，池中的Transport不会淘汰；请求级代理使用newRequestHTTPClient
+// 两者都未配置时返回nil，表示使用http.DefaultTransport；证书文件在首次创建时读取，之后修改需重启生效
+func sharedCredentialTransport(proxy string, tlsConf CredentialTLS) (*http.Transport, error) {
+	if proxy == "" && tlsConf.IsEmpty() {
+		return nil, nil
+	}
+	key := transportKey{proxy: proxy, tls: tlsConf}
+
+	httpClientPoolMu.Lock()
+	defer httpClientPoolMu.Unlock()
+	if transport, ok := transportPool[key]; ok {
+		return transport, nil
+	}
+	transport, err := newCredentialTransport(proxy, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	transportPool[key] = transport
+	return transport, nil
+}
+
+// newRequestHTTPClient 返回使用请求级代理的HTTP客户端，不放入连接池
+// 请求指定的代理不受凭证配置约束，放入连接池会使池无限增长；Transport禁用长连接，调用结束后不保留空闲连接。
+// base不为nil时复制base的设置，不修改base
+func newRequestHTTPClient(provider string, base *http.Client, proxy string, tlsConf CredentialTLS, timeoutSeconds int) (*http.Client, error) {
+	transport, err := newCredentialTransport(proxy, tlsConf)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP传输失败: %v", err)
+	}
+	transport.DisableKeepAlives = true
+
+	client := &http.Client{}
+	if base != nil {
+		copied := *base
+		client = &copied
+	}
+	client.Transport = newConnTraceTransport(provider, transport)
+	if timeoutSeconds > 0 {
+		client.Timeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	return client, nil
+}
+
+// newCallHTTPClient 返回一次调用使用的HTTP客户端，Transport已包装连接统计
+// base为nil时返回池中共享的客户端，调用方不能修改；base不为nil时复制base的设置，
+// 配置了代理或TLS时使用共享的Transport，否则沿用base的Transport，不修改base
+func newCallHTTPClient(provider string, base *http.Client, proxy string, tlsConf CredentialTLS, timeoutSeconds int) (*http.Client, error) {
+	transport, err := sharedCredentialTransport(proxy, tlsConf)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP传输失败: %v", err)
+	}
+
+	if base != nil {
+		client := *base
+		if transport != nil {
+			client.Transport = transport
+		}
+		client.Transport = newConnTraceTransport(provider, client.Transport)
+		if timeoutSeconds > 0 {
+			client.Timeout = time.Duration(timeoutSeconds) * time.Second
+		}
+		return &client, nil
+	}
+
+	key := httpClientKey{provider: provider, proxy: proxy, tls: tlsConf, timeout: timeoutSeconds}
+	httpClientPoolMu.Lock()
+	defer httpClientPoolMu.Unlock()
+	if client, ok := httpClientPool[key]; ok {
+		return client, nil
+	}
+	// transport为nil时newConnTraceTransport使用http.DefaultTransport
+	var roundTripper http.RoundTripper
+	if transport != nil {
+		roundTripper = transport
+	}
+	client := &http.Client{Transport: newConnTraceTransport(provider, roundTripper)}
+	if timeoutSeconds > 0 {
+		client.Timeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	httpClientPool[key] = client
+	return client, nil
+}
@@ -0,0 +1,92 @@
+package einox
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试相同供应商、代理、TLS和超时的调用复用同一个HTTP客户端
+func TestNewCallHTTPClientPooled(t *testing.T) {
+	first, err := newCallHTTPClient("qwen", nil, "http://pool-a:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	second, err := newCallHTTPClient("qwen", nil, "http://pool-a:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, "http://pool-a:8080", proxyOf(t, first))
+	assert.Equal(t, 30*time.Second, first.Timeout)
+	assert.IsType(t, &connTraceTransport{}, first.Transport, "应统计连接新建与复用情况")
+
+	other, err := newCallHTTPClient("qwen", nil, "http://pool-a:8080", CredentialTLS{}, 60)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, other, "超时不同时使用不同的客户端")
+	assert.Same(t, first.Transport.(*connTraceTransport).base, other.Transport.(*connTraceTransport).base, "代理相同时共享连接池")
+
+	other, err = newCallHTTPClient("qwen", nil, "http://pool-b:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, other)
+	assert.Equal(t, "http://pool-b:8080", proxyOf(t, other))
+
+	direct, err := newCallHTTPClient("qwen", nil, "", CredentialTLS{}, 0)
+	assert.NoError(t, err)
+	assert.Same(t, http.DefaultTransport, direct.Transport.(*connTraceTransport).base, "未配置代理和TLS时使用默认Transport")
+
+	_, err = newCallHTTPClient("qwen", nil, "://bad", CredentialTLS{}, 0)
+	assert.ErrorContains(t, err, "创建HTTP传输失败")
+}
+
+// 测试调用方提供HTTP客户端时复制其设置，不修改调用方的客户端
+func TestNewCallHTTPClientWithBase(t *testing.T) {
+	custom := &http.Transport{}
+	shared := &http.Client{Timeout: 5 * time.Second, Transport: custom}
+
+	client, err := newCallHTTPClient("azure", shared, "", CredentialTLS{}, 0)
+	assert.NoError(t, err)
+	assert.NotSame(t, shared, client)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+	assert.Same(t, custom, client.Transport.(*connTraceTransport).base, "未配置代理和TLS时沿用调用方的Transport")
+
+	client, err = newCallHTTPClient("azure", shared, "http://pool-a:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://pool-a:8080", proxyOf(t, client))
+	assert.Equal(t, 30*time.Second, client.Timeout)
+	assert.Same(t, custom, shared.Transport, "不修改调用方的客户端")
+	assert.Equal(t, 5*time.Second, shared.Timeout)
+
+	again, err := newCallHTTPClient("azure", shared, "http://pool-a:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	assert.Same(t, client.Transport.(*connTraceTransport).base, again.Transport.(*connTraceTransport).base, "复用共享的Transport")
+}
+
+// 测试请求级代理每次创建独立的客户端，不进入连接池且不保留空闲连接
+func TestNewRequestHTTPClientNotPooled(t *testing.T) {
+	httpClientPoolMu.Lock()
+	clients, transports := len(httpClientPool), len(transportPool)
+	httpClientPoolMu.Unlock()
+
+	first, err := (&Config{RequestProxy: "http://debug:8888"}).callHTTPClient("qwen", nil, "http://cred:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	second, err := (&Config{RequestProxy: "http://debug:8888"}).callHTTPClient("qwen", nil, "http://cred:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.Equal(t, "http://debug:8888", proxyOf(t, first))
+	assert.Equal(t, 30*time.Second, first.Timeout)
+	assert.True(t, first.Transport.(*connTraceTransport).base.(*http.Transport).DisableKeepAlives, "不应保留空闲连接")
+
+	httpClientPoolMu.Lock()
+	assert.Equal(t, clients, len(httpClientPool), "请求级代理不应进入连接池")
+	assert.Equal(t, transports, len(transportPool))
+	httpClientPoolMu.Unlock()
+
+	// 未指定请求级代理时使用凭证的代理并复用连接池
+	pooled, err := (&Config{}).callHTTPClient("qwen", nil, "http://cred:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	again, err := newCallHTTPClient("qwen", nil, "http://cred:8080", CredentialTLS{}, 30)
+	assert.NoError(t, err)
+	assert.Same(t, pooled, again)
+
+	_, err = (&Config{RequestProxy: "://bad"}).callHTTPClient("qwen", nil, "", CredentialTLS{}, 0)
+	assert.ErrorContains(t, err, "创建HTTP传输失败")
+}
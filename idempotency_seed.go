@@ -0,0 +1,25 @@
+package einox
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// seedFromIdempotencyKey 由幂等键确定性地计算seed，同一个键总是得到同一个非负seed
+func seedFromIdempotencyKey(key string) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	// 限制在int32范围内，兼容只接受32位seed的供应商
+	return int(h.Sum64() % uint64(math.MaxInt32))
+}
+
+// applyIdempotencySeed 开启DeriveSeedFromIdempotencyKey且请求未显式指定seed时，由幂等键生成seed
+// 同一逻辑请求的重试因此使用相同的seed，在支持确定性输出的模型上得到相同的结果
+func applyIdempotencySeed(req ChatRequest) ChatRequest {
+	if !req.DeriveSeedFromIdempotencyKey || req.IdempotencyKey == "" || req.Seed != nil {
+		return req
+	}
+	seed := seedFromIdempotencyKey(req.IdempotencyKey)
+	req.Seed = &seed
+	return req
+}
@@ -0,0 +1,51 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试同一个幂等键总是得到同一个seed
+func TestSeedFromIdempotencyKey(t *testing.T) {
+	first := seedFromIdempotencyKey("order-20240601-0001")
+	assert.Equal(t, first, seedFromIdempotencyKey("order-20240601-0001"))
+	assert.NotEqual(t, first, seedFromIdempotencyKey("order-20240601-0002"))
+	assert.GreaterOrEqual(t, first, 0)
+}
+
+// 测试仅在开启且未显式指定seed时生成seed
+func TestApplyIdempotencySeed(t *testing.T) {
+	req := ChatRequest{IdempotencyKey: "retry-me", DeriveSeedFromIdempotencyKey: true}
+	derived := applyIdempotencySeed(req)
+	if assert.NotNil(t, derived.Seed) {
+		assert.Equal(t, seedFromIdempotencyKey("retry-me"), *derived.Seed)
+	}
+	retried := applyIdempotencySeed(req)
+	assert.Equal(t, *derived.Seed, *retried.Seed, "重试应使用相同的seed")
+	assert.Nil(t, req.Seed, "不应修改调用方的请求")
+
+	explicit := 42
+	req.Seed = &explicit
+	assert.Equal(t, 42, *applyIdempotencySeed(req).Seed, "显式指定的seed优先")
+
+	assert.Nil(t, applyIdempotencySeed(ChatRequest{IdempotencyKey: "retry-me"}).Seed, "未开启时不生成")
+	assert.Nil(t, applyIdempotencySeed(ChatRequest{DeriveSeedFromIdempotencyKey: true}).Seed, "没有幂等键时不生成")
+}
+
+// 测试发送前的统一处理会生成seed
+func TestPrepareProviderRequestIdempotencySeed(t *testing.T) {
+	req, err := prepareProviderRequest("azure", ChatRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "你好"}},
+		},
+		IdempotencyKey:               "req-1",
+		DeriveSeedFromIdempotencyKey: true,
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, req.Seed) {
+		assert.Equal(t, seedFromIdempotencyKey("req-1"), *req.Seed)
+	}
+}
@@ -0,0 +1,83 @@
+package einox
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// IgnoredToolsHandling 请求绑定了工具但模型直接以文字回答时的处理方式
+type IgnoredToolsHandling string
+
+const (
+	// IgnoredToolsAccept 默认方式，原样返回文字回答
+	IgnoredToolsAccept IgnoredToolsHandling = "accept"
+	// IgnoredToolsReprompt 追加一条要求使用工具的指令后重试一次
+	IgnoredToolsReprompt IgnoredToolsHandling = "reprompt"
+	// IgnoredToolsForce 将tool_choice设置为required后重试一次，强制模型调用工具
+	IgnoredToolsForce IgnoredToolsHandling = "force"
+)
+
+// ignoredToolsInstruction 重试时追加的指令
+const ignoredToolsInstruction = "请调用提供的工具来完成上述请求，不要直接用文字回答。"
+
+// toolsExpected 判断请求是否期望模型调用工具：绑定了工具且tool_choice不为none
+func toolsExpected(req ChatRequest) bool {
+	if len(req.Tools) == 0 {
+		return false
+	}
+	choice, ok := req.ToolChoice.(string)
+	return !ok || choice != "none"
+}
+
+// hasToolCalls 判断响应中是否有工具调用
+func hasToolCalls(resp *openai.ChatCompletionResponse) bool {
+	if resp == nil {
+		return false
+	}
+	for _, choice := range resp.Choices {
+		if len(choice.Message.ToolCalls) > 0 || choice.Message.FunctionCall != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// retryOnIgnoredTools 发起非流式请求，期望调用工具但模型以文字回答时按req.IgnoredToolsHandling重试一次
+// 重试结果替换首次的回复，用量累加；重试失败时返回首次的文字回答
+func retryOnIgnoredTools(req ChatRequest, create func(ChatRequest) (*openai.ChatCompletionResponse, error)) (*openai.ChatCompletionResponse, error) {
+	resp, err := create(req)
+	if err != nil || resp == nil || !toolsExpected(req) || hasToolCalls(resp) {
+		return resp, err
+	}
+
+	// 复制消息列表，避免修改调用方的请求
+	next := req
+	switch req.IgnoredToolsHandling {
+	case IgnoredToolsReprompt:
+		next.Messages = make([]openai.ChatCompletionMessage, len(req.Messages), len(req.Messages)+2)
+		copy(next.Messages, req.Messages)
+		if len(resp.Choices) > 0 && resp.Choices[0].Message.Content != "" {
+			next.Messages = append(next.Messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: resp.Choices[0].Message.Content,
+			})
+		}
+		next.Messages = append(next.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: ignoredToolsInstruction,
+		})
+	case IgnoredToolsForce:
+		next.ToolChoice = "required"
+	default:
+		return resp, nil
+	}
+
+	retried, err := create(next)
+	if err != nil || retried == nil {
+		getLogger().Warn("模型未调用工具，重试失败，返回原回复", "error", err)
+		return resp, nil
+	}
+	retried.Usage.PromptTokens += resp.Usage.PromptTokens
+	retried.Usage.CompletionTokens += resp.Usage.CompletionTokens
+	retried.Usage.TotalTokens += resp.Usage.TotalTokens
+	return retried, nil
+}
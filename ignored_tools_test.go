@@ -0,0 +1,121 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 模拟提供商：第一次以文字回答，之后调用工具
+func newToolIgnoringCreator(calls *[]ChatRequest) func(ChatRequest) (*openai.ChatCompletionResponse, error) {
+	return func(req ChatRequest) (*openai.ChatCompletionResponse, error) {
+		*calls = append(*calls, req)
+		msg := openai.ChatCompletionMessage{Role: "assistant", Content: "北京今天晴。"}
+		finishReason := openai.FinishReasonStop
+		if len(*calls) > 1 {
+			msg = openai.ChatCompletionMessage{
+				Role: "assistant",
+				ToolCalls: []openai.ToolCall{{
+					ID:       "call_1",
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`},
+				}},
+			}
+			finishReason = openai.FinishReasonToolCalls
+		}
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: finishReason}},
+			Usage:   openai.Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25},
+		}, nil
+	}
+}
+
+func newToolRequest(handling IgnoredToolsHandling) ChatRequest {
+	return ChatRequest{
+		Provider: "azure",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "北京天气怎么样"}},
+			Tools: []openai.Tool{{
+				Type:     openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{Name: "get_weather"},
+			}},
+		},
+		IgnoredToolsHandling: handling,
+	}
+}
+
+// 测试追加指令后重试
+func TestRetryOnIgnoredToolsReprompt(t *testing.T) {
+	var calls []ChatRequest
+	req := newToolRequest(IgnoredToolsReprompt)
+	resp, err := retryOnIgnoredTools(req, newToolIgnoringCreator(&calls))
+	assert.NoError(t, err)
+
+	assert.Len(t, calls, 2)
+	retried := calls[1].Messages
+	assert.Len(t, retried, 3)
+	assert.Equal(t, openai.ChatMessageRoleAssistant, retried[1].Role)
+	assert.Equal(t, "北京今天晴。", retried[1].Content)
+	assert.Equal(t, openai.ChatMessageRoleUser, retried[2].Role)
+	assert.Equal(t, ignoredToolsInstruction, retried[2].Content)
+	assert.Len(t, req.Messages, 1, "不应修改调用方的请求")
+
+	assert.Equal(t, "get_weather", resp.Choices[0].Message.ToolCalls[0].Function.Name)
+	assert.Equal(t, 50, resp.Usage.TotalTokens)
+}
+
+// 测试强制调用工具后重试
+func TestRetryOnIgnoredToolsForce(t *testing.T) {
+	var calls []ChatRequest
+	resp, err := retryOnIgnoredTools(newToolRequest(IgnoredToolsForce), newToolIgnoringCreator(&calls))
+	assert.NoError(t, err)
+
+	assert.Len(t, calls, 2)
+	assert.Nil(t, calls[0].ToolChoice)
+	assert.Equal(t, "required", calls[1].ToolChoice)
+	assert.Len(t, calls[1].Messages, 1)
+	assert.True(t, hasToolCalls(resp))
+}
+
+// 测试默认不重试，以及不期望调用工具时不重试
+func TestRetryOnIgnoredToolsSkipped(t *testing.T) {
+	var calls []ChatRequest
+	resp, err := retryOnIgnoredTools(newToolRequest(""), newToolIgnoringCreator(&calls))
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+	assert.Equal(t, "北京今天晴。", resp.Choices[0].Message.Content)
+
+	calls = nil
+	req := newToolRequest(IgnoredToolsForce)
+	req.ToolChoice = "none"
+	_, err = retryOnIgnoredTools(req, newToolIgnoringCreator(&calls))
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+
+	calls = nil
+	req = newToolRequest(IgnoredToolsForce)
+	req.Tools = nil
+	_, err = retryOnIgnoredTools(req, newToolIgnoringCreator(&calls))
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+}
+
+// 测试重试失败时返回首次的回复
+func TestRetryOnIgnoredToolsRetryError(t *testing.T) {
+	calls := 0
+	resp, err := retryOnIgnoredTools(newToolRequest(IgnoredToolsReprompt), func(req ChatRequest) (*openai.ChatCompletionResponse, error) {
+		calls++
+		if calls > 1 {
+			return nil, errors.New("请求超时")
+		}
+		return &openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "直接回答"}}},
+		}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "直接回答", resp.Choices[0].Message.Content)
+}
@@ -0,0 +1,151 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"sync"
+)
+
+// resizeJPEGQuality 缩放后重新编码JPEG时使用的质量
+const resizeJPEGQuality = 90
+
+var (
+	maxImageDimensionsMu sync.RWMutex
+	// maxImageDimensions 各供应商允许的图片最大边长（像素），未配置表示不缩放
+	maxImageDimensions = map[string]int{}
+)
+
+// SetMaxImageDimension 设置供应商允许的图片最大边长（像素）
+// 宽或高超过该值的PNG/JPEG图片会在发送前按比例缩小，maxDimension<=0 表示关闭缩放
+func SetMaxImageDimension(provider string, maxDimension int) {
+	maxImageDimensionsMu.Lock()
+	defer maxImageDimensionsMu.Unlock()
+	if maxDimension <= 0 {
+		delete(maxImageDimensions, provider)
+		return
+	}
+	maxImageDimensions[provider] = maxDimension
+}
+
+// getMaxImageDimension 获取供应商的图片最大边长，未配置时返回0
+func getMaxImageDimension(provider string) int {
+	maxImageDimensionsMu.RLock()
+	defer maxImageDimensionsMu.RUnlock()
+	return maxImageDimensions[provider]
+}
+
+// resizeImageForProvider 按供应商的限制缩放base64图片，未配置限制或无需缩放时原样返回
+func resizeImageForProvider(provider, dataURL, mimeType string) (string, string) {
+	if provider == "" {
+		provider = "bedrock" // 与CreateChatCompletion的默认供应商保持一致
+	}
+	maxDimension := getMaxImageDimension(provider)
+	if maxDimension <= 0 {
+		return dataURL, mimeType
+	}
+
+	resized, resizedMIME, err := resizeImageDataURL(dataURL, maxDimension)
+	if err != nil {
+		getLogger().Warn("缩放图片失败，使用原图", "error", err)
+		return dataURL, mimeType
+	}
+	return resized, resizedMIME
+}
+
+// resizeImageDataURL 将data URL中的图片按比例缩小到最大边长不超过maxDimension
+// 只处理PNG和JPEG，其他格式以及未超过限制的图片原样返回
+func resizeImageDataURL(dataURL string, maxDimension int) (string, string, error) {
+	header, payload, found := strings.Cut(dataURL, ",")
+	if !strings.HasPrefix(dataURL, "data:") || !found || !strings.HasSuffix(header, ";base64") {
+		return "", "", fmt.Errorf("不是base64格式的data URL")
+	}
+	mimeType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+	if mimeType != "image/png" && mimeType != "image/jpeg" {
+		return dataURL, mimeType, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", fmt.Errorf("解码base64图片失败: %v", err)
+	}
+
+	// 先读取尺寸，未超过限制时无需完整解码
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", "", fmt.Errorf("读取图片尺寸失败: %v", err)
+	}
+	if config.Width <= maxDimension && config.Height <= maxDimension {
+		return dataURL, mimeType, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", "", fmt.Errorf("解码图片失败: %v", err)
+	}
+	width, height := scaledSize(config.Width, config.Height, maxDimension)
+	dst := downscaleImage(src, width, height)
+
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&buf, dst)
+		mimeType = "image/png"
+	default:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: resizeJPEGQuality})
+		mimeType = "image/jpeg"
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("编码缩放后的图片失败: %v", err)
+	}
+
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), mimeType, nil
+}
+
+// scaledSize 按比例计算缩放后的尺寸，使最长边等于maxDimension
+func scaledSize(width, height, maxDimension int) (int, int) {
+	if width >= height {
+		return maxDimension, max(1, height*maxDimension/width)
+	}
+	return max(1, width*maxDimension/height), maxDimension
+}
+
+// downscaleImage 使用区域平均将图片缩小到指定尺寸
+func downscaleImage(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcWidth/width)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					count++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / count >> 8),
+				G: uint8(g / count >> 8),
+				B: uint8(b / count >> 8),
+				A: uint8(a / count >> 8),
+			})
+		}
+	}
+	return dst
+}
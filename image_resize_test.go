@@ -0,0 +1,105 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成指定尺寸的测试图片并返回data URL
+func testImageDataURL(t *testing.T, format string, width, height int) string {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if format == "png" {
+		assert.NoError(t, png.Encode(&buf, img))
+	} else {
+		assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	}
+	return "data:image/" + format + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// 解码data URL中的图片尺寸
+func decodeDataURLSize(t *testing.T, dataURL string) (int, int) {
+	_, payload, _ := strings.Cut(dataURL, ",")
+	data, err := base64.StdEncoding.DecodeString(payload)
+	assert.NoError(t, err)
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	return config.Width, config.Height
+}
+
+// 测试超过限制的图片按比例缩小
+func TestResizeImageDataURLOversized(t *testing.T) {
+	for _, format := range []string{"png", "jpeg"} {
+		dataURL := testImageDataURL(t, format, 400, 200)
+
+		resized, mimeType, err := resizeImageDataURL(dataURL, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, "image/"+format, mimeType)
+
+		width, height := decodeDataURLSize(t, resized)
+		assert.Equal(t, 100, width)
+		assert.Equal(t, 50, height, "应保持宽高比")
+	}
+}
+
+// 测试未超过限制的图片保持不变
+func TestResizeImageDataURLSmall(t *testing.T) {
+	dataURL := testImageDataURL(t, "png", 80, 60)
+
+	resized, mimeType, err := resizeImageDataURL(dataURL, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", mimeType)
+	assert.Equal(t, dataURL, resized)
+}
+
+// 测试按供应商配置在消息转换时缩放图片
+func TestConvertMessagesResizesImageForProvider(t *testing.T) {
+	SetMaxImageDimension("azure", 50)
+	defer SetMaxImageDimension("azure", 0)
+
+	req := ChatRequest{
+		Provider: "azure",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: testImageDataURL(t, "png", 100, 200)},
+				}},
+			}},
+		},
+	}
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	part := messages[0].MultiContent[0]
+	assert.Equal(t, schema.ChatMessagePartTypeImageURL, part.Type)
+	width, height := decodeDataURLSize(t, part.ImageURL.URL)
+	assert.Equal(t, 25, width)
+	assert.Equal(t, 50, height)
+
+	// 其他供应商未配置限制，不做缩放
+	req.Provider = "openai"
+	messages, err = convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	width, height = decodeDataURLSize(t, messages[0].MultiContent[0].ImageURL.URL)
+	assert.Equal(t, 100, width)
+	assert.Equal(t, 200, height)
+}
@@ -0,0 +1,51 @@
+package einox
+
+import (
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// LatencyBreakdown 流式请求的耗时分解
+// 由流式处理中的时间戳计算，不依赖提供商返回的计时信息
+type LatencyBreakdown struct {
+	// TimeToFirstToken 从发起请求到收到首个有效输出（文本或工具调用）的耗时，包含排队和首包时间
+	TimeToFirstToken time.Duration `json:"time_to_first_token"`
+	// GenerationTime 从首个有效输出到流结束的耗时
+	GenerationTime time.Duration `json:"generation_time"`
+	// Total 从发起请求到流结束的总耗时
+	Total time.Duration `json:"total"`
+}
+
+// newLatencyBreakdown 根据时间戳计算耗时分解
+// 未收到任何有效输出时，首个token耗时按总耗时计算
+func newLatencyBreakdown(start, firstToken, end time.Time) *LatencyBreakdown {
+	if firstToken.IsZero() {
+		firstToken = end
+	}
+	return &LatencyBreakdown{
+		TimeToFirstToken: firstToken.Sub(start),
+		GenerationTime:   end.Sub(firstToken),
+		Total:            end.Sub(start),
+	}
+}
+
+// hasStreamOutput 判断数据块是否包含有效输出，仅包含角色的数据块不计入
+func hasStreamOutput(chunk *openai.ChatCompletionStreamResponse) bool {
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" || len(choice.Delta.ToolCalls) > 0 || choice.Delta.FunctionCall != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reportLatency 将耗时分解上报到指标回调
+func reportLatency(provider string, latency *LatencyBreakdown) {
+	if latency == nil {
+		return
+	}
+	if hook := getMetricsHook(); hook.OnLatency != nil {
+		hook.OnLatency(provider, *latency)
+	}
+}
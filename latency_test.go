@@ -0,0 +1,63 @@
+package einox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试带延迟的流能计算出首个token耗时和生成耗时，并上报到指标回调
+func TestPumpStreamEventsLatency(t *testing.T) {
+	var reported []LatencyBreakdown
+	SetMetricsHook(MetricsHook{OnLatency: func(provider string, latency LatencyBreakdown) {
+		assert.Equal(t, "azure", provider)
+		reported = append(reported, latency)
+	}})
+	defer SetMetricsHook(MetricsHook{})
+
+	reader, writer := schema.Pipe[*openai.ChatCompletionStreamResponse](3)
+	go func() {
+		defer writer.Close()
+		// 仅含角色的数据块不计为首个token
+		roleChunk := newTestStreamChunk("", "")
+		roleChunk.Choices[0].Delta.Role = openai.ChatMessageRoleAssistant
+		writer.Send(roleChunk, nil)
+		time.Sleep(20 * time.Millisecond)
+		writer.Send(newTestStreamChunk("你", ""), nil)
+		time.Sleep(20 * time.Millisecond)
+		writer.Send(newTestStreamChunk("好", openai.FinishReasonStop), nil)
+	}()
+
+	var done StreamEvent
+	err := consumeStreamWithCallback("azure", reader, time.Now(), 0, func(event StreamEvent) error {
+		if event.Type == StreamEventDone {
+			done = event
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	if assert.NotNil(t, done.Latency) {
+		latency := done.Latency
+		assert.GreaterOrEqual(t, latency.TimeToFirstToken, 20*time.Millisecond)
+		assert.GreaterOrEqual(t, latency.GenerationTime, 20*time.Millisecond)
+		assert.Equal(t, latency.Total, latency.TimeToFirstToken+latency.GenerationTime)
+	}
+	if assert.Len(t, reported, 1) {
+		assert.Equal(t, *done.Latency, reported[0])
+	}
+}
+
+// 测试没有有效输出时首个token耗时按总耗时计算
+func TestNewLatencyBreakdownNoOutput(t *testing.T) {
+	start := time.Now()
+	end := start.Add(time.Second)
+	latency := newLatencyBreakdown(start, time.Time{}, end)
+
+	assert.Equal(t, time.Second, latency.TimeToFirstToken)
+	assert.Equal(t, time.Duration(0), latency.GenerationTime)
+	assert.Equal(t, time.Second, latency.Total)
+}
@@ -3,9 +3,11 @@
 package einox
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
@@ -104,6 +106,46 @@ type Config struct {
 	//代理URl
 	ProxyURL string `yaml:"proxy_url" json:"proxy_url"`
 
+	// ParameterProfiles 命名的参数预设，由请求的ProfileName选择
+	// 不从配置文件读取，统一入口使用SetParameterProfiles注册的预设
+	ParameterProfiles map[string]ParameterProfile `yaml:"-" json:"-"`
+
+	// SelectionKey 凭证选择键，供sticky等策略使用，通常为请求中的用户标识
+	SelectionKey string `yaml:"-" json:"-"`
+
+	// CredentialName 指定使用的凭证名称，设置后跳过凭证选择策略
+	CredentialName string `yaml:"-" json:"-"`
+
+	// DeterministicSelection 为true时按SelectionKey的哈希值确定性地选择凭证
+	DeterministicSelection bool `yaml:"-" json:"-"`
+
+	// RequiredFeatures 请求使用的、需要特定API版本的特性，用于Azure API版本协商
+	RequiredFeatures []string `yaml:"-" json:"-"`
+
+	// RequestProxy 请求指定的代理，设置后优先于凭证配置的代理
+	RequestProxy string `yaml:"-" json:"-"`
+
+	// RequestTimeout 请求指定的超时时间，设置后优先于凭证配置的timeout
+	RequestTimeout time.Duration `yaml:"-" json:"-"`
+
+	// InlineAzureCredential 调用方直接提供的已解密Azure凭证，设置后不读取配置文件也不解密
+	InlineAzureCredential *AzureCredential `yaml:"-" json:"-"`
+
+	// onCredentialSelected 选中凭证后的回调，用于记录实际使用的凭证名称
+	onCredentialSelected func(info CallInfo)
+
+	// concurrencySlots 请求占用的凭证并发槽位，选中凭证后获取
+	concurrencySlots *concurrencySlots
+
+	// credentialFallback 凭证故障转移状态，选择凭证时跳过已失败的凭证
+	credentialFallback *credentialFallback
+
+	// ctx 请求的上下文，用于QPS限制等待时响应取消
+	ctx context.Context
+
+	// callTimeout 选中凭证后确定的调用超时，非流式调用为总超时，流式调用为空闲超时
+	callTimeout time.Duration
+
 	// 厂商可选配置参数
 	VendorOptional *VendorOptional `yaml:"vendor_optional,omitempty" json:"vendor_optional,omitempty"`
 }
@@ -132,6 +174,116 @@ type Config struct {
 //   - 当前支持 "bedrock" 供应商的流式响应，其他供应商正在开发中
 //   - 如未指定供应商，默认使用 "bedrock"
 func CreateChatCompletion(req ChatRequest, writer io.Writer) (*openai.ChatCompletionResponse, error) {
+	return createChatCompletion(req, writer, nil)
+}
+
+// CreateChatCompletionCtx 与CreateChatCompletion相同，使用ctx控制请求的生命周期
+// ctx被取消或超时后，对供应商的调用会被中止，流式响应的处理协程随之结束
+func CreateChatCompletionCtx(ctx context.Context, req ChatRequest, writer io.Writer) (*openai.ChatCompletionResponse, error) {
+	req.ctx = ctx
+	return createChatCompletion(req, writer, nil)
+}
+
+// requestContext 返回请求的上下文，未设置时使用context.Background()
+func requestContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// createChatCompletion CreateChatCompletion的实现，resolved不为nil时记录实际生效的请求配置
+func createChatCompletion(req ChatRequest, writer io.Writer, resolved *ResolvedConfig) (*openai.ChatCompletionResponse, error) {
+	run, err := beginChatCompletion(req, resolved)
+	if err != nil {
+		return nil, err
+	}
+	provider, req := run.provider, run.req
+
+	// 如果是流式响应且writer不为nil
+	if req.Stream && writer != nil {
+		// 登记进行中的流，以便Shutdown时等待或强制结束，强制结束时中止对供应商的调用
+		ctx, cancel := context.WithCancel(requestContext(run.req.ctx))
+		defer cancel()
+		run.req.ctx = ctx
+		stream, err := defaultStreamTracker.track(writer, cancel)
+		if err != nil {
+			run.finish(nil, err)
+			return nil, err
+		}
+		defer defaultStreamTracker.done(stream)
+		// 按请求的输出格式改写帧，放在最内层，预算截断写出的结束帧同样会被改写
+		writer = newStreamFormatWriter(stream, req.StreamFormat)
+		// 按补全token预算截断输出
+		writer = newBudgetWriter(writer, req.CompletionTokenBudget)
+		// 按需在首个内容帧之前补发只携带角色的数据帧
+		writer = newRoleChunkWriter(writer, req.EmitRoleChunk)
+		// 从输出中解析使用情况，流结束后生成使用记录
+		sniffer := newUsageSniffer(writer)
+		writer = sniffer
+
+		tracker := &writeTracker{w: writer, onFirstWrite: func() { run.span.AddEvent(SpanEventFirstToken) }}
+		handler, err := lookupProvider(provider)
+		if err == nil {
+			err = run.stream(func() bool { return tracker.written }, func(ctx context.Context, req ChatRequest) error {
+				err := handler.Stream(ctx, req, tracker)
+				if err != nil && stream.forceClosed() {
+					// 被强制结束时上游返回的是ctx取消的错误
+					return errStreamForceClosed
+				}
+				return err
+			})
+		}
+		if err == nil && sniffer.usage != nil {
+			recordUsage(provider, req.Model, run.credential(), *sniffer.usage, true)
+		}
+		if err == nil {
+			if !tracker.firstWriteAt.IsZero() {
+				reportTimeToFirstToken(provider, req.Model, tracker.firstWriteAt.Sub(run.start))
+			}
+			// 与通道、回调形式的流式接口一致，正常结束时上报耗时分解，首个token按首次写出的时间计算
+			reportLatency(provider, newLatencyBreakdown(run.start, tracker.firstWriteAt, time.Now()))
+		}
+		run.finish(sniffer.usage, err)
+		return nil, err
+	}
+
+	// 非流式响应，开启自动续写时会在因长度截断后继续请求；期望调用工具而模型未调用时按配置重试
+	resp, err := retryOnIgnoredTools(req, func(r ChatRequest) (*openai.ChatCompletionResponse, error) {
+		return continueOnLength(r, func(part ChatRequest) (*openai.ChatCompletionResponse, error) {
+			return createChatCompletionByProvider(provider, part)
+		})
+	})
+	if err == nil {
+		// 空回复检查
+		resp, err = applyEmptyCompletionPolicy(resp, req.ErrorOnEmptyCompletion)
+	}
+	if err == nil && structuredOutputProviders[provider] {
+		// JSON格式输出的校验
+		err = validateStructuredOutput(resp, req.ResponseFormat)
+	}
+	if err != nil {
+		run.finish(nil, err)
+		return nil, err
+	}
+
+	recordUsage(provider, req.Model, run.credential(), resp.Usage, false)
+	run.finish(&resp.Usage, nil)
+	return resp, nil
+}
+
+// chatCompletionRun 一次请求的公共状态，CreateChatCompletion和通道、回调形式的流式接口共用
+type chatCompletionRun struct {
+	provider   string
+	req        ChatRequest // 应用参数预设并整理消息后的请求
+	credential func() string
+	start      time.Time
+	span       Span
+}
+
+// beginChatCompletion 应用参数预设并整理消息，记录请求开始日志并开启请求span
+// resolved不为nil时记录实际生效的请求配置
+func beginChatCompletion(req ChatRequest, resolved *ResolvedConfig) (*chatCompletionRun, error) {
 	// 获取供应商
 	provider := req.Provider
 	if provider == "" {
@@ -140,45 +292,90 @@ func CreateChatCompletion(req ChatRequest, writer io.Writer) (*openai.ChatComple
 		provider = "bedrock" // 暂时默认使用bedrock
 	}
 
-	// 如果是流式响应且writer不为nil
-	if req.Stream && writer != nil {
-		var err error
-		switch provider {
-		case "bedrock":
-			err = BedrockStreamChatCompletionToChat(req, writer)
-		case "azure":
-			err = AzureStreamChatCompletionToChat(req, writer)
-		case "deepseek":
-			err = DeepSeekStreamChatCompletionToChat(req, writer)
-		case "openai":
-			//TODO 未实际测试通过 缺少KEY
-			err = OpenAIStreamChatCompletionToChat(req, writer)
-		case "claude":
-			//TODO 未实际测试通过 缺少KEY
-			err = ClaudeStreamChatCompletionToChat(req, writer)
-			// TODO: 在此处添加其他供应商的流式调用实现
-		default:
-			err = errors.New("不支持的AI供应商: " + provider)
-		}
+	// 应用参数预设、模型默认停止序列，并按需合并系统消息
+	req, err := prepareProviderRequest(provider, req)
+	if err != nil {
 		return nil, err
 	}
+	// Claude/Bedrock的系统提示需单独传递，且要求角色交替
+	req = arrangeAlternatingRoleMessages(provider, req)
+	if resolved != nil {
+		resolved.fill(provider, req)
+	}
+	run := &chatCompletionRun{provider: provider, credential: captureCredential(&req), start: time.Now()}
+	logRequestStart(provider, req)
+	run.span = startRequestSpan(&req, SpanChatCompletion, provider)
+	run.req = req
+	return run, nil
+}
+
+// finish 请求结束时记录日志、上报指标并结束span，usage为nil表示没有获取到token用量
+func (r *chatCompletionRun) finish(usage *openai.Usage, err error) {
+	logRequestDone(r.provider, r.req, r.credential(), r.start, usage, err)
+	reportRequestMetrics(r.provider, r.req.Model, requestOutcome(err), r.start, usage)
+	endSpan(r.span, r.credential(), usage, err)
+}
 
-	// 非流式响应
-	switch provider {
-	case "bedrock":
-		return BedrockCreateChatCompletionToChat(req)
-	case "azure":
-		return AzureCreateChatCompletionToChat(req)
-	case "deepseek":
-		return DeepSeekCreateChatCompletionToChat(req)
-	case "openai":
-		//TODO 未实际测试通过 缺少KEY
-		return OpenAICreateChatCompletionToChat(req)
-	case "claude":
-		//TODO 未实际测试通过 缺少KEY
-		return ClaudeCreateChatCompletionToChat(req)
-		// TODO: 在此处添加其他供应商的非流式调用实现
-	default:
-		return nil, errors.New("不支持的AI供应商: " + provider)
+// stream 发起流式请求，send向供应商发起一次请求并输出，written报告是否已经输出了内容
+// 尚未输出任何内容的流按重试策略重试，开启故障转移时在凭证失败后换用其余凭证重新请求
+func (r *chatCompletionRun) stream(written func() bool, send func(ctx context.Context, req ChatRequest) error) error {
+	_, err := callWithCredentialFallback(r.req, func(req ChatRequest) (struct{}, string, error) {
+		return callWithRetryPolicy(req, func(req ChatRequest) (struct{}, string, error) {
+			// 凭证并发槽位在本次请求的整个流期间占用，结束后释放，重试和故障转移不会被自身占用的槽位阻塞
+			release := withConcurrencySlots(&req)
+			defer release()
+
+			attempt := captureCredential(&req)
+			attemptStart := time.Now()
+			attemptSpan := startRequestSpan(&req, SpanProviderCall, r.provider)
+			err := send(requestContext(req.ctx), req)
+			// 达到预算提前结束属于正常结束
+			if errors.Is(err, errCompletionBudgetReached) {
+				err = nil
+			}
+			logProviderAttempt(r.provider, req, attempt(), attemptStart, err)
+			endSpan(attemptSpan, attempt(), nil, err)
+			ReportCredentialResult(r.provider, attempt(), err)
+			if err != nil && written() {
+				err = &outputStartedError{err: err}
+			}
+			return struct{}{}, attempt(), err
+		})
+	})
+	return err
+}
+
+// createChatCompletionByProvider 根据供应商发起一次非流式请求
+func createChatCompletionByProvider(provider string, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	// 瞬时错误按重试策略重试，开启故障转移时在凭证失败后换用其余凭证重新请求
+	return callWithCredentialFallback(req, func(req ChatRequest) (*openai.ChatCompletionResponse, string, error) {
+		return callWithRetryPolicy(req, func(req ChatRequest) (*openai.ChatCompletionResponse, string, error) {
+			// 每次请求结束后释放凭证并发槽位，续写、重试、故障转移等多次请求不会互相占用
+			release := withConcurrencySlots(&req)
+			defer release()
+
+			// 报告凭证的请求结果，供自适应权重策略使用
+			credential := captureCredential(&req)
+			start := time.Now()
+			span := startRequestSpan(&req, SpanProviderCall, provider)
+			resp, err := callProvider(provider, req)
+			logProviderAttempt(provider, req, credential(), start, err)
+			var usage *openai.Usage
+			if resp != nil {
+				usage = &resp.Usage
+			}
+			endSpan(span, credential(), usage, err)
+			ReportCredentialResult(provider, credential(), err)
+			return resp, credential(), err
+		})
+	})
+}
+
+// callProvider 调用供应商的非流式接口
+func callProvider(provider string, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	handler, err := lookupProvider(provider)
+	if err != nil {
+		return nil, err
 	}
+	return handler.Chat(requestContext(req.ctx), req)
 }
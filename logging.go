@@ -0,0 +1,125 @@
+package einox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	loggerMu sync.RWMutex
+	// logger 通过SetLogger设置的日志记录器，为nil时使用defaultLogger
+	logger *slog.Logger
+)
+
+// SetLogger 设置全局日志记录器，用于排查实际发送给供应商的请求
+// 请求开始、所选凭证和原始调试信息按Debug级别输出，请求完成（耗时、token用量）按Info级别输出，
+// 请求失败和异常按Warn/Error级别输出。传入nil恢复默认行为：只将Warn及以上级别输出到slog.Default()
+func SetLogger(l *slog.Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// getLogger 获取当前的日志记录器
+func getLogger() *slog.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	if logger != nil {
+		return logger
+	}
+	return defaultLogger
+}
+
+// defaultLogger 未设置日志记录器时使用，避免库在每次请求时输出日志
+var defaultLogger = slog.New(minLevelHandler{level: slog.LevelWarn})
+
+// minLevelHandler 只输出不低于level的日志，调用时才获取slog.Default()，以便跟随调用方对默认记录器的修改
+type minLevelHandler struct {
+	level slog.Level
+	// wrap 依次应用到slog.Default()的Handler上的WithAttrs/WithGroup
+	wrap []func(slog.Handler) slog.Handler
+}
+
+// Enabled 实现slog.Handler
+func (h minLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && slog.Default().Handler().Enabled(ctx, level)
+}
+
+// Handle 实现slog.Handler
+func (h minLevelHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := slog.Default().Handler()
+	for _, wrap := range h.wrap {
+		handler = wrap(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+// WithAttrs 实现slog.Handler
+func (h minLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+// WithGroup 实现slog.Handler
+func (h minLevelHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// with 返回追加了wrap的副本
+func (h minLevelHandler) with(wrap func(slog.Handler) slog.Handler) slog.Handler {
+	h.wrap = append(h.wrap[:len(h.wrap):len(h.wrap)], wrap)
+	return h
+}
+
+// logRequestStart 记录请求开始
+func logRequestStart(provider string, req ChatRequest) {
+	getLogger().Debug("开始请求大模型",
+		"provider", provider,
+		"model", req.Model,
+		"stream", req.Stream,
+		"messages", len(req.Messages),
+		"tools", len(req.Tools),
+	)
+}
+
+// logProviderAttempt 记录一次供应商请求的结果，包含所选凭证和耗时
+func logProviderAttempt(provider string, req ChatRequest, credential string, start time.Time, err error) {
+	attrs := []any{
+		"provider", provider,
+		"model", req.Model,
+		"credential", credential,
+		"stream", req.Stream,
+		"latency", time.Since(start),
+	}
+	if err != nil {
+		getLogger().Warn("大模型请求失败", append(attrs, "error", err)...)
+		return
+	}
+	getLogger().Debug("大模型请求成功", attrs...)
+}
+
+// logRequestDone 记录请求完成，usage为nil表示没有获取到token用量
+func logRequestDone(provider string, req ChatRequest, credential string, start time.Time, usage *openai.Usage, err error) {
+	attrs := []any{
+		"provider", provider,
+		"model", req.Model,
+		"credential", credential,
+		"stream", req.Stream,
+		"latency", time.Since(start),
+	}
+	if err != nil {
+		getLogger().Error("大模型请求结束，返回错误", append(attrs, "error", err)...)
+		return
+	}
+	if usage != nil {
+		attrs = append(attrs,
+			"prompt_tokens", usage.PromptTokens,
+			"completion_tokens", usage.CompletionTokens,
+			"total_tokens", usage.TotalTokens,
+		)
+	}
+	getLogger().Info("大模型请求完成", attrs...)
+}
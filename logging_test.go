@@ -0,0 +1,136 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs 设置写入缓冲区的JSON日志记录器，测试结束后恢复默认
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { SetLogger(nil) })
+	return &buf
+}
+
+// parseLogs 解析JSON日志，每行一条
+func parseLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record)) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// usageProvider 返回token用量的测试供应商
+type usageProvider struct{ fakeProvider }
+
+func (p *usageProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	resp, _ := p.fakeProvider.Chat(ctx, req)
+	resp.Usage = openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	return resp, nil
+}
+
+// failingProvider 总是返回错误的测试供应商
+type failingProvider struct{ fakeProvider }
+
+func (p *failingProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	return nil, errors.New("上游不可用")
+}
+
+func (p *failingProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	return errors.New("上游不可用")
+}
+
+// 测试请求开始、供应商请求和请求完成的结构化日志
+func TestRequestLogging(t *testing.T) {
+	buf := captureLogs(t, slog.LevelDebug)
+	RegisterProvider("logging", &usageProvider{})
+	t.Cleanup(func() { unregisterTestProvider("logging") })
+
+	req := ChatRequest{Provider: "logging"}
+	req.Model = "gpt-4o"
+	req.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+	_, err := CreateChatCompletion(req, nil)
+	assert.NoError(t, err)
+
+	records := parseLogs(t, buf)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, "开始请求大模型", records[0]["msg"])
+		assert.Equal(t, "DEBUG", records[0]["level"])
+		assert.Equal(t, "logging", records[0]["provider"])
+		assert.Equal(t, float64(1), records[0]["messages"])
+
+		assert.Equal(t, "大模型请求成功", records[1]["msg"])
+		assert.Contains(t, records[1], "latency")
+		assert.Contains(t, records[1], "credential")
+
+		assert.Equal(t, "大模型请求完成", records[2]["msg"])
+		assert.Equal(t, "INFO", records[2]["level"])
+		assert.Equal(t, "gpt-4o", records[2]["model"])
+		assert.Equal(t, float64(10), records[2]["prompt_tokens"])
+		assert.Equal(t, float64(15), records[2]["total_tokens"])
+	}
+}
+
+// 测试请求失败时记录错误
+func TestRequestLoggingError(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+	RegisterProvider("logging-failing", &failingProvider{})
+	t.Cleanup(func() { unregisterTestProvider("logging-failing") })
+
+	req := ChatRequest{Provider: "logging-failing"}
+	req.Model = "gpt-4o"
+	req.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+	_, err := CreateChatCompletion(req, nil)
+	assert.Error(t, err)
+
+	records := parseLogs(t, buf)
+	if assert.NotEmpty(t, records) {
+		// Debug级别的请求开始日志被过滤
+		assert.Equal(t, "大模型请求失败", records[0]["msg"])
+		assert.Equal(t, "WARN", records[0]["level"])
+		last := records[len(records)-1]
+		assert.Equal(t, "大模型请求结束，返回错误", last["msg"])
+		assert.Equal(t, "ERROR", last["level"])
+		assert.Equal(t, "上游不可用", last["error"])
+	}
+}
+
+// 测试未设置日志记录器时只输出Warn及以上级别
+func TestDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	logger := getLogger().With("provider", "test")
+	logger.Info("不应输出")
+	logger.Debug("不应输出")
+	logger.Warn("应输出")
+
+	assert.NotContains(t, buf.String(), "不应输出")
+	assert.Contains(t, buf.String(), "msg=应输出 provider=test")
+}
+
+// unregisterTestProvider 移除测试注册的供应商
+func unregisterTestProvider(name string) {
+	providerRegistryMu.Lock()
+	defer providerRegistryMu.Unlock()
+	delete(providerRegistry, name)
+}
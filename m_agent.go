@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
@@ -113,7 +112,7 @@ func parseQueryToSteps(query string) ([]AgentStep, error) {
 		// 根据领域查找匹配的智能体
 		agentID, agentName, err := findAgentByDomain(step.Domain)
 		if err != nil {
-			log.Printf("警告: 步骤 %d 无法找到匹配的智能体: %v", step.StepID, err)
+			getLogger().Warn("步骤无法找到匹配的智能体", "step", step.StepID, "error", err)
 			// 使用默认智能体
 			agentID = 1
 			agentName = "通用智能体"
@@ -6,46 +6,63 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
-	"net/http"
-	"net/url"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/sashabaranov/go-openai"
 
 	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/schema"
-	"gopkg.in/yaml.v2"
 )
 
 // 直接使用原始结构体类型
 type AzureCredential struct {
-	Name         string   `yaml:"name"`
-	ApiKey       string   `yaml:"api_key"`
-	Endpoint     string   `yaml:"endpoint"`
-	DeploymentId string   `yaml:"deployment_id"`
-	ApiVersion   string   `yaml:"api_version"`
-	Enabled      bool     `yaml:"enabled"`
-	Weight       int      `yaml:"weight"`
-	QPSLimit     int      `yaml:"qps_limit"`
-	Description  string   `yaml:"description"`
-	Models       []string `yaml:"models"`
-	Timeout      int      `yaml:"timeout"`
-	Proxy        string   `yaml:"proxy"`
+	Name          string        `yaml:"name"`
+	ApiKey        string        `yaml:"api_key"`
+	Endpoint      string        `yaml:"endpoint"`
+	DeploymentId  string        `yaml:"deployment_id"`
+	ApiVersion    string        `yaml:"api_version"`
+	Enabled       bool          `yaml:"enabled"`
+	Weight        int           `yaml:"weight"`
+	QPSLimit      int           `yaml:"qps_limit"`
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	Description   string        `yaml:"description"`
+	Models        []string      `yaml:"models"`
+	Timeout       int           `yaml:"timeout"`
+	Proxy         string        `yaml:"proxy"`
+	TLS           CredentialTLS `yaml:",inline"` // 自定义CA/客户端证书
 }
 
-// 修改配置文件结构定义
-var azureConfig struct {
+// azureConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type azureConfigFile struct {
 	Environments map[string]struct {
 		Credentials []AzureCredential `yaml:"credentials"`
 	} `yaml:"environments"`
 }
 
 // getAzureConfig 获取Azure配置
+// 设置了InlineAzureCredential时直接使用该凭证，不读取配置文件也不解密，
+// 凭证的DeploymentId不为空时作为部署名称代替模型名称
 func (c *Config) getAzureConfig() (*einoopenai.ChatModelConfig, error) {
+	if c.InlineAzureCredential != nil {
+		cred := *c.InlineAzureCredential
+		if cred.DeploymentId != "" {
+			c.Model = cred.DeploymentId
+		}
+		c.recordSelectedCredential(cred.Name, cred.Endpoint)
+		if err := c.waitForQPSLimit(cred.Name, cred.QPSLimit); err != nil {
+			return nil, err
+		}
+		c.recordCallTimeout(cred.Timeout)
+		if err := c.acquireConcurrencySlot(cred.Name, cred.MaxConcurrent); err != nil {
+			return nil, err
+		}
+		return c.newAzureModelConfig(cred)
+	}
+
 	// 使用统一定义的环境变量
 	env := ENV
 	if env == "" {
@@ -59,15 +76,8 @@ func (c *Config) getAzureConfig() (*einoopenai.ChatModelConfig, error) {
 	}
 
 	// 读取Azure配置文件
-	yamlFile, err := os.ReadFile(filepath.Join(LLMConfigPath, "azure.yaml"))
+	azureConfig, secrets, err := loadConfigFile[azureConfigFile](filepath.Join(LLMConfigPath, "azure.yaml"), "Azure")
 	if err != nil {
-		return nil, fmt.Errorf("读取Azure配置文件失败: %v", err)
-	}
-
-	err = yaml.Unmarshal(yamlFile, &azureConfig)
-	if err != nil {
-		fmt.Printf("解析Azure配置文件失败: %v", err)
-		//抛出异常
 		return nil, err
 	}
 
@@ -77,11 +87,18 @@ func (c *Config) getAzureConfig() (*einoopenai.ChatModelConfig, error) {
 		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
 	}
 
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred AzureCredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
 	// 存储启用的配置
 	var enabledCredentials []AzureCredential
 
 	// 遍历该环境下的所有凭证配置
-	for _, cred := range envConfig.Credentials {
+	for _, cred := range credentials {
 		// 只添加启用的配置
 		if cred.Enabled {
 			enabledCredentials = append(enabledCredentials, cred)
@@ -93,63 +110,37 @@ func (c *Config) getAzureConfig() (*einoopenai.ChatModelConfig, error) {
 		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
 	}
 
-	// 根据权重选择配置
-	var selectedCred AzureCredential
-	if len(enabledCredentials) > 1 {
-		// 计算总权重
-		totalWeight := 0
-		for _, cred := range enabledCredentials {
-			totalWeight += cred.Weight
-		}
-
-		// 生成一个随机数,范围是[0, totalWeight)
-		randomNum := rand.Intn(totalWeight)
-
-		// 根据权重选择配置
-		currentWeight := 0
-
-		for _, cred := range enabledCredentials {
-			currentWeight += cred.Weight
-			if randomNum < currentWeight {
-				selectedCred = cred
-				break
-			}
-		}
-	} else {
-		// 如果只有一个配置,直接使用
-		selectedCred = enabledCredentials[0]
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred AzureCredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
 	}
 
-	// 确保微软Azure配置存在
-	if c.VendorOptional == nil {
-		c.VendorOptional = &VendorOptional{}
-	}
-	if c.VendorOptional.AzureConfig == nil {
-		c.VendorOptional.AzureConfig = &AzureConfig{}
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "azure:"+env, enabledCredentials,
+		func(cred AzureCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
 	}
-
-	//判断c.VendorOptional.AzureConfig.HTTPClient 可完善优化
-	if c.VendorOptional.AzureConfig.HTTPClient == nil {
-		c.VendorOptional.AzureConfig.HTTPClient = &http.Client{}
+	// 只校验选中凭证的证书文件，结果在配置文件未变化期间缓存
+	if err := validateCredentialTLS(selectedCred.TLS); err != nil {
+		return nil, fmt.Errorf("凭证 %s 的TLS配置无效: %v", selectedCred.Name, err)
 	}
-
-	//判断代理设置不为空设置代理 可完善优化
-	if selectedCred.Proxy != "" {
-		c.VendorOptional.AzureConfig.HTTPClient.Transport = &http.Transport{
-			Proxy: func(req *http.Request) (*url.URL, error) {
-				return url.Parse(selectedCred.Proxy)
-			},
-		}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.Endpoint)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
 	}
-
-	//selectedCred.Timeout大于0时设置请求超时时间
-	if selectedCred.Timeout > 0 {
-		c.VendorOptional.AzureConfig.HTTPClient.Timeout = time.Duration(selectedCred.Timeout) * time.Second
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
 	}
+	// 按支持的模型列表使用规范的模型名称
+	c.canonicalizeModel(selectedCred.Models)
 
 	//selectedCred.ApiKey 解密
 	// 第一次初始化，应该生成新的密钥文件
-	_, decryptFunc1, err := InitRSAKeyManager()
+	decryptFunc1, err := cachedDecryptFunc(env, secrets)
 	if err != nil {
 		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
 	}
@@ -159,24 +150,41 @@ func (c *Config) getAzureConfig() (*einoopenai.ChatModelConfig, error) {
 	}
 	selectedCred.ApiKey = decryptedApiKey // 更新为解密后的 key
 
+	return c.newAzureModelConfig(selectedCred)
+}
+
+// newAzureModelConfig 使用已解密的凭证创建Azure模型配置
+func (c *Config) newAzureModelConfig(selectedCred AzureCredential) (*einoopenai.ChatModelConfig, error) {
+	// 只读取厂商配置而不写回，多个请求可以并发共享同一个AzureConfig
+	var azureOpts AzureConfig
+	if c.VendorOptional != nil && c.VendorOptional.AzureConfig != nil {
+		azureOpts = *c.VendorOptional.AzureConfig
+	}
+
+	// 代理、TLS和超时相同的请求复用HTTP连接；请求指定的代理优先于凭证的代理，且不进入连接池
+	httpClient, err := c.callHTTPClient("azure", azureOpts.HTTPClient, selectedCred.Proxy, selectedCred.TLS, selectedCred.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
 	nConf := &einoopenai.ChatModelConfig{
 		ByAzure:     true,
 		APIKey:      selectedCred.ApiKey,
 		BaseURL:     selectedCred.Endpoint,
-		APIVersion:  selectedCred.ApiVersion,
+		APIVersion:  negotiateAzureAPIVersion(selectedCred.ApiVersion, c.RequiredFeatures),
 		Model:       c.Model,
 		MaxTokens:   &c.MaxTokens,
 		Temperature: c.Temperature,
 		TopP:        c.TopP,
 		Stop:        c.Stop,
 		// 补充额外参数
-		HTTPClient:       c.VendorOptional.AzureConfig.HTTPClient,
-		PresencePenalty:  c.VendorOptional.AzureConfig.PresencePenalty,
-		FrequencyPenalty: c.VendorOptional.AzureConfig.FrequencyPenalty,
-		LogitBias:        c.VendorOptional.AzureConfig.LogitBias,
-		ResponseFormat:   c.VendorOptional.AzureConfig.ResponseFormat,
-		Seed:             c.VendorOptional.AzureConfig.Seed,
-		User:             c.VendorOptional.AzureConfig.User,
+		HTTPClient:       httpClient,
+		PresencePenalty:  azureOpts.PresencePenalty,
+		FrequencyPenalty: azureOpts.FrequencyPenalty,
+		LogitBias:        azureOpts.LogitBias,
+		ResponseFormat:   azureOpts.ResponseFormat,
+		Seed:             azureOpts.Seed,
+		User:             azureOpts.User,
 	}
 	return nConf, nil
 }
@@ -189,17 +197,30 @@ func convertOpenAIToolsToSchemaTools(tools []openai.Tool) ([]*schema.ToolInfo, e
 
 	schemaTools := make([]*schema.ToolInfo, 0, len(tools))
 	for _, tool := range tools {
-		if tool.Type != openai.ToolTypeFunction || tool.Function == nil {
+		subject := "tool"
+		if tool.Function != nil {
+			subject = "tool " + tool.Function.Name
+		}
+		if _, err := resolveToolType(string(tool.Type), subject); err != nil {
+			return nil, err
+		}
+		if tool.Function == nil {
+			getLogger().Warn("工具没有函数定义，已跳过", "provider", "azure", "type", tool.Type)
 			continue
 		}
 
-		// 创建一个基本的 ToolInfo 实例
 		schemaTool := &schema.ToolInfo{
 			Name: tool.Function.Name,
 			Desc: tool.Function.Description,
-			// 转换参数定义 (这部分需要根据实际情况实现或假设 einoopenai 会处理)
-			// Assuming parameters are handled downstream or this is sufficient for now
-			// ParamsOneOf: ???
+		}
+
+		// 转换参数定义，使模型能看到完整的参数结构
+		paramsSchema, err := toolParametersToOpenAPISchema(tool.Function.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("转换工具 %s 的参数定义失败: %w", tool.Function.Name, err)
+		}
+		if paramsSchema != nil {
+			schemaTool.ParamsOneOf = schema.NewParamsOneOfByOpenAPIV3(paramsSchema)
 		}
 
 		schemaTools = append(schemaTools, schemaTool)
@@ -207,53 +228,244 @@ func convertOpenAIToolsToSchemaTools(tools []openai.Tool) ([]*schema.ToolInfo, e
 	return schemaTools, nil
 }
 
+// toolParametersToOpenAPISchema 将工具的Parameters转换为openapi3.Schema
+// 支持map、JSON字符串/字节以及可序列化为JSON的结构体（如jsonschema.Definition），未设置参数时返回nil
+func toolParametersToOpenAPISchema(parameters any) (*openapi3.Schema, error) {
+	var paramsObj map[string]interface{}
+	switch params := parameters.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		paramsObj = params
+	case string:
+		if err := json.Unmarshal([]byte(params), &paramsObj); err != nil {
+			return nil, fmt.Errorf("工具参数JSON解析失败: %v", err)
+		}
+	case []byte:
+		if err := json.Unmarshal(params, &paramsObj); err != nil {
+			return nil, fmt.Errorf("工具参数JSON解析失败: %v", err)
+		}
+	case json.RawMessage:
+		if err := json.Unmarshal(params, &paramsObj); err != nil {
+			return nil, fmt.Errorf("工具参数JSON解析失败: %v", err)
+		}
+	default:
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("序列化工具参数失败: %v", err)
+		}
+		if err := json.Unmarshal(data, &paramsObj); err != nil {
+			return nil, fmt.Errorf("工具参数格式不支持: %T", parameters)
+		}
+	}
+	if paramsObj == nil {
+		return nil, nil
+	}
+
+	paramsSchema, err := openAPISchemaFromMap(paramsObj)
+	if err != nil {
+		return nil, err
+	}
+	// 参数定义的顶层必须为object
+	if paramsSchema.Type == "" {
+		paramsSchema.Type = openapi3.TypeObject
+	}
+	return paramsSchema, nil
+}
+
+// openAPISchemaFromMap 递归转换JSON Schema，支持嵌套对象、数组items、required、default和enum
+func openAPISchemaFromMap(obj map[string]interface{}) (*openapi3.Schema, error) {
+	result := &openapi3.Schema{}
+
+	if typeVal, ok := obj["type"].(string); ok {
+		result.Type = typeVal
+	}
+	if title, ok := obj["title"].(string); ok {
+		result.Title = title
+	}
+	if desc, ok := obj["description"].(string); ok {
+		result.Description = desc
+	}
+	if format, ok := obj["format"].(string); ok {
+		result.Format = format
+	}
+	if defaultVal, exists := obj["default"]; exists {
+		result.Default = defaultVal
+	}
+	if enum, ok := obj["enum"].([]interface{}); ok {
+		result.Enum = enum
+	}
+	result.Required = getRequiredFields(obj)
+
+	if properties, exists := obj["properties"]; exists {
+		propertiesMap, ok := properties.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("properties字段格式不正确: %T", properties)
+		}
+		result.Properties = make(openapi3.Schemas, len(propertiesMap))
+		for key, val := range propertiesMap {
+			propMap, ok := val.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("属性 %s 格式不正确", key)
+			}
+			propSchema, err := openAPISchemaFromMap(propMap)
+			if err != nil {
+				return nil, fmt.Errorf("属性 %s: %w", key, err)
+			}
+			result.Properties[key] = &openapi3.SchemaRef{Value: propSchema}
+		}
+	}
+
+	if items, exists := obj["items"]; exists {
+		itemsMap, ok := items.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("items字段格式不正确: %T", items)
+		}
+		itemsSchema, err := openAPISchemaFromMap(itemsMap)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		result.Items = &openapi3.SchemaRef{Value: itemsSchema}
+	}
+
+	return result, nil
+}
+
+// toolBinder 支持普通绑定和强制绑定工具的聊天模型
+type toolBinder interface {
+	BindTools(tools []*schema.ToolInfo) error
+	BindForcedTools(tools []*schema.ToolInfo) error
+}
+
+// bindToolsByChoice 根据tool_choice绑定工具
+// "required"/"force"强制调用任一工具；{"type":"function","function":{"name":...}}只强制绑定指定的函数；
+// 其他情况使用普通绑定，由模型决定是否调用
+func bindToolsByChoice(chatModel toolBinder, schemaTools []*schema.ToolInfo, toolChoice any) error {
+	name, err := namedToolChoice(toolChoice)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		for _, tool := range schemaTools {
+			if tool.Name == name {
+				if err := chatModel.BindForcedTools([]*schema.ToolInfo{tool}); err != nil {
+					return fmt.Errorf("强制绑定工具失败: %w", err)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("tool_choice指定的函数 %s 不在tools列表中", name)
+	}
+
+	toolChoiceStr := strings.ToLower(fmt.Sprintf("%v", toolChoice))
+	if toolChoiceStr == "required" || toolChoiceStr == "force" {
+		if err := chatModel.BindForcedTools(schemaTools); err != nil {
+			return fmt.Errorf("强制绑定工具失败: %w", err)
+		}
+		return nil
+	}
+	if err := chatModel.BindTools(schemaTools); err != nil {
+		return fmt.Errorf("绑定工具失败: %w", err)
+	}
+	return nil
+}
+
+// namedToolChoice 解析对象形式的tool_choice，返回指定的函数名称；字符串形式或未设置时返回空字符串
+// 支持openai.ToolChoice及其指针，以及从JSON解码得到的map
+func namedToolChoice(toolChoice any) (string, error) {
+	var choice openai.ToolChoice
+	switch value := toolChoice.(type) {
+	case nil, string:
+		return "", nil
+	case openai.ToolChoice:
+		choice = value
+	case *openai.ToolChoice:
+		if value == nil {
+			return "", nil
+		}
+		choice = *value
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("序列化tool_choice失败: %v", err)
+		}
+		if err := json.Unmarshal(data, &choice); err != nil {
+			return "", fmt.Errorf("tool_choice格式不正确: %s", data)
+		}
+	}
+
+	if choice.Type != "" && choice.Type != openai.ToolTypeFunction {
+		return "", fmt.Errorf("不支持的tool_choice类型: %s", choice.Type)
+	}
+	if choice.Function.Name == "" {
+		return "", fmt.Errorf("tool_choice缺少函数名称")
+	}
+	return choice.Function.Name, nil
+}
+
 // convertSchemaToolCallsToOpenAI 将 schema.ToolCall 转换为 openai.ToolCall
-func convertSchemaToolCallsToOpenAI(schemaCalls []schema.ToolCall) []openai.ToolCall {
+// 一轮中的多个并行工具调用按供应商给出的Index排序（有调用缺少Index时保持原顺序），
+// 并依次分配从0开始的索引，调用方可以按索引对应工具结果
+func convertSchemaToolCallsToOpenAI(schemaCalls []schema.ToolCall) ([]openai.ToolCall, error) {
 	if schemaCalls == nil || len(schemaCalls) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	openAICalls := make([]openai.ToolCall, 0, len(schemaCalls))
-	for _, sc := range schemaCalls {
+	ordered := make([]schema.ToolCall, len(schemaCalls))
+	copy(ordered, schemaCalls)
+	allIndexed := true
+	for _, sc := range ordered {
+		allIndexed = allIndexed && sc.Index != nil
+	}
+	if allIndexed {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return *ordered[i].Index < *ordered[j].Index
+		})
+	}
+
+	openAICalls := make([]openai.ToolCall, 0, len(ordered))
+	for i, sc := range ordered {
 		// 默认使用 function 类型，Eino 中默认也是 "function"
-		toolType := openai.ToolTypeFunction
-		if sc.Type != "function" {
-			fmt.Printf("Warning: Unknown tool type '%s' for ToolCall ID %s, defaulting to 'function'\n", sc.Type, sc.ID)
+		toolType, err := resolveToolType(sc.Type, "ToolCall ID "+sc.ID)
+		if err != nil {
+			return nil, err
 		}
 
+		index := i
 		openAICalls = append(openAICalls, openai.ToolCall{
-			ID:   sc.ID,
-			Type: toolType,
+			Index: &index,
+			ID:    sc.ID,
+			Type:  toolType,
 			Function: openai.FunctionCall{
 				Name:      sc.Function.Name,
 				Arguments: sc.Function.Arguments,
 			},
 		})
 	}
-	return openAICalls
+	return openAICalls, nil
 }
 
 // convertSchemaStreamToolCallsToOpenAI 将 schema.ToolCall 转换为流式 openai.ToolCall
-func convertSchemaStreamToolCallsToOpenAI(schemaCalls []schema.ToolCall) []openai.ToolCall {
+func convertSchemaStreamToolCallsToOpenAI(schemaCalls []schema.ToolCall) ([]openai.ToolCall, error) {
 	if schemaCalls == nil || len(schemaCalls) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	openAICalls := make([]openai.ToolCall, 0, len(schemaCalls))
-	for _, sc := range schemaCalls {
+	for i, sc := range schemaCalls {
 		var localIndex int
 		if sc.Index != nil {
 			localIndex = *sc.Index
 		} else {
-			// 如果 Index 为 nil，可能需要设置一个默认值或根据上下文决定
-			// 对于流式响应，通常需要索引，这里暂时设为 0，可能需要调整
-			localIndex = 0
-			fmt.Printf("Warning: Stream tool call index is nil for ID %s, defaulting to 0\n", sc.ID)
+			// Index 为 nil 时使用在当前数据块中的位置，
+			// 避免同一数据块中的多个工具调用（可能是同名函数）被合并到同一个索引
+			localIndex = i
+			getLogger().Debug("流式工具调用缺少index，使用默认值", "provider", "azure", "id", sc.ID, "index", i)
 		}
 
-		toolType := openai.ToolTypeFunction
-		if sc.Type != "function" {
-			fmt.Printf("Warning: Unknown stream tool type '%s' for ToolCall ID %s, defaulting to 'function'\n", sc.Type, sc.ID)
+		toolType, err := resolveToolType(sc.Type, "stream ToolCall ID "+sc.ID)
+		if err != nil {
+			return nil, err
 		}
 
 		openAICalls = append(openAICalls, openai.ToolCall{
@@ -266,19 +478,31 @@ func convertSchemaStreamToolCallsToOpenAI(schemaCalls []schema.ToolCall) []opena
 			},
 		})
 	}
-	return openAICalls
+	return openAICalls, nil
 }
 
 // AzureCreateChatCompletion 使用Azure OpenAI服务创建聊天完成
 func AzureCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse, error) {
 	// 创建Azure OpenAI配置
 	conf := &Config{
-		Vendor:      "azure",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "azure",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		RequiredFeatures:       requestAPIFeatures(req),
+		RequestProxy:           req.Proxy,
+		RequestTimeout:         req.Timeout,
+
+		InlineAzureCredential: req.AzureCredential,
 	}
 
 	// 获取Azure配置
@@ -286,15 +510,28 @@ func AzureCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse,
 	if err != nil {
 		return nil, fmt.Errorf("获取Azure配置失败: %v", err)
 	}
-	azureConf.Model = req.Model // 将请求中的模型设置到配置中
+	if req.Seed != nil {
+		azureConf.Seed = req.Seed // 请求中的seed优先于厂商配置
+	}
+	penaltiesFromChatRequest(req).applyToOpenAI(azureConf)
+	if err := applyRequestResponseFormat(azureConf, req.ResponseFormat); err != nil {
+		return nil, err
+	}
+
+	return generateWithOpenAIModel(req, "azure", "Azure", azureConf, conf.callTimeout)
+}
 
+// generateWithOpenAIModel 使用OpenAI兼容的模型配置发起非流式请求，Azure与其他OpenAI兼容接口共用
+// vendor用于生成响应ID和工具调用ID，label用于错误信息，timeout为Generate调用的总超时，0表示不限制
+func generateWithOpenAIModel(req ChatRequest, vendor, label string, modelConf *einoopenai.ChatModelConfig, timeout time.Duration) (*openai.ChatCompletionResponse, error) {
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
-	// 创建聊天模型
-	chatModel, err := einoopenai.NewChatModel(ctx, azureConf)
+	// 创建聊天模型，从原始响应体中读取eino-ext未转换的refusal等字段
+	callConf, capture := captureRawResponse(withoutClientTimeout(modelConf, timeout))
+	chatModel, err := einoopenai.NewChatModel(ctx, callConf)
 	if err != nil {
-		return nil, fmt.Errorf("创建聊天模型失败: %v", err)
+		return nil, fmt.Errorf("创建%s聊天模型失败: %v", label, err)
 	}
 
 	// --- 工具绑定逻辑 ---
@@ -308,54 +545,55 @@ func AzureCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse,
 
 		if len(schemaTools) > 0 {
 			// 根据toolChoice决定是否使用强制工具绑定
-			toolChoiceStr := fmt.Sprintf("%v", req.ChatCompletionRequest.ToolChoice) // 确保是字符串
-			if strings.ToLower(toolChoiceStr) == "required" || strings.ToLower(toolChoiceStr) == "force" {
-				err = chatModel.BindForcedTools(schemaTools) // 使用强制工具绑定
-				if err != nil {
-					return nil, fmt.Errorf("强制绑定工具失败: %w", err)
-				}
-			} else {
-				err = chatModel.BindTools(schemaTools) // 使用常规工具绑定 (auto or specific tool)
-				if err != nil {
-					return nil, fmt.Errorf("绑定工具失败: %w", err)
-				}
+			if err := bindToolsByChoice(chatModel, schemaTools, req.ChatCompletionRequest.ToolChoice); err != nil {
+				return nil, err
 			}
 		}
 	}
 	// --- 工具绑定逻辑结束 ---
 
 	// 转换消息格式，使用通用方法
-	schemaMessages := convertChatRequestToSchemaMessages(req)
+	schemaMessages, err := convertChatRequestToSchemaMessages(req)
+	if err != nil {
+		return nil, fmt.Errorf("转换消息失败: %w", err)
+	}
 
-	// 调用Generate方法获取响应
-	resp, err := chatModel.Generate(ctx, schemaMessages)
+	// 调用Generate方法获取响应，上游卡住时超时返回错误
+	generateCtx, cancel := withCallTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := chatModel.Generate(generateCtx, schemaMessages)
 	if err != nil {
-		// 尝试解析 Azure 特定的错误信息
-		var apiError *openai.APIError
-		if errors.As(err, &apiError) {
-			return nil, fmt.Errorf("调用Generate方法失败 (Azure API Error: Status=%d Type=%s Code=%v Param=%v): %w",
-				apiError.HTTPStatusCode, apiError.Type, apiError.Code, apiError.Param, err)
-		}
-		return nil, fmt.Errorf("调用Generate方法失败: %v", err)
+		// 解析API返回的状态码和错误码
+		return nil, fmt.Errorf("调用%s Generate方法失败: %w", label, newProviderError(vendor, err))
 	}
 
 	// --- 处理工具调用响应 ---
+	// 检查 resp 是否包含工具调用信息并进行转换
+	toolCalls, err := convertSchemaToolCallsToOpenAI(resp.ToolCalls)
+	if err != nil {
+		return nil, fmt.Errorf("转换%s工具调用失败: %w", label, err)
+	}
 	choices := []openai.ChatCompletionChoice{
 		{
 			Index: 0,
 			Message: openai.ChatCompletionMessage{
-				Role:    string(resp.Role),
-				Content: resp.Content,
-				// 检查 resp 是否包含工具调用信息并进行转换
-				ToolCalls: convertSchemaToolCallsToOpenAI(resp.ToolCalls),
+				Role:      string(resp.Role),
+				Content:   resp.Content,
+				ToolCalls: toolCalls,
 			},
-			FinishReason: openai.FinishReason(resp.ResponseMeta.FinishReason),
+			// 统一结束原因，调用了工具时为tool_calls
+			FinishReason: normalizeFinishReason(rawFinishReasonFromMessage(resp), len(toolCalls) > 0),
 		},
 	}
+	req.recordRawFinishReason(rawFinishReasonFromMessage(resp))
+	setChoiceRefusal(&choices[0], capture.response().refusal())
 	// --- 工具调用响应处理结束 ---
 
 	// 生成唯一ID
-	uniqueID := fmt.Sprintf("azure-%d", time.Now().UnixNano())
+	uniqueID := fmt.Sprintf("%s-%d", vendor, time.Now().UnixNano())
+
+	// 为缺少ID的工具调用补充ID
+	ensureToolCallIDs(vendor, uniqueID, choices[0].Message.ToolCalls)
 
 	// 获取Token使用情况
 	var usage openai.Usage
@@ -366,7 +604,7 @@ func AzureCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse,
 			TotalTokens:      resp.ResponseMeta.Usage.TotalTokens,
 		}
 	} else {
-		fmt.Println("Info: No usage info found in response meta")
+		getLogger().Debug("响应中没有token用量信息", "provider", "azure")
 	}
 
 	// 构造并返回响应
@@ -377,8 +615,13 @@ func AzureCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse,
 		Model:   req.Model, // 使用请求中的模型名称
 		Choices: choices,   // 使用上面构造的 choices
 		Usage:   usage,
+
+		// 后端配置的标识，与seed一起用于判断输出是否可复现
+		SystemFingerprint: capture.response().systemFingerprint(),
+		// 提示词过滤结果，便于调用方定位触发过滤的输入片段
+		PromptFilterResults: capture.response().promptFilterResults(),
 	}
-	return finalResp, nil
+	return applyRefusalHandling(finalResp, req.RefusalHandling)
 }
 
 // 检查消息中是否包含工具消息
@@ -399,7 +642,7 @@ func AzureCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRes
 	// 准备请求参数
 	model := req.Model
 	if model == "" {
-		return nil, fmt.Errorf("未指定模型名称")
+		return nil, ErrModelNotSpecified
 	}
 
 	// 调用Azure服务 (现在会处理工具调用)
@@ -416,12 +659,24 @@ func AzureCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRes
 func AzureStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
 	// 创建Azure OpenAI配置
 	conf := &Config{
-		Vendor:      "azure",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "azure",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		RequiredFeatures:       requestAPIFeatures(req),
+		RequestProxy:           req.Proxy,
+		RequestTimeout:         req.Timeout,
+
+		InlineAzureCredential: req.AzureCredential,
 	}
 
 	// 获取Azure配置
@@ -429,13 +684,27 @@ func AzureStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.Ch
 	if err != nil {
 		return nil, fmt.Errorf("获取Azure配置失败: %v", err)
 	}
-	azureConf.Model = req.Model // 确保使用请求中的模型
+	if req.Seed != nil {
+		azureConf.Seed = req.Seed // 请求中的seed优先于厂商配置
+	}
+	penaltiesFromChatRequest(req).applyToOpenAI(azureConf)
+	if err := applyRequestResponseFormat(azureConf, req.ResponseFormat); err != nil {
+		return nil, err
+	}
 
+	return streamWithOpenAIModel(req, "azure", "Azure", azureConf, conf.callTimeout)
+}
+
+// streamWithOpenAIModel 使用OpenAI兼容的模型配置发起流式请求，Azure与其他OpenAI兼容接口共用
+// idleTimeout为两个数据块之间的最长等待时间，0表示不限制
+func streamWithOpenAIModel(req ChatRequest, vendor, label string, modelConf *einoopenai.ChatModelConfig,
+	idleTimeout time.Duration) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
-	// 创建聊天模型
-	chatModel, err := einoopenai.NewChatModel(ctx, azureConf)
+	// 创建聊天模型，从原始数据帧中读取eino-ext未转换的提示词过滤结果
+	callConf, capture := captureRawResponse(withoutClientTimeout(modelConf, idleTimeout))
+	chatModel, err := einoopenai.NewChatModel(ctx, callConf)
 	if err != nil {
 		return nil, fmt.Errorf("创建聊天模型失败: %v", err)
 	}
@@ -448,23 +717,41 @@ func AzureStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.Ch
 			return nil, fmt.Errorf("转换工具定义失败: %w", err)
 		}
 		if len(schemaTools) > 0 {
-			err = chatModel.BindTools(schemaTools) // 调用 BindTools
-			if err != nil {
-				return nil, fmt.Errorf("绑定工具失败: %w", err)
+			// 与非流式一致，按toolChoice决定是否强制调用工具
+			if err := bindToolsByChoice(chatModel, schemaTools, req.ChatCompletionRequest.ToolChoice); err != nil {
+				return nil, err
 			}
 		}
 	}
 	// --- 工具绑定逻辑结束 ---
 
 	// 转换消息格式，使用通用方法
-	schemaMessages := convertChatRequestToSchemaMessages(req)
+	schemaMessages, err := convertChatRequestToSchemaMessages(req)
+	if err != nil {
+		return nil, fmt.Errorf("转换消息失败: %w", err)
+	}
 
-	// 调用Stream方法获取流式响应
-	streamReader, err := chatModel.Stream(ctx, schemaMessages)
+	// 调用Stream方法获取流式响应，长时间收不到数据块时超时返回错误
+	streamReader, err := streamWithIdleTimeout(ctx, idleTimeout, func(ctx context.Context) (*schema.StreamReader[*schema.Message], error) {
+		return chatModel.Stream(ctx, schemaMessages)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("调用Stream方法失败: %v", err)
+		return nil, fmt.Errorf("调用Stream方法失败: %w", newProviderError(vendor, err))
 	}
+	// 跳过个别格式错误的数据帧
+	streamReader = skipMalformedStreamFrames(vendor, streamReader)
 
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	return convertOpenAIModelStream(ctx, vendor, label, streamReader, req.Model, includeUsage, capture), nil
+}
+
+// convertOpenAIModelStream 将OpenAI兼容模型的消息流转换为OpenAI格式的流式响应
+// 内容数据块的usage始终为空；includeUsage为true时在流的最后追加一个choices为空、
+// 只包含usage的数据块，与OpenAI的stream_options.include_usage行为一致。
+// ctx取消后立即停止转换，发送取消错误并关闭上下游的流。
+// capture不为nil时，原始数据帧中的提示词过滤结果附加在之后转换的第一个数据块上
+func convertOpenAIModelStream(ctx context.Context, vendor, label string, streamReader *schema.StreamReader[*schema.Message], model string,
+	includeUsage bool, capture *rawResponseCapture) *schema.StreamReader[*openai.ChatCompletionStreamResponse] {
 	// 创建结果通道
 	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](10)
 
@@ -472,52 +759,79 @@ func AzureStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.Ch
 	go func() {
 		defer func() {
 			if panicErr := recover(); panicErr != nil {
-				fmt.Printf("Panic recovered in stream processing goroutine: %v\n", panicErr)
+				getLogger().Error("Azure Stream处理发生异常", "panic", panicErr)
 			}
 			streamReader.Close()
 			resultWriter.Close()
 		}()
 
 		// 生成唯一ID
-		uniqueID := fmt.Sprintf("azure-stream-%d", time.Now().UnixNano())
+		uniqueID := fmt.Sprintf("%s-stream-%d", vendor, time.Now().UnixNano())
 		created := time.Now().Unix()
+		toolCallIDs := newStreamToolCallIDs(vendor, uniqueID)
+		var usage *openai.Usage
+		received := recvWithContext(ctx, streamReader)
 
 		for {
-			// 从流中接收消息
-			message, err := streamReader.Recv()
+			// 从流中接收消息，请求被取消时不再等待上游
+			var message *schema.Message
+			var err error
+			select {
+			case <-ctx.Done():
+				_ = resultWriter.Send(nil, fmt.Errorf("%s流式请求已取消: %w", label, ctx.Err()))
+				return
+			case result := <-received:
+				message, err = result.value, result.err
+			}
 			if errors.Is(err, io.EOF) {
 				break // 流结束
 			}
 			if err != nil {
-				_ = resultWriter.Send(nil, fmt.Errorf("从Azure接收流数据失败: %v", err))
+				_ = resultWriter.Send(nil, fmt.Errorf("从%s接收流数据失败: %w", label, newProviderError(vendor, err)))
 				return
 			}
 
+			// 检查 message 是否包含工具调用信息并进行转换
+			toolCalls, err := convertSchemaStreamToolCallsToOpenAI(message.ToolCalls)
+			if err != nil {
+				_ = resultWriter.Send(nil, fmt.Errorf("转换工具调用失败: %w", err))
+				return
+			}
+			toolCallIDs.fill(toolCalls)
+
+			// 记录使用情况，通常只在最后一个数据块中返回
+			if message.ResponseMeta != nil && message.ResponseMeta.Usage != nil {
+				usage = &openai.Usage{
+					PromptTokens:     message.ResponseMeta.Usage.PromptTokens,
+					CompletionTokens: message.ResponseMeta.Usage.CompletionTokens,
+					TotalTokens:      message.ResponseMeta.Usage.TotalTokens,
+				}
+			}
+
 			// 构造流式响应
 			streamResp := &openai.ChatCompletionStreamResponse{
 				ID:      uniqueID,
 				Object:  "chat.completion.chunk",
 				Created: created,
-				Model:   req.Model, // 使用请求中的模型
+				Model:   model, // 使用请求中的模型
 				Choices: []openai.ChatCompletionStreamChoice{
 					{
 						Index: 0,
 						Delta: openai.ChatCompletionStreamChoiceDelta{
-							Role:    string(message.Role), // Role 可能为空或 "assistant"
-							Content: message.Content,
-							// 检查 message 是否包含工具调用信息并进行转换
-							ToolCalls: convertSchemaStreamToolCallsToOpenAI(message.ToolCalls),
+							Role:      string(message.Role), // Role 可能为空或 "assistant"
+							Content:   message.Content,
+							ToolCalls: toolCalls,
 						},
 						FinishReason: "", // 在最后一条消息中设置
 					},
 				},
-				// 流式响应通常不包含 Usage
+				// 内容数据块不包含 Usage，使用情况在最后单独的数据块中返回
+				PromptFilterResults: capture.takeStreamPromptFilterResults(),
 			}
 
 			// 处理 FinishReason
 			if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
-				finishReason := openai.FinishReason(message.ResponseMeta.FinishReason)
-				streamResp.Choices[0].FinishReason = finishReason
+				streamResp.Choices[0].FinishReason = normalizeFinishReason(message.ResponseMeta.FinishReason, toolCallIDs.hasToolCalls())
 			}
 
 			// 发送流式响应
@@ -526,9 +840,21 @@ func AzureStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.Ch
 				return
 			}
 		}
+
+		// 追加使用情况数据块
+		if includeUsage && usage != nil {
+			_ = resultWriter.Send(&openai.ChatCompletionStreamResponse{
+				ID:      uniqueID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []openai.ChatCompletionStreamChoice{},
+				Usage:   usage,
+			}, nil)
+		}
 	}()
 
-	return resultReader, nil
+	return resultReader
 }
 
 // --- 添加辅助函数 ---
@@ -540,6 +866,16 @@ func AzureStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("调用Azure流式聊天接口失败: %w", err)
 	}
+	return writeOpenAIStreamToChat(req, "Azure", streamReader, writer)
+}
+
+// writeOpenAIStreamToChat 将OpenAI格式的流式响应以SSE格式写入writer，最后写入结束标记
+func writeOpenAIStreamToChat(req ChatRequest, label string, streamReader *schema.StreamReader[*openai.ChatCompletionStreamResponse], writer io.Writer) error {
+	// 提前返回（如请求的上下文被取消）时关闭流，使转换协程及时退出
+	defer streamReader.Close()
+
+	// 按需丢弃重复的连续增量
+	dedupe := newDeltaDeduper(req.DedupeStreamDeltas)
 
 	// 处理流式响应
 	chunkCount := 0
@@ -549,36 +885,42 @@ func AzureStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 			break
 		}
 		if err != nil {
-			// 将错误写入流中，如果 writer 支持的话，或者直接返回错误
-			return fmt.Errorf("接收Azure流式响应失败: %w", err)
+			// 写入错误帧和结束标记后返回，避免客户端收到被截断的流
+			return writeStreamError(writer, fmt.Errorf("接收%s流式响应失败: %w", label, err))
 		}
 
 		// response 已经是 *openai.ChatCompletionStreamResponse 类型，直接序列化
 		if response == nil {
-			fmt.Println("Info: Received nil response from streamReader, skipping.")
+			getLogger().Debug("流中收到空响应，已跳过", "provider", "azure")
 			continue
 		}
 		chunkCount++
 
-		// 将响应写入writer
-		data, err := json.Marshal(response)
-		if err != nil {
-			// 记录错误，但尝试继续处理流
-			fmt.Printf("序列化流式响应失败: %v\n", err)
+		if dedupe.shouldDropOpenAI(response) {
 			continue
 		}
 
-		// 添加data:前缀
-		if _, err := writer.Write([]byte("data: ")); err != nil {
-			return fmt.Errorf("写入流式响应前缀失败: %w", err)
-		}
+		// 将响应写入writer，过大的内容会被拆分为多个帧
+		for _, frame := range splitOpenAIStreamResponse(response, req.MaxSSEFrameBytes) {
+			data, err := json.Marshal(frame)
+			if err != nil {
+				// 记录错误，但尝试继续处理流
+				getLogger().Warn("序列化流式响应失败", "provider", "azure", "error", err)
+				continue
+			}
 
-		if _, err := writer.Write(data); err != nil {
-			return fmt.Errorf("写入流式响应失败: %w", err)
-		}
+			// 添加data:前缀
+			if _, err := writer.Write([]byte("data: ")); err != nil {
+				return fmt.Errorf("写入流式响应前缀失败: %w", err)
+			}
 
-		if _, err := writer.Write([]byte("\n\n")); err != nil {
-			return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			if _, err := writer.Write(data); err != nil {
+				return fmt.Errorf("写入流式响应失败: %w", err)
+			}
+
+			if _, err := writer.Write([]byte("\n\n")); err != nil {
+				return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			}
 		}
 	}
 
@@ -3,12 +3,15 @@ package einox
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/cloudwego/eino/schema"
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/stretchr/testify/assert"
@@ -1000,3 +1003,347 @@ func TestAzureConfig(t *testing.T) {
 		}
 	})
 }
+
+// TestAzureInlineCredential 测试直接提供的凭证不读取配置文件也不解密
+func TestAzureInlineCredential(t *testing.T) {
+	// 配置目录中没有azure.yaml，读取文件时会失败
+	t.Setenv("LLM_CONFIG_PATH", t.TempDir())
+
+	conf := &Config{Vendor: "azure", Model: "gpt-4o", MaxTokens: 100}
+	_, err := conf.getAzureConfig()
+	assert.ErrorContains(t, err, "读取Azure配置文件失败")
+
+	var selected CallInfo
+	conf = &Config{
+		Vendor:    "azure",
+		Model:     "gpt-4o",
+		MaxTokens: 100,
+		InlineAzureCredential: &AzureCredential{
+			Name:         "vault",
+			ApiKey:       "plain-key",
+			Endpoint:     "https://example.openai.azure.com/",
+			DeploymentId: "gpt-4o-prod",
+			ApiVersion:   "2024-06-01",
+		},
+		onCredentialSelected: func(info CallInfo) { selected = info },
+	}
+	azureConf, err := conf.getAzureConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "plain-key", azureConf.APIKey, "直接提供的凭证不应被解密")
+	assert.Equal(t, "https://example.openai.azure.com/", azureConf.BaseURL)
+	assert.Equal(t, "gpt-4o-prod", azureConf.Model, "应使用凭证中的部署名称")
+	assert.Equal(t, "2024-06-01", azureConf.APIVersion)
+	assert.True(t, azureConf.ByAzure)
+	assert.Equal(t, CallInfo{Provider: "azure", Credential: "vault", Endpoint: "https://example.openai.azure.com/"}, selected)
+}
+
+// TestConvertOpenAIToolsToSchemaTools 测试工具参数定义完整传递给模型
+func TestConvertOpenAIToolsToSchemaTools(t *testing.T) {
+	tools := []openai.Tool{
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "create_order",
+				Description: "创建订单",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"customer": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"name":  map[string]interface{}{"type": "string", "description": "客户姓名"},
+								"level": map[string]interface{}{"type": "string", "enum": []interface{}{"normal", "vip"}, "default": "normal"},
+							},
+							"required": []string{"name"},
+						},
+						"items": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"sku":      map[string]interface{}{"type": "string"},
+									"quantity": map[string]interface{}{"type": "integer", "default": 1},
+								},
+								"required": []interface{}{"sku"},
+							},
+						},
+					},
+					"required": []string{"customer", "items"},
+				},
+			},
+		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:       "get_weather",
+				Parameters: `{"type":"object","properties":{"location":{"type":"string"}},"required":["location"]}`,
+			},
+		},
+		{
+			Type:     openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{Name: "ping"},
+		},
+	}
+
+	schemaTools, err := convertOpenAIToolsToSchemaTools(tools)
+	assert.NoError(t, err)
+	assert.Len(t, schemaTools, 3)
+
+	params, err := schemaTools[0].ParamsOneOf.ToOpenAPIV3()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", params.Type)
+	assert.Equal(t, []string{"customer", "items"}, params.Required)
+
+	customer := params.Properties["customer"].Value
+	assert.Equal(t, "object", customer.Type)
+	assert.Equal(t, []string{"name"}, customer.Required)
+	assert.Equal(t, "客户姓名", customer.Properties["name"].Value.Description)
+	assert.Equal(t, "normal", customer.Properties["level"].Value.Default)
+	assert.Equal(t, []interface{}{"normal", "vip"}, customer.Properties["level"].Value.Enum)
+
+	items := params.Properties["items"].Value
+	assert.Equal(t, "array", items.Type)
+	if assert.NotNil(t, items.Items) {
+		assert.Equal(t, []string{"sku"}, items.Items.Value.Required)
+		assert.Equal(t, "integer", items.Items.Value.Properties["quantity"].Value.Type)
+		assert.Equal(t, 1, items.Items.Value.Properties["quantity"].Value.Default)
+	}
+
+	weather, err := schemaTools[1].ParamsOneOf.ToOpenAPIV3()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"location"}, weather.Required)
+	assert.Equal(t, "string", weather.Properties["location"].Value.Type)
+
+	assert.Nil(t, schemaTools[2].ParamsOneOf, "未定义参数的工具不设置参数结构")
+
+	_, err = convertOpenAIToolsToSchemaTools([]openai.Tool{{
+		Type:     openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{Name: "bad", Parameters: `{"properties":"x"}`},
+	}})
+	assert.ErrorContains(t, err, "转换工具 bad 的参数定义失败")
+}
+
+// recordingToolBinder 记录绑定的工具
+type recordingToolBinder struct {
+	tools  []string
+	forced bool
+}
+
+func (b *recordingToolBinder) BindTools(tools []*schema.ToolInfo) error {
+	b.forced = false
+	b.record(tools)
+	return nil
+}
+
+func (b *recordingToolBinder) BindForcedTools(tools []*schema.ToolInfo) error {
+	b.forced = true
+	b.record(tools)
+	return nil
+}
+
+func (b *recordingToolBinder) record(tools []*schema.ToolInfo) {
+	b.tools = nil
+	for _, tool := range tools {
+		b.tools = append(b.tools, tool.Name)
+	}
+}
+
+// TestBindToolsByChoice 测试按tool_choice绑定工具，对象形式只强制绑定指定的函数
+func TestBindToolsByChoice(t *testing.T) {
+	tools := []*schema.ToolInfo{{Name: "get_weather"}, {Name: "get_time"}}
+
+	cases := []struct {
+		name       string
+		toolChoice any
+		wantTools  []string
+		wantForced bool
+	}{
+		{"未设置", nil, []string{"get_weather", "get_time"}, false},
+		{"auto", "auto", []string{"get_weather", "get_time"}, false},
+		{"required", "required", []string{"get_weather", "get_time"}, true},
+		{"结构体", openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: "get_time"}}, []string{"get_time"}, true},
+		{"结构体指针", &openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: "get_weather"}}, []string{"get_weather"}, true},
+		{"JSON对象", map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_time"}}, []string{"get_time"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			binder := &recordingToolBinder{}
+			assert.NoError(t, bindToolsByChoice(binder, tools, tc.toolChoice))
+			assert.Equal(t, tc.wantTools, binder.tools)
+			assert.Equal(t, tc.wantForced, binder.forced)
+		})
+	}
+
+	err := bindToolsByChoice(&recordingToolBinder{}, tools,
+		map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "send_email"}})
+	assert.EqualError(t, err, "tool_choice指定的函数 send_email 不在tools列表中")
+
+	err = bindToolsByChoice(&recordingToolBinder{}, tools, map[string]interface{}{"type": "function"})
+	assert.EqualError(t, err, "tool_choice缺少函数名称")
+}
+
+// TestAzureStreamToolChoice 测试流式请求同样按tool_choice绑定工具
+// 指定的函数不在tools列表中时，在发起请求前即返回错误
+func TestAzureStreamToolChoice(t *testing.T) {
+	req := ChatRequest{
+		Provider: "azure",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Stream:   true,
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "现在几点"}},
+			Tools: []openai.Tool{{
+				Type:     openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{Name: "get_weather"},
+			}},
+			ToolChoice: openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: "get_time"}},
+		},
+		AzureCredential: &AzureCredential{
+			Name:     "inline",
+			ApiKey:   "plain-key",
+			Endpoint: "https://example.openai.azure.com/",
+		},
+	}
+
+	_, err := AzureStreamChatCompletion(req)
+	assert.EqualError(t, err, "tool_choice指定的函数 get_time 不在tools列表中")
+}
+
+// TestConvertAzureStreamUsage 测试请求了include_usage时在流的最后追加使用情况数据块
+func TestConvertAzureStreamUsage(t *testing.T) {
+	newStream := func() *schema.StreamReader[*schema.Message] {
+		return schema.StreamReaderFromArray([]*schema.Message{
+			{Role: schema.Assistant, Content: "你好"},
+			{
+				Role:    schema.Assistant,
+				Content: "！",
+				ResponseMeta: &schema.ResponseMeta{
+					FinishReason: "stop",
+					Usage:        &schema.TokenUsage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+				},
+			},
+		})
+	}
+	collect := func(reader *schema.StreamReader[*openai.ChatCompletionStreamResponse]) []*openai.ChatCompletionStreamResponse {
+		var chunks []*openai.ChatCompletionStreamResponse
+		for {
+			chunk, err := reader.Recv()
+			if err != nil {
+				return chunks
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	chunks := collect(convertOpenAIModelStream(context.Background(), "azure", "Azure", newStream(), "gpt-4o", true, nil))
+	if assert.Len(t, chunks, 3) {
+		for _, chunk := range chunks[:2] {
+			assert.Nil(t, chunk.Usage, "内容数据块不应包含usage")
+		}
+		assert.Equal(t, openai.FinishReasonStop, chunks[1].Choices[0].FinishReason)
+
+		usageChunk := chunks[2]
+		assert.Equal(t, "chat.completion.chunk", usageChunk.Object)
+		assert.Equal(t, chunks[0].ID, usageChunk.ID)
+		assert.Equal(t, "gpt-4o", usageChunk.Model)
+		assert.NotNil(t, usageChunk.Choices)
+		assert.Empty(t, usageChunk.Choices)
+		if assert.NotNil(t, usageChunk.Usage) {
+			assert.Equal(t, 10, usageChunk.Usage.PromptTokens)
+			assert.Equal(t, 2, usageChunk.Usage.CompletionTokens)
+			assert.Equal(t, 12, usageChunk.Usage.TotalTokens)
+		}
+	}
+
+	// 未请求include_usage时不追加
+	chunks = collect(convertOpenAIModelStream(context.Background(), "azure", "Azure", newStream(), "gpt-4o", false, nil))
+	assert.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		assert.Nil(t, chunk.Usage)
+	}
+}
+
+// TestConvertAzureStreamCancel 测试上游没有数据时取消请求，转换协程立即退出并关闭上游
+func TestConvertAzureStreamCancel(t *testing.T) {
+	upstreamReader, upstreamWriter := schema.Pipe[*schema.Message](0)
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := convertOpenAIModelStream(ctx, "azure", "Azure", upstreamReader, "gpt-4o", false, nil)
+
+	cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := reader.Recv()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("取消后应立即返回错误")
+	}
+
+	_, err := reader.Recv()
+	assert.ErrorIs(t, err, io.EOF, "取消错误之后流应结束")
+	// 后台读取协程可能还会取走一条数据，之后上游应视为已关闭
+	assert.Eventually(t, func() bool {
+		return upstreamWriter.Send(&schema.Message{Content: "late"}, nil)
+	}, time.Second, 10*time.Millisecond, "上游流应已关闭")
+}
+
+// TestGetAzureConfigConcurrent 测试并发读取配置文件时互不影响
+func TestGetAzureConfigConcurrent(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("test-key")
+	assert.NoError(t, err)
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: dev-a
+        api_key: %[1]s
+        endpoint: https://a.example.com
+        enabled: true
+        weight: 1
+      - name: dev-b
+        api_key: %[1]s
+        endpoint: https://b.example.com
+        enabled: true
+        weight: 1
+  staging:
+    credentials:
+      - name: staging
+        api_key: %[1]s
+        endpoint: https://staging.example.com
+        enabled: true
+        weight: 1
+`, cipher)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conf, err := (&Config{Model: "gpt-4o"}).getAzureConfig()
+			if err == nil && conf.APIKey != "test-key" {
+				err = fmt.Errorf("解密后的密钥不正确: %s", conf.APIKey)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
@@ -1,15 +1,12 @@
 package einox
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -18,7 +15,6 @@ import (
 
 	"github.com/cloudwego/eino-ext/components/model/claude"
 	"github.com/cloudwego/eino/schema"
-	"gopkg.in/yaml.v2"
 )
 
 // BedrockCredential 定义Bedrock服务的凭证配置结构
@@ -31,14 +27,15 @@ type BedrockCredential struct {
 	Enabled         bool     `yaml:"enabled"`           // 是否启用
 	Weight          int      `yaml:"weight"`            // 权重
 	QPSLimit        int      `yaml:"qps_limit"`         // QPS限制
+	MaxConcurrent   int      `yaml:"max_concurrent"`    // 最大并发请求数，0表示不限制
 	Description     string   `yaml:"description"`       // 描述
 	Models          []string `yaml:"models"`            // 支持的模型列表
 	Timeout         int      `yaml:"timeout"`           // 超时时间
 	Proxy           string   `yaml:"proxy"`             // 代理设置
 }
 
-// 配置文件结构定义
-var bedrockConfig struct {
+// bedrockConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type bedrockConfigFile struct {
 	Environments map[string]struct {
 		Credentials []BedrockCredential `yaml:"credentials"`
 	} `yaml:"environments"`
@@ -58,14 +55,9 @@ func (c *Config) getBedrockConfig() (*claude.Config, error) {
 	}
 
 	// 读取Bedrock配置文件
-	yamlFile, err := os.ReadFile(filepath.Join(LLMConfigPath, "bedrock.yaml"))
+	bedrockConfig, secrets, err := loadConfigFile[bedrockConfigFile](filepath.Join(LLMConfigPath, "bedrock.yaml"), "Bedrock")
 	if err != nil {
-		return nil, fmt.Errorf("读取Bedrock配置文件失败: %v", err)
-	}
-
-	err = yaml.Unmarshal(yamlFile, &bedrockConfig)
-	if err != nil {
-		return nil, fmt.Errorf("解析Bedrock配置文件失败: %v", err)
+		return nil, err
 	}
 
 	// 获取指定环境的配置
@@ -74,11 +66,18 @@ func (c *Config) getBedrockConfig() (*claude.Config, error) {
 		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
 	}
 
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred BedrockCredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
 	// 存储启用的配置
 	var enabledCredentials []BedrockCredential
 
 	// 遍历该环境下的所有凭证配置
-	for _, cred := range envConfig.Credentials {
+	for _, cred := range credentials {
 		// 只添加启用的配置
 		if cred.Enabled {
 			enabledCredentials = append(enabledCredentials, cred)
@@ -90,35 +89,32 @@ func (c *Config) getBedrockConfig() (*claude.Config, error) {
 		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
 	}
 
-	// 根据权重选择配置
-	var selectedCred BedrockCredential
-	if len(enabledCredentials) > 1 {
-		// 计算总权重
-		totalWeight := 0
-		for _, cred := range enabledCredentials {
-			totalWeight += cred.Weight
-		}
-
-		// 生成一个随机数,范围是[0, totalWeight)
-		randomNum := rand.Intn(totalWeight)
-
-		// 根据权重选择配置
-		currentWeight := 0
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred BedrockCredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
+	}
 
-		for _, cred := range enabledCredentials {
-			currentWeight += cred.Weight
-			if randomNum < currentWeight {
-				selectedCred = cred
-				break
-			}
-		}
-	} else {
-		// 如果只有一个配置,直接使用
-		selectedCred = enabledCredentials[0]
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "bedrock:"+env, enabledCredentials,
+		func(cred BedrockCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
+	}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.Region)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
+	}
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
 	}
+	// 按支持的模型列表使用规范的模型名称
+	c.canonicalizeModel(selectedCred.Models)
 
 	// 解密凭证
-	_, decryptFunc, err := InitRSAKeyManager()
+	decryptFunc, err := cachedDecryptFunc(env, secrets)
 	if err != nil {
 		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
 	}
@@ -202,7 +198,7 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 	model := req.Model
 	if model == "" {
 		// 如果没有指定模型，可以设置一个默认值或返回错误
-		return nil, fmt.Errorf("未指定模型名称")
+		return nil, ErrModelNotSpecified
 	}
 
 	// 创建Bedrock配置
@@ -210,12 +206,19 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 	topP := float32(req.TopP)
 
 	conf := &Config{
-		Vendor:      "bedrock",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &temperature,
-		TopP:        &topP,
-		Stop:        req.Stop,
+		Vendor:                 "bedrock",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &temperature,
+		TopP:                   &topP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取Bedrock配置
@@ -225,7 +228,7 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
 	chatModel, err := claude.NewChatModel(ctx, bedrockConf)
@@ -234,7 +237,10 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 	}
 
 	// 转换消息格式，使用公共方法
-	schemaMessages := convertChatRequestToSchemaMessages(req)
+	schemaMessages, err := convertChatRequestToSchemaMessages(req)
+	if err != nil {
+		return nil, fmt.Errorf("转换消息失败: %w", err)
+	}
 
 	// 处理工具调用
 	if req.Tools != nil && len(req.Tools) > 0 {
@@ -254,7 +260,7 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 	// 调用Generate方法获取响应
 	resp, err := chatModel.Generate(ctx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Generate方法失败: %v", err)
+		return nil, fmt.Errorf("调用Generate方法失败: %w", newProviderError("bedrock", err))
 	}
 
 	// 构造ChatCompletionChoice
@@ -265,9 +271,11 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 				Role:    string(resp.Role),
 				Content: resp.Content,
 			},
-			FinishReason: openai.FinishReason(resp.ResponseMeta.FinishReason),
+			// Bedrock调用工具时返回tool_use，统一为tool_calls
+			FinishReason: normalizeFinishReason(rawFinishReasonFromMessage(resp), len(resp.ToolCalls) > 0),
 		},
 	}
+	req.recordRawFinishReason(rawFinishReasonFromMessage(resp))
 
 	// 处理工具调用，将Bedrock的工具调用映射到OpenAI格式
 	if resp.ToolCalls != nil && len(resp.ToolCalls) > 0 {
@@ -296,6 +304,9 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 	// 生成唯一ID
 	uniqueID := fmt.Sprintf("bedrock-%d", time.Now().UnixNano())
 
+	// 为缺少ID的工具调用补充ID
+	ensureToolCallIDs("bedrock", uniqueID, choices[0].Message.ToolCalls)
+
 	// 获取Token使用情况
 	var usage openai.Usage
 	if resp.ResponseMeta != nil && resp.ResponseMeta.Usage != nil {
@@ -323,12 +334,19 @@ func BedrockCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionR
 func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
 	// 创建Bedrock配置
 	conf := &Config{
-		Vendor:      "bedrock",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "bedrock",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取Bedrock配置
@@ -338,7 +356,7 @@ func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.
 	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
 	chatModel, err := claude.NewChatModel(ctx, bedrockConf)
@@ -347,7 +365,10 @@ func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.
 	}
 
 	// 转换消息格式，使用公共方法
-	schemaMessages := convertChatRequestToSchemaMessages(req)
+	schemaMessages, err := convertChatRequestToSchemaMessages(req)
+	if err != nil {
+		return nil, fmt.Errorf("转换消息失败: %w", err)
+	}
 
 	if req.Tools != nil && len(req.Tools) > 0 {
 		// 转换工具并过滤同名工具
@@ -366,8 +387,10 @@ func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.
 	// 调用Stream方法获取流式响应
 	streamReader, err := chatModel.Stream(ctx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Stream方法失败: %v", err)
+		return nil, fmt.Errorf("调用Stream方法失败: %w", newProviderError("bedrock", err))
 	}
+	// 跳过个别格式错误的数据帧
+	streamReader = skipMalformedStreamFrames("bedrock", streamReader)
 
 	// 创建结果通道
 	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](10)
@@ -376,7 +399,7 @@ func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.
 	go func() {
 		defer func() {
 			if panicErr := recover(); panicErr != nil {
-				fmt.Printf("Bedrock Stream处理发生异常: %v\n", panicErr)
+				getLogger().Error("Bedrock Stream处理发生异常", "panic", panicErr)
 			}
 			streamReader.Close()
 			resultWriter.Close()
@@ -395,7 +418,7 @@ func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.
 			}
 			if err != nil {
 				// 处理错误
-				_ = resultWriter.Send(nil, fmt.Errorf("从Bedrock接收流数据失败: %v", err))
+				_ = resultWriter.Send(nil, fmt.Errorf("从Bedrock接收流数据失败: %w", newProviderError("bedrock", err)))
 				return
 			}
 
@@ -419,7 +442,7 @@ func BedrockStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.
 
 			// 如果是最后一条消息，设置完成原因
 			if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
-				streamResp.Choices[0].FinishReason = openai.FinishReason(message.ResponseMeta.FinishReason)
+				streamResp.Choices[0].FinishReason = normalizeFinishReason(message.ResponseMeta.FinishReason, len(message.ToolCalls) > 0)
 			}
 
 			// 发送流式响应
@@ -440,7 +463,11 @@ func BedrockStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 	if err != nil {
 		return fmt.Errorf("调用Bedrock流式聊天接口失败: %w", err)
 	}
-	// 注意：由于streamReader没有Close方法，我们不需要defer close
+	// 提前返回（如请求的上下文被取消）时关闭流，使转换协程及时退出
+	defer streamReader.Close()
+
+	// 按需丢弃重复的连续增量
+	dedupe := newDeltaDeduper(req.DedupeStreamDeltas)
 
 	// 处理流式响应
 	for {
@@ -449,7 +476,8 @@ func BedrockStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("接收Bedrock流式响应失败: %w", err)
+			// 写入错误帧和结束标记后返回，避免客户端收到被截断的流
+			return writeStreamError(writer, fmt.Errorf("接收Bedrock流式响应失败: %w", err))
 		}
 
 		// 转换响应格式
@@ -475,23 +503,29 @@ func BedrockStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 			Choices: choices,
 		}
 
-		// 将响应写入writer
-		data, err := json.Marshal(streamResp)
-		if err != nil {
-			return fmt.Errorf("序列化流式响应失败: %w", err)
+		if dedupe.shouldDropOpenAI(&streamResp) {
+			continue
 		}
 
-		// 添加data:前缀
-		if _, err := writer.Write([]byte("data: ")); err != nil {
-			return fmt.Errorf("写入流式响应前缀失败: %w", err)
-		}
+		// 将响应写入writer，过大的内容会被拆分为多个帧
+		for _, frame := range splitOpenAIStreamResponse(&streamResp, req.MaxSSEFrameBytes) {
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return fmt.Errorf("序列化流式响应失败: %w", err)
+			}
 
-		if _, err := writer.Write(data); err != nil {
-			return fmt.Errorf("写入流式响应失败: %w", err)
-		}
+			// 添加data:前缀
+			if _, err := writer.Write([]byte("data: ")); err != nil {
+				return fmt.Errorf("写入流式响应前缀失败: %w", err)
+			}
 
-		if _, err := writer.Write([]byte("\n\n")); err != nil {
-			return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			if _, err := writer.Write(data); err != nil {
+				return fmt.Errorf("写入流式响应失败: %w", err)
+			}
+
+			if _, err := writer.Write([]byte("\n\n")); err != nil {
+				return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			}
 		}
 	}
 
@@ -505,6 +539,10 @@ func BedrockStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 
 // getRequiredFields 从参数对象中提取required字段
 func getRequiredFields(paramsObj map[string]interface{}) []string {
+	// 直接在Go代码中构造参数时required通常为[]string
+	if required, ok := paramsObj["required"].([]string); ok {
+		return required
+	}
 	if required, ok := paramsObj["required"].([]interface{}); ok {
 		result := make([]string, 0, len(required))
 		for _, r := range required {
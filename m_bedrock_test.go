@@ -3,6 +3,7 @@ package einox
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -407,3 +408,74 @@ func TestBedrockConfigurationErrors(t *testing.T) {
 		}
 	})
 }
+
+// TestGetBedrockConfigMultipleAccounts 测试按环境加载多个AWS账号/区域的凭证，解密后按权重选择
+func TestGetBedrockConfigMultipleAccounts(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "production"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	encrypt := func(plain string) string {
+		cipher, err := encryptFunc(plain)
+		assert.NoError(t, err)
+		return cipher
+	}
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: dev
+        access_key: %s
+        secret_access_key: %s
+        region: us-west-2
+        enabled: true
+        weight: 1
+  production:
+    credentials:
+      - name: prod-east
+        access_key: %s
+        secret_access_key: %s
+        region: us-east-1
+        session_token: east-session
+        enabled: true
+        weight: 1
+        models:
+          - anthropic.claude-3-5-sonnet-20241022-v2:0
+      - name: prod-west
+        access_key: %s
+        secret_access_key: %s
+        region: us-west-2
+        enabled: false
+        weight: 100
+`, encrypt("dev-ak"), encrypt("dev-sk"), encrypt("east-ak"), encrypt("east-sk"), encrypt("west-ak"), encrypt("west-sk"))
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "bedrock.yaml"), []byte(configContent), 0644))
+
+	var selected string
+	conf := &Config{
+		Vendor:               "bedrock",
+		Model:                "anthropic.claude-3-5-sonnet-20241022-v2:0",
+		onCredentialSelected: func(info CallInfo) { selected = info.Credential },
+	}
+	claudeConf, err := conf.getBedrockConfig()
+	assert.NoError(t, err)
+
+	// 未启用的凭证即使权重更高也不会被选中
+	assert.Equal(t, "prod-east", selected)
+	assert.True(t, claudeConf.ByBedrock)
+	assert.Equal(t, "east-ak", claudeConf.AccessKey)
+	assert.Equal(t, "east-sk", claudeConf.SecretAccessKey)
+	assert.Equal(t, "east-session", claudeConf.SessionToken)
+	assert.Equal(t, "us-east-1", claudeConf.Region)
+
+	// 环境不存在时返回错误
+	ENV = "staging"
+	_, err = (&Config{Vendor: "bedrock"}).getBedrockConfig()
+	assert.ErrorContains(t, err, "未找到环境 staging 的配置")
+}
@@ -1,40 +1,37 @@
 package einox
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/claude"
 	"github.com/cloudwego/eino/schema"
-	"gopkg.in/yaml.v2"
 )
 
 // ClaudeCredential 定义Claude服务的凭证配置结构
 type ClaudeCredential struct {
-	Name        string   `yaml:"name"`
-	APIKey      string   `yaml:"api_key"`     // Claude API 密钥
-	BaseURL     string   `yaml:"base_url"`    // 自定义API端点URL
-	Enabled     bool     `yaml:"enabled"`     // 是否启用
-	Weight      int      `yaml:"weight"`      // 权重
-	QPSLimit    int      `yaml:"qps_limit"`   // QPS限制
-	Description string   `yaml:"description"` // 描述
-	Models      []string `yaml:"models"`      // 支持的模型列表
-	Timeout     int      `yaml:"timeout"`     // 超时时间
-	Proxy       string   `yaml:"proxy"`       // 代理设置
+	Name          string   `yaml:"name"`
+	APIKey        string   `yaml:"api_key"`        // Claude API 密钥
+	BaseURL       string   `yaml:"base_url"`       // 自定义API端点URL
+	Enabled       bool     `yaml:"enabled"`        // 是否启用
+	Weight        int      `yaml:"weight"`         // 权重
+	QPSLimit      int      `yaml:"qps_limit"`      // QPS限制
+	MaxConcurrent int      `yaml:"max_concurrent"` // 最大并发请求数，0表示不限制
+	Description   string   `yaml:"description"`    // 描述
+	Models        []string `yaml:"models"`         // 支持的模型列表
+	Timeout       int      `yaml:"timeout"`        // 超时时间
+	Proxy         string   `yaml:"proxy"`          // 代理设置
 }
 
-// 配置文件结构定义
-var claudeConfig struct {
+// claudeConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type claudeConfigFile struct {
 	Environments map[string]struct {
 		Credentials []ClaudeCredential `yaml:"credentials"`
 	} `yaml:"environments"`
@@ -54,14 +51,9 @@ func (c *Config) getClaudeConfig() (*claude.Config, error) {
 	}
 
 	// 读取Claude配置文件
-	yamlFile, err := os.ReadFile(filepath.Join(LLMConfigPath, "claude.yaml"))
+	claudeConfig, secrets, err := loadConfigFile[claudeConfigFile](filepath.Join(LLMConfigPath, "claude.yaml"), "Claude")
 	if err != nil {
-		return nil, fmt.Errorf("读取Claude配置文件失败: %v", err)
-	}
-
-	err = yaml.Unmarshal(yamlFile, &claudeConfig)
-	if err != nil {
-		return nil, fmt.Errorf("解析Claude配置文件失败: %v", err)
+		return nil, err
 	}
 
 	// 获取指定环境的配置
@@ -70,11 +62,18 @@ func (c *Config) getClaudeConfig() (*claude.Config, error) {
 		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
 	}
 
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred ClaudeCredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
 	// 存储启用的配置
 	var enabledCredentials []ClaudeCredential
 
 	// 遍历该环境下的所有凭证配置
-	for _, cred := range envConfig.Credentials {
+	for _, cred := range credentials {
 		// 只添加启用的配置
 		if cred.Enabled {
 			enabledCredentials = append(enabledCredentials, cred)
@@ -86,35 +85,32 @@ func (c *Config) getClaudeConfig() (*claude.Config, error) {
 		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
 	}
 
-	// 根据权重选择配置
-	var selectedCred ClaudeCredential
-	if len(enabledCredentials) > 1 {
-		// 计算总权重
-		totalWeight := 0
-		for _, cred := range enabledCredentials {
-			totalWeight += cred.Weight
-		}
-
-		// 生成一个随机数,范围是[0, totalWeight)
-		randomNum := rand.Intn(totalWeight)
-
-		// 根据权重选择配置
-		currentWeight := 0
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred ClaudeCredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
+	}
 
-		for _, cred := range enabledCredentials {
-			currentWeight += cred.Weight
-			if randomNum < currentWeight {
-				selectedCred = cred
-				break
-			}
-		}
-	} else {
-		// 如果只有一个配置,直接使用
-		selectedCred = enabledCredentials[0]
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "claude:"+env, enabledCredentials,
+		func(cred ClaudeCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
+	}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.BaseURL)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
 	}
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
+	}
+	// 按支持的模型列表使用规范的模型名称
+	c.canonicalizeModel(selectedCred.Models)
 
 	// 解密凭证
-	_, decryptFunc, err := InitRSAKeyManager()
+	decryptFunc, err := cachedDecryptFunc(env, secrets)
 	if err != nil {
 		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
 	}
@@ -177,12 +173,19 @@ func (c *Config) getClaudeConfig() (*claude.Config, error) {
 func ClaudeCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse, error) {
 	// 创建Claude配置
 	conf := &Config{
-		Vendor:      "claude",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "claude",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取Claude配置
@@ -192,7 +195,7 @@ func ClaudeCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse
 	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
 	chatModel, err := claude.NewChatModel(ctx, claudeConf)
@@ -203,7 +206,7 @@ func ClaudeCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse
 	// 转换消息格式
 	schemaMessages := make([]*schema.Message, len(req.Messages))
 	for i, msg := range req.Messages {
-		role := schema.RoleType(msg.Role)
+		role := schema.RoleType(normalizeMessageRole(msg))
 		schemaMessages[i] = &schema.Message{
 			Role:    role,
 			Content: msg.Content,
@@ -213,7 +216,7 @@ func ClaudeCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse
 	// 调用Generate方法获取响应
 	resp, err := chatModel.Generate(ctx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Generate方法失败: %v", err)
+		return nil, fmt.Errorf("调用Generate方法失败: %w", newProviderError("claude", err))
 	}
 
 	// 构造ChatCompletionChoice
@@ -224,9 +227,14 @@ func ClaudeCreateChatCompletion(req ChatRequest) (*openai.ChatCompletionResponse
 				Role:    string(resp.Role),
 				Content: resp.Content,
 			},
-			FinishReason: "stop", // 默认值，实际应根据响应确定
+			// Claude调用工具时返回tool_use，统一为tool_calls；未返回结束原因时默认为stop
+			FinishReason: openai.FinishReasonStop,
 		},
 	}
+	if finishReason := normalizeFinishReason(rawFinishReasonFromMessage(resp), len(resp.ToolCalls) > 0); finishReason != "" {
+		choices[0].FinishReason = finishReason
+	}
+	req.recordRawFinishReason(rawFinishReasonFromMessage(resp))
 
 	// 生成唯一ID
 	uniqueID := fmt.Sprintf("claude-%d", time.Now().UnixNano())
@@ -279,12 +287,19 @@ func ClaudeCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRe
 func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatCompletionStreamResponse], error) {
 	// 创建Claude配置
 	conf := &Config{
-		Vendor:      "claude",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "claude",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取Claude配置
@@ -294,7 +309,7 @@ func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
 	chatModel, err := claude.NewChatModel(ctx, claudeConf)
@@ -305,7 +320,7 @@ func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	// 转换消息格式
 	schemaMessages := make([]*schema.Message, len(req.Messages))
 	for i, msg := range req.Messages {
-		role := schema.RoleType(msg.Role)
+		role := schema.RoleType(normalizeMessageRole(msg))
 		schemaMessages[i] = &schema.Message{
 			Role:    role,
 			Content: msg.Content,
@@ -315,8 +330,10 @@ func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	// 调用Stream方法获取流式响应
 	streamReader, err := chatModel.Stream(ctx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Stream方法失败: %v", err)
+		return nil, fmt.Errorf("调用Stream方法失败: %w", newProviderError("claude", err))
 	}
+	// 跳过个别格式错误的数据帧
+	streamReader = skipMalformedStreamFrames("claude", streamReader)
 
 	// 创建结果通道
 	resultReader, resultWriter := schema.Pipe[*ChatCompletionStreamResponse](10)
@@ -325,7 +342,7 @@ func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	go func() {
 		defer func() {
 			if panicErr := recover(); panicErr != nil {
-				fmt.Printf("Claude Stream处理发生异常: %v\n", panicErr)
+				getLogger().Error("Claude Stream处理发生异常", "panic", panicErr)
 			}
 			streamReader.Close()
 			resultWriter.Close()
@@ -344,7 +361,7 @@ func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 			}
 			if err != nil {
 				// 处理错误
-				_ = resultWriter.Send(nil, fmt.Errorf("从Claude接收流数据失败: %v", err))
+				_ = resultWriter.Send(nil, fmt.Errorf("从Claude接收流数据失败: %w", newProviderError("claude", err)))
 				return
 			}
 
@@ -368,7 +385,7 @@ func ClaudeStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 
 			// 如果是最后一条消息，设置完成原因
 			if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
-				streamResp.Choices[0].FinishReason = message.ResponseMeta.FinishReason
+				streamResp.Choices[0].FinishReason = string(normalizeFinishReason(message.ResponseMeta.FinishReason, len(message.ToolCalls) > 0))
 			}
 
 			// 发送流式响应
@@ -389,7 +406,11 @@ func ClaudeStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("调用Claude流式聊天接口失败: %w", err)
 	}
-	// 注意：由于streamReader没有Close方法，我们不需要defer close
+	// 提前返回（如请求的上下文被取消）时关闭流，使转换协程及时退出
+	defer streamReader.Close()
+
+	// 按需丢弃重复的连续增量
+	dedupe := newDeltaDeduper(req.DedupeStreamDeltas)
 
 	// 处理流式响应
 	for {
@@ -398,7 +419,8 @@ func ClaudeStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("接收Claude流式响应失败: %w", err)
+			// 写入错误帧和结束标记后返回，避免客户端收到被截断的流
+			return writeStreamError(writer, fmt.Errorf("接收Claude流式响应失败: %w", err))
 		}
 
 		// 转换响应格式
@@ -422,23 +444,29 @@ func ClaudeStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 			Choices: choices,
 		}
 
-		// 将响应写入writer
-		data, err := json.Marshal(streamResp)
-		if err != nil {
-			return fmt.Errorf("序列化流式响应失败: %w", err)
+		if dedupe.shouldDropLocal(streamResp) {
+			continue
 		}
 
-		// 添加data:前缀
-		if _, err := writer.Write([]byte("data: ")); err != nil {
-			return fmt.Errorf("写入流式响应前缀失败: %w", err)
-		}
+		// 将响应写入writer，过大的内容会被拆分为多个帧
+		for _, frame := range splitStreamResponse(streamResp, req.MaxSSEFrameBytes) {
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return fmt.Errorf("序列化流式响应失败: %w", err)
+			}
 
-		if _, err := writer.Write(data); err != nil {
-			return fmt.Errorf("写入流式响应失败: %w", err)
-		}
+			// 添加data:前缀
+			if _, err := writer.Write([]byte("data: ")); err != nil {
+				return fmt.Errorf("写入流式响应前缀失败: %w", err)
+			}
 
-		if _, err := writer.Write([]byte("\n\n")); err != nil {
-			return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			if _, err := writer.Write(data); err != nil {
+				return fmt.Errorf("写入流式响应失败: %w", err)
+			}
+
+			if _, err := writer.Write([]byte("\n\n")); err != nil {
+				return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			}
 		}
 	}
 
@@ -1,38 +1,35 @@
 package einox
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"io"
-	"math/rand"
-	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/deepseek"
 	"github.com/cloudwego/eino/schema"
-	"gopkg.in/yaml.v2"
 )
 
 // DeepSeekCredential 定义了DeepSeek模型的凭证配置
 type DeepSeekCredential struct {
-	Name        string   `yaml:"name"`
-	APIKey      string   `yaml:"api_key"`
-	BaseURL     string   `yaml:"base_url"`
-	Enabled     bool     `yaml:"enabled"`
-	Weight      int      `yaml:"weight"`
-	QPSLimit    int      `yaml:"qps_limit"`
-	Description string   `yaml:"description"`
-	Models      []string `yaml:"models"`
-	Timeout     int      `yaml:"timeout"`
-	Proxy       string   `yaml:"proxy"`
+	Name          string   `yaml:"name"`
+	APIKey        string   `yaml:"api_key"`
+	BaseURL       string   `yaml:"base_url"`
+	Enabled       bool     `yaml:"enabled"`
+	Weight        int      `yaml:"weight"`
+	QPSLimit      int      `yaml:"qps_limit"`
+	MaxConcurrent int      `yaml:"max_concurrent"`
+	Description   string   `yaml:"description"`
+	Models        []string `yaml:"models"`
+	Timeout       int      `yaml:"timeout"`
+	Proxy         string   `yaml:"proxy"`
 }
 
-// 定义配置文件结构
-var deepseekConfig struct {
+// deepseekConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type deepseekConfigFile struct {
 	Environments map[string]struct {
 		Credentials []DeepSeekCredential `yaml:"credentials"`
 	} `yaml:"environments"`
@@ -52,14 +49,9 @@ func (c *Config) getDeepSeekConfig() (*deepseek.ChatModelConfig, error) {
 	}
 
 	// 读取DeepSeek配置文件
-	yamlFile, err := os.ReadFile(filepath.Join(LLMConfigPath, "deepseek.yaml"))
+	deepseekConfig, secrets, err := loadConfigFile[deepseekConfigFile](filepath.Join(LLMConfigPath, "deepseek.yaml"), "DeepSeek")
 	if err != nil {
-		return nil, fmt.Errorf("读取DeepSeek配置文件失败: %v", err)
-	}
-
-	err = yaml.Unmarshal(yamlFile, &deepseekConfig)
-	if err != nil {
-		return nil, fmt.Errorf("解析DeepSeek配置文件失败: %v", err)
+		return nil, err
 	}
 
 	// 获取指定环境的配置
@@ -68,11 +60,18 @@ func (c *Config) getDeepSeekConfig() (*deepseek.ChatModelConfig, error) {
 		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
 	}
 
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred DeepSeekCredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
 	// 存储启用的配置
 	var enabledCredentials []DeepSeekCredential
 
 	// 遍历该环境下的所有凭证配置
-	for _, cred := range envConfig.Credentials {
+	for _, cred := range credentials {
 		// 只添加启用的配置
 		if cred.Enabled {
 			enabledCredentials = append(enabledCredentials, cred)
@@ -84,31 +83,29 @@ func (c *Config) getDeepSeekConfig() (*deepseek.ChatModelConfig, error) {
 		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
 	}
 
-	// 根据权重选择配置
-	var selectedCred DeepSeekCredential
-	if len(enabledCredentials) > 1 {
-		// 计算总权重
-		totalWeight := 0
-		for _, cred := range enabledCredentials {
-			totalWeight += cred.Weight
-		}
-
-		// 生成一个随机数,范围是[0, totalWeight)
-		randomNum := rand.Intn(totalWeight)
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred DeepSeekCredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
+	}
 
-		// 根据权重选择配置
-		currentWeight := 0
-		for _, cred := range enabledCredentials {
-			currentWeight += cred.Weight
-			if randomNum < currentWeight {
-				selectedCred = cred
-				break
-			}
-		}
-	} else {
-		// 如果只有一个配置,直接使用
-		selectedCred = enabledCredentials[0]
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "deepseek:"+env, enabledCredentials,
+		func(cred DeepSeekCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
 	}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.BaseURL)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
+	}
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
+	}
+	// 按支持的模型列表使用规范的模型名称
+	c.canonicalizeModel(selectedCred.Models)
 
 	// 确保DeepSeek配置存在
 	if c.VendorOptional == nil {
@@ -119,7 +116,7 @@ func (c *Config) getDeepSeekConfig() (*deepseek.ChatModelConfig, error) {
 	}
 
 	// 处理API密钥解密
-	_, decryptFunc, err := InitRSAKeyManager()
+	decryptFunc, err := cachedDecryptFunc(env, secrets)
 	if err != nil {
 		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
 	}
@@ -174,12 +171,19 @@ func dereferenceFloat32OrDefault(ptr *float32, defaultValue float32) float32 {
 func DeepSeekCreateChatCompletion(req ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
 	// 创建DeepSeek配置
 	conf := &Config{
-		Vendor:      "deepseek",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "deepseek",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.credentialName,
+		DeterministicSelection: req.deterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取DeepSeek配置
@@ -187,9 +191,10 @@ func DeepSeekCreateChatCompletion(req ChatCompletionRequest) (*openai.ChatComple
 	if err != nil {
 		return nil, fmt.Errorf("获取DeepSeek配置失败: %v", err)
 	}
+	penaltiesFromCompletionRequest(req).applyToDeepSeek(deepseekConf)
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
 	chatModel, err := deepseek.NewChatModel(ctx, deepseekConf)
@@ -210,7 +215,15 @@ func DeepSeekCreateChatCompletion(req ChatCompletionRequest) (*openai.ChatComple
 	// 调用Generate方法获取响应
 	resp, err := chatModel.Generate(ctx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Generate方法失败: %v", err)
+		return nil, fmt.Errorf("调用Generate方法失败: %w", newProviderError("deepseek", err))
+	}
+
+	// 合并模式下将推理内容合并到回复内容中
+	content := resp.Content
+	if req.ReasoningMode == ReasoningModeMerge {
+		if reasoning, ok := deepseek.GetReasoningContent(resp); ok {
+			content = mergeReasoningContent(reasoning, content)
+		}
 	}
 
 	// 构造ChatCompletionChoice
@@ -219,11 +232,12 @@ func DeepSeekCreateChatCompletion(req ChatCompletionRequest) (*openai.ChatComple
 			Index: 0,
 			Message: openai.ChatCompletionMessage{
 				Role:    string(resp.Role),
-				Content: resp.Content,
+				Content: content,
 			},
-			FinishReason: openai.FinishReason(resp.ResponseMeta.FinishReason),
+			FinishReason: normalizeFinishReason(rawFinishReasonFromMessage(resp), len(resp.ToolCalls) > 0),
 		},
 	}
+	req.recordRawFinishReason(rawFinishReasonFromMessage(resp))
 
 	// 生成唯一ID
 	uniqueID := fmt.Sprintf("deepseek-%d", time.Now().UnixNano())
@@ -255,7 +269,7 @@ func DeepSeekCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletion
 	model := req.Model
 	if model == "" {
 		// 如果没有指定模型，返回错误
-		return nil, fmt.Errorf("未指定模型名称")
+		return nil, ErrModelNotSpecified
 	}
 
 	temperature := float32(req.Temperature)
@@ -265,17 +279,27 @@ func DeepSeekCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletion
 	messages := make([]ChatMessage, 0, len(req.Messages))
 	for _, msg := range req.Messages {
 		messages = append(messages, ChatMessage{
-			Role:    msg.Role,
+			Role:    normalizeMessageRole(msg),
 			Content: msg.Content,
 		})
 	}
 
 	// 创建DeepSeek请求
 	deepseekReq := ChatCompletionRequest{
-		Model:       model,
-		Messages:    messages,
-		Temperature: temperature,
-		MaxTokens:   maxTokens,
+		Model:                  model,
+		Messages:               messages,
+		Temperature:            temperature,
+		MaxTokens:              maxTokens,
+		PresenceP:              req.PresencePenalty,
+		FrequencyP:             req.FrequencyPenalty,
+		ReasoningMode:          req.ReasoningMode,
+		onCredentialSelected:   req.onCredentialSelected,
+		credentialName:         req.CredentialName,
+		deterministicSelection: req.DeterministicSelection,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		onRawFinishReason:      req.onRawFinishReason,
 	}
 
 	// 调用DeepSeek服务
@@ -302,12 +326,19 @@ func DeepSeekCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletion
 func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamReader[*ChatCompletionStreamResponse], error) {
 	// 创建DeepSeek配置
 	conf := &Config{
-		Vendor:      "deepseek",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "deepseek",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.credentialName,
+		DeterministicSelection: req.deterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取DeepSeek配置
@@ -315,9 +346,10 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 	if err != nil {
 		return nil, fmt.Errorf("获取DeepSeek配置失败: %v", err)
 	}
+	penaltiesFromCompletionRequest(req).applyToDeepSeek(deepseekConf)
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
 	chatModel, err := deepseek.NewChatModel(ctx, deepseekConf)
@@ -338,9 +370,21 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 	// 调用Stream方法获取流式响应
 	streamReader, err := chatModel.Stream(ctx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Stream方法失败: %v", err)
+		return nil, fmt.Errorf("调用Stream方法失败: %w", newProviderError("deepseek", err))
 	}
+	// 跳过个别格式错误的数据帧
+	streamReader = skipMalformedStreamFrames("deepseek", streamReader)
+
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	return convertDeepSeekStream(streamReader, req.Model, includeUsage, req.ReasoningMode), nil
+}
 
+// convertDeepSeekStream 将DeepSeek的消息流转换为OpenAI格式的流式响应
+// DeepSeek在最后一个数据块中返回使用情况，includeUsage为true时会在流的最后追加一个
+// choices为空、只包含usage的数据块，与OpenAI的stream_options.include_usage行为一致。
+// reasoningMode为merge时推理增量会被合并到内容增量中
+func convertDeepSeekStream(streamReader *schema.StreamReader[*schema.Message], model string, includeUsage bool,
+	reasoningMode ReasoningMode) *schema.StreamReader[*ChatCompletionStreamResponse] {
 	// 创建结果通道
 	resultReader, resultWriter := schema.Pipe[*ChatCompletionStreamResponse](10)
 
@@ -348,7 +392,7 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 	go func() {
 		defer func() {
 			if panicErr := recover(); panicErr != nil {
-				fmt.Printf("DeepSeek Stream处理发生异常: %v\n", panicErr)
+				getLogger().Error("DeepSeek Stream处理发生异常", "panic", panicErr)
 			}
 			streamReader.Close()
 			resultWriter.Close()
@@ -357,6 +401,8 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 		// 生成唯一ID
 		uniqueID := fmt.Sprintf("deepseek-stream-%d", time.Now().UnixNano())
 		created := time.Now().Unix()
+		var usage *ChatCompletionUsage
+		merger := newReasoningMerger(reasoningMode)
 
 		for {
 			// 从流中接收消息
@@ -367,10 +413,19 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 			}
 			if err != nil {
 				// 处理错误
-				_ = resultWriter.Send(nil, fmt.Errorf("从DeepSeek接收流数据失败: %v", err))
+				_ = resultWriter.Send(nil, fmt.Errorf("从DeepSeek接收流数据失败: %w", newProviderError("deepseek", err)))
 				return
 			}
 
+			// 记录使用情况，DeepSeek只在最后一个数据块中返回
+			if message.ResponseMeta != nil && message.ResponseMeta.Usage != nil {
+				usage = &ChatCompletionUsage{
+					PromptTokens:     message.ResponseMeta.Usage.PromptTokens,
+					CompletionTokens: message.ResponseMeta.Usage.CompletionTokens,
+					TotalTokens:      message.ResponseMeta.Usage.TotalTokens,
+				}
+			}
+
 			// 获取推理内容
 			reasoningContent := ""
 			if reason, ok := deepseek.GetReasoningContent(message); ok {
@@ -382,7 +437,7 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 				ID:      uniqueID,
 				Object:  "chat.completion.chunk",
 				Created: created,
-				Model:   req.Model,
+				Model:   model,
 				Choices: []ChatCompletionStreamChoice{
 					{
 						Index: 0,
@@ -398,44 +453,95 @@ func DeepSeekStreamChatCompletion(req ChatCompletionRequest) (*schema.StreamRead
 
 			// 如果是最后一条消息，设置完成原因
 			if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
-				streamResp.Choices[0].FinishReason = message.ResponseMeta.FinishReason
+				streamResp.Choices[0].FinishReason = string(normalizeFinishReason(message.ResponseMeta.FinishReason, len(message.ToolCalls) > 0))
 			}
 
+			// 按需将推理内容合并到内容中
+			merger.merge(&streamResp.Choices[0].Delta, streamResp.Choices[0].FinishReason != "")
+
 			// 发送流式响应
 			closed := resultWriter.Send(streamResp, nil)
 			if closed {
 				return
 			}
 		}
+
+		// 流没有返回结束原因时补上推理内容的结束标签
+		if closeTag := merger.pending(); closeTag != "" {
+			if closed := resultWriter.Send(&ChatCompletionStreamResponse{
+				ID:      uniqueID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []ChatCompletionStreamChoice{
+					{Index: 0, Delta: ChatCompletionStreamDelta{Content: closeTag}},
+				},
+			}, nil); closed {
+				return
+			}
+		}
+
+		// 追加使用情况数据块
+		if includeUsage && usage != nil {
+			_ = resultWriter.Send(&ChatCompletionStreamResponse{
+				ID:      uniqueID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []ChatCompletionStreamChoice{},
+				Usage:   usage,
+			}, nil)
+		}
 	}()
 
-	return resultReader, nil
+	return resultReader
 }
 
-// DeepSeekStreamChatCompletionToChat 使用DeepSeek服务创建流式聊天完成并转换为聊天流格式
-func DeepSeekStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
+// toDeepSeekStreamRequest 将统一请求转换为DeepSeek流式请求
+func toDeepSeekStreamRequest(req ChatRequest) ChatCompletionRequest {
 	// 创建ChatCompletionRequest
 	chatReq := ChatCompletionRequest{
-		Model:       req.Model,
-		Temperature: float32(req.Temperature),
-		MaxTokens:   req.MaxTokens,
-		Stream:      true,
+		Model:                  req.Model,
+		Temperature:            float32(req.Temperature),
+		MaxTokens:              req.MaxTokens,
+		Stream:                 true,
+		User:                   req.User,
+		PresenceP:              req.PresencePenalty,
+		FrequencyP:             req.FrequencyPenalty,
+		StreamOptions:          req.StreamOptions,
+		ReasoningMode:          req.ReasoningMode,
+		onCredentialSelected:   req.onCredentialSelected,
+		credentialName:         req.CredentialName,
+		deterministicSelection: req.DeterministicSelection,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 转换消息格式
 	chatReq.Messages = make([]ChatMessage, len(req.Messages))
 	for i, msg := range req.Messages {
 		chatReq.Messages[i] = ChatMessage{
-			Role:    msg.Role,
+			Role:    normalizeMessageRole(msg),
 			Content: msg.Content,
 		}
 	}
 
+	return chatReq
+}
+
+// DeepSeekStreamChatCompletionToChat 使用DeepSeek服务创建流式聊天完成并转换为聊天流格式
+func DeepSeekStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 	// 调用DeepSeek流式聊天API
-	streamReader, err := DeepSeekStreamChatCompletion(chatReq)
+	streamReader, err := DeepSeekStreamChatCompletion(toDeepSeekStreamRequest(req))
 	if err != nil {
 		return fmt.Errorf("调用DeepSeek流式聊天接口失败: %w", err)
 	}
+	// 提前返回（如请求的上下文被取消）时关闭流，使转换协程及时退出
+	defer streamReader.Close()
+
+	// 按需丢弃重复的连续增量
+	dedupe := newDeltaDeduper(req.DedupeStreamDeltas)
 
 	// 处理流式响应
 	for {
@@ -444,7 +550,8 @@ func DeepSeekStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("接收DeepSeek流式响应失败: %w", err)
+			// 写入错误帧和结束标记后返回，避免客户端收到被截断的流
+			return writeStreamError(writer, fmt.Errorf("接收DeepSeek流式响应失败: %w", err))
 		}
 
 		// 转换响应格式
@@ -453,8 +560,9 @@ func DeepSeekStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 			choices = append(choices, StreamChoice{
 				Index: choice.Index,
 				Delta: StreamChoiceDelta{
-					Role:    choice.Delta.Role,
-					Content: choice.Delta.Content,
+					Role:             choice.Delta.Role,
+					Content:          choice.Delta.Content,
+					ReasoningContent: choice.Delta.ReasoningContent,
 				},
 				FinishReason: choice.FinishReason,
 			})
@@ -466,25 +574,32 @@ func DeepSeekStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error
 			Created: response.Created,
 			Model:   response.Model,
 			Choices: choices,
+			Usage:   response.Usage,
 		}
 
-		// 将响应写入writer
-		data, err := json.Marshal(streamResp)
-		if err != nil {
-			return fmt.Errorf("序列化流式响应失败: %w", err)
+		if dedupe.shouldDropLocal(streamResp) {
+			continue
 		}
 
-		// 添加data:前缀
-		if _, err := writer.Write([]byte("data: ")); err != nil {
-			return fmt.Errorf("写入流式响应前缀失败: %w", err)
-		}
+		// 将响应写入writer，过大的内容会被拆分为多个帧
+		for _, frame := range splitStreamResponse(streamResp, req.MaxSSEFrameBytes) {
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return fmt.Errorf("序列化流式响应失败: %w", err)
+			}
 
-		if _, err := writer.Write(data); err != nil {
-			return fmt.Errorf("写入流式响应失败: %w", err)
-		}
+			// 添加data:前缀
+			if _, err := writer.Write([]byte("data: ")); err != nil {
+				return fmt.Errorf("写入流式响应前缀失败: %w", err)
+			}
 
-		if _, err := writer.Write([]byte("\n\n")); err != nil {
-			return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			if _, err := writer.Write(data); err != nil {
+				return fmt.Errorf("写入流式响应失败: %w", err)
+			}
+
+			if _, err := writer.Write([]byte("\n\n")); err != nil {
+				return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			}
 		}
 	}
 
@@ -1,9 +1,16 @@
 package einox
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
 )
 
 // 定义测试所需的结构
@@ -57,6 +64,54 @@ func TestGetDeepSeekConfig(t *testing.T) {
 	})
 }
 
+// TestGetDeepSeekConfigFromFile 测试从deepseek.yaml加载凭证，包括base_url覆盖和没有启用凭证时的错误
+func TestGetDeepSeekConfigFromFile(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("sk-test")
+	assert.NoError(t, err)
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: gateway
+        api_key: %s
+        base_url: https://gateway.example.com/deepseek/v1
+        enabled: true
+        weight: 1
+        timeout: 45
+        models:
+          - deepseek-chat
+  production:
+    credentials:
+      - name: disabled
+        api_key: %s
+        enabled: false
+        weight: 1
+`, cipher, cipher)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "deepseek.yaml"), []byte(configContent), 0644))
+
+	conf, err := (&Config{Vendor: "deepseek", Model: "deepseek-chat"}).getDeepSeekConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test", conf.APIKey)
+	assert.Equal(t, "https://gateway.example.com/deepseek/v1", conf.BaseURL)
+	assert.Equal(t, 45*time.Second, conf.Timeout)
+	assert.Equal(t, "deepseek-chat", conf.Model)
+
+	ENV = "production"
+	_, err = (&Config{Vendor: "deepseek", Model: "deepseek-chat"}).getDeepSeekConfig()
+	assert.EqualError(t, err, "环境 production 中没有启用的配置")
+}
+
 // TestDeepSeekCreateChatCompletion 测试创建聊天完成的方法
 func TestDeepSeekCreateChatCompletion(t *testing.T) {
 	t.Run("测试创建聊天完成请求", func(t *testing.T) {
@@ -301,3 +356,66 @@ func mockStreamReceive() []*mockMessage {
 		},
 	}
 }
+
+// 构造模拟的DeepSeek消息流，最后一条消息携带完成原因和使用情况
+func newDeepSeekTestStream() *schema.StreamReader[*schema.Message] {
+	return schema.StreamReaderFromArray([]*schema.Message{
+		{Role: schema.Assistant, Content: "你好"},
+		{
+			Role:    schema.Assistant,
+			Content: "！",
+			ResponseMeta: &schema.ResponseMeta{
+				FinishReason: "stop",
+				Usage:        &schema.TokenUsage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+			},
+		},
+	})
+}
+
+// 读取流中的所有数据块
+func collectDeepSeekStream(t *testing.T, reader *schema.StreamReader[*ChatCompletionStreamResponse]) []*ChatCompletionStreamResponse {
+	var chunks []*ChatCompletionStreamResponse
+	for {
+		chunk, err := reader.Recv()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+}
+
+// 测试请求了include_usage时最后追加使用情况数据块
+func TestConvertDeepSeekStreamUsage(t *testing.T) {
+	chunks := collectDeepSeekStream(t, convertDeepSeekStream(newDeepSeekTestStream(), "deepseek-chat", true, ReasoningModeSeparate))
+
+	if assert.Len(t, chunks, 3) {
+		assert.Equal(t, "stop", chunks[1].Choices[0].FinishReason)
+		assert.Nil(t, chunks[1].Usage)
+
+		usageChunk := chunks[2]
+		assert.Empty(t, usageChunk.Choices)
+		assert.Equal(t, "deepseek-chat", usageChunk.Model)
+		if assert.NotNil(t, usageChunk.Usage) {
+			assert.Equal(t, 10, usageChunk.Usage.PromptTokens)
+			assert.Equal(t, 2, usageChunk.Usage.CompletionTokens)
+			assert.Equal(t, 12, usageChunk.Usage.TotalTokens)
+		}
+
+		// 转换为OpenAI格式后使用情况保留
+		converted := convertLocalStreamResponse(usageChunk)
+		if assert.NotNil(t, converted.Usage) {
+			assert.Equal(t, 12, converted.Usage.TotalTokens)
+		}
+	}
+}
+
+// 测试未请求include_usage时不追加使用情况数据块
+func TestConvertDeepSeekStreamWithoutUsage(t *testing.T) {
+	chunks := collectDeepSeekStream(t, convertDeepSeekStream(newDeepSeekTestStream(), "deepseek-chat", false, ReasoningModeSeparate))
+
+	assert.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		assert.Nil(t, chunk.Usage)
+	}
+}
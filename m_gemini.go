@@ -2,24 +2,25 @@ package einox
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/gemini"
 	"github.com/cloudwego/eino/schema"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/google/generative-ai-go/genai"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
-	"gopkg.in/yaml.v2"
 )
 
 // GeminiCredential 定义Google Gemini服务的凭证配置结构
@@ -27,9 +28,12 @@ type GeminiCredential struct {
 	Name                string                 `yaml:"name"`
 	APIKey              string                 `yaml:"api_key"`               // Gemini API 密钥
 	APIEndpoint         string                 `yaml:"api_endpoint"`          // API端点URL，可选
+	Project             string                 `yaml:"project"`               // Google Cloud项目ID，可选，仅用于标识凭证，请求通过api_key发送到Gemini API
+	Location            string                 `yaml:"location"`              // 区域，如us-central1，可选，用途同Project
 	Enabled             bool                   `yaml:"enabled"`               // 是否启用
 	Weight              int                    `yaml:"weight"`                // 权重
 	QPSLimit            int                    `yaml:"qps_limit"`             // QPS限制
+	MaxConcurrent       int                    `yaml:"max_concurrent"`        // 最大并发请求数，0表示不限制
 	Description         string                 `yaml:"description"`           // 描述
 	Models              []string               `yaml:"models"`                // 支持的模型列表
 	Timeout             int                    `yaml:"timeout"`               // 超时时间
@@ -39,8 +43,8 @@ type GeminiCredential struct {
 	EnableCodeExecution bool                   `yaml:"enable_code_execution"` // 允许模型执行代码
 }
 
-// 配置文件结构定义
-var geminiConfig struct {
+// geminiConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type geminiConfigFile struct {
 	Environments map[string]struct {
 		Credentials []GeminiCredential `yaml:"credentials"`
 	} `yaml:"environments"`
@@ -60,15 +64,8 @@ func (c *Config) getGeminiConfig() (*gemini.Config, error) {
 	}
 
 	// 读取Gemini配置文件
-	yamlFile, err := os.ReadFile(filepath.Join(LLMConfigPath, "gemini.yaml"))
+	geminiConfig, secrets, err := loadConfigFile[geminiConfigFile](filepath.Join(LLMConfigPath, "gemini.yaml"), "Gemini")
 	if err != nil {
-		return nil, fmt.Errorf("读取Gemini配置文件失败: %v", err)
-	}
-
-	err = yaml.Unmarshal(yamlFile, &geminiConfig)
-	if err != nil {
-		fmt.Printf("解析Gemini配置文件失败: %v", err)
-		// 抛出异常
 		return nil, err
 	}
 
@@ -78,11 +75,18 @@ func (c *Config) getGeminiConfig() (*gemini.Config, error) {
 		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
 	}
 
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred GeminiCredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
 	// 存储启用的配置
 	var enabledCredentials []GeminiCredential
 
 	// 遍历该环境下的所有凭证配置
-	for _, cred := range envConfig.Credentials {
+	for _, cred := range credentials {
 		// 只添加启用的配置
 		if cred.Enabled {
 			enabledCredentials = append(enabledCredentials, cred)
@@ -94,35 +98,30 @@ func (c *Config) getGeminiConfig() (*gemini.Config, error) {
 		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
 	}
 
-	// 根据权重选择配置
-	var selectedCred GeminiCredential
-	if len(enabledCredentials) > 1 {
-		// 计算总权重
-		totalWeight := 0
-		for _, cred := range enabledCredentials {
-			totalWeight += cred.Weight
-		}
-
-		// 生成一个随机数,范围是[0, totalWeight)
-		randomNum := rand.Intn(totalWeight)
-
-		// 根据权重选择配置
-		currentWeight := 0
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred GeminiCredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
+	}
 
-		for _, cred := range enabledCredentials {
-			currentWeight += cred.Weight
-			if randomNum < currentWeight {
-				selectedCred = cred
-				break
-			}
-		}
-	} else {
-		// 如果只有一个配置,直接使用
-		selectedCred = enabledCredentials[0]
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "gemini:"+env, enabledCredentials,
+		func(cred GeminiCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
+	}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.APIEndpoint)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
+	}
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
 	}
 
 	// 解密凭证
-	_, decryptFunc, err := InitRSAKeyManager()
+	decryptFunc, err := cachedDecryptFunc(env, secrets)
 	if err != nil {
 		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
 	}
@@ -175,20 +174,8 @@ func (c *Config) getGeminiConfig() (*gemini.Config, error) {
 		}
 	}
 
-	// 验证支持的模型
-	if len(selectedCred.Models) > 0 {
-		modelSupported := false
-		for _, supportedModel := range selectedCred.Models {
-			if supportedModel == c.Model {
-				modelSupported = true
-				break
-			}
-		}
-
-		if !modelSupported {
-			fmt.Printf("警告: 请求的模型 %s 不在配置支持的模型列表中: %v\n", c.Model, selectedCred.Models)
-		}
-	}
+	// 选择凭证时已按模型列表过滤，这里使用列表中的规范名称
+	c.canonicalizeModel(selectedCred.Models)
 
 	// 转换SafetySettings
 	var safetySettings []*genai.SafetySetting
@@ -283,7 +270,7 @@ func (c *Config) getGeminiConfig() (*gemini.Config, error) {
 		if selectedCred.GenerationConfig != nil {
 			// 这里可以根据需要从GenerationConfig中提取其他配置项
 			// 比如，后续可能会支持更多的生成选项
-			fmt.Printf("提示: Gemini凭证中包含GenerationConfig，但当前版本暂未完全支持\n")
+			getLogger().Debug("Gemini凭证中包含GenerationConfig，但当前版本暂未完全支持")
 		}
 	} else {
 		// 如果没有设置VendorOptional，确保初始化
@@ -304,12 +291,19 @@ func (c *Config) getGeminiConfig() (*gemini.Config, error) {
 func GeminiCreateChatCompletion(req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	// 创建Gemini配置
 	conf := &Config{
-		Vendor:      "gemini",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "gemini",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.credentialName,
+		DeterministicSelection: req.deterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
 	}
 
 	// 获取Gemini配置
@@ -319,7 +313,7 @@ func GeminiCreateChatCompletion(req ChatCompletionRequest) (*ChatCompletionRespo
 	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 转换消息格式
 	schemaMessages := make([]*schema.Message, len(req.Messages))
@@ -376,7 +370,7 @@ func GeminiCreateChatCompletion(req ChatCompletionRequest) (*ChatCompletionRespo
 	// 设置是否启用代码执行
 	if geminiConf.EnableCodeExecution {
 		// 注意：启用代码执行可能存在安全风险，应谨慎使用
-		fmt.Printf("警告：已为模型 %s 启用代码执行功能\n", req.Model)
+		getLogger().Debug("已启用代码执行功能", "provider", "gemini", "model", req.Model)
 	}
 
 	// 转换消息为Gemini格式
@@ -395,7 +389,7 @@ func GeminiCreateChatCompletion(req ChatCompletionRequest) (*ChatCompletionRespo
 	lastMsg := schemaMessages[len(schemaMessages)-1]
 	resp, err := chat.SendMessage(ctx, genai.Text(lastMsg.Content))
 	if err != nil {
-		return nil, fmt.Errorf("发送消息失败: %v", err)
+		return nil, fmt.Errorf("发送消息失败: %w", newProviderError("gemini", err))
 	}
 
 	// 解析响应
@@ -447,164 +441,103 @@ func GeminiCreateChatCompletion(req ChatCompletionRequest) (*ChatCompletionRespo
 }
 
 // GeminiCreateChatCompletionToChat 使用Google Gemini服务创建聊天完成接口
-func GeminiCreateChatCompletionToChat(req ChatRequest) (*ChatResponse, error) {
+// tools转换为Gemini的函数声明，模型返回的functionCall转换为ToolCalls，工具消息作为functionResponse发送
+func GeminiCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionResponse, error) {
 	// 准备请求参数
-	model := req.Model
-	if model == "" {
-		// 如果没有指定模型，可以设置一个默认值或返回错误
-		return nil, fmt.Errorf("未指定模型名称")
+	if req.Model == "" {
+		return nil, ErrModelNotSpecified
 	}
 
-	temperature := float32(req.Temperature)
-	maxTokens := req.MaxTokens
-
-	// 转换消息格式
-	messages := make([]ChatMessage, 0, len(req.Messages))
-	for _, msg := range req.Messages {
-		messages = append(messages, ChatMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
-	}
-
-	// 创建Gemini请求
-	geminiReq := ChatCompletionRequest{
-		Model:       model,
-		Messages:    messages,
-		Temperature: temperature,
-		MaxTokens:   maxTokens,
+	chat, parts, err := startGeminiChat(req)
+	if err != nil {
+		return nil, err
 	}
 
-	// 调用Gemini服务
-	resp, err := GeminiCreateChatCompletion(geminiReq)
+	resp, err := chat.SendMessage(requestContext(req.ctx), parts...)
 	if err != nil {
-		return nil, fmt.Errorf("调用Gemini聊天接口失败: %w", err)
+		return nil, fmt.Errorf("调用Gemini聊天接口失败: %w", newProviderError("gemini", err))
 	}
 
-	// 转换响应格式
-	choices := make([]Choice, 0, len(resp.Choices))
-	for _, choice := range resp.Choices {
-		choices = append(choices, Choice{
-			Index: choice.Index,
-			Message: ChatMessage{
-				Role:    choice.Message.Role,
-				Content: choice.Message.Content,
-			},
-			FinishReason: choice.FinishReason,
-		})
+	// 解析响应
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("Gemini返回的响应是空的")
 	}
+	candidate := resp.Candidates[0]
 
-	return &ChatResponse{
-		ID:      resp.ID,
-		Object:  resp.Object,
-		Created: resp.Created,
-		Model:   resp.Model,
-		Choices: choices,
-		Usage: TokenUsage{
-			PromptTokens:     resp.Usage.PromptTokens,
-			CompletionTokens: resp.Usage.CompletionTokens,
-			TotalTokens:      resp.Usage.TotalTokens,
-		},
-	}, nil
-}
-
-// GeminiStreamChatCompletion 使用Google Gemini服务创建流式聊天完成
-func GeminiStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatCompletionStreamResponse], error) {
-	// 创建Gemini配置
-	conf := &Config{
-		Vendor:      "gemini",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
-	}
+	// 生成唯一ID
+	uniqueID := fmt.Sprintf("gemini-%d", time.Now().UnixNano())
 
-	// 获取Gemini配置
-	geminiConf, err := conf.getGeminiConfig()
+	// 转换回复内容和工具调用
+	message, err := convertGeminiContentToSchemaMessage(candidate.Content, 0)
 	if err != nil {
-		return nil, fmt.Errorf("获取Gemini配置失败: %v", err)
+		return nil, err
 	}
-
-	// 创建上下文
-	ctx := context.Background()
-
-	// 转换消息格式
-	schemaMessages := make([]*schema.Message, len(req.Messages))
-	for i, msg := range req.Messages {
-		role := schema.RoleType(msg.Role)
-		schemaMessages[i] = &schema.Message{
-			Role:    role,
-			Content: msg.Content,
-		}
+	toolCalls, err := convertSchemaToolCallsToOpenAI(message.ToolCalls)
+	if err != nil {
+		return nil, fmt.Errorf("转换工具调用失败: %w", err)
 	}
+	// Gemini的functionCall没有ID，补充ID以便下一轮用ToolCallID对应工具结果
+	ensureToolCallIDs("gemini", uniqueID, toolCalls)
 
-	// 创建生成模型
-	model := geminiConf.Client.GenerativeModel(req.Model)
-
-	// 设置参数
-	if req.MaxTokens > 0 {
-		model.SetMaxOutputTokens(int32(req.MaxTokens))
-	}
-	if req.Temperature > 0 {
-		model.SetTemperature(req.Temperature)
-	}
-	if req.TopP > 0 {
-		model.SetTopP(req.TopP)
-	}
-	if geminiConf.TopK != nil {
-		model.SetTopK(*geminiConf.TopK)
+	// 获取Token使用情况
+	var usage openai.Usage
+	if resp.UsageMetadata != nil {
+		usage = convertGeminiUsage(resp.UsageMetadata)
 	}
 
-	// 设置安全级别
-	if len(geminiConf.SafetySettings) > 0 {
-		model.SafetySettings = geminiConf.SafetySettings
+	if candidate.FinishReason != genai.FinishReasonUnspecified {
+		req.recordRawFinishReason(candidate.FinishReason.String())
 	}
 
-	// 如果配置了ResponseSchema，设置结构化输出格式
-	if geminiConf.ResponseSchema != nil {
-		// 请求JSON格式响应
-		model.ResponseMIMEType = "application/json"
-
-		// 创建Schema实例 - 使用vertexai/genai包的TypeObject常量
-		// 根据搜索结果，TypeObject = 6
-		schema := &genai.Schema{
-			Type:        6, // TypeObject = 6
-			Description: geminiConf.ResponseSchema.Description,
-			Properties:  make(map[string]*genai.Schema),
-		}
-
-		// 如果有需要，还可以进一步转换properties
-		// 注意：这里只是一个简化的转换示例
-
-		// 设置ResponseSchema
-		model.ResponseSchema = schema
-	}
+	// 构造并返回响应
+	return &openai.ChatCompletionResponse{
+		ID:      uniqueID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Index: 0,
+				Message: openai.ChatCompletionMessage{
+					Role:      openai.ChatMessageRoleAssistant,
+					Content:   message.Content,
+					ToolCalls: toolCalls,
+				},
+				FinishReason: geminiFinishReason(candidate.FinishReason, len(toolCalls) > 0),
+			},
+		},
+		Usage: usage,
+	}, nil
+}
 
-	// 设置是否启用代码执行
-	if geminiConf.EnableCodeExecution {
-		// 注意：启用代码执行可能存在安全风险，应谨慎使用
-		fmt.Printf("警告：已为模型 %s 启用代码执行功能\n", req.Model)
+// GeminiStreamChatCompletion 使用Google Gemini服务创建流式聊天完成
+func GeminiStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	if req.Model == "" {
+		return nil, ErrModelNotSpecified
 	}
 
-	// 转换消息为Gemini格式
-	chat := model.StartChat()
-	for i := 0; i < len(schemaMessages)-1; i++ {
-		msg := schemaMessages[i]
-		parts := []genai.Part{genai.Text(msg.Content)}
-		content := &genai.Content{
-			Role:  toGeminiRole(msg.Role),
-			Parts: parts,
-		}
-		chat.History = append(chat.History, content)
+	chat, parts, err := startGeminiChat(req)
+	if err != nil {
+		return nil, err
 	}
 
 	// 发送最后一条消息（流式）
-	lastMsg := schemaMessages[len(schemaMessages)-1]
-	streamIter := chat.SendMessageStream(ctx, genai.Text(lastMsg.Content))
+	streamIter := chat.SendMessageStream(requestContext(req.ctx), parts...)
+
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	return convertGeminiStream(streamIter, req.Model, includeUsage), nil
+}
+
+// geminiStreamIterator Gemini流式响应的迭代器
+type geminiStreamIterator interface {
+	Next() (*genai.GenerateContentResponse, error)
+}
 
+// convertGeminiStream 将Gemini的流式响应转换为OpenAI格式的流式响应
+// 每个functionCall分配递增的下标；includeUsage为true时在流的最后追加一个只包含usage的数据块
+func convertGeminiStream(streamIter geminiStreamIterator, model string, includeUsage bool) *schema.StreamReader[*openai.ChatCompletionStreamResponse] {
 	// 创建结果通道
-	resultReader, resultWriter := schema.Pipe[*ChatCompletionStreamResponse](10)
+	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](10)
 
 	// 启动goroutine处理流式数据
 	go func() {
@@ -612,7 +545,7 @@ func GeminiStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 			if panicErr := recover(); panicErr != nil {
 				// 捕获panic并打印详细信息
 				stack := debug.Stack()
-				fmt.Printf("Gemini Stream处理发生异常: %v\n堆栈: %s\n", panicErr, string(stack))
+				getLogger().Error("Gemini Stream处理发生异常", "panic", panicErr, "stack", string(stack))
 				// 发送错误信息给resultWriter
 				_ = resultWriter.Send(nil, fmt.Errorf("Gemini Stream处理发生异常: %v", panicErr))
 			}
@@ -623,62 +556,95 @@ func GeminiStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 		// 生成唯一ID
 		uniqueID := fmt.Sprintf("gemini-stream-%d", time.Now().UnixNano())
 		created := time.Now().Unix()
+		toolCallIDs := newStreamToolCallIDs("gemini", uniqueID)
+		toolCallCount := 0
+		var usage *openai.Usage
 
 		for {
 			resp, err := streamIter.Next()
-			if errors.Is(err, io.EOF) {
+			if errors.Is(err, iterator.Done) || errors.Is(err, io.EOF) {
 				// 流结束
 				break
 			}
 			if err != nil {
 				// 处理错误
-				_ = resultWriter.Send(nil, fmt.Errorf("从Gemini接收流数据失败: %v", err))
+				_ = resultWriter.Send(nil, fmt.Errorf("从Gemini接收流数据失败: %w", newProviderError("gemini", err)))
 				return
 			}
 
-			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			// 记录使用情况，以最后一次返回的为准
+			if resp.UsageMetadata != nil {
+				geminiUsage := convertGeminiUsage(resp.UsageMetadata)
+				usage = &geminiUsage
+			}
+			if len(resp.Candidates) == 0 {
 				continue
 			}
-
-			content := ""
-			for _, part := range resp.Candidates[0].Content.Parts {
-				if text, ok := part.(genai.Text); ok {
-					content += string(text)
+			candidate := resp.Candidates[0]
+
+			message := &schema.Message{}
+			if candidate.Content != nil {
+				message, err = convertGeminiContentToSchemaMessage(candidate.Content, toolCallCount)
+				if err != nil {
+					_ = resultWriter.Send(nil, err)
+					return
 				}
 			}
+			toolCallCount += len(message.ToolCalls)
+			toolCalls, err := convertSchemaStreamToolCallsToOpenAI(message.ToolCalls)
+			if err != nil {
+				_ = resultWriter.Send(nil, fmt.Errorf("转换工具调用失败: %w", err))
+				return
+			}
+			toolCallIDs.fill(toolCalls)
+
+			if message.Content == "" && len(toolCalls) == 0 && candidate.FinishReason == genai.FinishReasonUnspecified {
+				continue
+			}
 
 			// 构造流式响应
-			streamResp := &ChatCompletionStreamResponse{
+			streamResp := &openai.ChatCompletionStreamResponse{
 				ID:      uniqueID,
 				Object:  "chat.completion.chunk",
 				Created: created,
-				Model:   req.Model,
-				Choices: []ChatCompletionStreamChoice{
+				Model:   model,
+				Choices: []openai.ChatCompletionStreamChoice{
 					{
 						Index: 0,
-						Delta: ChatCompletionStreamDelta{
-							Role:    "assistant",
-							Content: content,
+						Delta: openai.ChatCompletionStreamChoiceDelta{
+							Role:      openai.ChatMessageRoleAssistant,
+							Content:   message.Content,
+							ToolCalls: toolCalls,
 						},
-						FinishReason: "",
 					},
 				},
 			}
 
 			// 如果是最后一条消息，设置完成原因
-			if resp.Candidates[0].FinishReason != genai.FinishReasonUnspecified {
-				streamResp.Choices[0].FinishReason = resp.Candidates[0].FinishReason.String()
+			if candidate.FinishReason != genai.FinishReasonUnspecified {
+				streamResp.Choices[0].FinishReason = geminiFinishReason(candidate.FinishReason, toolCallCount > 0)
 			}
 
 			// 发送流式响应
-			closed := resultWriter.Send(streamResp, nil)
-			if closed {
+			if closed := resultWriter.Send(streamResp, nil); closed {
 				return
 			}
 		}
+
+		// 按stream_options.include_usage在最后追加使用情况
+		if includeUsage && usage != nil {
+			_ = resultWriter.Send(&openai.ChatCompletionStreamResponse{
+				ID:      uniqueID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []openai.ChatCompletionStreamChoice{},
+				Usage:   usage,
+			}, nil)
+		}
 	}()
 
-	return resultReader, nil
+	return resultReader
 }
 
 // GeminiStreamChatCompletionToChat 使用Google Gemini服务创建流式聊天完成并转换为聊天流格式
@@ -688,7 +654,11 @@ func GeminiStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("调用Gemini流式聊天接口失败: %w", err)
 	}
-	// 注意：由于streamReader没有Close方法，我们不需要defer close
+	// 提前返回（如请求的上下文被取消）时关闭流，使转换协程及时退出
+	defer streamReader.Close()
+
+	// 按需丢弃重复的连续增量
+	dedupe := newDeltaDeduper(req.DedupeStreamDeltas)
 
 	// 处理流式响应
 	for {
@@ -697,56 +667,411 @@ func GeminiStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("接收Gemini流式响应失败: %w", err)
+			// 写入错误帧和结束标记后返回，避免客户端收到被截断的流
+			return writeStreamError(writer, fmt.Errorf("接收Gemini流式响应失败: %w", err))
 		}
 
-		// 转换响应格式
-		choices := make([]StreamChoice, 0, len(response.Choices))
-		for _, choice := range response.Choices {
-			choices = append(choices, StreamChoice{
-				Index: choice.Index,
-				Delta: StreamChoiceDelta{
-					Role:    choice.Delta.Role,
-					Content: choice.Delta.Content,
-				},
-				FinishReason: choice.FinishReason,
-			})
+		if dedupe.shouldDropOpenAI(response) {
+			continue
 		}
 
-		streamResp := StreamResponse{
-			ID:      response.ID,
-			Object:  response.Object,
-			Created: response.Created,
-			Model:   response.Model,
-			Choices: choices,
+		// 将响应写入writer，过大的内容会被拆分为多个帧
+		for _, frame := range splitOpenAIStreamResponse(response, req.MaxSSEFrameBytes) {
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return fmt.Errorf("序列化流式响应失败: %w", err)
+			}
+
+			// 添加data:前缀
+			if _, err := writer.Write([]byte("data: ")); err != nil {
+				return fmt.Errorf("写入流式响应前缀失败: %w", err)
+			}
+
+			if _, err := writer.Write(data); err != nil {
+				return fmt.Errorf("写入流式响应失败: %w", err)
+			}
+
+			if _, err := writer.Write([]byte("\n\n")); err != nil {
+				return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			}
 		}
+	}
+
+	// 添加结束标记
+	if _, err := writer.Write([]byte("data: [DONE]\n\n")); err != nil {
+		return fmt.Errorf("写入流式响应结束标记失败: %w", err)
+	}
+
+	return nil
+}
+
+// startGeminiChat 选择凭证并创建对话，返回历史消息已填入的会话和最后一条消息的内容
+func startGeminiChat(req ChatRequest) (*genai.ChatSession, []genai.Part, error) {
+	// 创建Gemini配置
+	conf := &Config{
+		Vendor:                 "gemini",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+	}
+
+	// 获取Gemini配置
+	geminiConf, err := conf.getGeminiConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取Gemini配置失败: %v", err)
+	}
+
+	// 转换消息格式，工具调用和工具结果分别转换为functionCall和functionResponse
+	schemaMessages, err := convertChatRequestToSchemaMessages(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("转换消息失败: %w", err)
+	}
+	systemInstruction, contents, err := convertSchemaMessagesToGeminiContents(schemaMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(contents) == 0 {
+		return nil, nil, fmt.Errorf("消息列表不能为空")
+	}
+
+	// 创建生成模型，使用配置中的规范模型名称
+	model := geminiConf.Client.GenerativeModel(conf.Model)
+	model.SystemInstruction = systemInstruction
 
-		// 将响应写入writer
-		data, err := json.Marshal(streamResp)
+	// 设置参数
+	if req.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxTokens))
+	}
+	if req.Temperature > 0 {
+		model.SetTemperature(req.Temperature)
+	}
+	if req.TopP > 0 {
+		model.SetTopP(req.TopP)
+	}
+	if geminiConf.TopK != nil {
+		model.SetTopK(*geminiConf.TopK)
+	}
+	if len(req.Stop) > 0 {
+		model.StopSequences = req.Stop
+	}
+
+	// 设置安全级别
+	if len(geminiConf.SafetySettings) > 0 {
+		model.SafetySettings = geminiConf.SafetySettings
+	}
+
+	// 如果配置了ResponseSchema，设置结构化输出格式
+	if geminiConf.ResponseSchema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = convertOpenAPISchemaToGemini(geminiConf.ResponseSchema)
+	}
+
+	// 设置是否启用代码执行
+	if geminiConf.EnableCodeExecution {
+		// 注意：启用代码执行可能存在安全风险，应谨慎使用
+		getLogger().Debug("已启用代码执行功能", "provider", "gemini", "model", conf.Model)
+	}
+
+	// 绑定工具
+	model.Tools, err = convertOpenAIToolsToGemini(req.Tools)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(model.Tools) > 0 {
+		model.ToolConfig, err = geminiToolConfig(req.ToolChoice)
 		if err != nil {
-			return fmt.Errorf("序列化流式响应失败: %w", err)
+			return nil, nil, err
 		}
+	}
 
-		// 添加data:前缀
-		if _, err := writer.Write([]byte("data: ")); err != nil {
-			return fmt.Errorf("写入流式响应前缀失败: %w", err)
+	// 除最后一条消息外均作为历史消息
+	chat := model.StartChat()
+	chat.History = contents[:len(contents)-1]
+	return chat, contents[len(contents)-1].Parts, nil
+}
+
+// convertSchemaMessagesToGeminiContents 将消息转换为Gemini的对话内容
+// 系统消息合并为SystemInstruction；助手的工具调用转换为functionCall，工具消息转换为functionResponse；
+// 连续的同角色消息（如多个并行工具调用的结果）合并为一条内容
+func convertSchemaMessagesToGeminiContents(messages []*schema.Message) (*genai.Content, []*genai.Content, error) {
+	var systemInstruction *genai.Content
+	var contents []*genai.Content
+	// 工具调用ID对应的函数名称，工具消息未设置name时使用
+	toolNames := make(map[string]string)
+
+	for _, msg := range messages {
+		var parts []genai.Part
+		switch msg.Role {
+		case schema.System:
+			if systemInstruction == nil {
+				systemInstruction = &genai.Content{}
+			}
+			systemInstruction.Parts = append(systemInstruction.Parts, geminiMessageParts(msg)...)
+			continue
+		case schema.Tool:
+			name := msg.Name
+			if name == "" {
+				name = toolNames[msg.ToolCallID]
+			}
+			if name == "" {
+				return nil, nil, fmt.Errorf("工具消息 %s 找不到对应的函数名称", msg.ToolCallID)
+			}
+			parts = []genai.Part{genai.FunctionResponse{Name: name, Response: geminiFunctionResponse(msg.Content)}}
+		case schema.Assistant:
+			parts = geminiMessageParts(msg)
+			for _, call := range msg.ToolCalls {
+				args := map[string]any{}
+				if strings.TrimSpace(call.Function.Arguments) != "" {
+					if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+						return nil, nil, fmt.Errorf("解析工具调用 %s 的参数失败: %v", call.Function.Name, err)
+					}
+				}
+				toolNames[call.ID] = call.Function.Name
+				parts = append(parts, genai.FunctionCall{Name: call.Function.Name, Args: args})
+			}
+		default:
+			parts = geminiMessageParts(msg)
+		}
+		if len(parts) == 0 {
+			continue
 		}
 
-		if _, err := writer.Write(data); err != nil {
-			return fmt.Errorf("写入流式响应失败: %w", err)
+		role := toGeminiRole(msg.Role)
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
 		}
+		contents = append(contents, &genai.Content{Role: role, Parts: parts})
+	}
+	return systemInstruction, contents, nil
+}
 
-		if _, err := writer.Write([]byte("\n\n")); err != nil {
-			return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+// geminiMessageParts 转换消息的文本和多模态内容，媒体只支持base64格式的data URL
+func geminiMessageParts(msg *schema.Message) []genai.Part {
+	if len(msg.MultiContent) == 0 {
+		if msg.Content == "" {
+			return nil
 		}
+		return []genai.Part{genai.Text(msg.Content)}
 	}
 
-	// 添加结束标记
-	if _, err := writer.Write([]byte("data: [DONE]\n\n")); err != nil {
-		return fmt.Errorf("写入流式响应结束标记失败: %w", err)
+	parts := make([]genai.Part, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		var mediaURL string
+		switch {
+		case part.Type == schema.ChatMessagePartTypeText:
+			if part.Text != "" {
+				parts = append(parts, genai.Text(part.Text))
+			}
+			continue
+		case part.ImageURL != nil:
+			mediaURL = part.ImageURL.URL
+		case part.AudioURL != nil:
+			mediaURL = part.AudioURL.URL
+		case part.VideoURL != nil:
+			mediaURL = part.VideoURL.URL
+		case part.FileURL != nil:
+			mediaURL = part.FileURL.URL
+		}
+		if blob, ok := geminiBlobFromDataURL(mediaURL); ok {
+			parts = append(parts, blob)
+		} else {
+			getLogger().Warn("Gemini只支持内联的媒体内容，已跳过", "provider", "gemini", "type", part.Type)
+		}
 	}
+	return parts
+}
 
-	return nil
+// geminiBlobFromDataURL 解析base64格式的data URL
+func geminiBlobFromDataURL(dataURL string) (genai.Blob, bool) {
+	header, payload, found := strings.Cut(dataURL, ",")
+	if !found || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return genai.Blob{}, false
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return genai.Blob{}, false
+	}
+	// 去掉name等参数，只保留MIME类型
+	mimeType, _, _ := strings.Cut(strings.TrimPrefix(header, "data:"), ";")
+	return genai.Blob{MIMEType: mimeType, Data: data}, true
+}
+
+// geminiFunctionResponse 将工具结果转换为functionResponse的response字段
+// 结果是JSON对象时直接使用，否则放在content字段中
+func geminiFunctionResponse(content string) map[string]any {
+	var response map[string]any
+	if err := json.Unmarshal([]byte(content), &response); err == nil && response != nil {
+		return response
+	}
+	return map[string]any{"content": content}
+}
+
+// convertOpenAIToolsToGemini 将openai.Tool转换为Gemini的函数声明
+func convertOpenAIToolsToGemini(tools []openai.Tool) ([]*genai.Tool, error) {
+	schemaTools, err := convertOpenAIToolsToSchemaTools(tools)
+	if err != nil || len(schemaTools) == 0 {
+		return nil, err
+	}
+
+	declarations := make([]*genai.FunctionDeclaration, 0, len(schemaTools))
+	for _, tool := range schemaTools {
+		declaration := &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Desc,
+		}
+		if tool.ParamsOneOf != nil {
+			params, err := tool.ToOpenAPIV3()
+			if err != nil {
+				return nil, fmt.Errorf("转换工具 %s 的参数定义失败: %w", tool.Name, err)
+			}
+			declaration.Parameters = convertOpenAPISchemaToGemini(params)
+		}
+		declarations = append(declarations, declaration)
+	}
+	return []*genai.Tool{{FunctionDeclarations: declarations}}, nil
+}
+
+// convertOpenAPISchemaToGemini 将openapi3.Schema转换为Gemini的Schema，Gemini不支持的字段会被忽略
+func convertOpenAPISchemaToGemini(s *openapi3.Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+
+	result := &genai.Schema{
+		Type:        geminiSchemaType(s.Type),
+		Format:      s.Format,
+		Description: s.Description,
+		Nullable:    s.Nullable,
+		Required:    s.Required,
+	}
+	for _, value := range s.Enum {
+		result.Enum = append(result.Enum, fmt.Sprint(value))
+	}
+	if s.Items != nil {
+		result.Items = convertOpenAPISchemaToGemini(s.Items.Value)
+	}
+	if len(s.Properties) > 0 {
+		result.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, prop := range s.Properties {
+			if prop != nil && prop.Value != nil {
+				result.Properties[name] = convertOpenAPISchemaToGemini(prop.Value)
+			}
+		}
+	}
+	return result
+}
+
+// geminiSchemaType 将JSON Schema的类型名称转换为Gemini的类型
+func geminiSchemaType(schemaType string) genai.Type {
+	switch schemaType {
+	case openapi3.TypeString:
+		return genai.TypeString
+	case openapi3.TypeNumber:
+		return genai.TypeNumber
+	case openapi3.TypeInteger:
+		return genai.TypeInteger
+	case openapi3.TypeBoolean:
+		return genai.TypeBoolean
+	case openapi3.TypeArray:
+		return genai.TypeArray
+	case openapi3.TypeObject:
+		return genai.TypeObject
+	default:
+		return genai.TypeUnspecified
+	}
+}
+
+// geminiToolConfig 将tool_choice转换为Gemini的函数调用模式
+// "required"/"force"对应ANY，"none"对应NONE，指定函数时只允许调用该函数，其他情况由模型决定
+func geminiToolConfig(toolChoice any) (*genai.ToolConfig, error) {
+	name, err := namedToolChoice(toolChoice)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		return &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{
+			Mode:                 genai.FunctionCallingAny,
+			AllowedFunctionNames: []string{name},
+		}}, nil
+	}
+
+	choice, _ := toolChoice.(string)
+	switch strings.ToLower(choice) {
+	case "required", "force":
+		return &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingAny}}, nil
+	case "none":
+		return &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingNone}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// convertGeminiContentToSchemaMessage 将Gemini返回的内容转换为消息，functionCall转换为ToolCalls
+// firstIndex为第一个工具调用的下标，流式响应中按已收到的工具调用数量递增
+func convertGeminiContentToSchemaMessage(content *genai.Content, firstIndex int) (*schema.Message, error) {
+	message := &schema.Message{Role: schema.Assistant}
+	for _, part := range content.Parts {
+		var call genai.FunctionCall
+		switch p := part.(type) {
+		case genai.Text:
+			message.Content += string(p)
+			continue
+		case genai.FunctionCall:
+			call = p
+		case *genai.FunctionCall:
+			call = *p
+		default:
+			continue
+		}
+
+		args, err := json.Marshal(call.Args)
+		if err != nil {
+			return nil, fmt.Errorf("序列化工具调用 %s 的参数失败: %v", call.Name, err)
+		}
+		index := firstIndex + len(message.ToolCalls)
+		message.ToolCalls = append(message.ToolCalls, schema.ToolCall{
+			Index: &index,
+			Type:  string(openai.ToolTypeFunction),
+			Function: schema.FunctionCall{
+				Name:      call.Name,
+				Arguments: string(args),
+			},
+		})
+	}
+	return message, nil
+}
+
+// geminiFinishReason 将Gemini的结束原因转换为OpenAI格式，调用了工具时为tool_calls
+func geminiFinishReason(reason genai.FinishReason, hasToolCalls bool) openai.FinishReason {
+	switch {
+	case hasToolCalls:
+		return openai.FinishReasonToolCalls
+	case reason == genai.FinishReasonMaxTokens:
+		return openai.FinishReasonLength
+	case reason == genai.FinishReasonSafety || reason == genai.FinishReasonRecitation:
+		return openai.FinishReasonContentFilter
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+// convertGeminiUsage 转换Token使用情况
+func convertGeminiUsage(metadata *genai.UsageMetadata) openai.Usage {
+	return openai.Usage{
+		PromptTokens:     int(metadata.PromptTokenCount),
+		CompletionTokens: int(metadata.CandidatesTokenCount),
+		TotalTokens:      int(metadata.TotalTokenCount),
+	}
 }
 
 // 用于将schema.RoleType转换为Gemini的角色类型
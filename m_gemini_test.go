@@ -332,3 +332,147 @@ func TestGeminiStreamChatCompletion(t *testing.T) {
 func TestGeminiStreamChatCompletionToChat(t *testing.T) {
 	t.Skip("此测试需要进一步设置模拟环境")
 }
+
+// TestConvertSchemaMessagesToGeminiContents 测试工具调用和工具结果转换为functionCall和functionResponse
+func TestConvertSchemaMessagesToGeminiContents(t *testing.T) {
+	messages := []*schema.Message{
+		schema.SystemMessage("你是天气助手"),
+		schema.UserMessage("北京和上海的天气怎么样"),
+		schema.AssistantMessage("", []schema.ToolCall{
+			{ID: "call_1", Type: "function", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+			{ID: "call_2", Type: "function", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"上海"}`}},
+		}),
+		schema.ToolMessage(`{"temperature":20}`, "call_1"),
+		schema.ToolMessage("晴", "call_2"),
+	}
+
+	systemInstruction, contents, err := convertSchemaMessagesToGeminiContents(messages)
+	assert.NoError(t, err)
+	assert.Equal(t, []genai.Part{genai.Text("你是天气助手")}, systemInstruction.Parts)
+	if assert.Len(t, contents, 3) {
+		assert.Equal(t, "user", contents[0].Role)
+		assert.Equal(t, "model", contents[1].Role)
+		assert.Equal(t, []genai.Part{
+			genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "北京"}},
+			genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "上海"}},
+		}, contents[1].Parts)
+
+		// 并行工具调用的结果合并为一条内容，函数名称按ToolCallID查找
+		assert.Equal(t, "user", contents[2].Role)
+		assert.Equal(t, []genai.Part{
+			genai.FunctionResponse{Name: "get_weather", Response: map[string]any{"temperature": float64(20)}},
+			genai.FunctionResponse{Name: "get_weather", Response: map[string]any{"content": "晴"}},
+		}, contents[2].Parts)
+	}
+
+	// 找不到对应工具调用的工具消息
+	_, _, err = convertSchemaMessagesToGeminiContents([]*schema.Message{schema.ToolMessage("晴", "call_x")})
+	assert.Error(t, err)
+}
+
+// TestConvertOpenAIToolsToGemini 测试工具定义和tool_choice的转换
+func TestConvertOpenAIToolsToGemini(t *testing.T) {
+	tools := []openai.Tool{{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "get_weather",
+			Description: "查询天气",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"city": map[string]any{"type": "string", "description": "城市"},
+					"days": map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+				},
+				"required": []any{"city"},
+			},
+		},
+	}}
+
+	geminiTools, err := convertOpenAIToolsToGemini(tools)
+	assert.NoError(t, err)
+	if assert.Len(t, geminiTools, 1) && assert.Len(t, geminiTools[0].FunctionDeclarations, 1) {
+		declaration := geminiTools[0].FunctionDeclarations[0]
+		assert.Equal(t, "get_weather", declaration.Name)
+		assert.Equal(t, "查询天气", declaration.Description)
+		if assert.NotNil(t, declaration.Parameters) {
+			assert.Equal(t, genai.TypeObject, declaration.Parameters.Type)
+			assert.Equal(t, []string{"city"}, declaration.Parameters.Required)
+			assert.Equal(t, genai.TypeString, declaration.Parameters.Properties["city"].Type)
+			assert.Equal(t, genai.TypeInteger, declaration.Parameters.Properties["days"].Items.Type)
+		}
+	}
+
+	noTools, err := convertOpenAIToolsToGemini(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, noTools)
+
+	config, err := geminiToolConfig("required")
+	assert.NoError(t, err)
+	assert.Equal(t, genai.FunctionCallingAny, config.FunctionCallingConfig.Mode)
+	config, err = geminiToolConfig("none")
+	assert.NoError(t, err)
+	assert.Equal(t, genai.FunctionCallingNone, config.FunctionCallingConfig.Mode)
+	config, err = geminiToolConfig(openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: "get_weather"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"get_weather"}, config.FunctionCallingConfig.AllowedFunctionNames)
+	config, err = geminiToolConfig("auto")
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+}
+
+// TestConvertGeminiStream 测试流式响应中的文本、functionCall、结束原因和使用情况
+func TestConvertGeminiStream(t *testing.T) {
+	iter := &MockStreamIterator{responses: []*genai.GenerateContentResponse{
+		{Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []genai.Part{genai.Text("我来查一下")}}}}},
+		{Candidates: []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []genai.Part{
+			genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "北京"}},
+		}}}}},
+		{
+			Candidates: []*genai.Candidate{{
+				Content: &genai.Content{Role: "model", Parts: []genai.Part{
+					genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "上海"}},
+				}},
+				FinishReason: genai.FinishReasonStop,
+			}},
+			UsageMetadata: &genai.UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, TotalTokenCount: 15},
+		},
+	}}
+
+	reader := convertGeminiStream(iter, "gemini-1.5-pro", true)
+	var chunks []*openai.ChatCompletionStreamResponse
+	for {
+		chunk, err := reader.Recv()
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if assert.Len(t, chunks, 4) {
+		assert.Equal(t, "我来查一下", chunks[0].Choices[0].Delta.Content)
+		assert.Equal(t, "gemini-1.5-pro", chunks[0].Model)
+
+		first := chunks[1].Choices[0].Delta.ToolCalls
+		second := chunks[2].Choices[0].Delta.ToolCalls
+		if assert.Len(t, first, 1) && assert.Len(t, second, 1) {
+			assert.Equal(t, 0, *first[0].Index)
+			assert.Equal(t, 1, *second[0].Index, "工具调用的下标在整个流中递增")
+			assert.Equal(t, `{"city":"北京"}`, first[0].Function.Arguments)
+			assert.NotEmpty(t, first[0].ID)
+			assert.NotEqual(t, first[0].ID, second[0].ID)
+		}
+		assert.Equal(t, openai.FinishReasonToolCalls, chunks[2].Choices[0].FinishReason)
+
+		assert.Empty(t, chunks[3].Choices)
+		assert.Equal(t, 15, chunks[3].Usage.TotalTokens)
+	}
+}
+
+// TestGeminiFinishReason 测试结束原因的转换
+func TestGeminiFinishReason(t *testing.T) {
+	assert.Equal(t, openai.FinishReasonStop, geminiFinishReason(genai.FinishReasonStop, false))
+	assert.Equal(t, openai.FinishReasonLength, geminiFinishReason(genai.FinishReasonMaxTokens, false))
+	assert.Equal(t, openai.FinishReasonContentFilter, geminiFinishReason(genai.FinishReasonSafety, false))
+	assert.Equal(t, openai.FinishReasonToolCalls, geminiFinishReason(genai.FinishReasonStop, true))
+}
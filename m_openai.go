@@ -7,35 +7,32 @@ import (
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"io"
-	"math/rand"
-	"net/http"
-	"net/url"
-	"os"
 	"path/filepath"
 	"time"
 
 	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/schema"
-	"gopkg.in/yaml.v2"
 )
 
 // 直接使用原始结构体类型
 type OpenAICredential struct {
-	Name           string   `yaml:"name"`
-	ApiKey         string   `yaml:"api_key"`
-	OrganizationID string   `yaml:"organization_id"`
-	Enabled        bool     `yaml:"enabled"`
-	Weight         int      `yaml:"weight"`
-	QPSLimit       int      `yaml:"qps_limit"`
-	Description    string   `yaml:"description"`
-	Models         []string `yaml:"models"`
-	BaseURL        string   `yaml:"base_url"`
-	Timeout        int      `yaml:"timeout"`
-	Proxy          string   `yaml:"proxy"`
+	Name           string        `yaml:"name"`
+	ApiKey         string        `yaml:"api_key"`
+	OrganizationID string        `yaml:"organization_id"`
+	Enabled        bool          `yaml:"enabled"`
+	Weight         int           `yaml:"weight"`
+	QPSLimit       int           `yaml:"qps_limit"`
+	MaxConcurrent  int           `yaml:"max_concurrent"`
+	Description    string        `yaml:"description"`
+	Models         []string      `yaml:"models"`
+	BaseURL        string        `yaml:"base_url"`
+	Timeout        int           `yaml:"timeout"`
+	Proxy          string        `yaml:"proxy"`
+	TLS            CredentialTLS `yaml:",inline"` // 自定义CA/客户端证书
 }
 
-// 修改配置文件结构定义
-var openaiConfig struct {
+// openaiConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type openaiConfigFile struct {
 	Environments map[string]struct {
 		Credentials []OpenAICredential `yaml:"credentials"`
 	} `yaml:"environments"`
@@ -55,15 +52,8 @@ func (c *Config) getOpenAIConfig() (*einoopenai.ChatModelConfig, error) {
 	}
 
 	// 读取配置文件
-	yamlFile, err := os.ReadFile(filepath.Join(LLMConfigPath, "openai.yaml"))
+	openaiConfig, secrets, err := loadConfigFile[openaiConfigFile](filepath.Join(LLMConfigPath, "openai.yaml"), "OpenAI")
 	if err != nil {
-		return nil, fmt.Errorf("读取OpenAI配置文件失败: %v", err)
-	}
-
-	err = yaml.Unmarshal(yamlFile, &openaiConfig)
-	if err != nil {
-		fmt.Printf("解析OpenAI配置文件失败: %v", err)
-		//抛出异常
 		return nil, err
 	}
 
@@ -73,11 +63,18 @@ func (c *Config) getOpenAIConfig() (*einoopenai.ChatModelConfig, error) {
 		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
 	}
 
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred OpenAICredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
 	// 存储启用的配置
 	var enabledCredentials []OpenAICredential
 
 	// 遍历该环境下的所有凭证配置
-	for _, cred := range envConfig.Credentials {
+	for _, cred := range credentials {
 		// 只添加启用的配置
 		if cred.Enabled {
 			enabledCredentials = append(enabledCredentials, cred)
@@ -89,66 +86,52 @@ func (c *Config) getOpenAIConfig() (*einoopenai.ChatModelConfig, error) {
 		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
 	}
 
-	// 根据权重选择配置
-	var selectedCred OpenAICredential
-	if len(enabledCredentials) > 1 {
-		// 计算总权重
-		totalWeight := 0
-		for _, cred := range enabledCredentials {
-			totalWeight += cred.Weight
-		}
-
-		// 生成一个随机数,范围是[0, totalWeight)
-		randomNum := rand.Intn(totalWeight)
-
-		// 根据权重选择配置
-		currentWeight := 0
-
-		for _, cred := range enabledCredentials {
-			currentWeight += cred.Weight
-			if randomNum < currentWeight {
-				selectedCred = cred
-				break
-			}
-		}
-	} else {
-		// 如果只有一个配置,直接使用
-		selectedCred = enabledCredentials[0]
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred OpenAICredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
 	}
 
-	// 确保OpenAI配置存在
-	if c.VendorOptional == nil {
-		c.VendorOptional = &VendorOptional{}
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "openai:"+env, enabledCredentials,
+		func(cred OpenAICredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
 	}
-	if c.VendorOptional.OpenAIConfig == nil {
-		c.VendorOptional.OpenAIConfig = &OpenAIConfig{}
+	// 只校验选中凭证的证书文件，结果在配置文件未变化期间缓存
+	if err := validateCredentialTLS(selectedCred.TLS); err != nil {
+		return nil, fmt.Errorf("凭证 %s 的TLS配置无效: %v", selectedCred.Name, err)
 	}
-
-	// 设置HTTP客户端
-	if c.VendorOptional.OpenAIConfig.HTTPClient == nil {
-		c.VendorOptional.OpenAIConfig.HTTPClient = &http.Client{}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.BaseURL)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
 	}
-
-	// 如果有超时设置
-	if selectedCred.Timeout > 0 {
-		c.VendorOptional.OpenAIConfig.HTTPClient.Timeout = time.Duration(selectedCred.Timeout) * time.Second
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
 	}
+	// 按支持的模型列表使用规范的模型名称
+	c.canonicalizeModel(selectedCred.Models)
 
-	// 设置代理(如果有)
-	if selectedCred.Proxy != "" {
-		// 设置代理URL
-		c.ProxyURL = selectedCred.Proxy
+	// 只读取厂商配置而不写回，多个请求可以并发共享同一个OpenAIConfig
+	var openaiOpts OpenAIConfig
+	if c.VendorOptional != nil && c.VendorOptional.OpenAIConfig != nil {
+		openaiOpts = *c.VendorOptional.OpenAIConfig
+	}
 
-		// 设置代理
-		c.VendorOptional.OpenAIConfig.HTTPClient.Transport = &http.Transport{
-			Proxy: func(req *http.Request) (*url.URL, error) {
-				return url.Parse(selectedCred.Proxy)
-			},
-		}
+	// 代理、TLS和超时相同的请求复用HTTP连接；请求指定的代理优先于凭证的代理，且不进入连接池
+	proxy := c.effectiveProxy(selectedCred.Proxy)
+	if proxy != "" {
+		c.ProxyURL = proxy
+	}
+	httpClient, err := c.callHTTPClient("openai", openaiOpts.HTTPClient, selectedCred.Proxy, selectedCred.TLS, selectedCred.Timeout)
+	if err != nil {
+		return nil, err
 	}
 
 	// 解密API密钥
-	_, decryptFunc1, err := InitRSAKeyManager()
+	decryptFunc1, err := cachedDecryptFunc(env, secrets)
 	if err != nil {
 		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
 	}
@@ -175,13 +158,13 @@ func (c *Config) getOpenAIConfig() (*einoopenai.ChatModelConfig, error) {
 		TopP:        c.TopP,
 		Stop:        c.Stop,
 		// 补充额外参数
-		HTTPClient:       c.VendorOptional.OpenAIConfig.HTTPClient,
-		PresencePenalty:  c.VendorOptional.OpenAIConfig.PresencePenalty,
-		FrequencyPenalty: c.VendorOptional.OpenAIConfig.FrequencyPenalty,
-		LogitBias:        c.VendorOptional.OpenAIConfig.LogitBias,
-		ResponseFormat:   c.VendorOptional.OpenAIConfig.ResponseFormat,
-		Seed:             c.VendorOptional.OpenAIConfig.Seed,
-		User:             c.VendorOptional.OpenAIConfig.User,
+		HTTPClient:       httpClient,
+		PresencePenalty:  openaiOpts.PresencePenalty,
+		FrequencyPenalty: openaiOpts.FrequencyPenalty,
+		LogitBias:        openaiOpts.LogitBias,
+		ResponseFormat:   openaiOpts.ResponseFormat,
+		Seed:             openaiOpts.Seed,
+		User:             openaiOpts.User,
 	}
 	return nConf, nil
 }
@@ -190,12 +173,21 @@ func (c *Config) getOpenAIConfig() (*einoopenai.ChatModelConfig, error) {
 func OpenAICreateChatCompletion(req ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
 	// 创建OpenAI配置
 	conf := &Config{
-		Vendor:      "openai",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "openai",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.credentialName,
+		DeterministicSelection: req.deterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		RequestProxy:           req.proxy,
+		RequestTimeout:         req.timeout,
 	}
 
 	// 获取OpenAI配置
@@ -203,12 +195,20 @@ func OpenAICreateChatCompletion(req ChatCompletionRequest) (*openai.ChatCompleti
 	if err != nil {
 		return nil, fmt.Errorf("获取OpenAI配置失败: %v", err)
 	}
+	if req.Seed != nil {
+		openaiConf.Seed = req.Seed // 请求中的seed优先于厂商配置
+	}
+	penaltiesFromCompletionRequest(req).applyToOpenAI(openaiConf)
+	if err := applyRequestResponseFormat(openaiConf, req.ResponseFormat); err != nil {
+		return nil, err
+	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
-	// 创建聊天模型
-	chatModel, err := einoopenai.NewChatModel(ctx, openaiConf)
+	// 创建聊天模型，从原始响应体中读取eino-ext未转换的refusal等字段
+	callConf, capture := captureRawResponse(withoutClientTimeout(openaiConf, conf.callTimeout))
+	chatModel, err := einoopenai.NewChatModel(ctx, callConf)
 	if err != nil {
 		return nil, fmt.Errorf("创建聊天模型失败: %v", err)
 	}
@@ -223,10 +223,12 @@ func OpenAICreateChatCompletion(req ChatCompletionRequest) (*openai.ChatCompleti
 		}
 	}
 
-	// 调用Generate方法获取响应
-	resp, err := chatModel.Generate(ctx, schemaMessages)
+	// 调用Generate方法获取响应，上游卡住时超时返回错误
+	generateCtx, cancel := withCallTimeout(ctx, conf.callTimeout)
+	defer cancel()
+	resp, err := chatModel.Generate(generateCtx, schemaMessages)
 	if err != nil {
-		return nil, fmt.Errorf("调用Generate方法失败: %v", err)
+		return nil, fmt.Errorf("调用Generate方法失败: %w", newProviderError("openai", err))
 	}
 
 	// 构造ChatCompletionChoice
@@ -241,10 +243,12 @@ func OpenAICreateChatCompletion(req ChatCompletionRequest) (*openai.ChatCompleti
 		},
 	}
 
-	// 如果有完成原因，使用它
-	if resp.ResponseMeta != nil && resp.ResponseMeta.FinishReason != "" {
-		choices[0].FinishReason = openai.FinishReason(resp.ResponseMeta.FinishReason)
+	// 如果有完成原因，使用它；调用了工具时统一为tool_calls
+	if finishReason := normalizeFinishReason(rawFinishReasonFromMessage(resp), len(resp.ToolCalls) > 0); finishReason != "" {
+		choices[0].FinishReason = finishReason
 	}
+	req.recordRawFinishReason(rawFinishReasonFromMessage(resp))
+	setChoiceRefusal(&choices[0], capture.response().refusal())
 
 	// 生成唯一ID
 	uniqueID := fmt.Sprintf("openai-%d", time.Now().UnixNano())
@@ -267,6 +271,9 @@ func OpenAICreateChatCompletion(req ChatCompletionRequest) (*openai.ChatCompleti
 		Model:   req.Model,
 		Choices: choices,
 		Usage:   usage,
+
+		// 后端配置的标识，与seed一起用于判断输出是否可复现
+		SystemFingerprint: capture.response().systemFingerprint(),
 	}, nil
 }
 
@@ -276,7 +283,7 @@ func OpenAICreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRe
 	model := req.Model
 	if model == "" {
 		// 如果没有指定模型，可以设置一个默认值或返回错误
-		return nil, fmt.Errorf("未指定模型名称")
+		return nil, ErrModelNotSpecified
 	}
 
 	temperature := float32(req.Temperature)
@@ -286,17 +293,31 @@ func OpenAICreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRe
 	messages := make([]ChatMessage, 0, len(req.Messages))
 	for _, msg := range req.Messages {
 		messages = append(messages, ChatMessage{
-			Role:    msg.Role,
+			Role:    normalizeMessageRole(msg),
 			Content: msg.Content,
 		})
 	}
 
 	// 创建OpenAI请求
 	openaiReq := ChatCompletionRequest{
-		Model:       model,
-		Messages:    messages,
-		Temperature: temperature,
-		MaxTokens:   maxTokens,
+		Model:                  model,
+		Messages:               messages,
+		Temperature:            temperature,
+		MaxTokens:              maxTokens,
+		PresenceP:              req.PresencePenalty,
+		FrequencyP:             req.FrequencyPenalty,
+		LogitBias:              req.LogitBias,
+		ResponseFormat:         req.ResponseFormat,
+		Seed:                   req.Seed,
+		onCredentialSelected:   req.onCredentialSelected,
+		credentialName:         req.CredentialName,
+		deterministicSelection: req.DeterministicSelection,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		proxy:                  req.Proxy,
+		timeout:                req.Timeout,
+		onRawFinishReason:      req.onRawFinishReason,
 	}
 
 	// 调用OpenAI服务
@@ -305,7 +326,7 @@ func OpenAICreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRe
 		return nil, fmt.Errorf("调用OpenAI聊天接口失败: %w", err)
 	}
 
-	return &openai.ChatCompletionResponse{
+	return applyRefusalHandling(&openai.ChatCompletionResponse{
 		ID:      resp.ID,
 		Object:  resp.Object,
 		Created: resp.Created,
@@ -316,19 +337,29 @@ func OpenAICreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionRe
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
-	}, nil
+		SystemFingerprint: resp.SystemFingerprint,
+	}, req.RefusalHandling)
 }
 
 // OpenAIStreamChatCompletion 使用OpenAI服务创建流式聊天完成
 func OpenAIStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatCompletionStreamResponse], error) {
 	// 创建OpenAI配置
 	conf := &Config{
-		Vendor:      "openai",
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: &req.Temperature,
-		TopP:        &req.TopP,
-		Stop:        req.Stop,
+		Vendor:                 "openai",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		RequestProxy:           req.Proxy,
+		RequestTimeout:         req.Timeout,
 	}
 
 	// 获取OpenAI配置
@@ -336,12 +367,19 @@ func OpenAIStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	if err != nil {
 		return nil, fmt.Errorf("获取OpenAI配置失败: %v", err)
 	}
+	if req.Seed != nil {
+		openaiConf.Seed = req.Seed // 请求中的seed优先于厂商配置
+	}
+	penaltiesFromChatRequest(req).applyToOpenAI(openaiConf)
+	if err := applyRequestResponseFormat(openaiConf, req.ResponseFormat); err != nil {
+		return nil, err
+	}
 
 	// 创建上下文
-	ctx := context.Background()
+	ctx := requestContext(req.ctx)
 
 	// 创建聊天模型
-	chatModel, err := einoopenai.NewChatModel(ctx, openaiConf)
+	chatModel, err := einoopenai.NewChatModel(ctx, withoutClientTimeout(openaiConf, conf.callTimeout))
 	if err != nil {
 		return nil, fmt.Errorf("创建聊天模型失败: %v", err)
 	}
@@ -349,18 +387,22 @@ func OpenAIStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	// 转换消息格式
 	schemaMessages := make([]*schema.Message, len(req.Messages))
 	for i, msg := range req.Messages {
-		role := schema.RoleType(msg.Role)
+		role := schema.RoleType(normalizeMessageRole(msg))
 		schemaMessages[i] = &schema.Message{
 			Role:    role,
 			Content: msg.Content,
 		}
 	}
 
-	// 调用Stream方法获取流式响应
-	streamReader, err := chatModel.Stream(ctx, schemaMessages)
+	// 调用Stream方法获取流式响应，长时间收不到数据块时超时返回错误
+	streamReader, err := streamWithIdleTimeout(ctx, conf.callTimeout, func(ctx context.Context) (*schema.StreamReader[*schema.Message], error) {
+		return chatModel.Stream(ctx, schemaMessages)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("调用Stream方法失败: %v", err)
+		return nil, fmt.Errorf("调用Stream方法失败: %w", newProviderError("openai", err))
 	}
+	// 跳过个别格式错误的数据帧
+	streamReader = skipMalformedStreamFrames("openai", streamReader)
 
 	// 创建结果通道
 	resultReader, resultWriter := schema.Pipe[*ChatCompletionStreamResponse](10)
@@ -369,7 +411,7 @@ func OpenAIStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 	go func() {
 		defer func() {
 			if panicErr := recover(); panicErr != nil {
-				fmt.Printf("OpenAI Stream处理发生异常: %v\n", panicErr)
+				getLogger().Error("OpenAI Stream处理发生异常", "panic", panicErr)
 			}
 			streamReader.Close()
 			resultWriter.Close()
@@ -388,7 +430,7 @@ func OpenAIStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 			}
 			if err != nil {
 				// 处理错误
-				_ = resultWriter.Send(nil, fmt.Errorf("从OpenAI接收流数据失败: %v", err))
+				_ = resultWriter.Send(nil, fmt.Errorf("从OpenAI接收流数据失败: %w", newProviderError("openai", err)))
 				return
 			}
 
@@ -412,7 +454,7 @@ func OpenAIStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*ChatComp
 
 			// 如果是最后一条消息，设置完成原因
 			if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
-				streamResp.Choices[0].FinishReason = message.ResponseMeta.FinishReason
+				streamResp.Choices[0].FinishReason = string(normalizeFinishReason(message.ResponseMeta.FinishReason, len(message.ToolCalls) > 0))
 			}
 
 			// 发送流式响应
@@ -434,7 +476,11 @@ func OpenAIStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("调用OpenAI流式聊天接口失败: %w", err)
 	}
-	// 注意：由于streamReader没有Close方法，我们不需要defer close
+	// 提前返回（如请求的上下文被取消）时关闭流，使转换协程及时退出
+	defer streamReader.Close()
+
+	// 按需丢弃重复的连续增量
+	dedupe := newDeltaDeduper(req.DedupeStreamDeltas)
 
 	// 处理流式响应
 	for {
@@ -443,7 +489,8 @@ func OpenAIStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("接收OpenAI流式响应失败: %w", err)
+			// 写入错误帧和结束标记后返回，避免客户端收到被截断的流
+			return writeStreamError(writer, fmt.Errorf("接收OpenAI流式响应失败: %w", err))
 		}
 
 		// 转换响应格式
@@ -467,23 +514,29 @@ func OpenAIStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
 			Choices: choices,
 		}
 
-		// 将响应写入writer
-		data, err := json.Marshal(streamResp)
-		if err != nil {
-			return fmt.Errorf("序列化流式响应失败: %w", err)
+		if dedupe.shouldDropLocal(streamResp) {
+			continue
 		}
 
-		// 添加data:前缀
-		if _, err := writer.Write([]byte("data: ")); err != nil {
-			return fmt.Errorf("写入流式响应前缀失败: %w", err)
-		}
+		// 将响应写入writer，过大的内容会被拆分为多个帧
+		for _, frame := range splitStreamResponse(streamResp, req.MaxSSEFrameBytes) {
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return fmt.Errorf("序列化流式响应失败: %w", err)
+			}
 
-		if _, err := writer.Write(data); err != nil {
-			return fmt.Errorf("写入流式响应失败: %w", err)
-		}
+			// 添加data:前缀
+			if _, err := writer.Write([]byte("data: ")); err != nil {
+				return fmt.Errorf("写入流式响应前缀失败: %w", err)
+			}
 
-		if _, err := writer.Write([]byte("\n\n")); err != nil {
-			return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			if _, err := writer.Write(data); err != nil {
+				return fmt.Errorf("写入流式响应失败: %w", err)
+			}
+
+			if _, err := writer.Write([]byte("\n\n")); err != nil {
+				return fmt.Errorf("写入流式响应分隔符失败: %w", err)
+			}
 		}
 	}
 
@@ -0,0 +1,217 @@
+package einox
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultQwenBaseURL 阿里云百炼（DashScope）的OpenAI兼容接口地址
+const defaultQwenBaseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+
+// QwenCredential 定义了通义千问模型的凭证配置，通过DashScope的OpenAI兼容接口调用
+type QwenCredential struct {
+	Name          string        `yaml:"name"`
+	APIKey        string        `yaml:"api_key"`
+	BaseURL       string        `yaml:"base_url"` // 默认为DashScope的OpenAI兼容接口，国际站可改为dashscope-intl
+	Enabled       bool          `yaml:"enabled"`
+	Weight        int           `yaml:"weight"`
+	QPSLimit      int           `yaml:"qps_limit"`
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	Description   string        `yaml:"description"`
+	Models        []string      `yaml:"models"`
+	Timeout       int           `yaml:"timeout"`
+	Proxy         string        `yaml:"proxy"`
+	TLS           CredentialTLS `yaml:",inline"` // 自定义CA/客户端证书
+}
+
+// qwenConfigFile 配置文件结构定义，解析结果按文件缓存并在调用之间共享，只能读取
+type qwenConfigFile struct {
+	Environments map[string]struct {
+		Credentials []QwenCredential `yaml:"credentials"`
+	} `yaml:"environments"`
+}
+
+// getQwenConfig 获取通义千问配置，返回的模型配置与Azure共用OpenAI兼容的调用路径
+func (c *Config) getQwenConfig() (*einoopenai.ChatModelConfig, error) {
+	// 使用统一定义的环境变量
+	env := ENV
+	if env == "" {
+		env = "development"
+	}
+	//读取环境变量
+	err := LoadLLMConfigPathFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("读取LLM配置路径失败: %v", err)
+	}
+
+	// 读取通义千问配置文件
+	qwenConfig, secrets, err := loadConfigFile[qwenConfigFile](filepath.Join(LLMConfigPath, "qwen.yaml"), "Qwen")
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取指定环境的配置
+	envConfig, ok := qwenConfig.Environments[env]
+	if !ok {
+		return nil, fmt.Errorf("未找到环境 %s 的配置", env)
+	}
+
+	// 指定了CredentialName时只使用该凭证
+	credentials, err := pinnedCredentials(c, env, envConfig.Credentials,
+		func(cred QwenCredential) (string, bool) { return cred.Name, cred.Enabled })
+	if err != nil {
+		return nil, err
+	}
+
+	// 存储启用的配置
+	var enabledCredentials []QwenCredential
+	for _, cred := range credentials {
+		if cred.Enabled {
+			enabledCredentials = append(enabledCredentials, cred)
+		}
+	}
+
+	// 如果没有启用的配置,返回错误
+	if len(enabledCredentials) == 0 {
+		return nil, fmt.Errorf("环境 %s 中没有启用的配置", env)
+	}
+
+	// 只在支持请求模型的凭证中选择
+	enabledCredentials, err = credentialsForModel(c, env, enabledCredentials,
+		func(cred QwenCredential) []string { return cred.Models })
+	if err != nil {
+		return nil, err
+	}
+
+	// 按凭证选择策略链选择配置，故障转移时跳过已失败的凭证
+	selectedCred, err := selectConfigCredential(c, "qwen:"+env, enabledCredentials,
+		func(cred QwenCredential) (string, int) { return cred.Name, cred.Weight })
+	if err != nil {
+		return nil, err
+	}
+	// 只校验选中凭证的证书文件，结果在配置文件未变化期间缓存
+	if err := validateCredentialTLS(selectedCred.TLS); err != nil {
+		return nil, fmt.Errorf("凭证 %s 的TLS配置无效: %v", selectedCred.Name, err)
+	}
+	c.recordSelectedCredential(selectedCred.Name, selectedCred.BaseURL)
+	if err := c.waitForQPSLimit(selectedCred.Name, selectedCred.QPSLimit); err != nil {
+		return nil, err
+	}
+	c.recordCallTimeout(selectedCred.Timeout)
+	if err := c.acquireConcurrencySlot(selectedCred.Name, selectedCred.MaxConcurrent); err != nil {
+		return nil, err
+	}
+	// 按支持的模型列表使用规范的模型名称
+	c.canonicalizeModel(selectedCred.Models)
+
+	// 解密API密钥
+	decryptFunc, err := cachedDecryptFunc(env, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
+	}
+	apiKey, err := decryptFunc(selectedCred.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密失败: %v", err)
+	}
+
+	// 获取HTTP客户端，代理、TLS和超时相同的请求复用同一个客户端，请求指定的代理不进入连接池
+	httpClient, err := c.callHTTPClient("qwen", nil, selectedCred.Proxy, selectedCred.TLS, selectedCred.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := selectedCred.BaseURL
+	if baseURL == "" {
+		baseURL = defaultQwenBaseURL
+	}
+
+	return &einoopenai.ChatModelConfig{
+		ByAzure:     false,
+		APIKey:      apiKey,
+		BaseURL:     baseURL,
+		Model:       c.Model,
+		MaxTokens:   &c.MaxTokens,
+		Temperature: c.Temperature,
+		TopP:        c.TopP,
+		Stop:        c.Stop,
+		HTTPClient:  httpClient,
+	}, nil
+}
+
+// newQwenRequestConfig 根据请求创建通义千问配置，同时返回本次调用的超时时间
+func newQwenRequestConfig(req ChatRequest) (*einoopenai.ChatModelConfig, time.Duration, error) {
+	conf := &Config{
+		Vendor:                 "qwen",
+		Model:                  req.Model,
+		MaxTokens:              req.MaxTokens,
+		Temperature:            &req.Temperature,
+		TopP:                   &req.TopP,
+		Stop:                   req.Stop,
+		SelectionKey:           req.User,
+		CredentialName:         req.CredentialName,
+		DeterministicSelection: req.DeterministicSelection,
+		onCredentialSelected:   req.onCredentialSelected,
+		concurrencySlots:       req.concurrencySlots,
+		credentialFallback:     req.credentialFallback,
+		ctx:                    req.ctx,
+		RequestProxy:           req.Proxy,
+		RequestTimeout:         req.Timeout,
+	}
+
+	qwenConf, err := conf.getQwenConfig()
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取Qwen配置失败: %v", err)
+	}
+	if req.Seed != nil {
+		qwenConf.Seed = req.Seed
+	}
+	penaltiesFromChatRequest(req).applyToOpenAI(qwenConf)
+	return qwenConf, conf.callTimeout, nil
+}
+
+// QwenCreateChatCompletionToChat 使用通义千问创建聊天完成接口，支持工具调用
+func QwenCreateChatCompletionToChat(req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	if req.Model == "" {
+		return nil, ErrModelNotSpecified
+	}
+
+	qwenConf, timeout, err := newQwenRequestConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 响应的Model使用请求中的模型名称
+	resp, err := generateWithOpenAIModel(req, "qwen", "Qwen", qwenConf, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("调用Qwen聊天接口失败: %w", err)
+	}
+	return resp, nil
+}
+
+// QwenStreamChatCompletion 使用通义千问创建流式聊天完成
+func QwenStreamChatCompletion(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	if req.Model == "" {
+		return nil, ErrModelNotSpecified
+	}
+
+	qwenConf, timeout, err := newQwenRequestConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	return streamWithOpenAIModel(req, "qwen", "Qwen", qwenConf, timeout)
+}
+
+// QwenStreamChatCompletionToChat 使用通义千问创建流式聊天完成并转换为聊天流格式
+func QwenStreamChatCompletionToChat(req ChatRequest, writer io.Writer) error {
+	streamReader, err := QwenStreamChatCompletion(req)
+	if err != nil {
+		return fmt.Errorf("调用Qwen流式聊天接口失败: %w", err)
+	}
+	return writeOpenAIStreamToChat(req, "Qwen", streamReader, writer)
+}
@@ -0,0 +1,72 @@
+package einox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGetQwenConfigFromFile 测试从配置文件读取通义千问凭证
+func TestGetQwenConfigFromFile(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("sk-qwen")
+	assert.NoError(t, err)
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: dashscope
+        api_key: %s
+        enabled: true
+        weight: 1
+        timeout: 60
+        models:
+          - qwen-max
+          - qwen-plus
+  production:
+    credentials:
+      - name: intl
+        api_key: %s
+        base_url: https://dashscope-intl.aliyuncs.com/compatible-mode/v1
+        enabled: true
+        weight: 1
+`, cipher, cipher)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "qwen.yaml"), []byte(configContent), 0644))
+
+	conf, err := (&Config{Vendor: "qwen", Model: " qwen-max "}).getQwenConfig()
+	if assert.NoError(t, err) {
+		assert.False(t, conf.ByAzure)
+		assert.Equal(t, "sk-qwen", conf.APIKey)
+		assert.Equal(t, defaultQwenBaseURL, conf.BaseURL, "未配置base_url时使用DashScope的兼容接口")
+		assert.Equal(t, "qwen-max", conf.Model, "模型名称首尾的空白被去除")
+		assert.Equal(t, 60*time.Second, conf.HTTPClient.Timeout)
+	}
+
+	ENV = "production"
+	conf, err = (&Config{Vendor: "qwen", Model: "qwen-max"}).getQwenConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://dashscope-intl.aliyuncs.com/compatible-mode/v1", conf.BaseURL)
+	}
+}
+
+// TestQwenRequiresModel 测试未指定模型时返回错误
+func TestQwenRequiresModel(t *testing.T) {
+	_, err := QwenCreateChatCompletionToChat(ChatRequest{Provider: "qwen"})
+	assert.ErrorIs(t, err, ErrModelNotSpecified)
+	_, err = QwenStreamChatCompletion(ChatRequest{Provider: "qwen"})
+	assert.ErrorIs(t, err, ErrModelNotSpecified)
+}
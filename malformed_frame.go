@@ -0,0 +1,79 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// defaultMaxMalformedStreamFrames 默认最多跳过的格式错误数据帧数
+const defaultMaxMalformedStreamFrames = 3
+
+// maxMalformedStreamFrames 单个流最多跳过的格式错误数据帧数，0表示不跳过
+var maxMalformedStreamFrames atomic.Int64
+
+func init() {
+	maxMalformedStreamFrames.Store(defaultMaxMalformedStreamFrames)
+}
+
+// SetMaxMalformedStreamFrames 设置单个流最多跳过的格式错误（JSON无法解析）数据帧数
+// 供应商偶尔在流中返回一帧无法解析的JSON，跳过后流可以继续；
+// 超过该数量时按原有方式返回错误。设为0表示遇到格式错误立即返回错误，默认为3
+func SetMaxMalformedStreamFrames(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxMalformedStreamFrames.Store(int64(n))
+}
+
+// isMalformedFrameError 判断错误是否由数据帧的JSON格式错误引起
+func isMalformedFrameError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// skipMalformedStreamFrames 包装供应商的流，跳过格式错误的数据帧并记录警告
+func skipMalformedStreamFrames[T any](provider string, streamReader *schema.StreamReader[T]) *schema.StreamReader[T] {
+	limit := int(maxMalformedStreamFrames.Load())
+	if limit == 0 {
+		return streamReader
+	}
+
+	resultReader, resultWriter := schema.Pipe[T](10)
+	go func() {
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				getLogger().Error("过滤格式错误数据帧的goroutine发生异常", "panic", panicErr)
+			}
+			streamReader.Close()
+			resultWriter.Close()
+		}()
+
+		skipped := 0
+		for {
+			chunk, err := streamReader.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				if isMalformedFrameError(err) && skipped < limit {
+					skipped++
+					getLogger().Warn("跳过流中格式错误的数据帧", "provider", provider, "skipped", skipped, "limit", limit, "error", err)
+					continue
+				}
+				var zero T
+				_ = resultWriter.Send(zero, err)
+				return
+			}
+			if closed := resultWriter.Send(chunk, nil); closed {
+				return
+			}
+		}
+	}()
+
+	return resultReader
+}
@@ -0,0 +1,74 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造一个解析JSON失败的错误
+func newMalformedFrameError() error {
+	var v map[string]any
+	return json.Unmarshal([]byte(`{"choices":[{"delta":`), &v)
+}
+
+// 读取流中的全部内容，返回内容和遇到的错误
+func collectMessageStream(streamReader *schema.StreamReader[*schema.Message]) ([]string, error) {
+	var contents []string
+	for {
+		msg, err := streamReader.Recv()
+		if errors.Is(err, io.EOF) {
+			return contents, nil
+		}
+		if err != nil {
+			return contents, err
+		}
+		contents = append(contents, msg.Content)
+	}
+}
+
+// 测试单个格式错误的数据帧被跳过，流继续
+func TestSkipMalformedStreamFrames(t *testing.T) {
+	reader, writer := schema.Pipe[*schema.Message](5)
+	writer.Send(&schema.Message{Content: "你"}, nil)
+	writer.Send(nil, newMalformedFrameError())
+	writer.Send(&schema.Message{Content: "好"}, nil)
+	writer.Close()
+
+	contents, err := collectMessageStream(skipMalformedStreamFrames("azure", reader))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"你", "好"}, contents)
+}
+
+// 测试超过阈值后返回错误
+func TestSkipMalformedStreamFramesLimit(t *testing.T) {
+	SetMaxMalformedStreamFrames(1)
+	defer SetMaxMalformedStreamFrames(defaultMaxMalformedStreamFrames)
+
+	reader, writer := schema.Pipe[*schema.Message](5)
+	writer.Send(nil, newMalformedFrameError())
+	writer.Send(&schema.Message{Content: "你"}, nil)
+	writer.Send(nil, newMalformedFrameError())
+	writer.Send(&schema.Message{Content: "好"}, nil)
+	writer.Close()
+
+	contents, err := collectMessageStream(skipMalformedStreamFrames("azure", reader))
+	assert.True(t, isMalformedFrameError(err))
+	assert.Equal(t, []string{"你"}, contents)
+}
+
+// 测试其他错误不会被跳过
+func TestSkipMalformedStreamFramesOtherError(t *testing.T) {
+	reader, writer := schema.Pipe[*schema.Message](5)
+	writer.Send(nil, errors.New("连接中断"))
+	writer.Send(&schema.Message{Content: "你"}, nil)
+	writer.Close()
+
+	contents, err := collectMessageStream(skipMalformedStreamFrames("azure", reader))
+	assert.EqualError(t, err, "连接中断")
+	assert.Empty(t, contents)
+}
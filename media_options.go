@@ -0,0 +1,203 @@
+package einox
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultMaxImageBytes 默认的下载远程图片最大字节数
+	defaultMaxImageBytes = 20 << 20
+	// defaultImageFetchTimeout 默认的下载远程图片超时时间（秒）
+	defaultImageFetchTimeout = 30
+)
+
+// ErrImageURLNotAllowed 远程图片的地址不是http/https，或解析到回环、内网、链路本地等地址，不下载
+var ErrImageURLNotAllowed = errors.New("不允许下载该地址的图片")
+
+// MediaOptions 处理请求中多模态内容的选项，只能由服务端设置，不从请求体解析
+// 各项不能超过SetMediaFetchPolicy设置的上限，超过时按上限处理
+type MediaOptions struct {
+	// MaxImageBytes 下载远程图片的最大字节数，超过时返回ImageTooLargeError，不大于0时使用服务端上限
+	MaxImageBytes int64 `json:"max_image_bytes,omitempty"`
+
+	// ImageFetchTimeout 下载远程图片的超时时间（秒），不大于0时使用服务端上限
+	ImageFetchTimeout int `json:"image_fetch_timeout,omitempty"`
+}
+
+// MediaFetchPolicy 服务端下载远程图片的策略
+type MediaFetchPolicy struct {
+	// MaxImageBytes 下载远程图片的最大字节数上限，也是请求未指定时的默认值，不大于0时为20MB
+	MaxImageBytes int64
+
+	// Timeout 下载远程图片的超时时间上限，也是请求未指定时的默认值，不大于0时为30秒
+	Timeout time.Duration
+
+	// AllowPrivateNetworks 为true时允许下载回环、内网和链路本地地址的图片，默认拒绝以防止SSRF
+	AllowPrivateNetworks bool
+}
+
+var (
+	mediaFetchPolicyMu sync.RWMutex
+	mediaFetchPolicy   MediaFetchPolicy
+)
+
+// SetMediaFetchPolicy 设置服务端下载远程图片的策略，请求的MediaOptions不能超过其中的上限
+func SetMediaFetchPolicy(policy MediaFetchPolicy) {
+	mediaFetchPolicyMu.Lock()
+	defer mediaFetchPolicyMu.Unlock()
+	mediaFetchPolicy = policy
+}
+
+// getMediaFetchPolicy 获取当前的下载策略，未设置的上限使用默认值
+func getMediaFetchPolicy() MediaFetchPolicy {
+	mediaFetchPolicyMu.RLock()
+	policy := mediaFetchPolicy
+	mediaFetchPolicyMu.RUnlock()
+	if policy.MaxImageBytes <= 0 {
+		policy.MaxImageBytes = defaultMaxImageBytes
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultImageFetchTimeout * time.Second
+	}
+	return policy
+}
+
+// maxImageBytes 获取下载远程图片的最大字节数，不超过服务端上限
+func (o *MediaOptions) maxImageBytes() int64 {
+	limit := getMediaFetchPolicy().MaxImageBytes
+	if o == nil || o.MaxImageBytes <= 0 || o.MaxImageBytes > limit {
+		return limit
+	}
+	return o.MaxImageBytes
+}
+
+// imageFetchTimeout 获取下载远程图片的超时时间，不超过服务端上限
+func (o *MediaOptions) imageFetchTimeout() time.Duration {
+	limit := getMediaFetchPolicy().Timeout
+	if o == nil || o.ImageFetchTimeout <= 0 {
+		return limit
+	}
+	return min(time.Duration(o.ImageFetchTimeout)*time.Second, limit)
+}
+
+// imageFetchTransport 下载远程图片使用的传输，不使用代理，建立连接时检查实际连接的IP，重定向后的连接同样会检查
+var imageFetchTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: checkImageFetchAddress,
+	}).DialContext,
+	MaxIdleConns:        10,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// checkImageFetchAddress 拒绝连接回环、内网、链路本地、组播和未指定地址，AllowPrivateNetworks为true时不检查
+func checkImageFetchAddress(network, address string, _ syscall.RawConn) error {
+	if getMediaFetchPolicy().AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrImageURLNotAllowed, address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrImageURLNotAllowed, address)
+	}
+	return nil
+}
+
+// checkImageURLScheme 只允许http和https
+func checkImageURLScheme(imageURL string) error {
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %s", ErrImageURLNotAllowed, imageURL)
+	}
+	return nil
+}
+
+// ImageTooLargeError 远程图片超过MaxImageBytes限制，调用方可通过errors.As识别
+type ImageTooLargeError struct {
+	// URL 图片地址
+	URL string
+	// Limit 允许的最大字节数
+	Limit int64
+}
+
+// Error 实现error接口
+func (e *ImageTooLargeError) Error() string {
+	return fmt.Sprintf("图片 %s 超过%d字节的大小限制", e.URL, e.Limit)
+}
+
+// fetchImageURL 按大小和超时限制下载远程图片，返回图片内容和响应中的Content-Type
+// 只下载http/https地址，默认拒绝回环、内网和链路本地地址，见MediaFetchPolicy
+// 响应头声明的长度超过限制时不读取内容；未声明长度时最多读取限制加一个字节用于判断
+func fetchImageURL(imageURL string, opts *MediaOptions) ([]byte, string, error) {
+	if err := checkImageURLScheme(imageURL); err != nil {
+		return nil, "", err
+	}
+	limit := opts.maxImageBytes()
+	client := &http.Client{
+		Transport: imageFetchTransport,
+		Timeout:   opts.imageFetchTimeout(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("重定向次数过多")
+			}
+			return checkImageURLScheme(req.URL.String())
+		},
+	}
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("下载图片失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("下载图片失败，状态码: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > limit {
+		return nil, "", &ImageTooLargeError{URL: imageURL, Limit: limit}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("读取图片内容失败: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, "", &ImageTooLargeError{URL: imageURL, Limit: limit}
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// imageMIMEType 优先根据图片内容开头的字节识别类型，其次使用响应中的图片Content-Type，最后按URL后缀推断
+func imageMIMEType(data []byte, contentType, imageURL string) string {
+	if mimeType, ok := sniffImageMIMEType(data); ok {
+		return mimeType
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasPrefix(mediaType, "image/") {
+		return mediaType
+	}
+	return detectMIMEType(imageURL)
+}
+
+// convertImageURLToBase64 下载远程图片并编码为base64的data URL，返回data URL和MIME类型
+func convertImageURLToBase64(imageURL string, opts *MediaOptions) (string, string, error) {
+	data, contentType, err := fetchImageURL(imageURL, opts)
+	if err != nil {
+		return "", "", err
+	}
+	mimeType := imageMIMEType(data, contentType, imageURL)
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), mimeType, nil
+}
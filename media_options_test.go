@@ -0,0 +1,174 @@
+package einox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造包含远程图片的请求
+func newRemoteImageRequest(imageURL string, opts *MediaOptions) ChatRequest {
+	return ChatRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{
+					{Type: openai.ChatMessagePartTypeText, Text: "描述这张图片"},
+					{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: imageURL}},
+				},
+			}},
+		},
+		MediaOptions: opts,
+	}
+}
+
+// allowPrivateImageFetch 允许下载本机测试服务器上的图片，测试结束后恢复默认策略
+func allowPrivateImageFetch(t *testing.T) {
+	SetMediaFetchPolicy(MediaFetchPolicy{AllowPrivateNetworks: true})
+	t.Cleanup(func() { SetMediaFetchPolicy(MediaFetchPolicy{}) })
+}
+
+// 测试下载远程图片并编码为base64
+func TestConvertImageURLToBase64(t *testing.T) {
+	allowPrivateImageFetch(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png-data"))
+	}))
+	defer server.Close()
+
+	messages, err := convertChatRequestToSchemaMessages(newRemoteImageRequest(server.URL+"/a", nil))
+	assert.NoError(t, err)
+	imageURL := messages[0].MultiContent[1].ImageURL
+	assert.Equal(t, "data:image/png;base64,cG5nLWRhdGE=", imageURL.URL)
+	assert.Equal(t, "image/png", imageURL.MIMEType)
+}
+
+// 测试图片超过大小限制时返回ImageTooLargeError
+func TestConvertImageURLTooLarge(t *testing.T) {
+	allowPrivateImageFetch(t)
+	body := strings.Repeat("x", 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// 不声明长度，需读取后判断
+			w.Header().Set("Content-Type", "image/png")
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		_, err := convertChatRequestToSchemaMessages(newRemoteImageRequest(server.URL+path, &MediaOptions{MaxImageBytes: 32}))
+		var tooLarge *ImageTooLargeError
+		if assert.True(t, errors.As(err, &tooLarge), "路径 %s 应返回ImageTooLargeError", path) {
+			assert.Equal(t, int64(32), tooLarge.Limit)
+			assert.Equal(t, server.URL+path, tooLarge.URL)
+		}
+	}
+
+	// 未超过限制时正常转换
+	messages, err := convertChatRequestToSchemaMessages(newRemoteImageRequest(server.URL+"/sized", &MediaOptions{MaxImageBytes: 64}))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(messages[0].MultiContent[1].ImageURL.URL, "data:"))
+}
+
+// 测试下载超时或失败时保留原URL
+func TestConvertImageURLTimeout(t *testing.T) {
+	allowPrivateImageFetch(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+		w.Write([]byte("late"))
+	}))
+	defer server.Close()
+
+	messages, err := convertChatRequestToSchemaMessages(newRemoteImageRequest(server.URL+"/slow.png", &MediaOptions{ImageFetchTimeout: 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/slow.png", messages[0].MultiContent[1].ImageURL.URL)
+}
+
+// 测试未设置时使用默认值
+func TestMediaOptionsDefaults(t *testing.T) {
+	var opts *MediaOptions
+	assert.Equal(t, int64(defaultMaxImageBytes), opts.maxImageBytes())
+	assert.Equal(t, 30*time.Second, opts.imageFetchTimeout())
+
+	opts = &MediaOptions{MaxImageBytes: 1024, ImageFetchTimeout: 5}
+	assert.Equal(t, int64(1024), opts.maxImageBytes())
+	assert.Equal(t, 5*time.Second, opts.imageFetchTimeout())
+
+	// 请求不能超过服务端上限
+	opts = &MediaOptions{MaxImageBytes: 1 << 40, ImageFetchTimeout: 3600}
+	assert.Equal(t, int64(defaultMaxImageBytes), opts.maxImageBytes())
+	assert.Equal(t, 30*time.Second, opts.imageFetchTimeout())
+
+	SetMediaFetchPolicy(MediaFetchPolicy{MaxImageBytes: 2048, Timeout: 2 * time.Second})
+	t.Cleanup(func() { SetMediaFetchPolicy(MediaFetchPolicy{}) })
+	assert.Equal(t, int64(2048), opts.maxImageBytes())
+	assert.Equal(t, 2*time.Second, opts.imageFetchTimeout())
+	opts = nil
+	assert.Equal(t, int64(2048), opts.maxImageBytes(), "未指定时使用服务端上限")
+}
+
+// 测试MediaOptions不从请求体解析
+func TestMediaOptionsNotParsedFromRequest(t *testing.T) {
+	var req ChatRequest
+	err := json.Unmarshal([]byte(`{"model":"gpt-4o","media_options":{"max_image_bytes":10000000000,"image_fetch_timeout":3600}}`), &req)
+	assert.NoError(t, err)
+	assert.Nil(t, req.MediaOptions)
+}
+
+// 测试默认拒绝非http/https地址以及回环、内网和链路本地地址，重定向到这些地址同样被拒绝
+func TestFetchImageURLRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png-data"))
+	}))
+	defer server.Close()
+
+	for _, imageURL := range []string{
+		server.URL + "/a.png",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/a.png",
+		"http://[::1]/a.png",
+		"file:///etc/passwd",
+		"ftp://example.com/a.png",
+	} {
+		_, _, err := fetchImageURL(imageURL, nil)
+		assert.ErrorIs(t, err, ErrImageURLNotAllowed, imageURL)
+	}
+
+	// 允许内网地址时，重定向到非http地址仍被拒绝
+	allowPrivateImageFetch(t)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	}))
+	defer redirect.Close()
+	_, _, err := fetchImageURL(redirect.URL, nil)
+	assert.ErrorIs(t, err, ErrImageURLNotAllowed)
+
+	data, _, err := fetchImageURL(server.URL+"/a.png", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "png-data", string(data))
+}
+
+// 测试拨号时按实际连接的IP检查，域名解析到内网地址或重定向到内网地址时同样被拒绝
+func TestImageFetchDialerChecksAddress(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer target.Close()
+	_, err := imageFetchTransport.DialContext(context.Background(), "tcp", strings.TrimPrefix(target.URL, "http://"))
+	assert.ErrorIs(t, err, ErrImageURLNotAllowed)
+
+	assert.NoError(t, checkImageFetchAddress("tcp", "93.184.216.34:443", nil))
+	assert.ErrorIs(t, checkImageFetchAddress("tcp6", "[fd00::1]:80", nil), ErrImageURLNotAllowed)
+}
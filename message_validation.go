@@ -0,0 +1,117 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrInvalidMessages 请求中的消息顺序或结构不合法
+var ErrInvalidMessages = errors.New("消息不合法")
+
+// MessageValidationError 消息校验失败时返回的错误，调用方可通过errors.As获取出错消息的下标
+type MessageValidationError struct {
+	// Index 出错消息在Messages中的下标，从0开始；与具体消息无关时为-1
+	Index int
+	// Reason 出错原因
+	Reason string
+}
+
+// Error 实现error接口
+func (e *MessageValidationError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%s: %s", ErrInvalidMessages, e.Reason)
+	}
+	return fmt.Sprintf("%s: 第%d条消息%s", ErrInvalidMessages, e.Index+1, e.Reason)
+}
+
+// Is 使errors.Is(err, ErrInvalidMessages)成立
+func (e *MessageValidationError) Is(target error) bool {
+	return target == ErrInvalidMessages
+}
+
+// validMessageRoles 允许的消息角色
+var validMessageRoles = map[string]bool{
+	openai.ChatMessageRoleSystem:    true,
+	openai.ChatMessageRoleUser:      true,
+	openai.ChatMessageRoleAssistant: true,
+	openai.ChatMessageRoleTool:      true,
+	openai.ChatMessageRoleFunction:  true,
+}
+
+// ValidateMessages 检查对话的消息是否结构完整，在发送前发现供应商只会以400拒绝的问题：
+//   - 至少有一条消息，且角色合法（只设置了ToolCallID的消息视为工具消息）
+//   - assistant消息中的工具调用都带有ID，且ID不重复
+//   - 每条工具消息的ToolCallID对应前面assistant消息中尚未返回结果的工具调用
+//   - assistant发起的工具调用在下一条user或assistant消息之前全部返回结果
+//
+// 不合法时返回 *MessageValidationError，指明出错消息的下标
+func ValidateMessages(req ChatRequest) error {
+	if len(req.Messages) == 0 {
+		return &MessageValidationError{Index: -1, Reason: "至少需要一条消息"}
+	}
+
+	// pending 最近一条assistant消息中尚未返回结果的工具调用ID，pendingIndex为该assistant消息的下标
+	var pending []string
+	pendingIndex := -1
+	answered := map[string]bool{}
+	for i, msg := range req.Messages {
+		role := normalizeMessageRole(msg)
+		if !validMessageRoles[role] {
+			return &MessageValidationError{Index: i, Reason: fmt.Sprintf("的角色%q不合法", msg.Role)}
+		}
+
+		switch role {
+		case openai.ChatMessageRoleTool:
+			if msg.ToolCallID == "" {
+				return &MessageValidationError{Index: i, Reason: "是工具消息，但没有设置ToolCallID"}
+			}
+			if answered[msg.ToolCallID] {
+				return &MessageValidationError{Index: i, Reason: fmt.Sprintf("重复返回了工具调用%q的结果", msg.ToolCallID)}
+			}
+			remaining := removeToolCallID(pending, msg.ToolCallID)
+			if len(remaining) == len(pending) {
+				return &MessageValidationError{Index: i, Reason: fmt.Sprintf("的ToolCallID %q没有对应的工具调用，工具消息必须跟在包含该工具调用的assistant消息之后", msg.ToolCallID)}
+			}
+			pending = remaining
+			answered[msg.ToolCallID] = true
+
+		case openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+			if len(pending) > 0 {
+				return &MessageValidationError{Index: i, Reason: fmt.Sprintf("之前，第%d条消息的工具调用%s尚未返回结果",
+					pendingIndex+1, strings.Join(pending, ", "))}
+			}
+			if role != openai.ChatMessageRoleAssistant {
+				continue
+			}
+			for _, call := range msg.ToolCalls {
+				if call.ID == "" {
+					return &MessageValidationError{Index: i, Reason: fmt.Sprintf("中的工具调用%s没有ID", call.Function.Name)}
+				}
+				if answered[call.ID] || slices.Contains(pending, call.ID) {
+					return &MessageValidationError{Index: i, Reason: fmt.Sprintf("中的工具调用ID %q重复", call.ID)}
+				}
+				pending = append(pending, call.ID)
+			}
+			if len(pending) > 0 {
+				pendingIndex = i
+			}
+		}
+	}
+
+	if len(pending) > 0 {
+		return &MessageValidationError{Index: pendingIndex, Reason: fmt.Sprintf("的工具调用%s尚未返回结果", strings.Join(pending, ", "))}
+	}
+	return nil
+}
+
+// removeToolCallID 返回去掉指定ID后的工具调用ID列表，不存在时原样返回
+func removeToolCallID(ids []string, id string) []string {
+	if i := slices.Index(ids, id); i >= 0 {
+		return slices.Delete(slices.Clone(ids), i, i+1)
+	}
+	return ids
+}
@@ -0,0 +1,112 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// newToolConversation 构造一轮完整的工具调用对话
+func newToolConversation() []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "你是天气助手"},
+		{Role: openai.ChatMessageRoleUser, Content: "北京和上海天气如何"},
+		{
+			Role: openai.ChatMessageRoleAssistant,
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_bj", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather"}},
+				{ID: "call_sh", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather"}},
+			},
+		},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_sh", Content: "上海：小雨"},
+		{ToolCallID: "call_bj", Content: "北京：晴"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "北京晴，上海小雨"},
+		{Role: openai.ChatMessageRoleUser, Content: "谢谢"},
+	}
+}
+
+// 测试结构完整的对话通过校验
+func TestValidateMessages(t *testing.T) {
+	req := ChatRequest{}
+	req.Messages = newToolConversation()
+	assert.NoError(t, ValidateMessages(req))
+}
+
+// 测试不合法的对话返回出错消息的下标
+func TestValidateMessagesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage
+		index  int
+		want   string
+	}{
+		{"没有消息", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage { return nil },
+			-1, "消息不合法: 至少需要一条消息"},
+		{"角色不合法", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			m[1].Role = "human"
+			return m
+		}, 1, `消息不合法: 第2条消息的角色"human"不合法`},
+		{"工具消息没有ToolCallID", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			m[3].ToolCallID = ""
+			return m
+		}, 3, "消息不合法: 第4条消息是工具消息，但没有设置ToolCallID"},
+		{"ToolCallID没有对应的工具调用", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			m[3].ToolCallID = "call_gz"
+			return m
+		}, 3, `消息不合法: 第4条消息的ToolCallID "call_gz"没有对应的工具调用，工具消息必须跟在包含该工具调用的assistant消息之后`},
+		{"工具结果出现在工具调用之前", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			return append([]openai.ChatCompletionMessage{m[3]}, m...)
+		}, 0, `消息不合法: 第1条消息的ToolCallID "call_sh"没有对应的工具调用，工具消息必须跟在包含该工具调用的assistant消息之后`},
+		{"重复返回结果", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			return append(m[:5:5], m[4], m[5])
+		}, 5, `消息不合法: 第6条消息重复返回了工具调用"call_bj"的结果`},
+		{"工具调用未返回结果就开始下一轮", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			return append(m[:4:4], m[5:]...)
+		}, 4, "消息不合法: 第5条消息之前，第3条消息的工具调用call_bj尚未返回结果"},
+		{"对话以未返回结果的工具调用结束", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			return m[:3]
+		}, 2, "消息不合法: 第3条消息的工具调用call_bj, call_sh尚未返回结果"},
+		{"工具调用没有ID", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			m[2].ToolCalls[0].ID = ""
+			return m
+		}, 2, "消息不合法: 第3条消息中的工具调用get_weather没有ID"},
+		{"工具调用ID重复", func(m []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+			m[2].ToolCalls[1].ID = "call_bj"
+			return m
+		}, 2, `消息不合法: 第3条消息中的工具调用ID "call_bj"重复`},
+	}
+	for _, tt := range tests {
+		req := ChatRequest{}
+		req.Messages = tt.modify(newToolConversation())
+		err := ValidateMessages(req)
+		assert.EqualError(t, err, tt.want, tt.name)
+		assert.ErrorIs(t, err, ErrInvalidMessages, tt.name)
+		var validationError *MessageValidationError
+		if assert.ErrorAs(t, err, &validationError, tt.name) {
+			assert.Equal(t, tt.index, validationError.Index, tt.name)
+		}
+	}
+}
+
+// 测试开启StrictValidation时不合法的请求不会发送给供应商
+func TestStrictValidation(t *testing.T) {
+	provider := registerFakeProvider(t, "strict")
+	req := ChatRequest{Provider: "strict"}
+	req.Model = "gpt-4o"
+	req.Messages = newToolConversation()[:3]
+
+	// 默认不校验
+	_, err := CreateChatCompletion(req, nil)
+	assert.NoError(t, err)
+	assert.Len(t, provider.req.Messages, 3)
+
+	provider.req = ChatRequest{}
+	req.StrictValidation = true
+	_, err = CreateChatCompletion(req, nil)
+	var validationError *MessageValidationError
+	if assert.ErrorAs(t, err, &validationError) {
+		assert.Equal(t, 2, validationError.Index)
+	}
+	assert.Empty(t, provider.req.Messages, "校验失败时不应调用供应商")
+}
@@ -0,0 +1,129 @@
+package einox
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsHook 指标回调，未设置的回调会被忽略
+// 通过 SetMetricsHook 注册，可对接Prometheus等监控系统，回调可能被多个goroutine同时调用
+type MetricsHook struct {
+	// OnConnection 每次请求获取到连接时调用，reused表示是否复用了连接池中的连接
+	// 目前只有azure、openai和qwen的HTTP客户端经过连接统计，bedrock、claude、deepseek和gemini不会触发该回调
+	OnConnection func(provider string, reused bool)
+
+	// OnLatency 流式请求正常结束时调用，携带首个token耗时和生成耗时
+	OnLatency func(provider string, latency LatencyBreakdown)
+
+	// 以下请求级回调的provider、model和outcome适合作为Prometheus等指标的标签
+
+	// OnRequest 每次请求结束时调用一次，latency为包含重试、续写在内的端到端耗时
+	OnRequest func(provider, model string, outcome RequestOutcome, latency time.Duration)
+
+	// OnTimeToFirstToken 流式请求正常结束时调用，ttft为从发起请求到收到首个输出的耗时
+	OnTimeToFirstToken func(provider, model string, ttft time.Duration)
+
+	// OnTokens 供应商返回了token用量时调用
+	OnTokens func(provider, model string, promptTokens, completionTokens int)
+}
+
+var (
+	metricsHookMu sync.RWMutex
+	metricsHook   MetricsHook
+)
+
+// SetMetricsHook 设置全局指标回调
+func SetMetricsHook(hook MetricsHook) {
+	metricsHookMu.Lock()
+	defer metricsHookMu.Unlock()
+	metricsHook = hook
+}
+
+// getMetricsHook 获取当前的指标回调
+func getMetricsHook() MetricsHook {
+	metricsHookMu.RLock()
+	defer metricsHookMu.RUnlock()
+	return metricsHook
+}
+
+// ConnectionStats 某个提供商的连接统计
+type ConnectionStats struct {
+	NewConnections    int64 `json:"new_connections"`    // 新建连接数
+	ReusedConnections int64 `json:"reused_connections"` // 复用连接数
+}
+
+// connectionCounters 按提供商记录连接统计
+type connectionCounters struct {
+	newConnections    atomic.Int64
+	reusedConnections atomic.Int64
+}
+
+var connectionStats sync.Map // provider -> *connectionCounters
+
+// GetConnectionStats 获取指定提供商的连接复用统计
+// 只统计azure、openai和qwen，其他提供商的HTTP客户端不经过连接统计，始终返回零值
+func GetConnectionStats(provider string) ConnectionStats {
+	value, ok := connectionStats.Load(provider)
+	if !ok {
+		return ConnectionStats{}
+	}
+	counters := value.(*connectionCounters)
+	return ConnectionStats{
+		NewConnections:    counters.newConnections.Load(),
+		ReusedConnections: counters.reusedConnections.Load(),
+	}
+}
+
+// recordConnection 记录一次连接获取
+func recordConnection(provider string, reused bool) {
+	value, _ := connectionStats.LoadOrStore(provider, &connectionCounters{})
+	counters := value.(*connectionCounters)
+	if reused {
+		counters.reusedConnections.Add(1)
+	} else {
+		counters.newConnections.Add(1)
+	}
+
+	if hook := getMetricsHook(); hook.OnConnection != nil {
+		hook.OnConnection(provider, reused)
+	}
+}
+
+// connTraceTransport 通过httptrace统计连接新建与复用情况的RoundTripper
+type connTraceTransport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+// newConnTraceTransport 包装RoundTripper，base为nil时使用http.DefaultTransport
+// 已包装过的RoundTripper不会重复包装
+func newConnTraceTransport(provider string, base http.RoundTripper) http.RoundTripper {
+	if traced, ok := base.(*connTraceTransport); ok {
+		if traced.provider == provider {
+			return traced
+		}
+		base = traced.base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &connTraceTransport{provider: provider, base: base}
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *connTraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			recordConnection(t.provider, info.Reused)
+		},
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil {
+		// 记录Retry-After，供重试策略使用
+		recordRetryAfter(req.Context(), resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,56 @@
+package einox
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试同一主机的第二次请求被统计为连接复用
+func TestConnTraceTransportReuse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var events []bool
+	SetMetricsHook(MetricsHook{
+		OnConnection: func(provider string, reused bool) {
+			if provider != "test-reuse" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, reused)
+		},
+	})
+	defer SetMetricsHook(MetricsHook{})
+
+	client := &http.Client{Transport: newConnTraceTransport("test-reuse", &http.Transport{})}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		// 读完并关闭响应体，连接才会回到连接池
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	mu.Lock()
+	assert.Equal(t, []bool{false, true}, events, "第一次应新建连接，第二次应复用连接")
+	mu.Unlock()
+
+	stats := GetConnectionStats("test-reuse")
+	assert.Equal(t, int64(1), stats.NewConnections)
+	assert.Equal(t, int64(1), stats.ReusedConnections)
+}
+
+// 测试重复包装不会嵌套
+func TestNewConnTraceTransportNoDoubleWrap(t *testing.T) {
+	transport := newConnTraceTransport("azure", nil)
+	assert.Same(t, transport, newConnTraceTransport("azure", transport))
+}
@@ -0,0 +1,76 @@
+package einox
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelNameCasePolicy 匹配凭证支持的模型列表时对模型名称大小写的处理方式
+type ModelNameCasePolicy string
+
+const (
+	// ModelNameCaseExact 默认方式，模型名称需与列表中的名称大小写一致
+	ModelNameCaseExact ModelNameCasePolicy = "exact"
+	// ModelNameCaseInsensitive 忽略大小写匹配，匹配后改用列表中的规范名称发送给供应商
+	ModelNameCaseInsensitive ModelNameCasePolicy = "insensitive"
+)
+
+var (
+	modelNameCasePolicyMu sync.RWMutex
+	modelNameCasePolicy   = ModelNameCaseExact
+)
+
+// SetModelNameCasePolicy 设置模型名称的大小写匹配方式，空值恢复为默认的exact
+// 无论哪种方式，请求中模型名称首尾的空白都会被去除
+func SetModelNameCasePolicy(policy ModelNameCasePolicy) {
+	if policy == "" {
+		policy = ModelNameCaseExact
+	}
+	modelNameCasePolicyMu.Lock()
+	defer modelNameCasePolicyMu.Unlock()
+	modelNameCasePolicy = policy
+}
+
+// getModelNameCasePolicy 获取当前的大小写匹配方式
+func getModelNameCasePolicy() ModelNameCasePolicy {
+	modelNameCasePolicyMu.RLock()
+	defer modelNameCasePolicyMu.RUnlock()
+	return modelNameCasePolicy
+}
+
+// normalizeModelName 去除模型名称首尾的空白
+func normalizeModelName(model string) string {
+	return strings.TrimSpace(model)
+}
+
+// canonicalModelName 在支持的模型列表中查找模型，返回列表中的规范名称
+// 精确匹配优先；大小写匹配方式为insensitive时再忽略大小写匹配
+func canonicalModelName(model string, supported []string) (string, bool) {
+	model = normalizeModelName(model)
+	for _, name := range supported {
+		if normalizeModelName(name) == model {
+			return normalizeModelName(name), true
+		}
+	}
+	if getModelNameCasePolicy() != ModelNameCaseInsensitive {
+		return model, false
+	}
+	for _, name := range supported {
+		if strings.EqualFold(normalizeModelName(name), model) {
+			return normalizeModelName(name), true
+		}
+	}
+	return model, false
+}
+
+// canonicalizeModel 按凭证支持的模型列表规范化c.Model，返回模型是否在列表中
+// 列表为空表示不限制模型，视为支持
+func (c *Config) canonicalizeModel(supported []string) bool {
+	c.Model = normalizeModelName(c.Model)
+	if len(supported) == 0 {
+		return true
+	}
+	canonical, ok := canonicalModelName(c.Model, supported)
+	c.Model = canonical
+	return ok
+}
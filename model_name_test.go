@@ -0,0 +1,73 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试去除空白后匹配支持的模型列表
+func TestCanonicalModelNameWhitespace(t *testing.T) {
+	supported := []string{"gpt-4o", "gpt-4o-mini"}
+
+	for _, model := range []string{"gpt-4o", " gpt-4o", "gpt-4o\n", "\tgpt-4o  "} {
+		canonical, ok := canonicalModelName(model, supported)
+		assert.True(t, ok, "模型 %q 应匹配", model)
+		assert.Equal(t, "gpt-4o", canonical)
+	}
+
+	canonical, ok := canonicalModelName(" gpt-4 ", supported)
+	assert.False(t, ok)
+	assert.Equal(t, "gpt-4", canonical)
+}
+
+// 测试大小写匹配方式
+func TestCanonicalModelNameCase(t *testing.T) {
+	supported := []string{"DeepSeek-R1", "gpt-4o"}
+
+	_, ok := canonicalModelName("deepseek-r1", supported)
+	assert.False(t, ok, "默认大小写需一致")
+
+	SetModelNameCasePolicy(ModelNameCaseInsensitive)
+	defer SetModelNameCasePolicy("")
+
+	for _, model := range []string{"deepseek-r1", "DEEPSEEK-R1", " DeepSeek-r1 "} {
+		canonical, ok := canonicalModelName(model, supported)
+		assert.True(t, ok, "模型 %q 应匹配", model)
+		assert.Equal(t, "DeepSeek-R1", canonical, "应使用列表中的规范名称")
+	}
+	canonical, ok := canonicalModelName("GPT-4O", supported)
+	assert.True(t, ok)
+	assert.Equal(t, "gpt-4o", canonical)
+}
+
+// 测试凭证配置中的模型列表规范化发送给供应商的模型名称
+func TestConfigCanonicalizeModel(t *testing.T) {
+	SetModelNameCasePolicy(ModelNameCaseInsensitive)
+	defer SetModelNameCasePolicy("")
+
+	conf := &Config{Model: " GPT-4o-Mini "}
+	assert.True(t, conf.canonicalizeModel([]string{"gpt-4o", "gpt-4o-mini"}))
+	assert.Equal(t, "gpt-4o-mini", conf.Model)
+
+	conf = &Config{Model: " claude-3 "}
+	assert.False(t, conf.canonicalizeModel([]string{"gpt-4o"}))
+	assert.Equal(t, "claude-3", conf.Model)
+
+	conf = &Config{Model: " gpt-4o "}
+	assert.True(t, conf.canonicalizeModel(nil), "未配置模型列表时不限制")
+	assert.Equal(t, "gpt-4o", conf.Model)
+}
+
+// 测试发送前去除模型名称的空白
+func TestPrepareProviderRequestTrimsModel(t *testing.T) {
+	req, err := prepareProviderRequest("azure", ChatRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "  gpt-4o\n",
+			Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "你好"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4o", req.Model)
+}
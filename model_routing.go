@@ -0,0 +1,34 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoCredentialForModel 当前环境中没有启用的凭证支持请求的模型
+var ErrNoCredentialForModel = errors.New("没有支持该模型的凭证")
+
+// credentialsForModel 只保留模型列表中包含c.Model的凭证，用于在同一配置中按模型区分部署
+// 模型名称的匹配规则与canonicalizeModel相同，模型列表为空的凭证视为支持所有模型
+func credentialsForModel[T any](c *Config, env string, credentials []T, models func(T) []string) ([]T, error) {
+	model := normalizeModelName(c.Model)
+	if model == "" {
+		return credentials, nil
+	}
+
+	matched := make([]T, 0, len(credentials))
+	for _, cred := range credentials {
+		supported := models(cred)
+		if len(supported) == 0 {
+			matched = append(matched, cred)
+			continue
+		}
+		if _, ok := canonicalModelName(model, supported); ok {
+			matched = append(matched, cred)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: 环境 %s 中没有启用的凭证支持模型 %s", ErrNoCredentialForModel, env, model)
+	}
+	return matched, nil
+}
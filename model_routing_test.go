@@ -0,0 +1,99 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试按模型列表过滤候选凭证
+func TestCredentialsForModel(t *testing.T) {
+	creds := []AzureCredential{
+		{Name: "gpt4", Models: []string{"gpt-4o", "gpt-4o-mini"}},
+		{Name: "gpt35", Models: []string{"gpt-35-turbo"}},
+		{Name: "any"},
+	}
+	names := func(creds []AzureCredential) []string {
+		var result []string
+		for _, cred := range creds {
+			result = append(result, cred.Name)
+		}
+		return result
+	}
+	models := func(cred AzureCredential) []string { return cred.Models }
+
+	matched, err := credentialsForModel(&Config{Model: "gpt-35-turbo"}, "production", creds, models)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpt35", "any"}, names(matched))
+
+	matched, err = credentialsForModel(&Config{Model: " gpt-4o-mini "}, "production", creds, models)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpt4", "any"}, names(matched))
+
+	matched, err = credentialsForModel(&Config{}, "production", creds, models)
+	assert.NoError(t, err)
+	assert.Len(t, matched, 3, "未指定模型时不过滤")
+
+	_, err = credentialsForModel(&Config{Model: "o1"}, "production", creds[:2], models)
+	assert.ErrorIs(t, err, ErrNoCredentialForModel)
+	assert.ErrorContains(t, err, "o1")
+
+	// 忽略大小写时按规范名称匹配
+	SetModelNameCasePolicy(ModelNameCaseInsensitive)
+	defer SetModelNameCasePolicy("")
+	matched, err = credentialsForModel(&Config{Model: "GPT-4o"}, "production", creds[:2], models)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpt4"}, names(matched))
+}
+
+// 测试getAzureConfig只选择支持请求模型的凭证
+func TestGetAzureConfigRoutesByModel(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "production"
+	defer ReloadConfig()
+
+	encrypt := func(plaintext string) string {
+		cipherText, err := EncryptSecretForEnv(ENV, plaintext)
+		if err != nil {
+			t.Fatalf("加密失败: %v", err)
+		}
+		return cipherText
+	}
+	configContent := fmt.Sprintf(`
+environments:
+  production:
+    credentials:
+      - name: gpt4
+        api_key: %s
+        endpoint: https://gpt4.openai.azure.com
+        enabled: true
+        weight: 100
+        models: [gpt-4o]
+      - name: gpt35
+        api_key: %s
+        endpoint: https://gpt35.openai.azure.com
+        enabled: true
+        weight: 1
+        models: [gpt-35-turbo]
+`, encrypt("key-gpt4"), encrypt("key-gpt35"))
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	for i := 0; i < 10; i++ {
+		conf, err := (&Config{Model: "gpt-35-turbo"}).getAzureConfig()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "key-gpt35", conf.APIKey)
+	}
+
+	_, err := (&Config{Model: "o1"}).getAzureConfig()
+	assert.True(t, errors.Is(err, ErrNoCredentialForModel), "没有凭证支持时返回明确的错误: %v", err)
+}
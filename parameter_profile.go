@@ -0,0 +1,76 @@
+package einox
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ParameterProfile 命名的模型参数预设，例如 "creative"、"precise"
+// 字段为空时表示该预设不设置此参数
+type ParameterProfile struct {
+	Temperature      *float32 `yaml:"temperature,omitempty" json:"temperature,omitempty"`             // 温度参数
+	TopP             *float32 `yaml:"top_p,omitempty" json:"top_p,omitempty"`                         // 核采样参数
+	PresencePenalty  *float32 `yaml:"presence_penalty,omitempty" json:"presence_penalty,omitempty"`   // 存在惩罚
+	FrequencyPenalty *float32 `yaml:"frequency_penalty,omitempty" json:"frequency_penalty,omitempty"` // 频率惩罚
+	MaxTokens        int      `yaml:"max_tokens,omitempty" json:"max_tokens,omitempty"`               // 最大生成token数
+}
+
+var (
+	profileMu sync.RWMutex
+	// profileConfig 保存全局注册的参数预设，供CreateChatCompletion使用
+	profileConfig = &Config{}
+)
+
+// SetParameterProfiles 设置全局的参数预设，这是统一入口使用预设的唯一方式，预设不从配置文件读取
+// 例如：
+//
+//	temperature := float32(1.2)
+//	einox.SetParameterProfiles(map[string]einox.ParameterProfile{
+//		"creative": {Temperature: &temperature},
+//	})
+func SetParameterProfiles(profiles map[string]ParameterProfile) {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	profileConfig = &Config{ParameterProfiles: profiles}
+}
+
+// applyGlobalParameterProfile 使用全局注册的参数预设处理请求
+func applyGlobalParameterProfile(req ChatRequest) (ChatRequest, error) {
+	profileMu.RLock()
+	conf := profileConfig
+	profileMu.RUnlock()
+	return conf.ApplyParameterProfile(req)
+}
+
+// ApplyParameterProfile 将请求中ProfileName对应的参数预设应用到请求上
+// 请求中非零值的字段优先于预设；未指定ProfileName时原样返回。
+// ChatRequest的参数不是指针，无法区分未设置和显式设置为0，值为0的字段一律视为未设置，
+// 因此预设设置了temperature等参数时，请求无法将其覆盖为0，需要0时应使用未设置该参数的预设
+func (c *Config) ApplyParameterProfile(req ChatRequest) (ChatRequest, error) {
+	if req.ProfileName == "" {
+		return req, nil
+	}
+
+	profile, ok := c.ParameterProfiles[req.ProfileName]
+	if !ok {
+		return req, fmt.Errorf("未找到参数预设: %s", req.ProfileName)
+	}
+
+	if req.Temperature == 0 && profile.Temperature != nil {
+		req.Temperature = *profile.Temperature
+	}
+	if req.TopP == 0 && profile.TopP != nil {
+		req.TopP = *profile.TopP
+	}
+	if req.PresencePenalty == 0 && profile.PresencePenalty != nil {
+		req.PresencePenalty = *profile.PresencePenalty
+	}
+	if req.FrequencyPenalty == 0 && profile.FrequencyPenalty != nil {
+		req.FrequencyPenalty = *profile.FrequencyPenalty
+	}
+	if req.MaxTokens == 0 && profile.MaxTokens > 0 {
+		req.MaxTokens = profile.MaxTokens
+	}
+
+	return req, nil
+}
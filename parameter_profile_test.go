@@ -0,0 +1,86 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func float32Ptr(v float32) *float32 {
+	return &v
+}
+
+// 测试参数预设的应用
+func TestApplyParameterProfile(t *testing.T) {
+	conf := &Config{
+		ParameterProfiles: map[string]ParameterProfile{
+			"creative": {
+				Temperature:      float32Ptr(1.2),
+				TopP:             float32Ptr(0.95),
+				PresencePenalty:  float32Ptr(0.6),
+				FrequencyPenalty: float32Ptr(0.3),
+				MaxTokens:        2048,
+			},
+		},
+	}
+
+	req, err := conf.ApplyParameterProfile(ChatRequest{ProfileName: "creative"})
+	assert.NoError(t, err)
+	assert.Equal(t, float32(1.2), req.Temperature)
+	assert.Equal(t, float32(0.95), req.TopP)
+	assert.Equal(t, float32(0.6), req.PresencePenalty)
+	assert.Equal(t, float32(0.3), req.FrequencyPenalty)
+	assert.Equal(t, 2048, req.MaxTokens)
+
+	// 未知预设应返回错误
+	_, err = conf.ApplyParameterProfile(ChatRequest{ProfileName: "unknown"})
+	assert.Error(t, err)
+
+	// 未指定预设时原样返回
+	req, err = conf.ApplyParameterProfile(ChatRequest{})
+	assert.NoError(t, err)
+	assert.Zero(t, req.Temperature)
+}
+
+// 测试请求中显式设置的字段优先于预设
+func TestApplyParameterProfileOverride(t *testing.T) {
+	conf := &Config{
+		ParameterProfiles: map[string]ParameterProfile{
+			"precise": {
+				Temperature: float32Ptr(0.1),
+				TopP:        float32Ptr(0.5),
+				MaxTokens:   512,
+			},
+		},
+	}
+
+	req, err := conf.ApplyParameterProfile(ChatRequest{
+		ProfileName: "precise",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Temperature: 0.7,
+			MaxTokens:   100,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float32(0.7), req.Temperature, "显式设置的temperature应覆盖预设")
+	assert.Equal(t, 100, req.MaxTokens, "显式设置的max_tokens应覆盖预设")
+	assert.Equal(t, float32(0.5), req.TopP, "未设置的top_p应使用预设")
+
+	// 值为0的参数视为未设置，无法覆盖预设
+	req, err = conf.ApplyParameterProfile(ChatRequest{ProfileName: "precise"})
+	assert.NoError(t, err)
+	assert.Equal(t, float32(0.1), req.Temperature, "temperature为0时应使用预设")
+}
+
+// 测试全局注册的参数预设
+func TestSetParameterProfiles(t *testing.T) {
+	defer SetParameterProfiles(nil)
+
+	SetParameterProfiles(map[string]ParameterProfile{
+		"creative": {Temperature: float32Ptr(1.2)},
+	})
+	req, err := applyGlobalParameterProfile(ChatRequest{ProfileName: "creative"})
+	assert.NoError(t, err)
+	assert.Equal(t, float32(1.2), req.Temperature)
+}
@@ -0,0 +1,49 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseChatRequest 从HTTP请求体等io.Reader中解析OpenAI格式的聊天请求
+// 供应商优先取顶层的 "provider" 字段，其次取模型名称的前缀（如 "azure/gpt-4o"），
+// 模型前缀为已知供应商时会从模型名称中去掉
+func ParseChatRequest(r io.Reader) (ChatRequest, error) {
+	// response_format单独解码，保留json_schema.schema的原始JSON
+	var body struct {
+		ChatRequest
+		ResponseFormat *responseFormatBody `json:"response_format,omitempty"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return ChatRequest{}, fmt.Errorf("解析聊天请求失败: %w", err)
+	}
+	req := body.ChatRequest
+	req.ResponseFormat = body.ResponseFormat.toResponseFormat()
+
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+
+	// 从模型前缀中提取供应商
+	if prefix, model, found := strings.Cut(req.Model, "/"); found && IsProviderSupported(strings.ToLower(prefix)) {
+		prefix = strings.ToLower(prefix)
+		if req.Provider != "" && req.Provider != prefix {
+			return ChatRequest{}, fmt.Errorf("provider字段(%s)与模型前缀(%s)不一致", req.Provider, prefix)
+		}
+		req.Provider = prefix
+		req.Model = model
+	}
+
+	if req.Provider == "" {
+		return ChatRequest{}, errors.New("未指定AI供应商，请设置provider字段或使用 供应商/模型 格式的模型名称")
+	}
+	if !IsProviderSupported(req.Provider) {
+		return ChatRequest{}, &UnsupportedProviderError{Provider: req.Provider}
+	}
+	if req.Model == "" {
+		return ChatRequest{}, ErrModelNotSpecified
+	}
+
+	return req, nil
+}
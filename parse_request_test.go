@@ -0,0 +1,64 @@
+package einox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试从模型前缀中提取供应商
+func TestParseChatRequestModelPrefix(t *testing.T) {
+	body := `{
+		"model": "azure/gpt-4o",
+		"messages": [{"role": "user", "content": "你好"}],
+		"temperature": 0.5,
+		"stream": true
+	}`
+
+	req, err := ParseChatRequest(strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, "azure", req.Provider)
+	assert.Equal(t, "gpt-4o", req.Model, "模型名称应去掉供应商前缀")
+	assert.Equal(t, float32(0.5), req.Temperature)
+	assert.True(t, req.Stream)
+	assert.Len(t, req.Messages, 1)
+	assert.Equal(t, "你好", req.Messages[0].Content)
+}
+
+// 测试显式的provider字段
+func TestParseChatRequestProviderField(t *testing.T) {
+	body := `{
+		"provider": "DeepSeek",
+		"model": "deepseek-chat",
+		"messages": [{"role": "user", "content": "你好"}]
+	}`
+
+	req, err := ParseChatRequest(strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, "deepseek", req.Provider)
+	assert.Equal(t, "deepseek-chat", req.Model)
+
+	// 非供应商前缀的模型名称保持不变
+	body = `{"provider": "bedrock", "model": "anthropic.claude-3/sonnet", "messages": []}`
+	req, err = ParseChatRequest(strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, "anthropic.claude-3/sonnet", req.Model)
+}
+
+// 测试非法请求
+func TestParseChatRequestInvalid(t *testing.T) {
+	cases := map[string]string{
+		"JSON格式错误":   `{"model": `,
+		"未指定供应商":     `{"model": "gpt-4o", "messages": []}`,
+		"不支持的供应商":    `{"provider": "unknown", "model": "gpt-4o"}`,
+		"供应商与前缀不一致":  `{"provider": "openai", "model": "azure/gpt-4o"}`,
+		"仅有前缀没有模型名称": `{"model": "azure/"}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseChatRequest(strings.NewReader(body))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package einox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// PartialToolCall 流中断时已累积的工具调用
+type PartialToolCall struct {
+	openai.ToolCall
+	// Complete 表示参数原本就是完整合法的JSON；
+	// 为false时，Arguments为修复后可解析的JSON，无法修复时保留原始片段
+	Complete bool `json:"complete"`
+	// Parseable 表示Arguments可以被解析为JSON
+	Parseable bool `json:"parseable"`
+}
+
+// PartialStreamError 流被取消或中断时返回的错误，携带已收到的部分结果
+type PartialStreamError struct {
+	Err       error             // 中断原因
+	Content   string            // 已收到的文本内容
+	ToolCalls []PartialToolCall // 已累积的工具调用
+}
+
+func (e *PartialStreamError) Error() string {
+	return fmt.Sprintf("流式响应中断(已收到%d个工具调用): %v", len(e.ToolCalls), e.Err)
+}
+
+// Unwrap 返回中断原因，便于使用errors.Is判断
+func (e *PartialStreamError) Unwrap() error {
+	return e.Err
+}
+
+// streamAccumulator 累积流式响应中的文本和工具调用增量
+type streamAccumulator struct {
+	content   strings.Builder
+	toolCalls map[int]*openai.ToolCall
+	latency   *LatencyBreakdown // 流正常结束后的耗时分解
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{toolCalls: map[int]*openai.ToolCall{}}
+}
+
+// add 累积一个流式数据块
+func (a *streamAccumulator) add(chunk *openai.ChatCompletionStreamResponse) {
+	if chunk == nil || len(chunk.Choices) == 0 {
+		return
+	}
+	delta := chunk.Choices[0].Delta
+	a.content.WriteString(delta.Content)
+
+	for i, tc := range delta.ToolCalls {
+		// 未提供下标时按在增量中的位置处理
+		index := i
+		if tc.Index != nil {
+			index = *tc.Index
+		}
+		acc, ok := a.toolCalls[index]
+		if !ok {
+			acc = &openai.ToolCall{Type: openai.ToolTypeFunction}
+			a.toolCalls[index] = acc
+		}
+		if tc.ID != "" {
+			acc.ID = tc.ID
+		}
+		if tc.Type != "" {
+			acc.Type = tc.Type
+		}
+		if tc.Function.Name != "" {
+			acc.Function.Name = tc.Function.Name
+		}
+		acc.Function.Arguments += tc.Function.Arguments
+	}
+}
+
+// completeToolCalls 按下标顺序返回已累积的工具调用，与非流式响应一致不带下标
+func (a *streamAccumulator) completeToolCalls() []openai.ToolCall {
+	indexes := make([]int, 0, len(a.toolCalls))
+	for index := range a.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	result := make([]openai.ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		tc := *a.toolCalls[index]
+		tc.Index = nil
+		result = append(result, tc)
+	}
+	return result
+}
+
+// partialToolCalls 按下标顺序返回已累积的工具调用，并尝试修复不完整的参数
+func (a *streamAccumulator) partialToolCalls() []PartialToolCall {
+	toolCalls := a.completeToolCalls()
+	result := make([]PartialToolCall, 0, len(toolCalls))
+	for _, tc := range toolCalls {
+		partial := PartialToolCall{ToolCall: tc}
+
+		args := tc.Function.Arguments
+		if json.Valid([]byte(args)) {
+			partial.Complete = true
+			partial.Parseable = true
+		} else if repaired, ok := repairPartialJSON(args); ok {
+			partial.Function.Arguments = repaired
+			partial.Parseable = true
+		}
+		result = append(result, partial)
+	}
+	return result
+}
+
+// partialError 将中断原因包装为携带部分结果的错误
+// 没有累积到工具调用时原样返回
+func (a *streamAccumulator) partialError(err error) error {
+	if err == nil || len(a.toolCalls) == 0 {
+		return err
+	}
+	return &PartialStreamError{
+		Err:       err,
+		Content:   a.content.String(),
+		ToolCalls: a.partialToolCalls(),
+	}
+}
+
+// repairPartialJSON 尝试补全被截断的JSON，例如 {"city": "北京 -> {"city": "北京"}
+// 只做保守的补全（闭合字符串和括号、去掉末尾不完整的键值），结果必须是合法JSON
+func repairPartialJSON(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", false
+	}
+
+	var closers []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			closers = append(closers, '}')
+		case '[':
+			closers = append(closers, ']')
+		case '}', ']':
+			if len(closers) == 0 {
+				return "", false
+			}
+			closers = closers[:len(closers)-1]
+		}
+	}
+
+	if inString {
+		// 去掉末尾不完整的转义符后闭合字符串
+		if escaped {
+			s = s[:len(s)-1]
+		}
+		s += `"`
+	}
+
+	closing := make([]byte, len(closers))
+	for i := range closers {
+		closing[i] = closers[len(closers)-1-i]
+	}
+
+	candidates := []string{s}
+	trimmed := strings.TrimRight(s, " \t\r\n")
+	// 末尾为逗号时去掉逗号
+	if strings.HasSuffix(trimmed, ",") {
+		candidates = append(candidates, strings.TrimSuffix(trimmed, ","))
+	}
+	// 末尾为不完整的键（"key" 或 "key":）时去掉该键
+	if cut := strings.LastIndexAny(trimmed, ",{"); cut >= 0 {
+		prefix := trimmed[:cut]
+		if trimmed[cut] == '{' {
+			prefix = trimmed[:cut+1]
+		}
+		candidates = append(candidates, prefix)
+	}
+
+	for _, candidate := range candidates {
+		repaired := candidate + string(closing)
+		if json.Valid([]byte(repaired)) {
+			return repaired, true
+		}
+	}
+	return "", false
+}
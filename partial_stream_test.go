@@ -0,0 +1,106 @@
+package einox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造包含工具调用增量的流式数据块
+func newToolCallChunk(index int, id, name, args string) *openai.ChatCompletionStreamResponse {
+	return &openai.ChatCompletionStreamResponse{
+		ID: "chatcmpl-tool",
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{
+					Index:    &index,
+					ID:       id,
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: name, Arguments: args},
+				}},
+			},
+		}},
+	}
+}
+
+// 测试在工具参数传输中途取消时恢复部分结果
+func TestStreamCancelMidToolArguments(t *testing.T) {
+	reader := schema.StreamReaderFromArray([]*openai.ChatCompletionStreamResponse{
+		newToolCallChunk(0, "call_1", "get_weather", `{"city": `),
+		newToolCallChunk(0, "", "", `"北京"}`),
+		newToolCallChunk(1, "call_2", "search", `{"query": "明天`),
+		newToolCallChunk(1, "", "", `的天气", "limit": 5`),
+		newToolCallChunk(1, "", "", `}`),
+	})
+
+	received := 0
+	err := consumeStreamWithCallback("test", reader, time.Now(), 0, func(event StreamEvent) error {
+		received++
+		// 第二个工具调用的参数尚未传输完成时取消
+		if received == 4 {
+			return context.Canceled
+		}
+		return nil
+	})
+
+	assert.True(t, errors.Is(err, context.Canceled), "应能识别原始的取消原因")
+	var partialErr *PartialStreamError
+	if !assert.True(t, errors.As(err, &partialErr)) {
+		return
+	}
+	assert.Len(t, partialErr.ToolCalls, 2)
+
+	first := partialErr.ToolCalls[0]
+	assert.Equal(t, "call_1", first.ID)
+	assert.Equal(t, "get_weather", first.Function.Name)
+	assert.True(t, first.Complete)
+	assert.JSONEq(t, `{"city": "北京"}`, first.Function.Arguments)
+
+	second := partialErr.ToolCalls[1]
+	assert.Equal(t, "call_2", second.ID)
+	assert.False(t, second.Complete)
+	assert.True(t, second.Parseable)
+	var args map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(second.Function.Arguments), &args))
+	assert.Equal(t, "明天的天气", args["query"])
+	assert.Equal(t, float64(5), args["limit"])
+}
+
+// 测试没有工具调用时原样返回取消原因
+func TestStreamCancelWithoutToolCalls(t *testing.T) {
+	reader := schema.StreamReaderFromArray([]*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你好", ""),
+	})
+	err := consumeStreamWithCallback("test", reader, time.Now(), 0, func(event StreamEvent) error {
+		return context.Canceled
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+// 测试截断JSON的修复
+func TestRepairPartialJSON(t *testing.T) {
+	cases := map[string]string{
+		`{"city": "北`:             `{"city": "北"}`,
+		`{"a": 1,`:                `{"a": 1}`,
+		`{"a": 1, "b":`:           `{"a": 1}`,
+		`{"a": [1, 2`:             `{"a": [1, 2]}`,
+		`{"a": {"b": "c\`:         `{"a": {"b": "c"}}`,
+		`{"a": 1, "items": [{"na`: `{"a": 1, "items": [{}]}`,
+		`{"a": tr`:                `{}`,
+	}
+	for input, expected := range cases {
+		repaired, ok := repairPartialJSON(input)
+		if assert.True(t, ok, input) {
+			assert.JSONEq(t, expected, repaired, input)
+		}
+	}
+
+	_, ok := repairPartialJSON(`{"a": 1}}`)
+	assert.False(t, ok, "无法修复的片段应返回false")
+}
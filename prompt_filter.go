@@ -0,0 +1,16 @@
+package einox
+
+import "github.com/sashabaranov/go-openai"
+
+// FilteredPromptIndexes 返回被内容过滤标记的提示词片段序号
+// 序号对应Azure按请求中提示词片段（通常为消息）计算的下标
+func FilteredPromptIndexes(results []openai.PromptFilterResult) []int {
+	var indexes []int
+	for _, result := range results {
+		filters := result.ContentFilterResults
+		if filters.Hate.Filtered || filters.SelfHarm.Filtered || filters.Sexual.Filtered || filters.Violence.Filtered {
+			indexes = append(indexes, result.Index)
+		}
+	}
+	return indexes
+}
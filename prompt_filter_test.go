@@ -0,0 +1,72 @@
+package einox
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPromptFilterResults Azure返回的提示词过滤结果，同时包含新旧API版本的序号字段
+const testPromptFilterResults = `[{"index":0,"content_filter_results":{"hate":{"filtered":false,"severity":"safe"}}},` +
+	`{"prompt_index":1,"content_filter_results":{"violence":{"filtered":true,"severity":"high"}}}]`
+
+// 测试从非流式的原始响应体中读取提示词过滤结果
+func TestPromptFilterResultsFromRawResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","prompt_filter_results":%s,"choices":[{"index":0,"message":{"role":"assistant","content":"你好"}}]}`, testPromptFilterResults)
+	}))
+	defer server.Close()
+
+	callConf, capture := captureRawResponse(&einoopenai.ChatModelConfig{})
+	resp, err := callConf.HTTPClient.Get(server.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+
+	results := capture.response().promptFilterResults()
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, 1, results[1].Index)
+		assert.True(t, results[1].ContentFilterResults.Violence.Filtered)
+		assert.Equal(t, "high", results[1].ContentFilterResults.Violence.Severity)
+	}
+	assert.Equal(t, []int{1}, FilteredPromptIndexes(results))
+}
+
+// 测试从流式响应的第一个数据帧中读取提示词过滤结果，读取的内容不变且结果只返回一次
+func TestPromptFilterResultsFromStream(t *testing.T) {
+	body := fmt.Sprintf("data: {\"id\":\"\",\"choices\":[],\"prompt_filter_results\":%s}\r\n\r\n", testPromptFilterResults) +
+		"data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"你好\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	callConf, capture := captureRawResponse(&einoopenai.ChatModelConfig{})
+	resp, err := callConf.HTTPClient.Get(server.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+
+	results := capture.takeStreamPromptFilterResults()
+	assert.Equal(t, []int{1}, FilteredPromptIndexes(results))
+	assert.Nil(t, capture.takeStreamPromptFilterResults())
+	assert.Nil(t, capture.response(), "流式响应不按整体解析")
+
+	var nilCapture *rawResponseCapture
+	assert.Nil(t, nilCapture.takeStreamPromptFilterResults())
+	assert.Empty(t, FilteredPromptIndexes([]openai.PromptFilterResult{{Index: 2}}))
+}
@@ -0,0 +1,110 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	// ErrUnsupportedProvider 请求的AI供应商不受支持，实际返回的是 *UnsupportedProviderError，可通过errors.Is识别
+	ErrUnsupportedProvider = errors.New("不支持的AI供应商")
+	// ErrModelNotSpecified 请求未指定模型名称
+	ErrModelNotSpecified = errors.New("未指定模型名称")
+)
+
+// UnsupportedProviderError 请求的AI供应商不受支持，调用方可通过errors.As获取供应商名称
+type UnsupportedProviderError struct {
+	// Provider 请求中的供应商名称
+	Provider string
+}
+
+// Error 实现error接口
+func (e *UnsupportedProviderError) Error() string {
+	return ErrUnsupportedProvider.Error() + ": " + e.Provider
+}
+
+// Is 使errors.Is(err, ErrUnsupportedProvider)成立
+func (e *UnsupportedProviderError) Is(target error) bool {
+	return target == ErrUnsupportedProvider
+}
+
+// ProviderError 调用供应商接口失败时返回的错误，调用方可通过errors.As获取HTTP状态码和错误码，决定重试还是返回给用户
+// 原始错误可通过errors.Unwrap或errors.As（如*openai.APIError）继续获取
+type ProviderError struct {
+	// Provider 供应商名称，如"azure"、"bedrock"
+	Provider string
+	// HTTPStatus 供应商返回的HTTP状态码，未收到响应（如网络错误）或无法获取时为0
+	HTTPStatus int
+	// Code 供应商返回的错误码，如"rate_limit_exceeded"
+	Code string
+	// Type 供应商返回的错误类型，如"invalid_request_error"
+	Type string
+	// Message 错误信息
+	Message string
+	// Err 原始错误
+	Err error
+}
+
+// Error 实现error接口
+func (e *ProviderError) Error() string {
+	var details []string
+	if e.HTTPStatus > 0 {
+		details = append(details, fmt.Sprintf("HTTP %d", e.HTTPStatus))
+	}
+	if e.Type != "" {
+		details = append(details, "type="+e.Type)
+	}
+	if e.Code != "" {
+		details = append(details, "code="+e.Code)
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("%s接口返回错误: %s", e.Provider, e.Message)
+	}
+	return fmt.Sprintf("%s接口返回错误 (%s): %s", e.Provider, strings.Join(details, ", "), e.Message)
+}
+
+// Unwrap 返回原始错误
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// newProviderError 将供应商SDK返回的错误转换为 *ProviderError，已是 *ProviderError 时原样返回
+// 支持go-openai的APIError、RequestError，以及实现了HTTPStatusCode()或HTTPCode()方法的错误（如AWS SDK、Google API的错误）
+func newProviderError(provider string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var providerError *ProviderError
+	if errors.As(err, &providerError) {
+		return err
+	}
+
+	providerError = &ProviderError{Provider: provider, Message: err.Error(), Err: err}
+	var apiError *openai.APIError
+	var requestError *openai.RequestError
+	var statusError interface{ HTTPStatusCode() int }
+	var codeError interface{ HTTPCode() int }
+	switch {
+	case errors.As(err, &apiError):
+		providerError.HTTPStatus = apiError.HTTPStatusCode
+		providerError.Type = apiError.Type
+		providerError.Message = apiError.Message
+		if apiError.Code != nil {
+			providerError.Code = fmt.Sprint(apiError.Code)
+		}
+	case errors.As(err, &requestError):
+		providerError.HTTPStatus = requestError.HTTPStatusCode
+		if requestError.Err != nil {
+			providerError.Message = requestError.Err.Error()
+		}
+	case errors.As(err, &statusError):
+		providerError.HTTPStatus = statusError.HTTPStatusCode()
+	case errors.As(err, &codeError):
+		// gRPC调用时HTTPCode()返回-1
+		providerError.HTTPStatus = max(codeError.HTTPCode(), 0)
+	}
+	return providerError
+}
@@ -0,0 +1,110 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试不支持的供应商可通过errors.Is和errors.As识别
+func TestUnsupportedProviderError(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		req := ChatRequest{
+			Provider: "unknown",
+			ChatCompletionRequest: openai.ChatCompletionRequest{
+				Model:  "gpt-4o",
+				Stream: stream,
+			},
+		}
+		_, err := CreateChatCompletion(req, nil)
+		assert.ErrorIs(t, err, ErrUnsupportedProvider)
+		var unsupported *UnsupportedProviderError
+		if assert.True(t, errors.As(err, &unsupported), "stream=%v", stream) {
+			assert.Equal(t, "unknown", unsupported.Provider)
+		}
+		assert.EqualError(t, err, "不支持的AI供应商: unknown")
+	}
+
+	_, err := ParseChatRequest(strings.NewReader(`{"provider": "unknown", "model": "gpt-4o"}`))
+	assert.ErrorIs(t, err, ErrUnsupportedProvider)
+	_, _, err = SanitizeRequest(ChatRequest{Provider: "unknown"})
+	assert.ErrorIs(t, err, ErrUnsupportedProvider)
+}
+
+// 测试未指定模型名称时返回ErrModelNotSpecified
+func TestModelNotSpecifiedError(t *testing.T) {
+	_, err := ParseChatRequest(strings.NewReader(`{"model": "azure/"}`))
+	assert.ErrorIs(t, err, ErrModelNotSpecified)
+
+	_, err = AzureCreateChatCompletionToChat(ChatRequest{Provider: "azure"})
+	assert.ErrorIs(t, err, ErrModelNotSpecified)
+	assert.NotErrorIs(t, err, ErrUnsupportedProvider)
+}
+
+// statusCodeError 实现HTTPStatusCode()的错误，模拟AWS SDK的响应错误
+type statusCodeError struct{ status int }
+
+func (e statusCodeError) Error() string       { return fmt.Sprintf("status %d", e.status) }
+func (e statusCodeError) HTTPStatusCode() int { return e.status }
+
+// grpcCodeError 实现HTTPCode()的错误，模拟Google API的错误
+type grpcCodeError struct{ code int }
+
+func (e grpcCodeError) Error() string { return "rpc error" }
+func (e grpcCodeError) HTTPCode() int { return e.code }
+
+// 测试供应商错误转换为ProviderError
+func TestNewProviderError(t *testing.T) {
+	assert.NoError(t, newProviderError("azure", nil))
+
+	apiErr := &openai.APIError{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		Type:           "requests",
+		Code:           "429",
+		Message:        "Rate limit is exceeded.",
+	}
+	err := fmt.Errorf("调用Generate方法失败: %w", newProviderError("azure", apiErr))
+	var providerErr *ProviderError
+	if assert.ErrorAs(t, err, &providerErr) {
+		assert.Equal(t, "azure", providerErr.Provider)
+		assert.Equal(t, http.StatusTooManyRequests, providerErr.HTTPStatus)
+		assert.Equal(t, "429", providerErr.Code)
+		assert.Equal(t, "requests", providerErr.Type)
+		assert.Equal(t, "Rate limit is exceeded.", providerErr.Message)
+		assert.Equal(t, "azure接口返回错误 (HTTP 429, type=requests, code=429): Rate limit is exceeded.", providerErr.Error())
+	}
+	assert.ErrorIs(t, err, apiErr, "原始错误仍可获取")
+
+	// 已是ProviderError时原样返回
+	assert.Same(t, providerErr, newProviderError("qwen", providerErr))
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"请求错误", &openai.RequestError{HTTPStatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}, http.StatusBadGateway, "bad gateway"},
+		{"AWS响应错误", fmt.Errorf("create message: %w", statusCodeError{http.StatusServiceUnavailable}), http.StatusServiceUnavailable, "create message: status 503"},
+		{"Google API错误", grpcCodeError{http.StatusForbidden}, http.StatusForbidden, "rpc error"},
+		{"gRPC错误", grpcCodeError{-1}, 0, "rpc error"},
+		{"网络错误", errors.New("connection refused"), 0, "connection refused"},
+	}
+	for _, tt := range tests {
+		err := newProviderError("bedrock", tt.err)
+		if assert.ErrorAs(t, err, &providerErr, tt.name) {
+			assert.Equal(t, tt.status, providerErr.HTTPStatus, tt.name)
+			assert.Equal(t, tt.message, providerErr.Message, tt.name)
+		}
+	}
+	assert.EqualError(t, newProviderError("bedrock", errors.New("connection refused")), "bedrock接口返回错误: connection refused")
+
+	// 重试按ProviderError的状态码判断
+	assert.True(t, isRetryableError(nil, newProviderError("bedrock", statusCodeError{http.StatusServiceUnavailable})))
+	assert.False(t, isRetryableError(nil, newProviderError("bedrock", statusCodeError{http.StatusForbidden})))
+}
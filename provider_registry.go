@@ -0,0 +1,151 @@
+package einox
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ProviderHandler 供应商的调用入口，CreateChatCompletion通过供应商名称查找并分发请求
+// 参数预设、凭证并发槽位、流式输出格式等由CreateChatCompletion统一处理，实现方只需调用后端
+type ProviderHandler interface {
+	// Chat 非流式请求
+	Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error)
+	// Stream 流式请求，以OpenAI的SSE格式（"data: {...}\n\n"，以"data: [DONE]\n\n"结束）写入writer
+	Stream(ctx context.Context, req ChatRequest, writer io.Writer) error
+}
+
+// ProviderStreamOpener 可选接口，实现后供应商可用于StreamChatCompletionChannel和StreamChatCompletionWithCallback
+type ProviderStreamOpener interface {
+	// OpenStream 流式请求，返回数据块的流
+	OpenStream(ctx context.Context, req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error)
+}
+
+// builtinProvider 内置供应商，包装各供应商的调用函数
+type builtinProvider struct {
+	chat   func(req ChatRequest) (*openai.ChatCompletionResponse, error)
+	stream func(req ChatRequest, writer io.Writer) error
+	open   func(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error)
+}
+
+// Chat 实现ProviderHandler
+func (p builtinProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	req.ctx = ctx
+	return p.chat(req)
+}
+
+// Stream 实现ProviderHandler
+func (p builtinProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	req.ctx = ctx
+	return p.stream(req, writer)
+}
+
+// OpenStream 实现ProviderStreamOpener
+func (p builtinProvider) OpenStream(ctx context.Context, req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	req.ctx = ctx
+	return p.open(req)
+}
+
+var (
+	providerRegistryMu sync.RWMutex
+	// providerRegistry 已注册的供应商，ListProviders随之更新
+	providerRegistry = map[string]ProviderHandler{}
+)
+
+// 注册内置供应商
+func init() {
+	RegisterProvider("bedrock", builtinProvider{
+		chat:   BedrockCreateChatCompletionToChat,
+		stream: BedrockStreamChatCompletionToChat,
+		open:   BedrockStreamChatCompletion,
+	})
+	RegisterProvider("azure", builtinProvider{
+		chat:   AzureCreateChatCompletionToChat,
+		stream: AzureStreamChatCompletionToChat,
+		open:   AzureStreamChatCompletion,
+	})
+	RegisterProvider("deepseek", builtinProvider{
+		chat:   DeepSeekCreateChatCompletionToChat,
+		stream: DeepSeekStreamChatCompletionToChat,
+		open: func(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+			return openLocalStream(DeepSeekStreamChatCompletion(toDeepSeekStreamRequest(req)))
+		},
+	})
+	RegisterProvider("gemini", builtinProvider{
+		chat:   GeminiCreateChatCompletionToChat,
+		stream: GeminiStreamChatCompletionToChat,
+		open:   GeminiStreamChatCompletion,
+	})
+	RegisterProvider("qwen", builtinProvider{
+		chat:   QwenCreateChatCompletionToChat,
+		stream: QwenStreamChatCompletionToChat,
+		open:   QwenStreamChatCompletion,
+	})
+	//TODO 未实际测试通过 缺少KEY
+	RegisterProvider("openai", builtinProvider{
+		chat:   OpenAICreateChatCompletionToChat,
+		stream: OpenAIStreamChatCompletionToChat,
+		open: func(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+			return openLocalStream(OpenAIStreamChatCompletion(req))
+		},
+	})
+	//TODO 未实际测试通过 缺少KEY
+	RegisterProvider("claude", builtinProvider{
+		chat:   ClaudeCreateChatCompletionToChat,
+		stream: ClaudeStreamChatCompletionToChat,
+		open: func(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+			return openLocalStream(ClaudeStreamChatCompletion(req))
+		},
+	})
+}
+
+// RegisterProvider 注册供应商，注册后可通过ChatRequest.Provider使用
+// 同名供应商会被覆盖，可用于替换内置实现
+func RegisterProvider(name string, handler ProviderHandler) {
+	providerRegistryMu.Lock()
+	defer providerRegistryMu.Unlock()
+	providerRegistry[name] = handler
+}
+
+// openLocalStream 将返回本地流式响应类型的供应商流转换为go-openai类型
+func openLocalStream(streamReader *schema.StreamReader[*ChatCompletionStreamResponse], err error) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	if err != nil {
+		return nil, err
+	}
+	return convertLocalStreamReader(streamReader), nil
+}
+
+// lookupProvider 获取供应商的调用入口，未注册时返回 *UnsupportedProviderError
+func lookupProvider(provider string) (ProviderHandler, error) {
+	providerRegistryMu.RLock()
+	defer providerRegistryMu.RUnlock()
+	handler, ok := providerRegistry[provider]
+	if !ok || handler == nil {
+		return nil, &UnsupportedProviderError{Provider: provider}
+	}
+	return handler, nil
+}
+
+// ListProviders 返回已注册的供应商名称，按字母顺序排列
+func ListProviders() []string {
+	providerRegistryMu.RLock()
+	defer providerRegistryMu.RUnlock()
+	providers := make([]string, 0, len(providerRegistry))
+	for name, handler := range providerRegistry {
+		if handler != nil {
+			providers = append(providers, name)
+		}
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// IsProviderSupported 判断供应商是否已注册
+func IsProviderSupported(name string) bool {
+	_, err := lookupProvider(name)
+	return err == nil
+}
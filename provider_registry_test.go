@@ -0,0 +1,108 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider 测试用的自定义供应商
+type fakeProvider struct {
+	ctx context.Context
+	req ChatRequest
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	p.ctx, p.req = ctx, req
+	return &openai.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "来自自定义后端"},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}, nil
+}
+
+func (p *fakeProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	p.ctx, p.req = ctx, req
+	_, err := fmt.Fprint(writer, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n")
+	return err
+}
+
+// registerFakeProvider 注册自定义供应商，测试结束后移除
+func registerFakeProvider(t *testing.T, name string) *fakeProvider {
+	provider := &fakeProvider{}
+	RegisterProvider(name, provider)
+	t.Cleanup(func() {
+		providerRegistryMu.Lock()
+		defer providerRegistryMu.Unlock()
+		delete(providerRegistry, name)
+	})
+	return provider
+}
+
+// 测试列出支持的供应商
+func TestListProviders(t *testing.T) {
+	assert.Equal(t, []string{"azure", "bedrock", "claude", "deepseek", "gemini", "openai", "qwen"}, ListProviders())
+
+	// 返回的切片可以修改，不影响注册表
+	providers := ListProviders()
+	providers[0] = "changed"
+	assert.Equal(t, "azure", ListProviders()[0])
+
+	registerFakeProvider(t, "in-house")
+	assert.Contains(t, ListProviders(), "in-house")
+}
+
+// 测试判断供应商是否受支持
+func TestIsProviderSupported(t *testing.T) {
+	for _, name := range ListProviders() {
+		assert.True(t, IsProviderSupported(name), name)
+		handler, err := lookupProvider(name)
+		assert.NoError(t, err)
+		assert.Implements(t, (*ProviderStreamOpener)(nil), handler, "内置供应商应支持StreamChatCompletionChannel")
+	}
+	assert.False(t, IsProviderSupported("unknown"))
+	assert.False(t, IsProviderSupported(""))
+
+	_, err := lookupProvider("unknown")
+	assert.ErrorIs(t, err, ErrUnsupportedProvider)
+}
+
+// 测试自定义供应商通过CreateChatCompletion分发
+func TestRegisterProvider(t *testing.T) {
+	provider := registerFakeProvider(t, "in-house")
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	req := ChatRequest{
+		Provider: "in-house",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    " my-model ",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+		},
+	}
+	resp, err := CreateChatCompletionCtx(ctx, req, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "来自自定义后端", resp.Choices[0].Message.Content)
+	}
+	assert.Equal(t, "value", provider.ctx.Value(ctxKey{}), "请求的上下文应传给供应商")
+	assert.Equal(t, "my-model", provider.req.Model, "请求应经过统一的预处理")
+
+	// 流式请求
+	req.Stream = true
+	var buf bytes.Buffer
+	_, err = CreateChatCompletionCtx(ctx, req, &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "hi")
+	assert.Equal(t, "value", provider.ctx.Value(ctxKey{}))
+
+	// 未实现ProviderStreamOpener时不支持StreamChatCompletionChannel
+	_, err = StreamChatCompletionChannel(context.Background(), req)
+	assert.Error(t, err)
+}
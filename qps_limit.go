@@ -0,0 +1,86 @@
+package einox
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// QPSLimitPolicy 凭证请求速率超过QPSLimit时的处理方式
+type QPSLimitPolicy string
+
+const (
+	// QPSLimitWait 默认方式，排队等待直到可以发送
+	QPSLimitWait QPSLimitPolicy = "wait"
+	// QPSLimitReject 立即返回QPSLimitExceededError
+	QPSLimitReject QPSLimitPolicy = "reject"
+)
+
+var (
+	qpsLimitersMu sync.Mutex
+	// qpsLimiters 各凭证的限流器，键为"供应商:凭证名称"，配置重新加载后继续使用
+	qpsLimiters = map[string]*rate.Limiter{}
+	// qpsLimitPolicy 超过限制时的处理方式
+	qpsLimitPolicy = QPSLimitWait
+)
+
+// SetQPSLimitPolicy 设置凭证请求速率超过QPSLimit时的处理方式，空值恢复为默认的wait
+func SetQPSLimitPolicy(policy QPSLimitPolicy) {
+	if policy == "" {
+		policy = QPSLimitWait
+	}
+	qpsLimitersMu.Lock()
+	defer qpsLimitersMu.Unlock()
+	qpsLimitPolicy = policy
+}
+
+// QPSLimitExceededError 凭证请求速率超过QPSLimit，仅在处理方式为reject时返回，调用方可通过errors.As识别
+type QPSLimitExceededError struct {
+	// Provider 供应商名称
+	Provider string
+	// Credential 凭证名称
+	Credential string
+	// Limit 每秒允许的请求数
+	Limit int
+}
+
+// Error 实现error接口
+func (e *QPSLimitExceededError) Error() string {
+	return fmt.Sprintf("凭证 %s:%s 超过每秒%d次的请求限制", e.Provider, e.Credential, e.Limit)
+}
+
+// getQPSLimiter 获取凭证的限流器和当前的处理方式
+// 配置的限制变化时调整已有限流器的速率，不重新创建，已消耗的令牌不会被重置
+func getQPSLimiter(key string, qps int) (*rate.Limiter, QPSLimitPolicy) {
+	qpsLimitersMu.Lock()
+	defer qpsLimitersMu.Unlock()
+	limiter, ok := qpsLimiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(qps), qps)
+		qpsLimiters[key] = limiter
+	} else if limiter.Burst() != qps {
+		limiter.SetLimit(rate.Limit(qps))
+		limiter.SetBurst(qps)
+	}
+	return limiter, qpsLimitPolicy
+}
+
+// waitForQPSLimit 凭证配置了QPSLimit时按限制发送请求
+// 处理方式为wait时排队等待，请求的上下文取消时停止等待；为reject时超过限制立即返回QPSLimitExceededError
+func (c *Config) waitForQPSLimit(name string, qps int) error {
+	if qps <= 0 {
+		return nil
+	}
+	limiter, policy := getQPSLimiter(c.Vendor+":"+name, qps)
+	if policy == QPSLimitReject {
+		if !limiter.Allow() {
+			return &QPSLimitExceededError{Provider: c.Vendor, Credential: name, Limit: qps}
+		}
+		return nil
+	}
+	if err := limiter.Wait(requestContext(c.ctx)); err != nil {
+		return fmt.Errorf("等待凭证 %s 的QPS限制失败: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试超过限制时排队等待
+func TestWaitForQPSLimitWait(t *testing.T) {
+	conf := &Config{Vendor: "azure"}
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, conf.waitForQPSLimit("test-qps-wait", 5))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "超过突发数后应等待令牌")
+
+	// 未配置限制时不等待
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, conf.waitForQPSLimit("test-qps-unlimited", 0))
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+// 测试处理方式为reject时返回QPSLimitExceededError
+func TestWaitForQPSLimitReject(t *testing.T) {
+	SetQPSLimitPolicy(QPSLimitReject)
+	defer SetQPSLimitPolicy("")
+
+	conf := &Config{
+		Vendor: "azure",
+		Model:  "gpt-4o",
+		InlineAzureCredential: &AzureCredential{
+			Name:     "test-qps-reject",
+			ApiKey:   "plain-key",
+			Endpoint: "https://example.openai.azure.com/",
+			QPSLimit: 1,
+		},
+	}
+	_, err := conf.getAzureConfig()
+	assert.NoError(t, err)
+
+	_, err = conf.getAzureConfig()
+	var exceeded *QPSLimitExceededError
+	if assert.True(t, errors.As(err, &exceeded)) {
+		assert.Equal(t, "azure", exceeded.Provider)
+		assert.Equal(t, "test-qps-reject", exceeded.Credential)
+		assert.Equal(t, 1, exceeded.Limit)
+	}
+}
+
+// 测试配置重新加载后沿用同一个限流器
+func TestQPSLimiterSurvivesReload(t *testing.T) {
+	limiter, _ := getQPSLimiter("azure:test-qps-reload", 2)
+	assert.True(t, limiter.Allow())
+	assert.True(t, limiter.Allow())
+
+	again, _ := getQPSLimiter("azure:test-qps-reload", 2)
+	assert.Same(t, limiter, again, "限制未变化时应复用限流器")
+	assert.False(t, again.Allow(), "令牌不应被重置")
+
+	changed, _ := getQPSLimiter("azure:test-qps-reload", 10)
+	assert.Same(t, limiter, changed, "限制变化时调整已有限流器")
+	assert.Equal(t, 10, changed.Burst())
+}
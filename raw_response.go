@@ -0,0 +1,190 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/sashabaranov/go-openai"
+)
+
+// rawChatResponse 从供应商原始响应体中解析的字段，eino-ext不会将这些字段转换到schema.Message中
+type rawChatResponse struct {
+	// SystemFingerprint 后端配置的标识，变化时相同seed的输出可能不同
+	SystemFingerprint string `json:"system_fingerprint"`
+	// PromptFilterResults Azure的提示词过滤结果，流式响应中在第一个数据帧返回
+	PromptFilterResults []rawPromptFilterResult `json:"prompt_filter_results"`
+
+	Choices []struct {
+		Message struct {
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// rawPromptFilterResult Azure的提示词过滤结果，较新的API版本使用prompt_index，旧版本使用index
+type rawPromptFilterResult struct {
+	PromptIndex          *int                        `json:"prompt_index"`
+	Index                int                         `json:"index"`
+	ContentFilterResults openai.ContentFilterResults `json:"content_filter_results"`
+}
+
+// toPromptFilterResults 转换为OpenAI格式的提示词过滤结果
+func toPromptFilterResults(raw []rawPromptFilterResult) []openai.PromptFilterResult {
+	if len(raw) == 0 {
+		return nil
+	}
+	results := make([]openai.PromptFilterResult, len(raw))
+	for i, r := range raw {
+		index := r.Index
+		if r.PromptIndex != nil {
+			index = *r.PromptIndex
+		}
+		results[i] = openai.PromptFilterResult{Index: index, ContentFilterResults: r.ContentFilterResults}
+	}
+	return results
+}
+
+// refusal 返回第一个选项的refusal，没有时返回空字符串
+func (r *rawChatResponse) refusal() string {
+	if r == nil || len(r.Choices) == 0 {
+		return ""
+	}
+	return r.Choices[0].Message.Refusal
+}
+
+// systemFingerprint 返回system_fingerprint，没有时返回空字符串
+func (r *rawChatResponse) systemFingerprint() string {
+	if r == nil {
+		return ""
+	}
+	return r.SystemFingerprint
+}
+
+// promptFilterResults 返回提示词过滤结果，没有时返回nil
+func (r *rawChatResponse) promptFilterResults() []openai.PromptFilterResult {
+	if r == nil {
+		return nil
+	}
+	return toPromptFilterResults(r.PromptFilterResults)
+}
+
+// rawResponseCapture 包装HTTP传输，读取非流式响应体并解析rawChatResponse，响应体原样交给上层；
+// 流式响应在上层读取时逐行解析数据帧。每次调用使用单独的实例，不在请求之间共享
+type rawResponseCapture struct {
+	base http.RoundTripper
+
+	mu   sync.Mutex
+	resp *rawChatResponse
+	// streamPromptFilters 流式响应中尚未被取走的提示词过滤结果
+	streamPromptFilters []openai.PromptFilterResult
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *rawResponseCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &sseCaptureBody{ReadCloser: resp.Body, capture: t}
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var raw rawChatResponse
+	if err := json.Unmarshal(body, &raw); err != nil {
+		// 无法解析时交给上层按原有方式处理
+		return resp, nil
+	}
+	t.mu.Lock()
+	t.resp = &raw
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// response 返回最近一次成功解析的响应，没有时返回nil
+func (t *rawResponseCapture) response() *rawChatResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resp
+}
+
+// takeStreamPromptFilterResults 取走流式响应中已解析的提示词过滤结果，只返回一次，nil时返回nil
+func (t *rawResponseCapture) takeStreamPromptFilterResults() []openai.PromptFilterResult {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	results := t.streamPromptFilters
+	t.streamPromptFilters = nil
+	return results
+}
+
+// captureSSELine 解析流式响应的一行，记录数据帧中的提示词过滤结果
+func (t *rawResponseCapture) captureSSELine(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimRight(line, "\r"), []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	var raw rawChatResponse
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw.PromptFilterResults) == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.streamPromptFilters = append(t.streamPromptFilters, toPromptFilterResults(raw.PromptFilterResults)...)
+	t.mu.Unlock()
+}
+
+// sseCaptureBody 包装流式响应体，上层读取的同时按行交给rawResponseCapture解析，不改变读取的内容
+type sseCaptureBody struct {
+	io.ReadCloser
+	capture *rawResponseCapture
+	line    []byte
+}
+
+// Read 实现io.Reader
+func (b *sseCaptureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	for _, c := range p[:n] {
+		if c != '\n' {
+			b.line = append(b.line, c)
+			continue
+		}
+		b.capture.captureSSELine(b.line)
+		b.line = b.line[:0]
+	}
+	return n, err
+}
+
+// captureRawResponse 返回使用rawResponseCapture的模型配置副本，不修改共享的modelConf和HTTP客户端
+func captureRawResponse(modelConf *einoopenai.ChatModelConfig) (*einoopenai.ChatModelConfig, *rawResponseCapture) {
+	conf := *modelConf
+	var client http.Client
+	if modelConf.HTTPClient != nil {
+		client = *modelConf.HTTPClient
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	capture := &rawResponseCapture{base: base}
+	client.Transport = capture
+	conf.HTTPClient = &client
+	return &conf, capture
+}
@@ -0,0 +1,74 @@
+package einox
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试从原始响应体中读取refusal，响应体原样交给上层
+func TestCaptureRawResponseRefusal(t *testing.T) {
+	body := `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":null,"refusal":"抱歉，我无法协助完成该请求。"},"finish_reason":"stop"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	shared := &http.Client{Timeout: 20 * time.Second}
+	modelConf := &einoopenai.ChatModelConfig{Model: "gpt-4o", HTTPClient: shared}
+	callConf, capture := captureRawResponse(modelConf)
+	assert.Nil(t, capture.response())
+	assert.Same(t, shared, modelConf.HTTPClient, "不修改共享的模型配置")
+	assert.Nil(t, shared.Transport, "不修改共享的HTTP客户端")
+	assert.Equal(t, 20*time.Second, callConf.HTTPClient.Timeout)
+
+	resp, err := callConf.HTTPClient.Get(server.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+	assert.Equal(t, "抱歉，我无法协助完成该请求。", capture.response().refusal())
+}
+
+// 测试没有refusal、无法解析或请求失败时不影响响应
+func TestCaptureRawResponseNoRefusal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"你好"}}]}`)
+		case "/invalid":
+			fmt.Fprint(w, "不是JSON")
+		default:
+			http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	callConf, capture := captureRawResponse(&einoopenai.ChatModelConfig{})
+	for _, path := range []string{"/invalid", "/error"} {
+		resp, err := callConf.HTTPClient.Get(server.URL + path)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	}
+	assert.Nil(t, capture.response())
+	assert.Empty(t, capture.response().refusal())
+
+	resp, err := callConf.HTTPClient.Get(server.URL + "/ok")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	if assert.NotNil(t, capture.response()) {
+		assert.Empty(t, capture.response().refusal())
+	}
+}
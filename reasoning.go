@@ -0,0 +1,67 @@
+package einox
+
+// ReasoningMode 推理内容（reasoning_content）的返回方式
+type ReasoningMode string
+
+const (
+	// ReasoningModeSeparate 默认方式：推理内容通过独立的reasoning_content字段返回
+	ReasoningModeSeparate ReasoningMode = "separate"
+	// ReasoningModeMerge 将推理内容用标签包裹后合并到content中，适用于不处理独立推理字段的客户端
+	ReasoningModeMerge ReasoningMode = "merge"
+)
+
+const (
+	reasoningOpenTag  = "<think>"
+	reasoningCloseTag = "</think>"
+)
+
+// mergeReasoningContent 将完整的推理内容用标签包裹后放在回复内容之前
+func mergeReasoningContent(reasoning, content string) string {
+	if reasoning == "" {
+		return content
+	}
+	return reasoningOpenTag + reasoning + reasoningCloseTag + content
+}
+
+// reasoningMerger 在流式响应中将推理增量合并到内容增量
+// 首个推理增量前加开始标签，推理结束后第一个内容增量或结束时补上结束标签
+type reasoningMerger struct {
+	enabled bool
+	open    bool // 是否已输出开始标签且尚未闭合
+}
+
+// newReasoningMerger 创建推理内容合并器，mode不为merge时不做任何处理
+func newReasoningMerger(mode ReasoningMode) *reasoningMerger {
+	return &reasoningMerger{enabled: mode == ReasoningModeMerge}
+}
+
+// merge 将增量中的推理内容合并到内容中，finished表示这是流的最后一个增量
+func (m *reasoningMerger) merge(delta *ChatCompletionStreamDelta, finished bool) {
+	if !m.enabled {
+		return
+	}
+
+	merged := ""
+	if delta.ReasoningContent != "" {
+		if !m.open {
+			merged += reasoningOpenTag
+			m.open = true
+		}
+		merged += delta.ReasoningContent
+		delta.ReasoningContent = ""
+	}
+	if m.open && (delta.Content != "" || finished) {
+		merged += reasoningCloseTag
+		m.open = false
+	}
+	delta.Content = merged + delta.Content
+}
+
+// pending 返回流异常缺少结束原因时仍需补上的结束标签
+func (m *reasoningMerger) pending() string {
+	if m.enabled && m.open {
+		m.open = false
+		return reasoningCloseTag
+	}
+	return ""
+}
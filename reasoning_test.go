@@ -0,0 +1,65 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 依次合并一组增量，返回合并后的内容和剩余的推理内容
+func mergeTestDeltas(mode ReasoningMode, deltas []ChatCompletionStreamDelta) (string, string) {
+	merger := newReasoningMerger(mode)
+	content, reasoning := "", ""
+	for i := range deltas {
+		delta := deltas[i]
+		merger.merge(&delta, i == len(deltas)-1)
+		content += delta.Content
+		reasoning += delta.ReasoningContent
+	}
+	return content + merger.pending(), reasoning
+}
+
+// 测试合并模式下推理内容被标签包裹后放在内容之前
+func TestReasoningMergerMerge(t *testing.T) {
+	content, reasoning := mergeTestDeltas(ReasoningModeMerge, []ChatCompletionStreamDelta{
+		{Role: "assistant", ReasoningContent: "用户在"},
+		{ReasoningContent: "打招呼"},
+		{Content: "你好"},
+		{Content: "！"},
+	})
+	assert.Equal(t, "<think>用户在打招呼</think>你好！", content)
+	assert.Empty(t, reasoning)
+
+	// 只有推理内容时在最后一个增量闭合标签
+	content, _ = mergeTestDeltas(ReasoningModeMerge, []ChatCompletionStreamDelta{
+		{ReasoningContent: "思考中"},
+		{},
+	})
+	assert.Equal(t, "<think>思考中</think>", content)
+
+	// 流中途结束时由pending补上结束标签
+	merger := newReasoningMerger(ReasoningModeMerge)
+	delta := ChatCompletionStreamDelta{ReasoningContent: "思考中"}
+	merger.merge(&delta, false)
+	assert.Equal(t, "<think>思考中", delta.Content)
+	assert.Equal(t, "</think>", merger.pending())
+	assert.Empty(t, merger.pending())
+}
+
+// 测试默认模式下推理内容保持独立
+func TestReasoningMergerSeparate(t *testing.T) {
+	for _, mode := range []ReasoningMode{"", ReasoningModeSeparate} {
+		content, reasoning := mergeTestDeltas(mode, []ChatCompletionStreamDelta{
+			{ReasoningContent: "用户在打招呼"},
+			{Content: "你好"},
+		})
+		assert.Equal(t, "你好", content)
+		assert.Equal(t, "用户在打招呼", reasoning)
+	}
+}
+
+// 测试非流式响应的推理内容合并
+func TestMergeReasoningContent(t *testing.T) {
+	assert.Equal(t, "<think>先算2+2</think>4", mergeReasoningContent("先算2+2", "4"))
+	assert.Equal(t, "4", mergeReasoningContent("", "4"))
+}
@@ -0,0 +1,70 @@
+package einox
+
+import (
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// FinishReasonRefusal 模型拒绝回答时的结束原因，便于调用方与正常的stop区分
+const FinishReasonRefusal openai.FinishReason = "refusal"
+
+// RefusalHandling 模型拒绝回答时的处理方式
+type RefusalHandling string
+
+const (
+	// RefusalHandlingSurface 默认方式：拒绝内容放在Message.Refusal，结束原因为refusal
+	RefusalHandlingSurface RefusalHandling = "surface"
+	// RefusalHandlingContent 将拒绝内容作为普通回复内容返回，结束原因为stop
+	RefusalHandlingContent RefusalHandling = "content"
+	// RefusalHandlingError 模型拒绝时返回 *RefusalError
+	RefusalHandlingError RefusalHandling = "error"
+)
+
+// RefusalError 模型拒绝回答时返回的错误
+type RefusalError struct {
+	Model   string // 模型名称
+	Refusal string // 模型给出的拒绝说明
+}
+
+func (e *RefusalError) Error() string {
+	return fmt.Sprintf("模型 %s 拒绝回答: %s", e.Model, e.Refusal)
+}
+
+// setChoiceRefusal 将refusal写入响应选项，并映射为独立的结束原因
+func setChoiceRefusal(choice *openai.ChatCompletionChoice, refusal string) {
+	if refusal == "" {
+		return
+	}
+	choice.Message.Refusal = refusal
+	choice.FinishReason = FinishReasonRefusal
+}
+
+// applyRefusalHandling 按配置的方式处理响应中的refusal
+func applyRefusalHandling(resp *openai.ChatCompletionResponse, handling RefusalHandling) (*openai.ChatCompletionResponse, error) {
+	if resp == nil {
+		return resp, nil
+	}
+
+	for i := range resp.Choices {
+		choice := &resp.Choices[i]
+		if choice.Message.Refusal == "" {
+			continue
+		}
+
+		switch handling {
+		case RefusalHandlingContent:
+			if choice.Message.Content == "" {
+				choice.Message.Content = choice.Message.Refusal
+			}
+			choice.Message.Refusal = ""
+			choice.FinishReason = openai.FinishReasonStop
+		case RefusalHandlingError:
+			return nil, &RefusalError{Model: resp.Model, Refusal: choice.Message.Refusal}
+		default:
+			choice.FinishReason = FinishReasonRefusal
+		}
+	}
+
+	return resp, nil
+}
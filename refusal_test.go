@@ -0,0 +1,58 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造一个模拟的拒绝响应，refusal来自供应商的原始响应体
+func newRefusalResponse() *openai.ChatCompletionResponse {
+	var raw rawChatResponse
+	_ = json.Unmarshal([]byte(`{"choices":[{"message":{"role":"assistant","content":null,"refusal":"抱歉，我无法协助完成该请求。"}}]}`), &raw)
+	choice := openai.ChatCompletionChoice{
+		Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant},
+		FinishReason: openai.FinishReasonStop,
+	}
+	setChoiceRefusal(&choice, raw.refusal())
+	return &openai.ChatCompletionResponse{Model: "gpt-4o", Choices: []openai.ChatCompletionChoice{choice}}
+}
+
+func TestRefusalHandling(t *testing.T) {
+	// 默认方式：refusal单独返回并映射为独立的结束原因
+	resp, err := applyRefusalHandling(newRefusalResponse(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "抱歉，我无法协助完成该请求。", resp.Choices[0].Message.Refusal)
+	assert.Empty(t, resp.Choices[0].Message.Content)
+	assert.Equal(t, FinishReasonRefusal, resp.Choices[0].FinishReason)
+
+	// content方式：refusal作为普通内容返回
+	resp, err = applyRefusalHandling(newRefusalResponse(), RefusalHandlingContent)
+	assert.NoError(t, err)
+	assert.Equal(t, "抱歉，我无法协助完成该请求。", resp.Choices[0].Message.Content)
+	assert.Empty(t, resp.Choices[0].Message.Refusal)
+	assert.Equal(t, openai.FinishReasonStop, resp.Choices[0].FinishReason)
+
+	// error方式：返回RefusalError
+	_, err = applyRefusalHandling(newRefusalResponse(), RefusalHandlingError)
+	var refusalErr *RefusalError
+	assert.True(t, errors.As(err, &refusalErr))
+	assert.Equal(t, "gpt-4o", refusalErr.Model)
+}
+
+func TestRefusalHandlingNormalResponse(t *testing.T) {
+	// 没有refusal的正常响应不受影响
+	resp := &openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: "assistant", Content: "你好"},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}
+	resp, err := applyRefusalHandling(resp, RefusalHandlingError)
+	assert.NoError(t, err)
+	assert.Equal(t, "你好", resp.Choices[0].Message.Content)
+	assert.Equal(t, openai.FinishReasonStop, resp.Choices[0].FinishReason)
+}
@@ -0,0 +1,52 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// RequestOutcome 请求结果，用作指标的标签
+type RequestOutcome string
+
+const (
+	// OutcomeSuccess 请求成功，流式请求正常结束
+	OutcomeSuccess RequestOutcome = "success"
+	// OutcomeError 请求失败或流异常中断
+	OutcomeError RequestOutcome = "error"
+	// OutcomeCanceled 调用方取消了请求（ctx被取消或流式回调返回错误）
+	OutcomeCanceled RequestOutcome = "canceled"
+)
+
+// requestOutcome 根据请求返回的错误判断请求结果
+func requestOutcome(err error) RequestOutcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	default:
+		return OutcomeError
+	}
+}
+
+// reportRequestMetrics 上报请求结果、端到端耗时和token用量，usage为nil表示供应商未返回用量
+func reportRequestMetrics(provider, model string, outcome RequestOutcome, start time.Time, usage *openai.Usage) {
+	hook := getMetricsHook()
+	provider, model = providerOrDefault(provider), normalizeModelName(model)
+	if hook.OnRequest != nil {
+		hook.OnRequest(provider, model, outcome, time.Since(start))
+	}
+	if usage != nil && hook.OnTokens != nil {
+		hook.OnTokens(provider, model, usage.PromptTokens, usage.CompletionTokens)
+	}
+}
+
+// reportTimeToFirstToken 上报流式请求的首个token耗时
+func reportTimeToFirstToken(provider, model string, ttft time.Duration) {
+	if hook := getMetricsHook(); hook.OnTimeToFirstToken != nil {
+		hook.OnTimeToFirstToken(providerOrDefault(provider), normalizeModelName(model), ttft)
+	}
+}
@@ -0,0 +1,152 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMetrics 记录请求级指标回调收到的内容
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []string
+	ttft     []time.Duration
+	latency  []string
+	prompt   int
+	complete int
+}
+
+func (m *recordingMetrics) ObserveRequest(provider, model string, outcome RequestOutcome, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, provider+"/"+model+"/"+string(outcome))
+}
+
+func (m *recordingMetrics) ObserveTimeToFirstToken(provider, model string, ttft time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ttft = append(m.ttft, ttft)
+}
+
+func (m *recordingMetrics) ObserveLatency(provider string, latency LatencyBreakdown) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency = append(m.latency, provider)
+}
+
+func (m *recordingMetrics) AddTokens(provider, model string, promptTokens, completionTokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prompt += promptTokens
+	m.complete += completionTokens
+}
+
+// setRecordingMetrics 设置记录请求级指标的回调，测试结束后取消
+func setRecordingMetrics(t *testing.T) *recordingMetrics {
+	metrics := &recordingMetrics{}
+	SetMetricsHook(MetricsHook{
+		OnRequest:          metrics.ObserveRequest,
+		OnTimeToFirstToken: metrics.ObserveTimeToFirstToken,
+		OnLatency:          metrics.ObserveLatency,
+		OnTokens:           metrics.AddTokens,
+	})
+	t.Cleanup(func() { SetMetricsHook(MetricsHook{}) })
+	return metrics
+}
+
+// 测试非流式请求按结果上报请求数和token用量
+func TestRequestMetricsNonStream(t *testing.T) {
+	metrics := setRecordingMetrics(t)
+	RegisterProvider("metrics", &usageProvider{})
+	RegisterProvider("metrics-failing", &failingProvider{})
+	t.Cleanup(func() {
+		unregisterTestProvider("metrics")
+		unregisterTestProvider("metrics-failing")
+	})
+
+	req := ChatRequest{Provider: "metrics"}
+	req.Model = " gpt-4o "
+	req.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+	_, err := CreateChatCompletion(req, nil)
+	assert.NoError(t, err)
+
+	req.Provider = "metrics-failing"
+	_, err = CreateChatCompletion(req, nil)
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"metrics/gpt-4o/success", "metrics-failing/gpt-4o/error"}, metrics.requests)
+	assert.Equal(t, 10, metrics.prompt)
+	assert.Equal(t, 5, metrics.complete)
+	assert.Empty(t, metrics.ttft, "非流式请求不上报首个token耗时")
+	assert.Empty(t, metrics.latency, "非流式请求不上报耗时分解")
+
+	// 写入writer的流式请求按首次写出的时间上报首个token耗时
+	req.Provider = "metrics"
+	req.Stream = true
+	_, err = CreateChatCompletion(req, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, "metrics/gpt-4o/success", metrics.requests[2])
+	assert.Len(t, metrics.ttft, 1)
+	assert.Equal(t, []string{"metrics"}, metrics.latency, "写入writer的流式请求同样上报耗时分解")
+}
+
+// 测试流式请求上报首个token耗时，以及流中断和调用方中途停止的结果
+func TestRequestMetricsStream(t *testing.T) {
+	metrics := setRecordingMetrics(t)
+	registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你", ""),
+		newTestStreamChunk("好", openai.FinishReasonStop),
+	}, nil)
+	req := ChatRequest{Provider: "chunks"}
+	req.Model = "gpt-4o"
+
+	err := StreamChatCompletionFunc(context.Background(), req, func(chunk *openai.ChatCompletionStreamResponse) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	stop := errors.New("停止")
+	err = StreamChatCompletionFunc(context.Background(), req, func(chunk *openai.ChatCompletionStreamResponse) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+
+	events, err := StreamChatCompletionChannel(context.Background(), req)
+	assert.NoError(t, err)
+	for range events {
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	assert.Equal(t, []string{"chunks/gpt-4o/success", "chunks/gpt-4o/canceled", "chunks/gpt-4o/success"}, metrics.requests)
+	assert.Len(t, metrics.ttft, 2)
+	assert.Equal(t, []string{"chunks", "chunks"}, metrics.latency, "中途停止的流不上报耗时分解")
+}
+
+// 测试流中断时上报为错误
+func TestRequestMetricsStreamError(t *testing.T) {
+	metrics := setRecordingMetrics(t)
+	registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{newTestStreamChunk("你", "")}, errors.New("连接中断"))
+	req := ChatRequest{Provider: "chunks"}
+	req.Model = "gpt-4o"
+
+	err := StreamChatCompletionFunc(context.Background(), req, func(chunk *openai.ChatCompletionStreamResponse) error {
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"chunks/gpt-4o/error"}, metrics.requests)
+	assert.Empty(t, metrics.ttft)
+}
+
+// 测试根据错误判断请求结果
+func TestRequestOutcome(t *testing.T) {
+	assert.Equal(t, OutcomeSuccess, requestOutcome(nil))
+	assert.Equal(t, OutcomeCanceled, requestOutcome(context.Canceled))
+	assert.Equal(t, OutcomeError, requestOutcome(errors.New("失败")))
+}
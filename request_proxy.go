@@ -0,0 +1,20 @@
+package einox
+
+import "net/http"
+
+// effectiveProxy 返回本次调用使用的代理，请求指定的代理优先于凭证配置的代理
+func (c *Config) effectiveProxy(credentialProxy string) string {
+	if c.RequestProxy != "" {
+		return c.RequestProxy
+	}
+	return credentialProxy
+}
+
+// callHTTPClient 返回本次调用使用的HTTP客户端
+// 使用凭证配置的代理时复用连接池，请求指定了代理时每次创建独立的客户端，避免连接池随请求的代理取值无限增长
+func (c *Config) callHTTPClient(provider string, base *http.Client, credentialProxy string, tlsConf CredentialTLS, timeoutSeconds int) (*http.Client, error) {
+	if c.RequestProxy != "" {
+		return newRequestHTTPClient(provider, base, c.RequestProxy, tlsConf, timeoutSeconds)
+	}
+	return newCallHTTPClient(provider, base, credentialProxy, tlsConf, timeoutSeconds)
+}
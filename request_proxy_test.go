@@ -0,0 +1,111 @@
+package einox
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// proxyOf 返回HTTP客户端对目标地址使用的代理，未设置代理时返回空字符串
+func proxyOf(t *testing.T, client *http.Client) string {
+	transport := client.Transport
+	if traced, ok := transport.(*connTraceTransport); ok {
+		transport = traced.base
+	}
+	httpTransport, ok := transport.(*http.Transport)
+	if !ok || httpTransport.Proxy == nil {
+		return ""
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.openai.azure.com/", nil)
+	proxyURL, err := httpTransport.Proxy(req)
+	assert.NoError(t, err)
+	if proxyURL == nil {
+		return ""
+	}
+	return proxyURL.String()
+}
+
+// 测试请求指定的代理优先于凭证配置的代理
+func TestEffectiveProxy(t *testing.T) {
+	assert.Equal(t, "http://cred:8080", (&Config{}).effectiveProxy("http://cred:8080"))
+	assert.Equal(t, "http://debug:8888", (&Config{RequestProxy: "http://debug:8888"}).effectiveProxy("http://cred:8080"))
+	assert.Equal(t, "", (&Config{}).effectiveProxy(""))
+}
+
+// 测试Azure请求覆盖凭证的代理，且并发请求共享的AzureConfig不被修改
+func TestAzureRequestProxy(t *testing.T) {
+	shared := &AzureConfig{HTTPClient: &http.Client{}}
+	newConf := func(proxy string) *Config {
+		return &Config{
+			Vendor:         "azure",
+			Model:          "gpt-4o",
+			RequestProxy:   proxy,
+			VendorOptional: &VendorOptional{AzureConfig: shared},
+			InlineAzureCredential: &AzureCredential{
+				Name:     "vault",
+				ApiKey:   "plain-key",
+				Endpoint: "https://example.openai.azure.com/",
+				Proxy:    "http://egress:3128",
+				Timeout:  20,
+			},
+		}
+	}
+
+	azureConf, err := newConf("").getAzureConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://egress:3128", proxyOf(t, azureConf.HTTPClient))
+
+	debugConf, err := newConf("http://debug:8888").getAzureConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://debug:8888", proxyOf(t, debugConf.HTTPClient))
+	assert.Equal(t, 20*time.Second, debugConf.HTTPClient.Timeout)
+
+	assert.Equal(t, "http://egress:3128", proxyOf(t, azureConf.HTTPClient), "其他请求的客户端不受影响")
+	assert.Nil(t, shared.HTTPClient.Transport, "共享的HTTPClient不被修改")
+	assert.Zero(t, shared.HTTPClient.Timeout)
+}
+
+// 测试共享同一个VendorOptional的并发请求选中代理不同的凭证时，各自使用凭证的代理
+func TestAzureSharedConfigConcurrentProxies(t *testing.T) {
+	for name, shared := range map[string]*VendorOptional{
+		"未配置AzureConfig": {},
+		"配置了HTTPClient":  {AzureConfig: &AzureConfig{HTTPClient: &http.Client{}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			hadAzureConfig := shared.AzureConfig != nil
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					proxy := fmt.Sprintf("http://egress-%d:3128", i%4)
+					conf := &Config{
+						Vendor:         "azure",
+						Model:          "gpt-4o",
+						VendorOptional: shared,
+						InlineAzureCredential: &AzureCredential{
+							Name:     fmt.Sprintf("region-%d", i%4),
+							ApiKey:   "plain-key",
+							Endpoint: "https://example.openai.azure.com/",
+							Proxy:    proxy,
+						},
+					}
+					azureConf, err := conf.getAzureConfig()
+					if assert.NoError(t, err) {
+						assert.Equal(t, proxy, proxyOf(t, azureConf.HTTPClient))
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			assert.Equal(t, hadAzureConfig, shared.AzureConfig != nil, "不向共享的配置写回默认值")
+			if hadAzureConfig {
+				assert.Nil(t, shared.AzureConfig.HTTPClient.Transport, "共享的HTTPClient不被修改")
+			}
+		})
+	}
+}
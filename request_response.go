@@ -1,6 +1,11 @@
 package einox
 
-import "github.com/sashabaranov/go-openai"
+import (
+	"context"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
 
 // ChatCompletionRequest 聊天完成请求
 type ChatCompletionRequest struct {
@@ -16,6 +21,41 @@ type ChatCompletionRequest struct {
 	FrequencyP  float32        `json:"frequency_penalty"`           // 频率惩罚
 	LogitBias   map[string]int `json:"logit_bias"`                  // 逻辑偏差
 	User        string         `json:"user"`                        // 用户标识
+	// StreamOptions 流式选项，IncludeUsage为true时在流的最后返回使用情况
+	StreamOptions *openai.StreamOptions `json:"stream_options,omitempty"`
+	// ReasoningMode 推理内容的返回方式，默认为separate
+	ReasoningMode ReasoningMode `json:"reasoning_mode,omitempty"`
+	// ResponseFormat 输出格式，json_schema用于结构化输出
+	ResponseFormat *openai.ChatCompletionResponseFormat `json:"response_format,omitempty"`
+	// Seed 随机种子，相同的seed和参数尽量返回相同的结果
+	Seed *int `json:"seed,omitempty"`
+
+	// onCredentialSelected 选中凭证后的回调，用于记录实际使用的凭证
+	onCredentialSelected func(info CallInfo)
+
+	// credentialName 指定使用的凭证名称，来自ChatRequest.CredentialName
+	credentialName string
+
+	// deterministicSelection 按选择键确定性地选择凭证，来自ChatRequest.DeterministicSelection
+	deterministicSelection bool
+
+	// concurrencySlots 请求占用的凭证并发槽位
+	concurrencySlots *concurrencySlots
+
+	// credentialFallback 凭证故障转移状态
+	credentialFallback *credentialFallback
+
+	// proxy 请求指定的代理，来自ChatRequest.Proxy
+	proxy string
+
+	// timeout 请求指定的超时时间，来自ChatRequest.Timeout
+	timeout time.Duration
+
+	// ctx 请求的上下文，由CreateChatCompletionCtx设置，取消后中止对供应商的调用
+	ctx context.Context
+
+	// onRawFinishReason 收到供应商原始结束原因时的回调
+	onRawFinishReason func(reason string)
 }
 
 // ChatMessage 聊天消息
@@ -56,6 +96,8 @@ type ChatCompletionStreamResponse struct {
 	Created int64                        `json:"created"` // 创建时间
 	Model   string                       `json:"model"`   // 模型名称
 	Choices []ChatCompletionStreamChoice `json:"choices"` // 选择列表
+	// Usage 使用情况，仅在请求了IncludeUsage时出现在最后一个数据块中
+	Usage *ChatCompletionUsage `json:"usage,omitempty"`
 }
 
 // ChatCompletionStreamChoice 聊天完成流式选择
@@ -78,6 +120,131 @@ type ChatRequest struct {
 	openai.ChatCompletionRequest
 	//额外参数
 	Extra map[string]any `json:"extra,omitempty"` // 额外参数
+
+	// DecodeToolAttachments 为true时，工具结果中的base64图片/PDF会被转换为多模态内容
+	// 仅对支持视觉输入的模型生效
+	DecodeToolAttachments bool `json:"decode_tool_attachments,omitempty"`
+
+	// RefusalHandling 模型拒绝回答时的处理方式，默认为surface
+	RefusalHandling RefusalHandling `json:"refusal_handling,omitempty"`
+
+	// ProfileName 使用的参数预设名称（见SetParameterProfiles），请求中非零值的参数优先于预设，值为0的参数视为未设置
+	ProfileName string `json:"profile_name,omitempty"`
+
+	// MaxSSEFrameBytes 单个SSE帧中增量内容的最大字节数，超出时拆分为多个帧，0表示不限制
+	// 只限制文本内容，工具调用的Arguments增量不拆分，单帧可能超过该上限
+	MaxSSEFrameBytes int `json:"max_sse_frame_bytes,omitempty"`
+
+	// ErrorOnEmptyCompletion 为true时，非流式响应既没有内容也没有工具调用会返回ErrEmptyCompletion，便于调用方重试
+	ErrorOnEmptyCompletion bool `json:"error_on_empty_completion,omitempty"`
+
+	// MaxContinuations 非流式响应因长度截断(finish_reason为length)时自动续写的最大次数，0表示不续写
+	// 续写依赖assistant消息预填充，仅支持claude和bedrock，其他供应商设置后返回ErrContinuationUnsupported
+	MaxContinuations int `json:"max_continuations,omitempty"`
+
+	// DedupeStreamDeltas 为true时丢弃流式响应中完全相同的连续文本增量，用于规避网关重复推送
+	DedupeStreamDeltas bool `json:"dedupe_stream_deltas,omitempty"`
+
+	// UsageTrailers 为true时，StreamToHTTP会额外通过HTTP trailer返回token使用情况，供只读取trailer的代理客户端使用
+	UsageTrailers bool `json:"usage_trailers,omitempty"`
+
+	// CompletionTokenBudget 流式响应的补全token预算，累计超过后提前结束生成并返回finish_reason为length，0表示不限制
+	CompletionTokenBudget int `json:"completion_token_budget,omitempty"`
+
+	// ReasoningMode 推理内容的返回方式，默认为separate；merge时推理内容用<think>标签包裹后合并到content中
+	ReasoningMode ReasoningMode `json:"reasoning_mode,omitempty"`
+
+	// AzureCredential 调用方直接提供的已解密Azure凭证（如从密钥管理服务获取），
+	// 设置后跳过azure.yaml的读取和RSA解密；不参与JSON序列化，避免客户端通过请求体传入凭证
+	AzureCredential *AzureCredential `json:"-"`
+
+	// Proxy 本次请求使用的代理地址，优先于凭证配置的代理，如临时经由调试代理发出请求；
+	// 目前对Azure、OpenAI和通义千问生效。不参与JSON序列化，避免客户端通过请求体指定出口
+	Proxy string `json:"-"`
+
+	// Timeout 本次请求的超时时间，优先于凭证配置的timeout；非流式调用为总超时，
+	// 流式调用为两个数据块之间的最长等待时间。目前对Azure、OpenAI和通义千问生效
+	Timeout time.Duration `json:"-"`
+
+	// ToolOutputHandling 工具结果不符合RegisterToolOutputSchema注册的输出结构时的处理方式，默认为error
+	ToolOutputHandling ToolOutputHandling `json:"tool_output_handling,omitempty"`
+
+	// RequireSeed 为true时，目标供应商不支持seed会返回ErrSeedUnsupported，而不是忽略seed继续请求
+	RequireSeed bool `json:"require_seed,omitempty"`
+
+	// WarnOnFingerprintChange 为true时，带seed的请求在供应商返回的system_fingerprint与同一模型上一次的值不同时，
+	// 在ChatCompletionResult.Warnings中给出警告，说明后端配置已变化，相同seed的输出可能不同；目前对Azure、OpenAI和通义千问生效
+	WarnOnFingerprintChange bool `json:"warn_on_fingerprint_change,omitempty"`
+
+	// IgnoredToolsHandling 绑定了工具但模型直接以文字回答时的处理方式，默认为accept；仅对非流式请求生效
+	IgnoredToolsHandling IgnoredToolsHandling `json:"ignored_tools_handling,omitempty"`
+
+	// EmitRoleChunk 为true时，流式响应的首个数据块只携带assistant角色，与OpenAI的行为一致，供依赖该数据块的客户端使用
+	EmitRoleChunk bool `json:"emit_role_chunk,omitempty"`
+
+	// IdempotencyKey 幂等键，标识同一个逻辑请求，重试时应保持不变
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// DeriveSeedFromIdempotencyKey 为true且未指定seed时，由IdempotencyKey生成seed，使重试得到相同的输出
+	DeriveSeedFromIdempotencyKey bool `json:"derive_seed_from_idempotency_key,omitempty"`
+
+	// StreamFormat 流式响应的输出格式，默认为chat_completions；responses时输出Responses API风格的事件
+	StreamFormat StreamFormat `json:"stream_format,omitempty"`
+
+	// MediaOptions 多模态内容的处理选项，如远程图片的下载大小和超时限制，未设置时使用服务端的上限
+	// 只能由服务端设置，不从请求体解析，上限见SetMediaFetchPolicy
+	MediaOptions *MediaOptions `json:"-"`
+
+	// FallbackEnabled 为true时，凭证调用出现限流(429)、服务端错误(5xx)或超时后，换用其余启用的凭证重试（按权重从高到低，跳过已失败的凭证）
+	// 流式请求仅在尚未输出任何内容时转移；只能由服务端设置，不从请求体解析
+	FallbackEnabled bool `json:"-"`
+
+	// MaxFallbacks 开启FallbackEnabled时最多转移的次数，0表示依次尝试全部启用的凭证
+	// 不参与JSON序列化，避免客户端通过请求体放大对供应商的调用次数
+	MaxFallbacks int `json:"-"`
+
+	// RetryPolicy 瞬时错误（429、500、502、503、504、网络超时）的重试策略，未设置时不重试
+	// 每个凭证先按策略重试，开启FallbackEnabled时重试仍失败再转移到其他凭证；流式请求仅在尚未输出任何内容时重试。
+	// 不参与JSON序列化，避免客户端通过请求体放大对供应商的调用次数
+	RetryPolicy *RetryPolicy `json:"-"`
+
+	// CredentialName 指定使用的凭证名称，跳过凭证选择策略，用于复现某个凭证上的问题
+	// 凭证不存在或未启用时返回ErrCredentialNotFound或ErrCredentialDisabled
+	// 只能由服务端设置，不从请求体解析，避免客户端绕过凭证选择策略
+	CredentialName string `json:"-"`
+
+	// DeterministicSelection 为true时凭证不再随机选择，而是按User的哈希值在启用的凭证中按权重确定性地选择，
+	// 同一User（未设置时视为同一个空值）在凭证配置不变时始终使用同一凭证
+	// 只能由服务端设置，不从请求体解析，避免客户端通过构造User把流量集中到某个凭证
+	DeterministicSelection bool `json:"-"`
+
+	// StrictValidation 为true时，发送前按ValidateMessages检查消息顺序，不合法时返回 *MessageValidationError 而不调用供应商
+	StrictValidation bool `json:"strict_validation,omitempty"`
+
+	// MaxContextTokens 输入token数上限，大于0时发送前按TruncationStrategy整轮丢弃较早的历史消息，
+	// system消息和最近一轮对话始终保留；token数按CountTokens计算
+	MaxContextTokens int `json:"max_context_tokens,omitempty"`
+
+	// TruncationStrategy 超过MaxContextTokens时裁剪历史消息的方式，默认为drop_oldest
+	TruncationStrategy TruncationStrategy `json:"truncation_strategy,omitempty"`
+
+	// onCredentialSelected 选中凭证后的回调，用于在响应中记录实际使用的凭证
+	onCredentialSelected func(info CallInfo)
+
+	// concurrencySlots 请求占用的凭证并发槽位，由统一入口创建并在调用结束后释放
+	concurrencySlots *concurrencySlots
+
+	// credentialFallback 凭证故障转移状态，由统一入口在开启FallbackEnabled时创建
+	credentialFallback *credentialFallback
+
+	// ctx 请求的上下文，由CreateChatCompletionCtx设置，取消后中止对供应商的调用
+	ctx context.Context
+
+	// onRawFinishReason 收到供应商原始结束原因时的回调，结束原因归一化为OpenAI格式前的值
+	onRawFinishReason func(reason string)
+
+	// onTruncated 按MaxContextTokens裁剪了历史消息时的回调
+	onTruncated func(info *TruncationInfo)
 }
 
 // ChatResponse 聊天响应
@@ -111,6 +278,8 @@ type StreamResponse struct {
 	Created int64          `json:"created"` // 创建时间
 	Model   string         `json:"model"`   // 模型名称
 	Choices []StreamChoice `json:"choices"` // 选择列表
+	// Usage 使用情况，仅在请求了IncludeUsage时出现在最后一个数据块中
+	Usage *ChatCompletionUsage `json:"usage,omitempty"`
 }
 
 // StreamChoice 流式选择
@@ -122,15 +291,17 @@ type StreamChoice struct {
 
 // StreamChoiceDelta 流式选择增量
 type StreamChoiceDelta struct {
-	Role    string `json:"role,omitempty"`    // 角色
-	Content string `json:"content,omitempty"` // 内容
+	Role             string `json:"role,omitempty"`              // 角色
+	Content          string `json:"content,omitempty"`           // 内容
+	ReasoningContent string `json:"reasoning_content,omitempty"` // 推理内容，用于DeepSeek模型
 }
 
 // ErrorResponse 错误响应
 type ErrorResponse struct {
 	Error struct {
-		Message string `json:"message"` // 错误消息
-		Type    string `json:"type"`    // 错误类型
-		Code    string `json:"code"`    // 错误代码
+		Message string  `json:"message"` // 错误消息
+		Type    string  `json:"type"`    // 错误类型
+		Param   *string `json:"param"`   // 出错的参数，与OpenAI一致没有时为null
+		Code    string  `json:"code"`    // 错误代码
 	} `json:"error"`
 }
@@ -0,0 +1,113 @@
+package einox
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ResolvedConfig 应用默认值、参数预设等之后实际发送的请求配置，用于审计
+// 只记录凭证名称，不包含密钥等敏感信息
+type ResolvedConfig struct {
+	Provider    string   `json:"provider"`               // 供应商
+	Model       string   `json:"model"`                  // 模型名称
+	Temperature float32  `json:"temperature"`            // 温度参数
+	TopP        float32  `json:"top_p"`                  // 核采样参数
+	MaxTokens   int      `json:"max_tokens"`             // 最大生成token数
+	Stop        []string `json:"stop,omitempty"`         // 停止序列
+	ToolCount   int      `json:"tool_count"`             // 绑定的工具数量
+	ProfileName string   `json:"profile_name,omitempty"` // 使用的参数预设
+	Seed        *int     `json:"seed,omitempty"`         // 请求的seed
+	Credential  string   `json:"credential,omitempty"`   // 实际使用的凭证名称，多次调用时为最后一次
+
+	mu sync.Mutex
+}
+
+// ChatCompletionResult 附带实际生效配置的聊天响应
+type ChatCompletionResult struct {
+	*openai.ChatCompletionResponse
+	ResolvedConfig *ResolvedConfig `json:"resolved_config,omitempty"` // 实际生效的请求配置
+	Warnings       []string        `json:"warnings,omitempty"`        // 警告信息
+	// RawFinishReason 供应商原始的结束原因（如Bedrock的tool_use），Choices中的结束原因已统一为OpenAI格式
+	RawFinishReason string `json:"raw_finish_reason,omitempty"`
+	// Truncation 按MaxContextTokens裁剪历史消息的结果，未裁剪时为nil
+	Truncation *TruncationInfo `json:"truncation,omitempty"`
+	// CallInfo 实际处理请求的凭证及其端点，未选中凭证（如自定义供应商）时为nil
+	CallInfo *CallInfo `json:"call_info,omitempty"`
+}
+
+// CreateChatCompletionWithResolvedConfig 发起非流式请求，并在响应中附带实际生效的请求配置
+// 配置为应用参数预设、模型默认停止序列等之后的值，凭证为本次调用实际选中的凭证；
+// 带seed的请求按需在供应商的system_fingerprint变化时给出警告，供应商原始的结束原因记录在RawFinishReason中，
+// 按MaxContextTokens裁剪了历史消息时记录在Truncation中，实际处理请求的凭证及其端点记录在CallInfo中
+func CreateChatCompletionWithResolvedConfig(req ChatRequest) (*ChatCompletionResult, error) {
+	if req.Stream {
+		return nil, errors.New("CreateChatCompletionWithResolvedConfig不支持流式请求")
+	}
+
+	resolved := &ResolvedConfig{}
+	var rawFinishReason string
+	req.onCredentialSelected = resolved.setCredential
+	callInfo := captureCallInfo(&req)
+	var truncation *TruncationInfo
+	req.onRawFinishReason = func(reason string) { rawFinishReason = reason }
+	req.onTruncated = func(info *TruncationInfo) { truncation = info }
+	resp, err := createChatCompletion(req, nil, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChatCompletionResult{
+		ChatCompletionResponse: resp,
+		ResolvedConfig:         resolved,
+		RawFinishReason:        rawFinishReason,
+		Truncation:             truncation,
+		CallInfo:               callInfoOrNil(callInfo()),
+	}
+	result.applySystemFingerprint(resolved.Seed, req.WarnOnFingerprintChange)
+	return result, nil
+}
+
+// applySystemFingerprint 带seed的请求记录供应商返回的system_fingerprint，按需在与同一模型上一次的值不同时添加警告
+func (r *ChatCompletionResult) applySystemFingerprint(seed *int, warn bool) {
+	if seed == nil || r.ChatCompletionResponse == nil || r.SystemFingerprint == "" {
+		return
+	}
+	previous := recordSystemFingerprint(r.ResolvedConfig.Provider, r.ResolvedConfig.Model, r.SystemFingerprint)
+	if !warn {
+		return
+	}
+	if warning := systemFingerprintWarning(previous, r.SystemFingerprint); warning != "" {
+		r.Warnings = append(r.Warnings, warning)
+	}
+}
+
+// fill 记录预处理后的请求参数
+func (r *ResolvedConfig) fill(provider string, req ChatRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Provider = provider
+	r.Model = req.Model
+	r.Temperature = req.Temperature
+	r.TopP = req.TopP
+	r.MaxTokens = req.MaxTokens
+	r.Stop = append([]string(nil), req.Stop...)
+	r.ToolCount = len(req.Tools)
+	r.ProfileName = req.ProfileName
+	r.Seed = req.Seed
+}
+
+// setCredential 记录选中的凭证名称
+func (r *ResolvedConfig) setCredential(info CallInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Credential = info.Credential
+}
+
+// recordSelectedCredential 通知请求方选中的凭证及其端点
+func (c *Config) recordSelectedCredential(name, endpoint string) {
+	if c.onCredentialSelected != nil {
+		c.onCredentialSelected(CallInfo{Provider: c.Vendor, Credential: name, Endpoint: endpoint})
+	}
+}
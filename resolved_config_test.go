@@ -0,0 +1,67 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试记录的配置反映预设和默认停止序列
+func TestResolvedConfigReflectsDefaults(t *testing.T) {
+	temperature := float32(1.2)
+	SetParameterProfiles(map[string]ParameterProfile{
+		"creative": {Temperature: &temperature, MaxTokens: 2048},
+	})
+	defer SetParameterProfiles(nil)
+	SetModelStopDefaults(map[string][]string{"gpt-4o*": {"<|end|>"}})
+	defer SetModelStopDefaults(nil)
+
+	req := ChatRequest{
+		Provider:    "unsupported-test",
+		ProfileName: "creative",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o-mini",
+			TopP:     0.9,
+			Stop:     []string{"END"},
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+			Tools: []openai.Tool{
+				{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get_weather"}},
+			},
+		},
+	}
+
+	// 供应商不受支持时在预处理之后才会失败，已记录的配置可用于断言
+	resolved := &ResolvedConfig{}
+	_, err := createChatCompletion(req, nil, resolved)
+	assert.Error(t, err)
+
+	assert.Equal(t, "unsupported-test", resolved.Provider)
+	assert.Equal(t, "gpt-4o-mini", resolved.Model)
+	assert.Equal(t, float32(1.2), resolved.Temperature)
+	assert.Equal(t, float32(0.9), resolved.TopP)
+	assert.Equal(t, 2048, resolved.MaxTokens)
+	assert.Equal(t, []string{"END", "<|end|>"}, resolved.Stop)
+	assert.Equal(t, 1, resolved.ToolCount)
+	assert.Equal(t, "creative", resolved.ProfileName)
+}
+
+// 测试选中的凭证通过配置回调记录
+func TestResolvedConfigCredential(t *testing.T) {
+	resolved := &ResolvedConfig{}
+	req := ChatRequest{onCredentialSelected: resolved.setCredential}
+
+	conf := &Config{onCredentialSelected: req.onCredentialSelected}
+	conf.recordSelectedCredential("azure-eastus", "")
+	assert.Equal(t, "azure-eastus", resolved.Credential)
+
+	// 未设置回调时不做任何处理
+	(&Config{}).recordSelectedCredential("azure-westus", "")
+}
+
+// 测试流式请求返回错误
+func TestCreateChatCompletionWithResolvedConfigStream(t *testing.T) {
+	req := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{Stream: true}}
+	_, err := CreateChatCompletionWithResolvedConfig(req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	aclopenai "github.com/cloudwego/eino-ext/libs/acl/openai"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrInvalidStructuredOutput 设置了JSON格式输出时，模型返回的内容不是合法JSON或不符合指定的JSON Schema
+var ErrInvalidStructuredOutput = errors.New("模型返回的内容不符合指定的输出格式")
+
+// structuredOutputProviders 会将response_format发送给模型的供应商，只校验这些供应商的响应
+var structuredOutputProviders = map[string]bool{
+	"azure":  true,
+	"openai": true,
+}
+
+// applyRequestResponseFormat 请求中设置了response_format时覆盖厂商配置中的设置
+func applyRequestResponseFormat(modelConf *einoopenai.ChatModelConfig, format *openai.ChatCompletionResponseFormat) error {
+	if format == nil {
+		return nil
+	}
+	responseFormat, err := toEinoResponseFormat(format)
+	if err != nil {
+		return fmt.Errorf("转换response_format失败: %w", err)
+	}
+	modelConf.ResponseFormat = responseFormat
+	return nil
+}
+
+// toEinoResponseFormat 将请求中的response_format转换为eino模型配置使用的格式
+// json_schema的Schema可以是jsonschema.Definition、json.RawMessage等任意可序列化为JSON Schema的值
+func toEinoResponseFormat(format *openai.ChatCompletionResponseFormat) (*aclopenai.ChatCompletionResponseFormat, error) {
+	if format == nil {
+		return nil, nil
+	}
+	result := &aclopenai.ChatCompletionResponseFormat{
+		Type: aclopenai.ChatCompletionResponseFormatType(format.Type),
+	}
+	if format.Type != openai.ChatCompletionResponseFormatTypeJSONSchema {
+		return result, nil
+	}
+	if format.JSONSchema == nil || format.JSONSchema.Name == "" {
+		return nil, errors.New("response_format为json_schema时必须指定json_schema.name")
+	}
+
+	schema, err := responseFormatSchema(format.JSONSchema)
+	if err != nil {
+		return nil, err
+	}
+	result.JSONSchema = &aclopenai.ChatCompletionResponseFormatJSONSchema{
+		Name:        format.JSONSchema.Name,
+		Description: format.JSONSchema.Description,
+		Schema:      schema,
+		Strict:      format.JSONSchema.Strict,
+	}
+	return result, nil
+}
+
+// responseFormatSchema 解析json_schema中的Schema，未设置时返回nil
+func responseFormatSchema(jsonSchema *openai.ChatCompletionResponseFormatJSONSchema) (*openapi3.Schema, error) {
+	if jsonSchema.Schema == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(jsonSchema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("序列化json_schema %s 失败: %v", jsonSchema.Name, err)
+	}
+	schema := &openapi3.Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("json_schema %s 格式不正确: %v", jsonSchema.Name, err)
+	}
+	return schema, nil
+}
+
+// validateStructuredOutput 校验JSON格式输出的非流式响应
+// json_object和json_schema要求回复内容为合法JSON；json_schema设置strict为true时还要求符合Schema。
+// 调用了工具或拒绝回答的选项不校验
+func validateStructuredOutput(resp *openai.ChatCompletionResponse, format *openai.ChatCompletionResponseFormat) error {
+	if resp == nil || format == nil {
+		return nil
+	}
+	if format.Type != openai.ChatCompletionResponseFormatTypeJSONObject && format.Type != openai.ChatCompletionResponseFormatTypeJSONSchema {
+		return nil
+	}
+
+	var schema *openapi3.Schema
+	if format.JSONSchema != nil && format.JSONSchema.Strict {
+		var err error
+		if schema, err = responseFormatSchema(format.JSONSchema); err != nil {
+			return err
+		}
+	}
+
+	for _, choice := range resp.Choices {
+		msg := choice.Message
+		if len(msg.ToolCalls) > 0 || msg.FunctionCall != nil || msg.Refusal != "" {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal([]byte(msg.Content), &value); err != nil {
+			return fmt.Errorf("%w: 第%d个选项不是合法的JSON: %v", ErrInvalidStructuredOutput, choice.Index, err)
+		}
+		if schema == nil {
+			continue
+		}
+		if err := schema.VisitJSON(value); err != nil {
+			return fmt.Errorf("%w: 第%d个选项不符合json_schema %s: %v", ErrInvalidStructuredOutput, choice.Index, format.JSONSchema.Name, err)
+		}
+	}
+	return nil
+}
+
+// responseFormatBody 解析请求体中的response_format
+// go-openai中json_schema.schema的类型为json.Marshaler接口，无法直接从JSON解码，这里先保留原始JSON
+type responseFormatBody struct {
+	Type       openai.ChatCompletionResponseFormatType `json:"type,omitempty"`
+	JSONSchema *struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Schema      json.RawMessage `json:"schema"`
+		Strict      bool            `json:"strict"`
+	} `json:"json_schema,omitempty"`
+}
+
+// toResponseFormat 转换为go-openai的response_format，Schema保留为原始JSON
+func (b *responseFormatBody) toResponseFormat() *openai.ChatCompletionResponseFormat {
+	if b == nil {
+		return nil
+	}
+	format := &openai.ChatCompletionResponseFormat{Type: b.Type}
+	if b.JSONSchema != nil {
+		format.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        b.JSONSchema.Name,
+			Description: b.JSONSchema.Description,
+			Strict:      b.JSONSchema.Strict,
+		}
+		if len(b.JSONSchema.Schema) > 0 {
+			format.JSONSchema.Schema = b.JSONSchema.Schema
+		}
+	}
+	return format
+}
@@ -0,0 +1,133 @@
+package einox
+
+import (
+	"strings"
+	"testing"
+
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/stretchr/testify/assert"
+)
+
+// newWeatherResponseFormat 构造一个strict的json_schema输出格式
+func newWeatherResponseFormat(strict bool) *openai.ChatCompletionResponseFormat {
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   "weather",
+			Strict: strict,
+			Schema: &jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					"city":        {Type: jsonschema.String},
+					"temperature": {Type: jsonschema.Number},
+				},
+				Required:             []string{"city", "temperature"},
+				AdditionalProperties: false,
+			},
+		},
+	}
+}
+
+// newJSONResponse 构造只有一个选项的响应
+func newJSONResponse(content string) *openai.ChatCompletionResponse {
+	return &openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+		{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}},
+	}}
+}
+
+// 测试response_format转换为eino模型配置并覆盖厂商配置
+func TestApplyRequestResponseFormat(t *testing.T) {
+	conf := &einoopenai.ChatModelConfig{}
+	assert.NoError(t, applyRequestResponseFormat(conf, nil))
+	assert.Nil(t, conf.ResponseFormat, "未设置时保留厂商配置")
+
+	assert.NoError(t, applyRequestResponseFormat(conf, newWeatherResponseFormat(true)))
+	if assert.NotNil(t, conf.ResponseFormat) && assert.NotNil(t, conf.ResponseFormat.JSONSchema) {
+		assert.Equal(t, "json_schema", string(conf.ResponseFormat.Type))
+		assert.Equal(t, "weather", conf.ResponseFormat.JSONSchema.Name)
+		assert.True(t, conf.ResponseFormat.JSONSchema.Strict)
+		schema := conf.ResponseFormat.JSONSchema.Schema
+		assert.Equal(t, "object", schema.Type)
+		assert.ElementsMatch(t, []string{"city", "temperature"}, schema.Required)
+		assert.Equal(t, "number", schema.Properties["temperature"].Value.Type)
+	}
+
+	assert.NoError(t, applyRequestResponseFormat(conf, &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}))
+	assert.Equal(t, "json_object", string(conf.ResponseFormat.Type))
+	assert.Nil(t, conf.ResponseFormat.JSONSchema)
+
+	err := applyRequestResponseFormat(conf, &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONSchema})
+	assert.ErrorContains(t, err, "json_schema.name")
+}
+
+// 测试JSON格式输出的校验
+func TestValidateStructuredOutput(t *testing.T) {
+	valid := `{"city":"上海","temperature":21.5}`
+	missing := `{"city":"上海"}`
+
+	assert.NoError(t, validateStructuredOutput(newJSONResponse("普通文本"), nil))
+	assert.NoError(t, validateStructuredOutput(newJSONResponse("普通文本"),
+		&openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeText}))
+
+	jsonObject := &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	assert.NoError(t, validateStructuredOutput(newJSONResponse(missing), jsonObject))
+	err := validateStructuredOutput(newJSONResponse("```json\n{}```"), jsonObject)
+	assert.ErrorIs(t, err, ErrInvalidStructuredOutput)
+	assert.ErrorContains(t, err, "不是合法的JSON")
+
+	assert.NoError(t, validateStructuredOutput(newJSONResponse(valid), newWeatherResponseFormat(true)))
+	err = validateStructuredOutput(newJSONResponse(missing), newWeatherResponseFormat(true))
+	assert.ErrorIs(t, err, ErrInvalidStructuredOutput)
+	assert.ErrorContains(t, err, "json_schema weather")
+	assert.ErrorIs(t, validateStructuredOutput(newJSONResponse(`{"city":"上海","temperature":21,"unit":"C"}`), newWeatherResponseFormat(true)),
+		ErrInvalidStructuredOutput, "strict时不允许额外字段")
+
+	// 非strict时只要求合法JSON
+	assert.NoError(t, validateStructuredOutput(newJSONResponse(missing), newWeatherResponseFormat(false)))
+	assert.ErrorIs(t, validateStructuredOutput(newJSONResponse("不是JSON"), newWeatherResponseFormat(false)), ErrInvalidStructuredOutput)
+
+	// 调用了工具或拒绝回答的选项不校验
+	resp := newJSONResponse("")
+	resp.Choices[0].Message.ToolCalls = []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction}}
+	assert.NoError(t, validateStructuredOutput(resp, newWeatherResponseFormat(true)))
+	resp = newJSONResponse("抱歉，无法回答")
+	resp.Choices[0].Message.Refusal = "抱歉，无法回答"
+	assert.NoError(t, validateStructuredOutput(resp, newWeatherResponseFormat(true)))
+}
+
+// 测试从请求体解析带Schema的response_format
+func TestParseChatRequestResponseFormat(t *testing.T) {
+	body := `{
+		"model": "azure/gpt-4o",
+		"messages": [{"role": "user", "content": "上海天气"}],
+		"response_format": {
+			"type": "json_schema",
+			"json_schema": {
+				"name": "weather",
+				"strict": true,
+				"schema": {
+					"type": "object",
+					"properties": {"city": {"type": "string"}, "temperature": {"type": "number"}},
+					"required": ["city", "temperature"],
+					"additionalProperties": false
+				}
+			}
+		}
+	}`
+	req, err := ParseChatRequest(strings.NewReader(body))
+	if !assert.NoError(t, err) || !assert.NotNil(t, req.ResponseFormat) {
+		return
+	}
+	assert.Equal(t, "azure", req.Provider)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONSchema, req.ResponseFormat.Type)
+	assert.Equal(t, "weather", req.ResponseFormat.JSONSchema.Name)
+
+	assert.NoError(t, validateStructuredOutput(newJSONResponse(`{"city":"上海","temperature":21}`), req.ResponseFormat))
+	assert.ErrorIs(t, validateStructuredOutput(newJSONResponse(`{"city":"上海"}`), req.ResponseFormat), ErrInvalidStructuredOutput)
+
+	req, err = ParseChatRequest(strings.NewReader(`{"model": "azure/gpt-4o", "messages": []}`))
+	assert.NoError(t, err)
+	assert.Nil(t, req.ResponseFormat)
+}
@@ -0,0 +1,242 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// defaultRetryBaseDelay 未指定时首次重试前的等待时间
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	// defaultRetryMaxDelay 未指定时单次等待时间的上限
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// RetryPolicy 瞬时错误的重试策略
+// 限流(429)、500、502、503、504和网络超时会按指数退避重试，其他错误（如400、401、403）立即返回
+type RetryPolicy struct {
+	// MaxRetries 最大重试次数，不大于0时不重试
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// BaseDelayMs 首次重试前的等待时间（毫秒），之后每次翻倍，不大于0时使用默认的500毫秒
+	BaseDelayMs int `json:"base_delay_ms,omitempty"`
+
+	// MaxDelayMs 单次等待时间的上限（毫秒），不大于0时使用默认的30秒
+	// 供应商通过Retry-After要求的等待时间超过上限时不再重试
+	MaxDelayMs int `json:"max_delay_ms,omitempty"`
+
+	// Jitter 随机抖动比例，取值[0,1]，实际等待时间在[delay*(1-Jitter), delay]之间随机
+	Jitter float64 `json:"jitter,omitempty"`
+
+	// Budget 可选的共享重试预算，设置后每次重试同时占用预算，预算用完时返回ErrRetryBudgetExhausted
+	Budget *RetryBudget `json:"-"`
+}
+
+// baseDelay 获取首次重试前的等待时间
+func (p *RetryPolicy) baseDelay() time.Duration {
+	if p.BaseDelayMs <= 0 {
+		return defaultRetryBaseDelay
+	}
+	return time.Duration(p.BaseDelayMs) * time.Millisecond
+}
+
+// maxDelay 获取单次等待时间的上限
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelayMs <= 0 {
+		return defaultRetryMaxDelay
+	}
+	return time.Duration(p.MaxDelayMs) * time.Millisecond
+}
+
+// backoff 第retry次重试（从0开始）前的等待时间
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay, maxDelay := p.baseDelay(), p.maxDelay()
+	for i := 0; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// retrySleep 等待重试，ctx取消时提前返回，测试中可替换
+var retrySleep = func(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// callWithRetryPolicy 按请求的RetryPolicy调用call，出现可重试的错误时等待后重试
+// 供应商响应中带有Retry-After时按其要求等待；call的返回值与callWithCredentialFallback一致
+func callWithRetryPolicy[T any](req ChatRequest, call func(req ChatRequest) (T, string, error)) (T, string, error) {
+	policy := req.RetryPolicy
+	if policy == nil || policy.MaxRetries <= 0 {
+		return call(req)
+	}
+
+	ctx := requestContext(req.ctx)
+	for retry := 0; ; retry++ {
+		hint := &retryAfterHint{}
+		attempt := req
+		attempt.ctx = context.WithValue(ctx, retryAfterHintKey{}, hint)
+		result, name, err := call(attempt)
+		if err == nil || retry >= policy.MaxRetries || !isRetryableError(ctx, err) {
+			return result, name, err
+		}
+
+		delay := policy.backoff(retry)
+		if retryAfter, ok := hint.get(); ok {
+			if retryAfter > policy.maxDelay() {
+				// 供应商要求的等待时间超过上限，不再重试
+				return result, name, err
+			}
+			delay = retryAfter
+		}
+		if policy.Budget != nil && !policy.Budget.take() {
+			return result, name, fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+		}
+		if sleepErr := retrySleep(ctx, delay); sleepErr != nil {
+			return result, name, fmt.Errorf("等待重试时请求已取消: %w", errors.Join(sleepErr, err))
+		}
+	}
+}
+
+// isRetryableError 判断错误是否为可重试的瞬时错误：429、500、502、503、504或网络超时
+// 请求的上下文已取消或超时、流式请求已输出内容时不重试
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx != nil && ctx.Err() != nil {
+		return false
+	}
+	var started *outputStartedError
+	if errors.As(err, &started) {
+		return false
+	}
+
+	if statusCode, ok := errorStatusCode(err); ok {
+		switch statusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return isTimeoutError(err)
+}
+
+// errorStatusCode 从供应商返回的错误中获取HTTP状态码
+// 支持ProviderError、go-openai的APIError、RequestError，以及实现了HTTPStatusCode()方法的错误（如AWS SDK的响应错误）
+func errorStatusCode(err error) (int, bool) {
+	var providerError *ProviderError
+	if errors.As(err, &providerError) && providerError.HTTPStatus > 0 {
+		return providerError.HTTPStatus, true
+	}
+	var apiError *openai.APIError
+	if errors.As(err, &apiError) && apiError.HTTPStatusCode > 0 {
+		return apiError.HTTPStatusCode, true
+	}
+	var requestError *openai.RequestError
+	if errors.As(err, &requestError) && requestError.HTTPStatusCode > 0 {
+		return requestError.HTTPStatusCode, true
+	}
+	var statusError interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusError) && statusError.HTTPStatusCode() > 0 {
+		return statusError.HTTPStatusCode(), true
+	}
+	return 0, false
+}
+
+// isTimeoutError 判断错误是否为超时
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+// outputStartedError 流式请求已输出内容后出现的错误，不再重试或转移凭证
+type outputStartedError struct {
+	err error
+}
+
+// Error 实现error接口
+func (e *outputStartedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *outputStartedError) Unwrap() error {
+	return e.err
+}
+
+// retryAfterHintKey 请求上下文中retryAfterHint的键
+type retryAfterHintKey struct{}
+
+// retryAfterHint 记录供应商响应中的Retry-After
+// go-openai的APIError不包含响应头，由connTraceTransport在收到响应时写入请求上下文中的retryAfterHint
+type retryAfterHint struct {
+	mu    sync.Mutex
+	delay time.Duration
+	ok    bool
+}
+
+// get 返回记录的等待时间
+func (h *retryAfterHint) get() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay, h.ok
+}
+
+// recordRetryAfter 请求上下文中有retryAfterHint时，记录响应头要求的等待时间
+// 优先使用Azure返回的毫秒级retry-after-ms，其次为标准的Retry-After（秒数或HTTP日期）
+func recordRetryAfter(ctx context.Context, resp *http.Response) {
+	hint, ok := ctx.Value(retryAfterHintKey{}).(*retryAfterHint)
+	if !ok || resp == nil {
+		return
+	}
+	delay, ok := parseRetryAfter(resp.Header, time.Now())
+	if !ok {
+		return
+	}
+	hint.mu.Lock()
+	defer hint.mu.Unlock()
+	hint.delay, hint.ok = delay, true
+}
+
+// parseRetryAfter 解析响应头中的等待时间
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := header.Get("retry-after-ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
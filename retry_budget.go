@@ -0,0 +1,65 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRetryBudgetExhausted 共享的重试预算已用完
+var ErrRetryBudgetExhausted = errors.New("重试预算已用完")
+
+// RetryBudget 在多次请求之间共享的重试预算
+// 多轮调用（例如工具调用循环中的每一轮）使用同一个RetryBudget时，
+// 无论进行多少轮，向供应商发起的重试总次数都不会超过上限。
+// 零值和nil表示不允许重试，可以安全地并发使用
+type RetryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// NewRetryBudget 创建最多允许maxRetries次重试的预算
+func NewRetryBudget(maxRetries int) *RetryBudget {
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	return &RetryBudget{remaining: maxRetries}
+}
+
+// take 占用一次重试，预算不足时返回false
+func (b *RetryBudget) take() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// Remaining 返回剩余的重试次数
+func (b *RetryBudget) Remaining() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining
+}
+
+// callWithRetryBudget 调用call，失败时从共享预算中扣减重试次数后重试
+// 预算用完时返回包装了最后一次错误的ErrRetryBudgetExhausted
+func callWithRetryBudget[T any](budget *RetryBudget, call func() (T, error)) (T, error) {
+	for {
+		result, err := call()
+		if err == nil {
+			return result, nil
+		}
+		if !budget.take() {
+			return result, fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试多轮调用共享同一预算时重试总次数受限
+func TestRetryBudgetSharedAcrossRounds(t *testing.T) {
+	budget := NewRetryBudget(3)
+	calls := 0
+	// 每一轮都先失败两次再成功
+	flaky := func() func() (string, error) {
+		failures := 0
+		return func() (string, error) {
+			calls++
+			if failures < 2 {
+				failures++
+				return "", errors.New("503 服务暂不可用")
+			}
+			return "ok", nil
+		}
+	}
+
+	var transcript []string
+	var err error
+	for round := 0; round < 5; round++ {
+		var result string
+		result, err = callWithRetryBudget(budget, flaky())
+		if err != nil {
+			break
+		}
+		transcript = append(transcript, result)
+	}
+
+	// 第一轮用掉2次重试，第二轮只剩1次，第三次失败时预算耗尽
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.ErrorContains(t, err, "503 服务暂不可用")
+	assert.Equal(t, []string{"ok"}, transcript, "耗尽前已完成的轮次应保留")
+	assert.Equal(t, 0, budget.Remaining())
+	assert.Equal(t, 3+2, calls, "总调用次数为首次调用数加上重试上限")
+}
+
+// 测试nil预算不重试
+func TestRetryBudgetNil(t *testing.T) {
+	var budget *RetryBudget
+	calls := 0
+	_, err := callWithRetryBudget(budget, func() (int, error) {
+		calls++
+		return 0, errors.New("失败")
+	})
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0, budget.Remaining())
+}
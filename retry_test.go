@@ -0,0 +1,302 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyProvider 测试用的供应商，按顺序返回预设的错误，用完后成功
+type flakyProvider struct {
+	mu     sync.Mutex
+	errors []error
+	// partial 为true时，流式请求在失败前先输出部分内容
+	partial bool
+	calls   int
+}
+
+// next 返回本次调用预设的错误
+func (p *flakyProvider) next() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if len(p.errors) == 0 {
+		return nil
+	}
+	err := p.errors[0]
+	p.errors = p.errors[1:]
+	return err
+}
+
+func (p *flakyProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	if err := p.next(); err != nil {
+		return nil, fmt.Errorf("调用Generate方法失败: %w", err)
+	}
+	return &openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "ok"},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}, nil
+}
+
+func (p *flakyProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	if err := p.next(); err != nil {
+		if p.partial {
+			fmt.Fprint(writer, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"部分\"}}]}\n\n")
+		}
+		return err
+	}
+	_, err := fmt.Fprint(writer, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+	return err
+}
+
+// registerFlakyProvider 注册按顺序失败的供应商，测试结束后移除
+func registerFlakyProvider(t *testing.T, errs ...error) *flakyProvider {
+	provider := &flakyProvider{errors: errs}
+	RegisterProvider("flaky", provider)
+	t.Cleanup(func() {
+		providerRegistryMu.Lock()
+		defer providerRegistryMu.Unlock()
+		delete(providerRegistry, "flaky")
+	})
+	return provider
+}
+
+// stubRetrySleep 记录重试前的等待时间而不实际等待，测试结束后恢复
+func stubRetrySleep(t *testing.T) *[]time.Duration {
+	var delays []time.Duration
+	original := retrySleep
+	retrySleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { retrySleep = original })
+	return &delays
+}
+
+func newFlakyRequest(policy *RetryPolicy) ChatRequest {
+	return ChatRequest{
+		Provider: "flaky",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+		},
+		RetryPolicy: policy,
+	}
+}
+
+// 测试瞬时错误按指数退避重试
+func TestRetryPolicyTransientErrors(t *testing.T) {
+	delays := stubRetrySleep(t)
+	provider := registerFlakyProvider(t,
+		&openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable},
+		&openai.RequestError{HTTPStatusCode: http.StatusBadGateway},
+		context.DeadlineExceeded,
+	)
+
+	resp, err := CreateChatCompletion(newFlakyRequest(&RetryPolicy{MaxRetries: 3, BaseDelayMs: 100, MaxDelayMs: 300}), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ok", resp.Choices[0].Message.Content)
+	}
+	assert.Equal(t, 4, provider.calls)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}, *delays)
+}
+
+// 测试重试次数用完和不可重试的错误
+func TestRetryPolicyGivesUp(t *testing.T) {
+	delays := stubRetrySleep(t)
+	unavailable := &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}
+	provider := registerFlakyProvider(t, unavailable, unavailable, unavailable)
+
+	_, err := CreateChatCompletion(newFlakyRequest(&RetryPolicy{MaxRetries: 2}), nil)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 3, provider.calls)
+	assert.Len(t, *delays, 2)
+
+	for _, statusCode := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden} {
+		*delays = nil
+		provider := registerFlakyProvider(t, &openai.APIError{HTTPStatusCode: statusCode})
+		_, err := CreateChatCompletion(newFlakyRequest(&RetryPolicy{MaxRetries: 2}), nil)
+		assert.Error(t, err)
+		assert.Equal(t, 1, provider.calls, "状态码%d不应重试", statusCode)
+		assert.Empty(t, *delays)
+	}
+
+	// 未设置重试策略时不重试
+	provider = registerFlakyProvider(t, unavailable)
+	_, err = CreateChatCompletion(newFlakyRequest(nil), nil)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 1, provider.calls)
+}
+
+// 测试重试占用共享的重试预算
+func TestRetryPolicyBudget(t *testing.T) {
+	stubRetrySleep(t)
+	unavailable := &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}
+	provider := registerFlakyProvider(t, unavailable, unavailable, unavailable)
+
+	budget := NewRetryBudget(1)
+	_, err := CreateChatCompletion(newFlakyRequest(&RetryPolicy{MaxRetries: 5, Budget: budget}), nil)
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 2, provider.calls)
+	assert.Equal(t, 0, budget.Remaining())
+}
+
+// 测试流式请求仅在尚未输出内容时重试
+func TestRetryPolicyStream(t *testing.T) {
+	stubRetrySleep(t)
+	unavailable := &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}
+	provider := registerFlakyProvider(t, unavailable)
+
+	req := newFlakyRequest(&RetryPolicy{MaxRetries: 2})
+	req.Stream = true
+	var buf bytes.Buffer
+	_, err := CreateChatCompletion(req, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, provider.calls)
+	assert.Contains(t, buf.String(), "ok")
+
+	// 已输出部分内容后不再重试
+	provider = registerFlakyProvider(t, unavailable, unavailable)
+	provider.partial = true
+	buf.Reset()
+	_, err = CreateChatCompletion(req, &buf)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 1, provider.calls)
+	assert.Contains(t, buf.String(), "部分")
+}
+
+// httpProvider 测试用的供应商，通过带连接统计的HTTP客户端请求服务端，非200响应转换为openai.APIError
+type httpProvider struct {
+	url    string
+	client *http.Client
+}
+
+func (p *httpProvider) Chat(ctx context.Context, req ChatRequest) (*openai.ChatCompletionResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &openai.APIError{HTTPStatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	return &openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "ok"}}}}, nil
+}
+
+func (p *httpProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	return fmt.Errorf("不支持流式请求")
+}
+
+// 测试按响应中的Retry-After等待
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	delays := stubRetrySleep(t)
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("retry-after-ms", "1500")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	RegisterProvider("flaky", &httpProvider{
+		url:    server.URL,
+		client: &http.Client{Transport: newConnTraceTransport("flaky", nil)},
+	})
+	t.Cleanup(func() {
+		providerRegistryMu.Lock()
+		defer providerRegistryMu.Unlock()
+		delete(providerRegistry, "flaky")
+	})
+
+	// 第三次要求的等待时间超过上限，不再重试
+	_, err := CreateChatCompletion(newFlakyRequest(&RetryPolicy{MaxRetries: 5, MaxDelayMs: 60000}), nil)
+	var apiError *openai.APIError
+	if assert.ErrorAs(t, err, &apiError) {
+		assert.Equal(t, http.StatusTooManyRequests, apiError.HTTPStatusCode)
+	}
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{2 * time.Second, 1500 * time.Millisecond}, *delays)
+}
+
+// 测试指数退避的等待时间
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{BaseDelayMs: 100, MaxDelayMs: 1000}
+	var got []time.Duration
+	for retry := 0; retry < 6; retry++ {
+		got = append(got, policy.backoff(retry))
+	}
+	assert.Equal(t, []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second,
+	}, got)
+
+	// 抖动后的等待时间在[delay*(1-Jitter), delay]之间
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.backoff(2)
+		assert.GreaterOrEqual(t, delay, 200*time.Millisecond)
+		assert.LessOrEqual(t, delay, 400*time.Millisecond)
+	}
+
+	// 默认值
+	assert.Equal(t, defaultRetryBaseDelay, (&RetryPolicy{}).backoff(0))
+	assert.Equal(t, defaultRetryMaxDelay, (&RetryPolicy{}).backoff(100))
+}
+
+// 测试解析Retry-After响应头
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{"秒数", http.Header{"Retry-After": {"5"}}, 5 * time.Second, true},
+		{"HTTP日期", http.Header{"Retry-After": {now.Add(10 * time.Second).Format(http.TimeFormat)}}, 10 * time.Second, true},
+		{"已过去的日期", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0, true},
+		{"毫秒优先", http.Header{"Retry-After": {"5"}, "Retry-After-Ms": {"250"}}, 250 * time.Millisecond, true},
+		{"无效值", http.Header{"Retry-After": {"soon"}}, 0, false},
+		{"未设置", http.Header{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.header, now)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+// 测试重试策略不从请求体解析，客户端无法放大对供应商的调用次数
+func TestRetryPolicyNotParsedFromRequest(t *testing.T) {
+	req, err := ParseChatRequest(strings.NewReader(`{"model":"azure/gpt-4o","retry_policy":{"max_retries":1000000}}`))
+	assert.NoError(t, err)
+	assert.Nil(t, req.RetryPolicy)
+}
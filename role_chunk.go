@@ -0,0 +1,169 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// isRoleOnlyChunk 判断数据块是否只携带角色，没有内容、工具调用和结束原因
+func isRoleOnlyChunk(chunk *openai.ChatCompletionStreamResponse) bool {
+	if chunk == nil || len(chunk.Choices) == 0 {
+		return false
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta.Role == "" || delta.Content != "" || len(delta.ToolCalls) > 0 ||
+			delta.FunctionCall != nil || delta.Refusal != "" || choice.FinishReason != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// newRoleChunk 构造只携带assistant角色的首个数据块，ID、模型等字段与后续数据块一致
+func newRoleChunk(next *openai.ChatCompletionStreamResponse) *openai.ChatCompletionStreamResponse {
+	return &openai.ChatCompletionStreamResponse{
+		ID:      next.ID,
+		Object:  "chat.completion.chunk",
+		Created: next.Created,
+		Model:   next.Model,
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Index: 0,
+			Delta: openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant},
+		}},
+	}
+}
+
+// primeRoleStreamReader 包装流，首个数据块不是仅含角色的数据块时，先补发一个只携带assistant角色的数据块
+func primeRoleStreamReader(streamReader *schema.StreamReader[*openai.ChatCompletionStreamResponse]) *schema.StreamReader[*openai.ChatCompletionStreamResponse] {
+	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](10)
+
+	go func() {
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				getLogger().Error("补发角色数据帧的goroutine发生异常", "panic", panicErr)
+			}
+			streamReader.Close()
+			resultWriter.Close()
+		}()
+
+		primed := false
+		for {
+			chunk, err := streamReader.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				_ = resultWriter.Send(nil, err)
+				return
+			}
+			if !primed && chunk != nil && len(chunk.Choices) > 0 {
+				primed = true
+				if !isRoleOnlyChunk(chunk) {
+					if closed := resultWriter.Send(newRoleChunk(chunk), nil); closed {
+						return
+					}
+				}
+			}
+			if closed := resultWriter.Send(chunk, nil); closed {
+				return
+			}
+		}
+	}()
+
+	return resultReader
+}
+
+// roleChunkWriter 在SSE输出的首个数据帧之前补发只携带assistant角色的数据帧
+// 首个数据帧本身只含角色、或者是错误帧/结束标记时不补发；补发之后的写入直接透传
+type roleChunkWriter struct {
+	w       io.Writer
+	pending []byte
+	primed  bool
+}
+
+// newRoleChunkWriter 包装writer，enabled为false时原样返回
+func newRoleChunkWriter(w io.Writer, enabled bool) io.Writer {
+	if !enabled {
+		return w
+	}
+	return &roleChunkWriter{w: w}
+}
+
+// Write 实现io.Writer接口，返回值为输入的字节数
+func (r *roleChunkWriter) Write(p []byte) (int, error) {
+	if r.primed {
+		return r.w.Write(p)
+	}
+
+	r.pending = append(r.pending, p...)
+	for !r.primed {
+		end := bytes.Index(r.pending, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		frame := r.pending[:end+2]
+		if chunk, ok := parseChunkFrame(frame); ok {
+			r.primed = true
+			if !isRoleOnlyChunk(chunk) {
+				if err := writeChunkFrame(r.w, newRoleChunk(chunk)); err != nil {
+					return len(p), err
+				}
+			}
+		} else if isDataFrame(frame) {
+			// 错误帧或结束标记，不再补发
+			r.primed = true
+		}
+		if _, err := r.w.Write(frame); err != nil {
+			return len(p), err
+		}
+		r.pending = r.pending[end+2:]
+	}
+
+	// 补发后剩余的内容直接透传
+	if len(r.pending) > 0 {
+		rest := r.pending
+		r.pending = nil
+		if _, err := r.w.Write(rest); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// isDataFrame 判断SSE帧是否为数据帧
+func isDataFrame(frame []byte) bool {
+	_, ok := sseFrameData(frame)
+	return ok
+}
+
+// parseChunkFrame 解析数据帧中带有choices的流式数据块
+func parseChunkFrame(frame []byte) (*openai.ChatCompletionStreamResponse, bool) {
+	data, ok := sseFrameData(frame)
+	if !ok {
+		return nil, false
+	}
+	var chunk openai.ChatCompletionStreamResponse
+	if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err != nil || len(chunk.Choices) == 0 {
+		return nil, false
+	}
+	return &chunk, true
+}
+
+// writeChunkFrame 以SSE数据帧的形式写出数据块
+func writeChunkFrame(w io.Writer, chunk *openai.ChatCompletionStreamResponse) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("序列化角色数据帧失败: %v", err)
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return fmt.Errorf("写入角色数据帧失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试流的首个数据块只携带角色
+func TestPrimeRoleStreamReader(t *testing.T) {
+	reader := primeRoleStreamReader(schema.StreamReaderFromArray([]*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你", ""),
+		newTestStreamChunk("好", openai.FinishReasonStop),
+	}))
+
+	var chunks []*openai.ChatCompletionStreamResponse
+	for {
+		chunk, err := reader.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+
+	if assert.Len(t, chunks, 3) {
+		first := chunks[0]
+		assert.Equal(t, openai.ChatMessageRoleAssistant, first.Choices[0].Delta.Role)
+		assert.Empty(t, first.Choices[0].Delta.Content)
+		assert.Empty(t, first.Choices[0].FinishReason)
+		assert.Equal(t, "chatcmpl-test", first.ID)
+		assert.Equal(t, "gpt-4o", first.Model)
+		assert.Equal(t, "你", chunks[1].Choices[0].Delta.Content)
+	}
+}
+
+// 测试已有仅含角色的首个数据块时不重复补发
+func TestPrimeRoleStreamReaderAlreadyPrimed(t *testing.T) {
+	roleChunk := newTestStreamChunk("", "")
+	roleChunk.Choices[0].Delta.Role = openai.ChatMessageRoleAssistant
+	reader := primeRoleStreamReader(schema.StreamReaderFromArray([]*openai.ChatCompletionStreamResponse{
+		roleChunk,
+		newTestStreamChunk("你", openai.FinishReasonStop),
+	}))
+
+	count := 0
+	for {
+		_, err := reader.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+// 测试SSE输出的首个数据帧只携带角色
+func TestRoleChunkWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer := newRoleChunkWriter(&output, true)
+
+	var input bytes.Buffer
+	input.WriteString(": keep-alive\n\n")
+	writeTestChunk(t, &input, newTestStreamChunk("你", ""))
+	writeTestChunk(t, &input, newTestStreamChunk("好", openai.FinishReasonStop))
+	input.WriteString("data: [DONE]\n\n")
+	// 分多次写入，模拟帧跨写入的情况
+	data := input.Bytes()
+	for len(data) > 0 {
+		n := min(5, len(data))
+		written, err := writer.Write(data[:n])
+		assert.NoError(t, err)
+		assert.Equal(t, n, written)
+		data = data[n:]
+	}
+
+	frames := strings.Split(strings.TrimSuffix(output.String(), "\n\n"), "\n\n")
+	if assert.Len(t, frames, 5) {
+		assert.Equal(t, ": keep-alive", frames[0])
+		var first openai.ChatCompletionStreamResponse
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frames[1], "data: ")), &first))
+		assert.Equal(t, openai.ChatMessageRoleAssistant, first.Choices[0].Delta.Role)
+		assert.Empty(t, first.Choices[0].Delta.Content)
+		assert.Contains(t, frames[2], `"content":"你"`)
+		assert.Equal(t, "data: [DONE]", frames[4])
+	}
+}
+
+// 测试未开启时原样输出，错误帧前不补发
+func TestRoleChunkWriterDisabledAndError(t *testing.T) {
+	var output bytes.Buffer
+	assert.Same(t, &output, newRoleChunkWriter(&output, false).(*bytes.Buffer))
+
+	writer := newRoleChunkWriter(&output, true)
+	assert.NoError(t, writeSSEError(writer, errors.New("连接中断")))
+	assert.NotContains(t, output.String(), `"role"`)
+	assert.True(t, strings.HasPrefix(output.String(), `data: {"error"`))
+}
@@ -0,0 +1,177 @@
+package einox
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// RSAPrivateKeyEnvVar 环境变量，内容为PEM格式的RSA私钥，设置后不再读写密钥目录
+	RSAPrivateKeyEnvVar = "EINOX_RSA_PRIVATE_KEY"
+	// RSAPrivateKeyFileEnvVar 环境变量，为PEM格式RSA私钥文件的路径，如Kubernetes挂载的Secret
+	RSAPrivateKeyFileEnvVar = "EINOX_RSA_PRIVATE_KEY_FILE"
+	// rsaKeyIDHeader PEM块中标记密钥版本号的头部，未设置时为v1
+	rsaKeyIDHeader = "Key-ID"
+)
+
+// RSAKeyProvider 提供加解密配置使用的RSA密钥，用于从Vault、KMS等外部系统获取密钥
+// 设置后不再从 $EINOX_RSA_KEYS_DIR 读取或生成密钥文件
+type RSAKeyProvider interface {
+	// RSAKeys 返回env环境使用的所有版本的密钥对，键为密钥版本号（如"v1"、"v2"），
+	// 加密使用版本号最大的密钥，解密规则见RotateRSAKey。PublicKey为空时由私钥推导
+	RSAKeys(env string) (map[string]*RSAKeyPair, error)
+}
+
+// RSAKeyProviderFunc 函数形式的RSAKeyProvider
+type RSAKeyProviderFunc func(env string) (map[string]*RSAKeyPair, error)
+
+// RSAKeys 实现RSAKeyProvider
+func (f RSAKeyProviderFunc) RSAKeys(env string) (map[string]*RSAKeyPair, error) {
+	return f(env)
+}
+
+// FileRSAKeyProvider 从PEM文件读取私钥，不会生成或写入文件，适用于只读文件系统中挂载的密钥
+// 文件格式见ParseRSAPrivateKeysPEM，所有环境使用同一个文件
+type FileRSAKeyProvider struct {
+	Path string
+}
+
+// RSAKeys 实现RSAKeyProvider
+func (p FileRSAKeyProvider) RSAKeys(string) (map[string]*RSAKeyPair, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyNotFound, err)
+	}
+	return ParseRSAPrivateKeysPEM(data)
+}
+
+var (
+	rsaKeyProviderMu sync.RWMutex
+	rsaKeyProvider   RSAKeyProvider
+)
+
+// SetRSAKeyProvider 设置全局的RSA密钥来源，传入nil表示恢复默认行为：
+// 依次使用 $EINOX_RSA_PRIVATE_KEY、$EINOX_RSA_PRIVATE_KEY_FILE，都未设置时使用 $EINOX_RSA_KEYS_DIR 中的密钥文件
+// 设置后会清空已缓存的解密函数和解密后的凭证
+func SetRSAKeyProvider(provider RSAKeyProvider) {
+	rsaKeyProviderMu.Lock()
+	rsaKeyProvider = provider
+	rsaKeyProviderMu.Unlock()
+
+	decryptCacheMu.Lock()
+	decryptFuncs = map[string]func(string) (string, error){}
+	decryptCacheMu.Unlock()
+	clearConfigFileCache()
+}
+
+// activeRSAKeyProvider 返回当前生效的密钥来源及用于区分缓存的来源标识，使用密钥目录时返回nil
+func activeRSAKeyProvider() (RSAKeyProvider, string) {
+	rsaKeyProviderMu.RLock()
+	provider := rsaKeyProvider
+	rsaKeyProviderMu.RUnlock()
+	if provider != nil {
+		return provider, "provider"
+	}
+
+	if data := os.Getenv(RSAPrivateKeyEnvVar); data != "" {
+		sum := sha256.Sum256([]byte(data))
+		return RSAKeyProviderFunc(func(string) (map[string]*RSAKeyPair, error) {
+			return ParseRSAPrivateKeysPEM([]byte(data))
+		}), "env:" + hex.EncodeToString(sum[:8])
+	}
+	if path := os.Getenv(RSAPrivateKeyFileEnvVar); path != "" {
+		return FileRSAKeyProvider{Path: path}, "file:" + path
+	}
+	return nil, ""
+}
+
+// rsaKeysConfigured 是否设置了RSA密钥来源，未设置时InitializationSettings会panic
+func rsaKeysConfigured() bool {
+	provider, _ := activeRSAKeyProvider()
+	return provider != nil || os.Getenv(RSAKeysEnvVar) != ""
+}
+
+// rsaKeySourceForEnv 返回env环境的密钥来源标识，作为解密函数的缓存键
+func rsaKeySourceForEnv(env string) string {
+	if provider, source := activeRSAKeyProvider(); provider != nil {
+		return source + "|" + env
+	}
+	return RSAKeysDirForEnv(env)
+}
+
+// initRSAKeyManagerFromProvider 使用外部提供的密钥创建加解密函数
+func initRSAKeyManagerFromProvider(provider RSAKeyProvider, env string) (
+	encryptFunc func(string) (string, error),
+	decryptFunc func(string) (string, error),
+	err error) {
+
+	keys, err := provider.RSAKeys(env)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取RSA密钥失败: %w", err)
+	}
+	ring, err := newRSAKeyRing(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ring.encrypt, ring.decrypt, nil
+}
+
+// ParseRSAPrivateKeysPEM 解析PEM格式的RSA私钥，支持PKCS#1（RSA PRIVATE KEY）和PKCS#8（PRIVATE KEY）
+// 可以包含多个私钥用于密钥轮换，通过PEM头部 "Key-ID: v2" 标记版本号，未标记的为v1；公钥块会被忽略
+func ParseRSAPrivateKeysPEM(data []byte) (map[string]*RSAKeyPair, error) {
+	keys := map[string]*RSAKeyPair{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var privateKey *rsa.PrivateKey
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+			}
+			privateKey = key
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("%w: 不是RSA私钥", ErrInvalidKey)
+			}
+			privateKey = rsaKey
+		case "RSA PUBLIC KEY", "PUBLIC KEY":
+			continue
+		default:
+			return nil, fmt.Errorf("%w: 不支持的PEM类型 %s", ErrInvalidKey, block.Type)
+		}
+
+		keyID := legacyRSAKeyID
+		if id := block.Headers[rsaKeyIDHeader]; id != "" {
+			keyID = id
+		}
+		if !rsaKeyIDRe.MatchString(keyID) {
+			return nil, fmt.Errorf("%w: 密钥版本号 %q 格式不正确，应为v1、v2等", ErrInvalidKey, keyID)
+		}
+		if _, ok := keys[keyID]; ok {
+			return nil, fmt.Errorf("%w: 密钥版本号%s重复", ErrInvalidKey, keyID)
+		}
+		keys[keyID] = &RSAKeyPair{PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: 未找到PEM格式的RSA私钥", ErrKeyNotFound)
+	}
+	return keys, nil
+}
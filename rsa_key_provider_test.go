@@ -0,0 +1,171 @@
+package einox
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeTestPrivateKey 将私钥编码为PEM，keyID非空时写入Key-ID头部
+func encodeTestPrivateKey(t *testing.T, keyPair *RSAKeyPair, keyID string, pkcs8 bool) []byte {
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(keyPair.PrivateKey)}
+	if pkcs8 {
+		data, err := x509.MarshalPKCS8PrivateKey(keyPair.PrivateKey)
+		if err != nil {
+			t.Fatalf("序列化私钥失败: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: data}
+	}
+	if keyID != "" {
+		block.Headers = map[string]string{rsaKeyIDHeader: keyID}
+	}
+	return pem.EncodeToMemory(block)
+}
+
+// 测试解析包含多个版本的PEM私钥
+func TestParseRSAPrivateKeysPEM(t *testing.T) {
+	v1, err := GenerateRSAKeyPair()
+	assert.NoError(t, err)
+	v2, err := GenerateRSAKeyPair()
+	assert.NoError(t, err)
+
+	data := append(encodeTestPrivateKey(t, v1, "", false), encodeTestPrivateKey(t, v2, "v2", true)...)
+	keys, err := ParseRSAPrivateKeysPEM(data)
+	if assert.NoError(t, err) && assert.Len(t, keys, 2) {
+		assert.True(t, keys["v1"].PrivateKey.Equal(v1.PrivateKey))
+		assert.True(t, keys["v2"].PrivateKey.Equal(v2.PrivateKey))
+		assert.True(t, keys["v2"].PublicKey.Equal(&v2.PrivateKey.PublicKey))
+	}
+
+	_, err = ParseRSAPrivateKeysPEM(append(encodeTestPrivateKey(t, v1, "", false), encodeTestPrivateKey(t, v2, "", false)...))
+	assert.ErrorIs(t, err, ErrInvalidKey, "版本号重复")
+	_, err = ParseRSAPrivateKeysPEM(encodeTestPrivateKey(t, v1, "latest", false))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = ParseRSAPrivateKeysPEM([]byte("not a pem"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+// 测试通过环境变量提供私钥时不读写密钥目录
+func TestRSAPrivateKeyEnvVar(t *testing.T) {
+	keyPair, err := GenerateRSAKeyPair()
+	if !assert.NoError(t, err) {
+		return
+	}
+	t.Setenv(RSAKeysEnvVar, "")
+	t.Setenv(RSAPrivateKeyEnvVar, string(encodeTestPrivateKey(t, keyPair, "", false)))
+
+	cipherText, err := EncryptSecretForEnv("production", "sk-env")
+	if !assert.NoError(t, err) {
+		return
+	}
+	plainText, err := DecryptWithPrivateKey(keyPair.PrivateKey, cipherText)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-env", plainText)
+
+	decrypt, err := cachedDecryptFunc("production", nil)
+	if assert.NoError(t, err) {
+		plainText, err = decrypt(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk-env", plainText)
+	}
+
+	_, err = RotateRSAKeyForEnv("production")
+	assert.ErrorIs(t, err, ErrRSAKeyRotationUnsupported)
+}
+
+// 测试从只读挂载的私钥文件读取密钥并解密Azure配置
+func TestGetAzureConfigWithKeyFile(t *testing.T) {
+	keyPair, err := GenerateRSAKeyPair()
+	if !assert.NoError(t, err) {
+		return
+	}
+	keyFile := filepath.Join(t.TempDir(), "rsa.pem")
+	assert.NoError(t, os.WriteFile(keyFile, encodeTestPrivateKey(t, keyPair, "", true), 0400))
+	t.Setenv(RSAKeysEnvVar, "")
+	t.Setenv(RSAPrivateKeyEnvVar, "")
+	t.Setenv(RSAPrivateKeyFileEnvVar, keyFile)
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "production"
+	defer ReloadConfig()
+
+	cipherText, err := EncryptWithPublicKey(keyPair.PublicKey, "key-mounted")
+	if !assert.NoError(t, err) {
+		return
+	}
+	configContent := fmt.Sprintf(`
+environments:
+  production:
+    credentials:
+      - name: production
+        api_key: %s
+        endpoint: https://production.example.com
+        enabled: true
+        weight: 1
+`, cipherText)
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644))
+
+	conf, err := (&Config{}).getAzureConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "key-mounted", conf.APIKey)
+	}
+}
+
+// 测试自定义密钥来源按环境提供密钥
+func TestSetRSAKeyProvider(t *testing.T) {
+	staging, err := GenerateRSAKeyPair()
+	assert.NoError(t, err)
+	prodV1, err := GenerateRSAKeyPair()
+	assert.NoError(t, err)
+	prodV2, err := GenerateRSAKeyPair()
+	assert.NoError(t, err)
+
+	var requested []string
+	SetRSAKeyProvider(RSAKeyProviderFunc(func(env string) (map[string]*RSAKeyPair, error) {
+		requested = append(requested, env)
+		if env == "staging" {
+			return map[string]*RSAKeyPair{"v1": staging}, nil
+		}
+		// 只提供私钥时由私钥推导公钥
+		return map[string]*RSAKeyPair{"v1": prodV1, "v2": {PrivateKey: prodV2.PrivateKey}}, nil
+	}))
+	defer SetRSAKeyProvider(nil)
+	t.Setenv(RSAKeysEnvVar, "")
+
+	encrypt, decrypt, err := InitRSAKeyManagerForEnv("production")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cipherText, err := encrypt("sk-prod")
+	assert.NoError(t, err)
+	assert.Regexp(t, "^v2:", cipherText, "使用最新版本的密钥加密")
+	plainText, err := decrypt(cipherText)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-prod", plainText)
+
+	legacyCipher, err := EncryptWithPublicKey(prodV1.PublicKey, "sk-old")
+	assert.NoError(t, err)
+	plainText, err = decrypt(legacyCipher)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-old", plainText)
+
+	_, stagingDecrypt, err := InitRSAKeyManagerForEnv("staging")
+	if assert.NoError(t, err) {
+		_, err = stagingDecrypt(cipherText)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, []string{"production", "staging"}, requested)
+
+	SetRSAKeyProvider(RSAKeyProviderFunc(func(string) (map[string]*RSAKeyPair, error) {
+		return map[string]*RSAKeyPair{"v1": {}}, nil
+	}))
+	_, _, err = InitRSAKeyManagerForEnv("production")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,193 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 密钥轮换后，密钥目录中同时保存多个版本的密钥对:
+//
+//	private_key.pem / public_key.pem        轮换前的密钥，版本号为v1，密文不带前缀
+//	private_key.v2.pem / public_key.v2.pem  第一次轮换生成的密钥，密文格式为 "v2:<Base64>"
+//
+// 加密始终使用版本号最大的密钥；解密时根据密文前缀选择密钥，
+// 因此轮换后已有的YAML配置无需重新加密，确认旧凭证都已替换后再删除旧版本的密钥文件即可
+const legacyRSAKeyID = "v1"
+
+// rsaKeyFileRe 匹配带版本号的密钥文件名
+var rsaKeyFileRe = regexp.MustCompile(`^private_key\.(v\d+)\.pem$`)
+
+// rsaKeyIDRe 匹配密文前缀中的密钥版本号，Base64字符集不包含':'，前缀不会与旧格式的密文混淆
+var rsaKeyIDRe = regexp.MustCompile(`^v\d+$`)
+
+// ErrRSAKeyRotationUnsupported 密钥由外部来源提供时无法由本库轮换，应在外部系统中添加新版本的密钥
+var ErrRSAKeyRotationUnsupported = errors.New("RSA密钥由外部来源提供，无法轮换")
+
+// rotateRSAKeyMu 避免同一进程内并发轮换生成相同版本号的密钥
+var rotateRSAKeyMu sync.Mutex
+
+// rsaKeyRing 一个密钥目录或外部密钥来源中所有版本的密钥对
+type rsaKeyRing struct {
+	keys   map[string]*RSAKeyPair
+	latest string
+}
+
+// rsaKeyPaths 返回指定版本密钥对的文件路径
+func rsaKeyPaths(keysDir, keyID string) (privateKeyPath, publicKeyPath string) {
+	if keyID == legacyRSAKeyID {
+		return filepath.Join(keysDir, "private_key.pem"), filepath.Join(keysDir, "public_key.pem")
+	}
+	return filepath.Join(keysDir, "private_key."+keyID+".pem"), filepath.Join(keysDir, "public_key."+keyID+".pem")
+}
+
+// rsaKeyVersion 返回密钥版本号中的数字，用于比较新旧
+func rsaKeyVersion(keyID string) int {
+	version, _ := strconv.Atoi(strings.TrimPrefix(keyID, "v"))
+	return version
+}
+
+// listRSAKeyIDs 列出密钥目录中公钥和私钥文件都存在的密钥版本
+func listRSAKeyIDs(keysDir string) ([]string, error) {
+	entries, err := os.ReadDir(keysDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取密钥目录失败: %v", err)
+	}
+
+	var keyIDs []string
+	for _, entry := range entries {
+		var keyID string
+		if entry.Name() == "private_key.pem" {
+			keyID = legacyRSAKeyID
+		} else if m := rsaKeyFileRe.FindStringSubmatch(entry.Name()); m != nil {
+			keyID = m[1]
+		} else {
+			continue
+		}
+		_, publicKeyPath := rsaKeyPaths(keysDir, keyID)
+		if _, err := os.Stat(publicKeyPath); err == nil {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	return keyIDs, nil
+}
+
+// loadRSAKeyRing 加载密钥目录中所有版本的密钥对，目录中没有任何密钥时返回ErrKeyNotFound
+func loadRSAKeyRing(keysDir string) (*rsaKeyRing, error) {
+	keyIDs, err := listRSAKeyIDs(keysDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyIDs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keysDir)
+	}
+
+	keys := make(map[string]*RSAKeyPair, len(keyIDs))
+	for _, keyID := range keyIDs {
+		privateKeyPath, publicKeyPath := rsaKeyPaths(keysDir, keyID)
+		keyPair, err := LoadRSAKeyPair(privateKeyPath, publicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("加载密钥%s失败: %w", keyID, err)
+		}
+		keys[keyID] = keyPair
+	}
+	return newRSAKeyRing(keys)
+}
+
+// newRSAKeyRing 校验各版本的密钥并选出最新版本
+func newRSAKeyRing(keys map[string]*RSAKeyPair) (*rsaKeyRing, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: 未提供任何密钥", ErrKeyNotFound)
+	}
+	ring := &rsaKeyRing{keys: make(map[string]*RSAKeyPair, len(keys))}
+	for keyID, keyPair := range keys {
+		if !rsaKeyIDRe.MatchString(keyID) {
+			return nil, fmt.Errorf("%w: 密钥版本号 %q 格式不正确，应为v1、v2等", ErrInvalidKey, keyID)
+		}
+		if keyPair == nil || keyPair.PrivateKey == nil {
+			return nil, fmt.Errorf("%w: 密钥%s缺少私钥", ErrInvalidKey, keyID)
+		}
+		if keyPair.PublicKey == nil {
+			keyPair = &RSAKeyPair{PrivateKey: keyPair.PrivateKey, PublicKey: &keyPair.PrivateKey.PublicKey}
+		}
+		ring.keys[keyID] = keyPair
+		if ring.latest == "" || rsaKeyVersion(keyID) > rsaKeyVersion(ring.latest) {
+			ring.latest = keyID
+		}
+	}
+	return ring, nil
+}
+
+// encrypt 使用最新的密钥加密，未轮换过时保持不带前缀的旧格式
+func (r *rsaKeyRing) encrypt(data string) (string, error) {
+	cipherText, err := EncryptWithPublicKey(r.keys[r.latest].PublicKey, data)
+	if err != nil || r.latest == legacyRSAKeyID {
+		return cipherText, err
+	}
+	return r.latest + ":" + cipherText, nil
+}
+
+// decrypt 根据密文前缀中的版本号选择密钥解密，不带前缀的密文使用v1密钥
+func (r *rsaKeyRing) decrypt(encryptedData string) (string, error) {
+	keyID := legacyRSAKeyID
+	if prefix, rest, ok := strings.Cut(encryptedData, ":"); ok && rsaKeyIDRe.MatchString(prefix) {
+		keyID, encryptedData = prefix, rest
+	}
+	keyPair, ok := r.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: 密钥%s不存在或已删除", ErrKeyNotFound, keyID)
+	}
+	return DecryptWithPrivateKey(keyPair.PrivateKey, encryptedData)
+}
+
+// RotateRSAKey 为默认密钥目录生成新版本的密钥对，之后加密的数据使用新密钥，
+// 旧密钥保留用于解密已有的密文。返回新密钥的版本号，如"v2"
+func RotateRSAKey() (string, error) {
+	if provider, _ := activeRSAKeyProvider(); provider != nil {
+		return "", ErrRSAKeyRotationUnsupported
+	}
+	InitializationSettings()
+	return rotateRSAKeyInDir(DefaultRSAKeysDir)
+}
+
+// RotateRSAKeyForEnv 为指定环境使用的密钥目录生成新版本的密钥对，密钥目录的选择规则见RSAKeysDirForEnv
+func RotateRSAKeyForEnv(env string) (string, error) {
+	if provider, _ := activeRSAKeyProvider(); provider != nil {
+		return "", ErrRSAKeyRotationUnsupported
+	}
+	return rotateRSAKeyInDir(RSAKeysDirForEnv(env))
+}
+
+// rotateRSAKeyInDir 在指定目录生成比现有版本号大1的密钥对
+func rotateRSAKeyInDir(keysDir string) (string, error) {
+	rotateRSAKeyMu.Lock()
+	defer rotateRSAKeyMu.Unlock()
+
+	keyIDs, err := listRSAKeyIDs(keysDir)
+	if err != nil {
+		return "", err
+	}
+	latest := 0
+	for _, keyID := range keyIDs {
+		latest = max(latest, rsaKeyVersion(keyID))
+	}
+	keyID := "v" + strconv.Itoa(latest+1)
+
+	privateKeyPath, publicKeyPath := rsaKeyPaths(keysDir, keyID)
+	if err := GenerateAndSaveRSAKeyPair(privateKeyPath, publicKeyPath); err != nil {
+		return "", fmt.Errorf("生成密钥%s失败: %w", keyID, err)
+	}
+
+	// 已缓存的解密函数只包含旧密钥，需要重新加载；已解密的凭证仍然有效
+	decryptCacheMu.Lock()
+	delete(decryptFuncs, keysDir)
+	decryptCacheMu.Unlock()
+
+	getLogger().Info("RSA密钥已轮换", "keys_dir", keysDir, "key_id", keyID)
+	return keyID, nil
+}
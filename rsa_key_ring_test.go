@@ -0,0 +1,116 @@
+package einox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试轮换后新密文使用新密钥，旧密文仍可解密
+func TestRotateRSAKey(t *testing.T) {
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+
+	encryptV1, _, err := InitRSAKeyManager()
+	if !assert.NoError(t, err) {
+		return
+	}
+	cipherV1, err := encryptV1("sk-old")
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(cipherV1, ":"), "未轮换时保持旧的密文格式")
+
+	keyID, err := RotateRSAKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", keyID)
+	assert.FileExists(t, filepath.Join(keysDir, "private_key.v2.pem"))
+	assert.FileExists(t, filepath.Join(keysDir, "public_key.v2.pem"))
+
+	encrypt, decrypt, err := InitRSAKeyManager()
+	if !assert.NoError(t, err) {
+		return
+	}
+	cipherV2, err := encrypt("sk-new")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(cipherV2, "v2:"))
+
+	plainText, err := decrypt(cipherV1)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-old", plainText)
+	plainText, err = decrypt(cipherV2)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-new", plainText)
+
+	keyID, err = RotateRSAKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "v3", keyID)
+
+	// 删除旧密钥后，旧密文无法解密，其他版本不受影响
+	assert.NoError(t, os.Remove(filepath.Join(keysDir, "private_key.pem")))
+	encrypt, decrypt, err = InitRSAKeyManager()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = decrypt(cipherV1)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	plainText, err = decrypt(cipherV2)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-new", plainText)
+	cipherV3, err := encrypt("sk-latest")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(cipherV3, "v3:"))
+}
+
+// 测试轮换后读取配置时重新加载密钥
+func TestRotateRSAKeyForEnvReloadsDecryptFunc(t *testing.T) {
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+	envDir := filepath.Join(keysDir, "production")
+	assert.NoError(t, os.Mkdir(envDir, 0700))
+
+	cipherV1, err := EncryptSecretForEnv("production", "sk-old")
+	assert.NoError(t, err)
+	decrypt, err := cachedDecryptFunc("production", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = decrypt(cipherV1)
+	assert.NoError(t, err)
+
+	keyID, err := RotateRSAKeyForEnv("production")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", keyID)
+	assert.FileExists(t, filepath.Join(envDir, "private_key.v2.pem"))
+	assert.NoFileExists(t, filepath.Join(keysDir, "private_key.v2.pem"), "不影响共享密钥目录")
+
+	cipherV2, err := EncryptSecretForEnv("production", "sk-new")
+	assert.NoError(t, err)
+	decrypt, err = cachedDecryptFunc("production", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	plainText, err := decrypt(cipherV2)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-new", plainText)
+	plainText, err = decrypt(cipherV1)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-old", plainText)
+}
+
+// 测试解密时识别密文前缀中的版本号
+func TestRSAKeyRingDecryptPrefix(t *testing.T) {
+	keyPair, err := GenerateRSAKeyPair()
+	if !assert.NoError(t, err) {
+		return
+	}
+	ring := &rsaKeyRing{keys: map[string]*RSAKeyPair{"v2": keyPair}, latest: "v2"}
+
+	_, err = ring.decrypt("v9:AAAA")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = ring.decrypt("AAAA")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "不带前缀的密文使用v1密钥")
+	_, err = ring.decrypt("x2:AAAA")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "非版本号前缀按旧格式处理")
+}
@@ -0,0 +1,48 @@
+package einox
+
+import (
+	"github.com/cloudwego/eino-ext/components/model/deepseek"
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+)
+
+// samplingPenalties 请求中的presence_penalty、frequency_penalty和logit_bias，零值表示未设置
+type samplingPenalties struct {
+	presence  float32
+	frequency float32
+	logitBias map[string]int
+}
+
+// penaltiesFromChatRequest 读取统一请求中的惩罚参数
+func penaltiesFromChatRequest(req ChatRequest) samplingPenalties {
+	return samplingPenalties{presence: req.PresencePenalty, frequency: req.FrequencyPenalty, logitBias: req.LogitBias}
+}
+
+// penaltiesFromCompletionRequest 读取ChatCompletionRequest中的惩罚参数
+func penaltiesFromCompletionRequest(req ChatCompletionRequest) samplingPenalties {
+	return samplingPenalties{presence: req.PresenceP, frequency: req.FrequencyP, logitBias: req.LogitBias}
+}
+
+// applyToOpenAI 请求中设置的参数优先于厂商配置
+func (p samplingPenalties) applyToOpenAI(modelConf *einoopenai.ChatModelConfig) {
+	if p.presence != 0 {
+		presence := p.presence
+		modelConf.PresencePenalty = &presence
+	}
+	if p.frequency != 0 {
+		frequency := p.frequency
+		modelConf.FrequencyPenalty = &frequency
+	}
+	if len(p.logitBias) > 0 {
+		modelConf.LogitBias = p.logitBias
+	}
+}
+
+// applyToDeepSeek 请求中设置的参数优先于厂商配置，DeepSeek不支持logit_bias
+func (p samplingPenalties) applyToDeepSeek(modelConf *deepseek.ChatModelConfig) {
+	if p.presence != 0 {
+		modelConf.PresencePenalty = p.presence
+	}
+	if p.frequency != 0 {
+		modelConf.FrequencyPenalty = p.frequency
+	}
+}
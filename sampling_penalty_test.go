@@ -0,0 +1,57 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino-ext/components/model/deepseek"
+	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试请求中的惩罚参数覆盖厂商配置，未设置时保留厂商配置
+func TestSamplingPenaltiesApplyToOpenAI(t *testing.T) {
+	configured := float32(0.3)
+	conf := &einoopenai.ChatModelConfig{
+		PresencePenalty:  &configured,
+		FrequencyPenalty: &configured,
+		LogitBias:        map[string]int{"100": 1},
+	}
+	penaltiesFromChatRequest(ChatRequest{}).applyToOpenAI(conf)
+	assert.Equal(t, float32(0.3), *conf.PresencePenalty)
+	assert.Equal(t, float32(0.3), *conf.FrequencyPenalty)
+	assert.Equal(t, map[string]int{"100": 1}, conf.LogitBias)
+
+	req := ChatRequest{}
+	req.PresencePenalty = 0.8
+	req.FrequencyPenalty = -0.5
+	req.LogitBias = map[string]int{"50256": -100}
+	penaltiesFromChatRequest(req).applyToOpenAI(conf)
+	assert.Equal(t, float32(0.8), *conf.PresencePenalty)
+	assert.Equal(t, float32(-0.5), *conf.FrequencyPenalty)
+	assert.Equal(t, map[string]int{"50256": -100}, conf.LogitBias)
+	assert.Equal(t, float32(0.3), configured, "不修改厂商配置中的值")
+
+	conf = &einoopenai.ChatModelConfig{}
+	penaltiesFromCompletionRequest(ChatCompletionRequest{PresenceP: 1, LogitBias: map[string]int{"1": 5}}).applyToOpenAI(conf)
+	assert.Equal(t, float32(1), *conf.PresencePenalty)
+	assert.Nil(t, conf.FrequencyPenalty)
+	assert.Equal(t, map[string]int{"1": 5}, conf.LogitBias)
+}
+
+// 测试DeepSeek配置的惩罚参数覆盖
+func TestSamplingPenaltiesApplyToDeepSeek(t *testing.T) {
+	conf := &deepseek.ChatModelConfig{PresencePenalty: 0.3, FrequencyPenalty: 0.3}
+	penaltiesFromCompletionRequest(ChatCompletionRequest{FrequencyP: 1.2}).applyToDeepSeek(conf)
+	assert.Equal(t, float32(0.3), conf.PresencePenalty)
+	assert.Equal(t, float32(1.2), conf.FrequencyPenalty)
+}
+
+// 测试转换为DeepSeek流式请求时保留惩罚参数
+func TestToDeepSeekStreamRequestPenalties(t *testing.T) {
+	req := ChatRequest{}
+	req.PresencePenalty = 0.6
+	req.FrequencyPenalty = 0.4
+	chatReq := toDeepSeekStreamRequest(req)
+	assert.Equal(t, float32(0.6), chatReq.PresenceP)
+	assert.Equal(t, float32(0.4), chatReq.FrequencyP)
+}
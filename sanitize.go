@@ -0,0 +1,280 @@
+package einox
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// requestParam 可被供应商忽略的请求参数
+type requestParam struct {
+	isSet func(req *ChatRequest) bool // 请求中是否设置了该参数
+	clear func(req *ChatRequest)      // 清除该参数
+}
+
+// requestParams 可被移除的请求参数，键为参数的JSON字段名
+var requestParams = map[string]requestParam{
+	"presence_penalty": {
+		isSet: func(r *ChatRequest) bool { return r.PresencePenalty != 0 },
+		clear: func(r *ChatRequest) { r.PresencePenalty = 0 },
+	},
+	"frequency_penalty": {
+		isSet: func(r *ChatRequest) bool { return r.FrequencyPenalty != 0 },
+		clear: func(r *ChatRequest) { r.FrequencyPenalty = 0 },
+	},
+	"logit_bias": {
+		isSet: func(r *ChatRequest) bool { return len(r.LogitBias) > 0 },
+		clear: func(r *ChatRequest) { r.LogitBias = nil },
+	},
+	"n": {
+		isSet: func(r *ChatRequest) bool { return r.N > 1 },
+		clear: func(r *ChatRequest) { r.N = 0 },
+	},
+	"seed": {
+		isSet: func(r *ChatRequest) bool { return r.Seed != nil },
+		clear: func(r *ChatRequest) { r.Seed = nil },
+	},
+	"logprobs": {
+		isSet: func(r *ChatRequest) bool { return r.LogProbs || r.TopLogProbs > 0 },
+		clear: func(r *ChatRequest) { r.LogProbs, r.TopLogProbs = false, 0 },
+	},
+	"response_format": {
+		isSet: func(r *ChatRequest) bool { return r.ResponseFormat != nil },
+		clear: func(r *ChatRequest) { r.ResponseFormat = nil },
+	},
+	"tools": {
+		isSet: func(r *ChatRequest) bool { return len(r.Tools) > 0 || r.ToolChoice != nil },
+		clear: func(r *ChatRequest) { r.Tools, r.ToolChoice = nil, nil },
+	},
+}
+
+// providerUnsupportedParams 各供应商调用路径中不会发送的请求参数
+var providerUnsupportedParams = map[string][]string{
+	"bedrock":  {"presence_penalty", "frequency_penalty", "logit_bias", "n", "seed", "logprobs", "response_format"},
+	"claude":   {"presence_penalty", "frequency_penalty", "logit_bias", "n", "seed", "logprobs", "response_format"},
+	"deepseek": {"logit_bias", "n", "seed", "logprobs", "tools"},
+	"gemini":   {"presence_penalty", "frequency_penalty", "logit_bias", "n", "seed", "logprobs", "response_format"},
+}
+
+// alternatingRoleProviders 要求user/assistant消息交替出现的供应商
+var alternatingRoleProviders = map[string]bool{
+	"bedrock": true,
+	"claude":  true,
+}
+
+// toolNameRequiredProviders 要求工具结果消息带有工具名称的供应商，发送前自动补充
+var toolNameRequiredProviders = map[string]bool{
+	"bedrock": true,
+	"claude":  true,
+}
+
+// SanitizeRequest 返回按目标供应商整理后的请求副本，不发起调用
+// 依次应用参数预设、模型默认停止序列、系统消息合并，并：
+//   - 移除供应商不支持的参数
+//   - 规范化消息角色（只设置了ToolCallID的消息视为工具消息）
+//   - 为缺少name的工具消息补充对应工具调用的函数名
+//   - 超过MaxContextTokens时丢弃较早的历史消息
+//   - 对要求角色交替的供应商将系统消息合并到开头，并合并连续的同角色文本消息
+//
+// 每项实际发生的调整都会记录在warnings中；供应商不受支持或参数预设不存在时返回错误
+func SanitizeRequest(req ChatRequest) (ChatRequest, []string, error) {
+	provider := req.Provider
+	if provider == "" {
+		provider = "bedrock" // 与CreateChatCompletion保持一致
+	}
+	if !IsProviderSupported(provider) {
+		return ChatRequest{}, nil, &UnsupportedProviderError{Provider: provider}
+	}
+
+	// 复制消息，避免修改调用方的请求
+	req.Messages = append([]openai.ChatCompletionMessage(nil), req.Messages...)
+	req.Stop = append([]string(nil), req.Stop...)
+
+	var warnings []string
+	stopCount := len(req.Stop)
+	req.onTruncated = func(info *TruncationInfo) {
+		warnings = append(warnings, fmt.Sprintf("超过上下文窗口上限%d个token，已丢弃%d条较早的历史消息", req.MaxContextTokens, len(info.DroppedIndices)))
+	}
+	req, err := prepareProviderRequest(provider, req)
+	if err != nil {
+		return ChatRequest{}, nil, err
+	}
+	if limit := providerStopLimits[provider]; limit > 0 && stopCount > limit {
+		req.Stop = mergeStopSequences(req.Stop, nil, limit)
+		warnings = append(warnings, fmt.Sprintf("停止序列超过%s的上限%d个，已截断", provider, limit))
+	}
+
+	for _, name := range providerUnsupportedParams[provider] {
+		param := requestParams[name]
+		if param.isSet(&req) {
+			param.clear(&req)
+			warnings = append(warnings, fmt.Sprintf("%s不支持参数%s，已移除", provider, name))
+		}
+	}
+
+	for i, msg := range req.Messages {
+		if role := normalizeMessageRole(msg); role != msg.Role {
+			req.Messages[i].Role = role
+			warnings = append(warnings, fmt.Sprintf("第%d条消息的角色已由%q规范化为%q", i+1, msg.Role, role))
+		}
+	}
+
+	if named := fillToolMessageNames(req.Messages); named > 0 {
+		warnings = append(warnings, fmt.Sprintf("为%d条工具消息补充了name字段", named))
+	}
+
+	if alternatingRoleProviders[provider] {
+		var hoisted int
+		req.Messages, hoisted = hoistSystemMessages(req.Messages)
+		if hoisted > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s的系统提示需单独传递，已将%d条系统消息合并到开头", provider, hoisted))
+		}
+		before := len(req.Messages)
+		req.Messages = mergeConsecutiveMessages(req.Messages)
+		if merged := before - len(req.Messages); merged > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s要求角色交替，已合并%d条连续的同角色消息", provider, merged))
+		}
+	}
+
+	req.Provider = provider
+	req.onTruncated = nil
+	return req, warnings, nil
+}
+
+// prepareProviderRequest 发送前对请求的统一处理：消息校验、参数预设、幂等seed、seed支持检查、自动续写支持检查、工具结果校验、上下文窗口裁剪、模型默认停止序列、系统消息合并
+func prepareProviderRequest(provider string, req ChatRequest) (ChatRequest, error) {
+	// 按需在发送前检查消息顺序，避免供应商只返回难以定位的400错误
+	if req.StrictValidation {
+		if err := ValidateMessages(req); err != nil {
+			return req, err
+		}
+	}
+
+	// 去除模型名称首尾的空白，避免按模型名称查找配置时匹配失败
+	req.Model = normalizeModelName(req.Model)
+
+	// 应用参数预设
+	req, err := applyGlobalParameterProfile(req)
+	if err != nil {
+		return req, err
+	}
+
+	// 未指定seed时按配置由幂等键生成
+	req = applyIdempotencySeed(req)
+	if err := checkSeedSupport(provider, req); err != nil {
+		return req, err
+	}
+	if err := checkContinuationSupport(provider, req); err != nil {
+		return req, err
+	}
+
+	// 按注册的输出结构校验工具结果
+	req, err = validateToolOutputs(req)
+	if err != nil {
+		return req, err
+	}
+
+	// 超过上下文窗口时裁剪较早的历史消息，在合并系统消息之前进行，避免系统指令随历史消息被丢弃
+	req, err = applyContextWindow(req)
+	if err != nil {
+		return req, err
+	}
+
+	// 合并模型默认的停止序列
+	req = applyStopDefaults(provider, req)
+
+	// 不支持system角色的模型，将系统消息合并到用户消息中
+	return foldSystemMessages(req), nil
+}
+
+// fillToolMessageNames 为缺少name的工具消息补充对应工具调用的函数名，返回补充的数量
+func fillToolMessageNames(messages []openai.ChatCompletionMessage) int {
+	names := make(map[string]string)
+	filled := 0
+	for i, msg := range messages {
+		for _, call := range msg.ToolCalls {
+			if call.ID != "" {
+				names[call.ID] = call.Function.Name
+			}
+		}
+		if msg.Role != openai.ChatMessageRoleTool || msg.Name != "" {
+			continue
+		}
+		if name := names[msg.ToolCallID]; name != "" {
+			messages[i].Name = name
+			filled++
+		}
+	}
+	return filled
+}
+
+// mergeConsecutiveMessages 合并连续的同角色纯文本user/assistant消息，内容以空行拼接
+func mergeConsecutiveMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	mergeable := func(msg openai.ChatCompletionMessage) bool {
+		return (msg.Role == openai.ChatMessageRoleUser || msg.Role == openai.ChatMessageRoleAssistant) &&
+			len(msg.MultiContent) == 0 && len(msg.ToolCalls) == 0 && msg.ToolCallID == ""
+	}
+
+	merged := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, msg := range messages {
+		if n := len(merged); n > 0 && mergeable(msg) && mergeable(merged[n-1]) && merged[n-1].Role == msg.Role {
+			merged[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		merged = append(merged, msg)
+	}
+	return merged
+}
+
+// hoistSystemMessages 将所有系统消息按顺序以空行拼接为开头的一条，返回整理后的消息和被合并的系统消息数量
+// Anthropic的系统提示需要单独传递，而eino的claude组件只会把开头连续的系统消息作为系统提示，
+// 其余位置的系统消息会被当作用户消息发送，导致系统指令被忽略；系统消息已经只有开头一条时原样返回
+func hoistSystemMessages(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, int) {
+	var systemParts []string
+	count := 0
+	rest := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role != openai.ChatMessageRoleSystem {
+			rest = append(rest, msg)
+			continue
+		}
+		count++
+		if text := messageText(msg); text != "" {
+			systemParts = append(systemParts, text)
+		}
+	}
+	if count == 0 || (count == 1 && messages[0].Role == openai.ChatMessageRoleSystem) {
+		return messages, 0
+	}
+
+	system := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: strings.Join(systemParts, "\n\n"),
+	}
+	return append([]openai.ChatCompletionMessage{system}, rest...), count
+}
+
+// messageText 获取消息的文本内容，多模态消息取其中的文本部分
+func messageText(msg openai.ChatCompletionMessage) string {
+	if msg.Content != "" || len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	var parts []string
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// arrangeAlternatingRoleMessages 对要求角色交替的供应商（Anthropic协议），将系统消息合并到开头并合并连续的同角色文本消息
+func arrangeAlternatingRoleMessages(provider string, req ChatRequest) ChatRequest {
+	if !alternatingRoleProviders[provider] {
+		return req
+	}
+	req.Messages, _ = hoistSystemMessages(req.Messages)
+	req.Messages = mergeConsecutiveMessages(req.Messages)
+	return req
+}
@@ -0,0 +1,170 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造一个面向OpenAI编写、发送给Claude的请求
+func newCrossProviderRequest() ChatRequest {
+	seed := 42
+	return ChatRequest{
+		Provider: "claude",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:            "claude-3-5-sonnet",
+			PresencePenalty:  0.5,
+			FrequencyPenalty: 0.2,
+			Seed:             &seed,
+			Temperature:      0.7,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "北京天气如何"},
+				{Role: openai.ChatMessageRoleUser, Content: "顺便看看上海"},
+				{Role: openai.ChatMessageRoleSystem, Content: "你是天气助手"},
+				{
+					Role: openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{{
+						ID:       "call_1",
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`},
+					}},
+				},
+				{ToolCallID: "call_1", Content: "晴，25度"},
+				{Role: openai.ChatMessageRoleAssistant, Content: "北京晴，25度。"},
+				{Role: openai.ChatMessageRoleAssistant, Content: "上海稍后查询。"},
+			},
+		},
+	}
+}
+
+// 测试跨供应商请求的整理结果和警告
+func TestSanitizeRequestCrossProvider(t *testing.T) {
+	req := newCrossProviderRequest()
+
+	sanitized, warnings, err := SanitizeRequest(req)
+	assert.NoError(t, err)
+
+	assert.Zero(t, sanitized.PresencePenalty)
+	assert.Zero(t, sanitized.FrequencyPenalty)
+	assert.Nil(t, sanitized.Seed)
+	assert.Equal(t, float32(0.7), sanitized.Temperature, "支持的参数应保留")
+
+	if assert.Len(t, sanitized.Messages, 5) {
+		assert.Equal(t, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "你是天气助手"}, sanitized.Messages[0])
+		assert.Equal(t, "北京天气如何\n\n顺便看看上海", sanitized.Messages[1].Content)
+		assert.Equal(t, openai.ChatMessageRoleTool, sanitized.Messages[3].Role)
+		assert.Equal(t, "get_weather", sanitized.Messages[3].Name)
+		assert.Equal(t, "北京晴，25度。\n\n上海稍后查询。", sanitized.Messages[4].Content)
+	}
+
+	assert.Equal(t, []string{
+		"claude不支持参数presence_penalty，已移除",
+		"claude不支持参数frequency_penalty，已移除",
+		"claude不支持参数seed，已移除",
+		`第5条消息的角色已由""规范化为"tool"`,
+		"为1条工具消息补充了name字段",
+		"claude的系统提示需单独传递，已将1条系统消息合并到开头",
+		"claude要求角色交替，已合并2条连续的同角色消息",
+	}, warnings)
+
+	// 原请求不应被修改
+	assert.Len(t, req.Messages, 7)
+	assert.Equal(t, "", req.Messages[4].Role)
+	assert.Equal(t, float32(0.5), req.PresencePenalty)
+}
+
+// 测试OpenAI兼容的供应商保留参数，只截断超出上限的停止序列
+func TestSanitizeRequestOpenAI(t *testing.T) {
+	req := newCrossProviderRequest()
+	req.Provider = "openai"
+	req.Model = "gpt-4o"
+	req.Stop = []string{"a", "b", "c", "d", "e"}
+
+	sanitized, warnings, err := SanitizeRequest(req)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(0.5), sanitized.PresencePenalty)
+	assert.Len(t, sanitized.Messages, 7, "不要求角色交替时不合并消息")
+	assert.Equal(t, []string{"a", "b", "c", "d"}, sanitized.Stop)
+	assert.Contains(t, warnings, "停止序列超过openai的上限4个，已截断")
+}
+
+// 测试不支持的供应商返回错误
+func TestSanitizeRequestUnsupportedProvider(t *testing.T) {
+	_, _, err := SanitizeRequest(ChatRequest{Provider: "unknown"})
+	assert.EqualError(t, err, "不支持的AI供应商: unknown")
+}
+
+// 测试同名工具的多次调用按ToolCallID补充name
+func TestFillToolMessageNamesRepeatedCalls(t *testing.T) {
+	req := newRepeatedToolCallRequest()
+	req.Messages[1].ToolCalls[1].Function.Name = "get_air_quality"
+
+	assert.Equal(t, 2, fillToolMessageNames(req.Messages))
+	assert.Equal(t, "get_air_quality", req.Messages[2].Name)
+	assert.Equal(t, "get_weather", req.Messages[3].Name)
+}
+
+// 测试系统消息合并到开头
+func TestHoistSystemMessages(t *testing.T) {
+	messages, hoisted := hoistSystemMessages([]openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+		{Role: openai.ChatMessageRoleSystem, Content: "你是一个助手"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "你好，有什么可以帮你"},
+		{Role: openai.ChatMessageRoleSystem, MultiContent: []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: "用中文回答"}}},
+	})
+	assert.Equal(t, 2, hoisted)
+	assert.Equal(t, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "你是一个助手\n\n用中文回答"},
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "你好，有什么可以帮你"},
+	}, messages)
+
+	// 已经只有开头一条系统消息，或没有系统消息时原样返回
+	leading := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "你是一个助手"},
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+	}
+	messages, hoisted = hoistSystemMessages(leading)
+	assert.Zero(t, hoisted)
+	assert.Equal(t, leading, messages)
+	messages, hoisted = hoistSystemMessages(leading[1:])
+	assert.Zero(t, hoisted)
+	assert.Equal(t, leading[1:], messages)
+}
+
+// 测试发送给Claude/Bedrock的请求中系统消息合并到开头，连续的同角色消息被合并
+func TestCreateChatCompletionArrangesAlternatingRoles(t *testing.T) {
+	providerRegistryMu.RLock()
+	original := providerRegistry["claude"]
+	providerRegistryMu.RUnlock()
+	provider := &fakeProvider{}
+	RegisterProvider("claude", provider)
+	t.Cleanup(func() { RegisterProvider("claude", original) })
+
+	req := ChatRequest{
+		Provider: "claude",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "claude-3-5-sonnet",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "北京天气如何"},
+				{Role: openai.ChatMessageRoleSystem, Content: "你是天气助手"},
+				{Role: openai.ChatMessageRoleUser, Content: "顺便看看上海"},
+			},
+		},
+	}
+	_, err := CreateChatCompletion(req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "你是天气助手"},
+		{Role: openai.ChatMessageRoleUser, Content: "北京天气如何\n\n顺便看看上海"},
+	}, provider.req.Messages)
+	assert.Len(t, req.Messages, 3, "原请求不应被修改")
+
+	// 其他供应商保持不变
+	openaiProvider := registerFakeProvider(t, "fake-openai")
+	req.Provider = "fake-openai"
+	_, err = CreateChatCompletion(req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, req.Messages, openaiProvider.req.Messages)
+}
@@ -0,0 +1,65 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EncryptSecret 加密API密钥等敏感配置，结果可直接写入各供应商YAML配置文件的api_key等字段
+// 使用当前环境（ENV，未设置时为development）的RSA密钥对，与读取配置时的解密方式一致；
+// 密钥对不存在时会生成并保存到 $EINOX_RSA_KEYS_DIR，设置了外部密钥来源时使用其提供的密钥，见SetRSAKeyProvider
+func EncryptSecret(plaintext string) (string, error) {
+	return EncryptSecretForEnv(currentEnv(), plaintext)
+}
+
+// EncryptSecretForEnv 使用指定环境的RSA密钥对加密敏感配置，密钥目录的选择规则见RSAKeysDirForEnv
+func EncryptSecretForEnv(env, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", errors.New("待加密的内容为空")
+	}
+	// InitializationSettings在未设置密钥目录时会panic，这里提前返回错误
+	if !rsaKeysConfigured() {
+		return "", fmt.Errorf("未设置环境变量 %s，无法确定RSA密钥目录", RSAKeysEnvVar)
+	}
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(env)
+	if err != nil {
+		return "", fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
+	}
+	cipherText, err := encryptFunc(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("加密失败: %v", err)
+	}
+	return cipherText, nil
+}
+
+// EncryptSecretAES 使用当前环境的AES密钥加密敏感配置，适用于较长的凭证（如服务账号JSON）
+// 结果带有"aes:"前缀，读取配置时自动识别并使用AES密钥解密，AES密钥的来源见SetAESKeyProvider
+func EncryptSecretAES(plaintext string) (string, error) {
+	return EncryptSecretAESForEnv(currentEnv(), plaintext)
+}
+
+// EncryptSecretAESForEnv 使用指定环境的AES密钥加密敏感配置
+func EncryptSecretAESForEnv(env, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", errors.New("待加密的内容为空")
+	}
+	key, err := aesKeyForEnv(env)
+	if err != nil {
+		return "", err
+	}
+	cipherText, err := EncryptWithAESKey(key, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("加密失败: %v", err)
+	}
+	return cipherText, nil
+}
+
+// DecryptSecretForEnv 按读取配置时的方式解密凭证，根据前缀自动选择AES或RSA，可用于校验加密结果
+func DecryptSecretForEnv(env, cipherText string) (string, error) {
+	decrypt, err := cachedDecryptFunc(env, nil)
+	if err != nil {
+		return "", err
+	}
+	return decrypt(cipherText)
+}
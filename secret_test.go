@@ -0,0 +1,84 @@
+package einox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试加密结果可以被读取配置时的解密函数还原
+func TestEncryptSecret(t *testing.T) {
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	cipherText, err := EncryptSecret("sk-test-123")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "sk-test-123", cipherText)
+
+	decrypt, err := cachedDecryptFunc(ENV, nil)
+	if assert.NoError(t, err) {
+		plainText, err := decrypt(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk-test-123", plainText)
+	}
+
+	_, err = EncryptSecret("")
+	assert.Error(t, err)
+}
+
+// 测试按环境使用独立的密钥对
+func TestEncryptSecretForEnv(t *testing.T) {
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+	assert.NoError(t, os.Mkdir(filepath.Join(keysDir, "production"), 0700))
+
+	cipherText, err := EncryptSecretForEnv("production", "sk-prod")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(keysDir, "production", "private_key.pem"))
+
+	_, decrypt, err := InitRSAKeyManagerForEnv("production")
+	if assert.NoError(t, err) {
+		plainText, err := decrypt(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk-prod", plainText)
+	}
+
+	_, sharedDecrypt, err := InitRSAKeyManagerForEnv("staging")
+	if assert.NoError(t, err) {
+		_, err = sharedDecrypt(cipherText)
+		assert.Error(t, err, "其他环境的密钥对不能解密")
+	}
+}
+
+// 测试EncryptKey使用密钥目录下的共享密钥对
+func TestEncryptKey(t *testing.T) {
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+	assert.NoError(t, os.Mkdir(filepath.Join(keysDir, "production"), 0700))
+
+	cipherText, err := EncryptKey("sk-shared")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(keysDir, "private_key.pem"))
+
+	_, decrypt, err := InitRSAKeyManager()
+	if assert.NoError(t, err) {
+		plainText, err := decrypt(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk-shared", plainText)
+	}
+
+	_, err = EncryptKey("")
+	assert.Error(t, err)
+}
+
+// 测试未设置密钥目录时返回错误而不是panic
+func TestEncryptSecretWithoutKeysDir(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, "")
+	_, err := EncryptSecretForEnv("development", "sk-test")
+	assert.ErrorContains(t, err, RSAKeysEnvVar)
+}
@@ -0,0 +1,23 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrSeedUnsupported 请求设置了RequireSeed，但目标供应商不支持seed，无法保证输出可复现
+var ErrSeedUnsupported = errors.New("供应商不支持seed")
+
+// checkSeedSupport 检查目标供应商是否支持请求中的seed
+// 不支持时，RequireSeed为true返回ErrSeedUnsupported，否则忽略seed并记录调试日志
+func checkSeedSupport(provider string, req ChatRequest) error {
+	if req.Seed == nil || !slices.Contains(providerUnsupportedParams[provider], "seed") {
+		return nil
+	}
+	if req.RequireSeed {
+		return fmt.Errorf("%w: %s", ErrSeedUnsupported, provider)
+	}
+	getLogger().Debug("供应商不支持seed，已忽略", "provider", provider, "seed", *req.Seed)
+	return nil
+}
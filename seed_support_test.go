@@ -0,0 +1,46 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试供应商不支持seed时按RequireSeed忽略或返回错误
+func TestCheckSeedSupport(t *testing.T) {
+	seed := 42
+	req := ChatRequest{}
+	req.Seed = &seed
+
+	for _, provider := range []string{"azure", "openai", "qwen"} {
+		req.RequireSeed = true
+		assert.NoError(t, checkSeedSupport(provider, req), provider)
+	}
+	for _, provider := range []string{"deepseek", "claude", "bedrock", "gemini"} {
+		req.RequireSeed = false
+		assert.NoError(t, checkSeedSupport(provider, req), provider)
+		req.RequireSeed = true
+		err := checkSeedSupport(provider, req)
+		assert.ErrorIs(t, err, ErrSeedUnsupported, provider)
+		assert.ErrorContains(t, err, provider)
+	}
+
+	// 未设置seed时不检查
+	assert.NoError(t, checkSeedSupport("claude", ChatRequest{RequireSeed: true}))
+}
+
+// 测试RequireSeed时在调用供应商之前返回错误
+func TestRequireSeedBeforeProviderCall(t *testing.T) {
+	seed := 7
+	req := ChatRequest{Provider: "claude", RequireSeed: true}
+	req.Model = "claude-3-5-sonnet"
+	req.Seed = &seed
+	req.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+
+	_, err := CreateChatCompletion(req, nil)
+	assert.ErrorIs(t, err, ErrSeedUnsupported)
+
+	_, _, err = SanitizeRequest(req)
+	assert.ErrorIs(t, err, ErrSeedUnsupported)
+}
@@ -0,0 +1,148 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrShuttingDown 服务关闭期间发起新的流式请求，或流在关闭超时后被强制结束时返回
+var ErrShuttingDown = errors.New("服务正在关闭，流式请求已终止")
+
+// errStreamForceClosed 流被强制结束后继续写入时返回，此时错误帧和结束标记已经写出
+var errStreamForceClosed = fmt.Errorf("%w: 流已被强制结束", ErrShuttingDown)
+
+// defaultStreamTracker 跟踪进行中的流式请求，包括写入writer的流和通道、回调形式的流
+var defaultStreamTracker = newStreamTracker()
+
+// Shutdown 优雅关闭：不再接受新的流式请求，并等待进行中的流结束
+// ctx到期时仍未结束的流会收到一个SSE错误帧和结束标记，之后对该流的写入都会失败；
+// 通道、回调形式的流收到一个错误为ErrShuttingDown的error事件。此时返回ctx.Err()
+func Shutdown(ctx context.Context) error {
+	return defaultStreamTracker.shutdown(ctx)
+}
+
+// streamTracker 记录进行中的流式请求
+type streamTracker struct {
+	mu      sync.Mutex
+	closing bool
+	streams map[*trackedStream]struct{}
+	drained chan struct{} // 关闭期间所有流结束时关闭
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{streams: map[*trackedStream]struct{}{}}
+}
+
+// track 登记一个新的流，关闭期间返回ErrShuttingDown
+// cancel用于在强制关闭时中止对供应商的调用；通道、回调形式的流没有writer，w为nil，由读取流的一方通过forceClosed检查
+func (t *streamTracker) track(w io.Writer, cancel context.CancelFunc) (*trackedStream, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return nil, ErrShuttingDown
+	}
+	stream := &trackedStream{w: w, cancel: cancel}
+	t.streams[stream] = struct{}{}
+	return stream, nil
+}
+
+// done 注销已结束的流
+func (t *streamTracker) done(stream *trackedStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.streams, stream)
+	if t.closing && len(t.streams) == 0 && t.drained != nil {
+		close(t.drained)
+		t.drained = nil
+	}
+}
+
+// shutdown 等待所有流结束，超时后强制关闭剩余的流
+func (t *streamTracker) shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	t.closing = true
+	if len(t.streams) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	drained := make(chan struct{})
+	t.drained = drained
+	t.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	remaining := make([]*trackedStream, 0, len(t.streams))
+	for stream := range t.streams {
+		remaining = append(remaining, stream)
+	}
+	t.mu.Unlock()
+
+	for _, stream := range remaining {
+		stream.forceClose()
+	}
+	return ctx.Err()
+}
+
+// trackedStream 可被强制关闭的流式输出
+type trackedStream struct {
+	mu      sync.Mutex
+	w       io.Writer          // 通道、回调形式的流为nil
+	cancel  context.CancelFunc // 中止对供应商的调用，可为nil
+	closed  bool
+	partial bool // 最后写入的SSE帧是否不完整
+}
+
+// Write 实现io.Writer接口，流被强制关闭后返回errStreamForceClosed
+func (s *trackedStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, errStreamForceClosed
+	}
+	n, err := s.w.Write(p)
+	if n > 0 {
+		s.partial = !bytes.HasSuffix(p[:n], []byte("\n\n"))
+	}
+	return n, err
+}
+
+// forceClose 中止对供应商的调用，写入错误帧和结束标记后关闭流
+// 如果正好有写了一半的帧，先补上分隔符，避免错误帧与其拼接在一起
+func (s *trackedStream) forceClose() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.w == nil {
+		return
+	}
+
+	if s.partial {
+		_, _ = s.w.Write([]byte("\n\n"))
+	}
+	if err := writeSSEError(s.w, ErrShuttingDown); err != nil {
+		return
+	}
+	_, _ = s.w.Write([]byte("data: [DONE]\n\n"))
+}
+
+// forceClosed 流是否已被强制关闭
+func (s *trackedStream) forceClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
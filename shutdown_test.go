@@ -0,0 +1,150 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 模拟一个持续输出的流，每个帧拆成多次写入，直到写入失败或写满count个帧
+func runTestStream(tracker *streamTracker, buf *bytes.Buffer, count int, interval time.Duration) (*sync.WaitGroup, error) {
+	stream, err := tracker.track(buf, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer tracker.done(stream)
+		for i := 0; i < count; i++ {
+			for _, part := range []string{"data: ", `{"id":"1"}`, "\n\n"} {
+				if _, err := stream.Write([]byte(part)); err != nil {
+					return
+				}
+			}
+			time.Sleep(interval)
+		}
+		_, _ = stream.Write([]byte("data: [DONE]\n\n"))
+	}()
+	return &wg, nil
+}
+
+// 测试在截止时间前结束的流正常完成
+func TestShutdownWaitsForActiveStream(t *testing.T) {
+	tracker := newStreamTracker()
+	var buf bytes.Buffer
+	wg, err := runTestStream(tracker, &buf, 3, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, tracker.shutdown(ctx))
+	wg.Wait()
+
+	assert.Equal(t, 3, strings.Count(buf.String(), `{"id":"1"}`))
+	assert.True(t, strings.HasSuffix(buf.String(), "data: [DONE]\n\n"))
+	assert.NotContains(t, buf.String(), "error")
+
+	// 关闭后不再接受新的流
+	_, err = tracker.track(&buf, nil)
+	assert.True(t, errors.Is(err, ErrShuttingDown))
+}
+
+// 测试超过截止时间的流被写入错误帧后关闭
+func TestShutdownForceClosesSlowStream(t *testing.T) {
+	tracker := newStreamTracker()
+	var buf bytes.Buffer
+	wg, err := runTestStream(tracker, &buf, 1000, 5*time.Millisecond)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	err = tracker.shutdown(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	wg.Wait()
+
+	body := buf.String()
+	assert.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"), "应以结束标记收尾")
+	assert.Contains(t, body, `"message":"服务正在关闭，流式请求已终止"`)
+	// 所有帧都是完整的
+	for _, frame := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		assert.True(t, strings.HasPrefix(frame, "data: "), "帧格式错误: %q", frame)
+	}
+}
+
+// 测试强制关闭时中止对供应商的调用，上游没有新的数据时流也能结束
+func TestShutdownCancelsStalledStream(t *testing.T) {
+	tracker := newStreamTracker()
+	var buf bytes.Buffer
+	upstream, cancelUpstream := context.WithCancel(context.Background())
+	defer cancelUpstream()
+	stream, err := tracker.track(&buf, cancelUpstream)
+	if !assert.NoError(t, err) {
+		return
+	}
+	go func() {
+		defer tracker.done(stream)
+		<-upstream.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(tracker.shutdown(ctx), context.DeadlineExceeded))
+	select {
+	case <-upstream.Done():
+	case <-time.After(time.Second):
+		t.Fatal("强制关闭时应中止对供应商的调用")
+	}
+	assert.Contains(t, buf.String(), `"message":"服务正在关闭，流式请求已终止"`)
+	assert.True(t, strings.HasSuffix(buf.String(), "data: [DONE]\n\n"))
+}
+
+// stalledStreamProvider 测试用的供应商，流式请求一直等到ctx被取消
+type stalledStreamProvider struct {
+	fakeProvider
+}
+
+func (p *stalledStreamProvider) Stream(ctx context.Context, req ChatRequest, writer io.Writer) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// 测试CreateChatCompletion的流被强制关闭时中止对供应商的调用并返回ErrShuttingDown
+func TestShutdownCancelsCreateChatCompletionStream(t *testing.T) {
+	previous := defaultStreamTracker
+	defaultStreamTracker = newStreamTracker()
+	t.Cleanup(func() { defaultStreamTracker = previous })
+	RegisterProvider("stalled", &stalledStreamProvider{})
+	t.Cleanup(func() { unregisterTestProvider("stalled") })
+
+	var buf bytes.Buffer
+	result := make(chan error, 1)
+	go func() {
+		req := ChatRequest{Provider: "stalled"}
+		req.Stream = true
+		_, err := CreateChatCompletion(req, &buf)
+		result <- err
+	}()
+	// 等待流登记后再关闭
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(Shutdown(ctx), context.DeadlineExceeded))
+	select {
+	case err := <-result:
+		assert.True(t, errors.Is(err, ErrShuttingDown))
+	case <-time.After(time.Second):
+		t.Fatal("强制关闭时应中止对供应商的调用")
+	}
+	assert.True(t, strings.HasSuffix(buf.String(), "data: [DONE]\n\n"))
+}
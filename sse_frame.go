@@ -0,0 +1,98 @@
+package einox
+
+import (
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// splitUTF8String 按字节上限切分字符串，不会在合法的多字节字符中间切断
+// maxBytes小于等于0或字符串未超过上限时原样返回；上限内找不到字符边界（非法UTF-8）时直接在上限处切断
+func splitUTF8String(s string, maxBytes int) []string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return []string{s}
+	}
+	// 上限小于单个字符的最大字节数时，至少保证每段包含一个完整字符
+	if maxBytes < utf8.UTFMax {
+		maxBytes = utf8.UTFMax
+	}
+
+	parts := make([]string, 0, len(s)/maxBytes+1)
+	for len(s) > maxBytes {
+		cut := maxBytes
+		// 回退到字符边界
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = maxBytes
+		}
+		parts = append(parts, s[:cut])
+		s = s[cut:]
+	}
+	if s != "" {
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+// splitOpenAIStreamResponse 将内容过大的流式响应拆分为多个帧
+// 角色和工具调用只保留在第一帧，结束原因和用量只保留在最后一帧，拼接后的内容与原内容一致；
+// 只拆分文本内容，工具调用的Arguments不拆分，随第一帧完整发送
+func splitOpenAIStreamResponse(resp *openai.ChatCompletionStreamResponse, maxBytes int) []*openai.ChatCompletionStreamResponse {
+	if resp == nil || len(resp.Choices) != 1 {
+		return []*openai.ChatCompletionStreamResponse{resp}
+	}
+
+	parts := splitUTF8String(resp.Choices[0].Delta.Content, maxBytes)
+	if len(parts) == 1 {
+		return []*openai.ChatCompletionStreamResponse{resp}
+	}
+
+	frames := make([]*openai.ChatCompletionStreamResponse, len(parts))
+	for i, part := range parts {
+		frame := *resp
+		choice := resp.Choices[0]
+		choice.Delta.Content = part
+		if i > 0 {
+			choice.Delta.Role = ""
+			choice.Delta.ToolCalls = nil
+		}
+		if i < len(parts)-1 {
+			choice.FinishReason = ""
+			frame.Usage = nil
+		}
+		frame.Choices = []openai.ChatCompletionStreamChoice{choice}
+		frames[i] = &frame
+	}
+	return frames
+}
+
+// splitStreamResponse 将内容过大的流式响应拆分为多个帧，规则同splitOpenAIStreamResponse
+func splitStreamResponse(resp StreamResponse, maxBytes int) []StreamResponse {
+	if len(resp.Choices) != 1 {
+		return []StreamResponse{resp}
+	}
+
+	parts := splitUTF8String(resp.Choices[0].Delta.Content, maxBytes)
+	if len(parts) == 1 {
+		return []StreamResponse{resp}
+	}
+
+	frames := make([]StreamResponse, len(parts))
+	for i, part := range parts {
+		frame := resp
+		choice := resp.Choices[0]
+		choice.Delta.Content = part
+		if i > 0 {
+			choice.Delta.Role = ""
+			choice.Delta.ReasoningContent = ""
+		}
+		if i < len(parts)-1 {
+			choice.FinishReason = ""
+		}
+		frame.Choices = []StreamChoice{choice}
+		frames[i] = frame
+	}
+	return frames
+}
@@ -0,0 +1,93 @@
+package einox
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试按字节切分时不会切断多字节字符
+func TestSplitUTF8String(t *testing.T) {
+	content := strings.Repeat("中文abc", 100)
+	parts := splitUTF8String(content, 10)
+
+	assert.Greater(t, len(parts), 1)
+	for _, part := range parts {
+		assert.LessOrEqual(t, len(part), 10)
+		assert.True(t, utf8.ValidString(part), "每段都应是合法的UTF-8")
+	}
+	assert.Equal(t, content, strings.Join(parts, ""))
+
+	// 不限制或未超出时原样返回
+	assert.Equal(t, []string{content}, splitUTF8String(content, 0))
+	assert.Equal(t, []string{"abc"}, splitUTF8String("abc", 10))
+}
+
+// 测试上限内没有字符边界的非法UTF-8按上限切断，不会死循环
+func TestSplitUTF8StringInvalid(t *testing.T) {
+	content := strings.Repeat("\x80", 25)
+	parts := splitUTF8String(content, 10)
+
+	assert.Len(t, parts, 3)
+	for _, part := range parts {
+		assert.LessOrEqual(t, len(part), 10)
+	}
+	assert.Equal(t, content, strings.Join(parts, ""))
+}
+
+// 测试超大的单个增量被拆分为多个帧
+func TestSplitOpenAIStreamResponse(t *testing.T) {
+	content := strings.Repeat("你好，世界！", 2000)
+	resp := &openai.ChatCompletionStreamResponse{
+		ID:    "chatcmpl-big",
+		Model: "gpt-4o",
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        openai.ChatCompletionStreamChoiceDelta{Role: "assistant", Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		Usage: &openai.Usage{TotalTokens: 10},
+	}
+
+	frames := splitOpenAIStreamResponse(resp, 1024)
+	assert.Greater(t, len(frames), 1, "超大增量应被拆分")
+
+	var joined strings.Builder
+	for i, frame := range frames {
+		delta := frame.Choices[0].Delta
+		assert.LessOrEqual(t, len(delta.Content), 1024)
+		assert.Equal(t, "chatcmpl-big", frame.ID)
+		joined.WriteString(delta.Content)
+
+		if i == 0 {
+			assert.Equal(t, "assistant", delta.Role)
+		} else {
+			assert.Empty(t, delta.Role)
+		}
+		if i == len(frames)-1 {
+			assert.Equal(t, openai.FinishReasonStop, frame.Choices[0].FinishReason)
+			assert.NotNil(t, frame.Usage)
+		} else {
+			assert.Empty(t, frame.Choices[0].FinishReason)
+			assert.Nil(t, frame.Usage)
+		}
+	}
+	assert.Equal(t, content, joined.String(), "拼接后的内容应与原内容一致")
+
+	// 原响应不应被修改
+	assert.Equal(t, content, resp.Choices[0].Delta.Content)
+}
+
+// 测试本地流式响应结构的拆分
+func TestSplitStreamResponse(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	frames := splitStreamResponse(StreamResponse{
+		Choices: []StreamChoice{{Delta: StreamChoiceDelta{Content: content}, FinishReason: "stop"}},
+	}, 30)
+
+	assert.Len(t, frames, 4)
+	assert.Equal(t, "", frames[0].Choices[0].FinishReason)
+	assert.Equal(t, "stop", frames[3].Choices[0].FinishReason)
+}
@@ -0,0 +1,90 @@
+package einox
+
+import (
+	"strings"
+	"sync"
+)
+
+// providerStopLimits 各供应商允许的停止序列数量上限，未列出的供应商不限制
+var providerStopLimits = map[string]int{
+	"openai":   4,
+	"azure":    4,
+	"deepseek": 16,
+	"gemini":   5,
+}
+
+var (
+	stopDefaultsMu sync.RWMutex
+	// modelStopDefaults 模型默认的停止序列，键为模型名称，以 "*" 结尾时按前缀匹配
+	modelStopDefaults = map[string][]string{}
+)
+
+// SetModelStopDefaults 设置模型默认的停止序列
+// 键为模型名称，以 "*" 结尾时按前缀匹配（如 "llama-3*"），精确匹配优先，其次是最长前缀。
+// 默认停止序列会与请求中的Stop合并去重，请求中的停止序列排在前面，
+// 超过供应商的数量上限时截断
+func SetModelStopDefaults(defaults map[string][]string) {
+	copied := make(map[string][]string, len(defaults))
+	for model, stops := range defaults {
+		copied[model] = append([]string(nil), stops...)
+	}
+
+	stopDefaultsMu.Lock()
+	defer stopDefaultsMu.Unlock()
+	modelStopDefaults = copied
+}
+
+// lookupModelStopDefaults 查找模型的默认停止序列
+func lookupModelStopDefaults(model string) []string {
+	stopDefaultsMu.RLock()
+	defer stopDefaultsMu.RUnlock()
+	stops, _ := lookupModelSetting(modelStopDefaults, model)
+	return stops
+}
+
+// lookupModelSetting 按模型名称查找配置
+// 键以 "*" 结尾时按前缀匹配，精确匹配优先，其次是最长前缀
+func lookupModelSetting[T any](settings map[string]T, model string) (T, bool) {
+	if value, ok := settings[model]; ok {
+		return value, true
+	}
+	var matched T
+	found := false
+	longest := -1
+	for key, value := range settings {
+		prefix, isPattern := strings.CutSuffix(key, "*")
+		if isPattern && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			matched, longest, found = value, len(prefix), true
+		}
+	}
+	return matched, found
+}
+
+// applyStopDefaults 将模型默认的停止序列合并到请求中
+func applyStopDefaults(provider string, req ChatRequest) ChatRequest {
+	defaults := lookupModelStopDefaults(req.Model)
+	if len(defaults) == 0 {
+		return req
+	}
+	req.Stop = mergeStopSequences(req.Stop, defaults, providerStopLimits[provider])
+	return req
+}
+
+// mergeStopSequences 合并并去重停止序列，limit大于0时最多保留limit个
+func mergeStopSequences(stops, defaults []string, limit int) []string {
+	merged := make([]string, 0, len(stops)+len(defaults))
+	seen := make(map[string]bool, len(stops)+len(defaults))
+	for _, list := range [][]string{stops, defaults} {
+		for _, stop := range list {
+			if stop == "" || seen[stop] {
+				continue
+			}
+			seen[stop] = true
+			merged = append(merged, stop)
+		}
+	}
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
@@ -0,0 +1,50 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试请求未设置Stop时使用模型默认值
+func TestApplyStopDefaults(t *testing.T) {
+	SetModelStopDefaults(map[string][]string{
+		"llama-3*":       {"<|eot_id|>"},
+		"llama-3-70b*":   {"<|eot_id|>", "<|end_of_text|>"},
+		"deepseek-coder": {"<|EOT|>"},
+	})
+	defer SetModelStopDefaults(nil)
+
+	req := applyStopDefaults("deepseek", ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{Model: "deepseek-coder"}})
+	assert.Equal(t, []string{"<|EOT|>"}, req.Stop)
+
+	// 最长前缀优先
+	req = applyStopDefaults("bedrock", ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{Model: "llama-3-70b-instruct"}})
+	assert.Equal(t, []string{"<|eot_id|>", "<|end_of_text|>"}, req.Stop)
+
+	// 没有默认值的模型保持不变
+	req = applyStopDefaults("openai", ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{Model: "gpt-4o"}})
+	assert.Nil(t, req.Stop)
+}
+
+// 测试与请求中的Stop合并、去重并按供应商上限截断
+func TestApplyStopDefaultsMerge(t *testing.T) {
+	SetModelStopDefaults(map[string][]string{
+		"gpt-4o": {"\n\nUser:", "END", "###"},
+	})
+	defer SetModelStopDefaults(nil)
+
+	req := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Model: "gpt-4o",
+		Stop:  []string{"END", "STOP"},
+	}}
+
+	merged := applyStopDefaults("bedrock", req)
+	assert.Equal(t, []string{"END", "STOP", "\n\nUser:", "###"}, merged.Stop)
+
+	// azure最多4个停止序列，请求中的优先保留
+	req.Stop = []string{"A", "B", "C"}
+	capped := applyStopDefaults("azure", req)
+	assert.Equal(t, []string{"A", "B", "C", "\n\nUser:"}, capped.Stop)
+}
@@ -0,0 +1,41 @@
+package einox
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// StreamAggregator 累积流式响应的数据块，按下标把分片到达的工具调用参数拼接为完整的工具调用
+// 不能并发使用
+type StreamAggregator struct {
+	acc *streamAccumulator
+}
+
+// NewStreamAggregator 创建流式响应累积器
+func NewStreamAggregator() *StreamAggregator {
+	return &StreamAggregator{acc: newStreamAccumulator()}
+}
+
+// Add 累积一个流式数据块，nil或没有choices的数据块（如只携带usage的数据块）会被忽略
+func (a *StreamAggregator) Add(chunk *openai.ChatCompletionStreamResponse) {
+	a.acc.add(chunk)
+}
+
+// Content 返回已累积的文本内容
+func (a *StreamAggregator) Content() string {
+	return a.acc.content.String()
+}
+
+// ToolCalls 按下标顺序返回已拼接的工具调用，Arguments为各分片依次拼接后的完整JSON
+// 与非流式响应一致，返回的工具调用不带Index
+func (a *StreamAggregator) ToolCalls() []openai.ToolCall {
+	return a.acc.completeToolCalls()
+}
+
+// AggregateStreamToolCalls 将流式响应的数据块中分片到达的工具调用按下标拼接为完整的工具调用
+func AggregateStreamToolCalls(chunks ...*openai.ChatCompletionStreamResponse) []openai.ToolCall {
+	aggregator := NewStreamAggregator()
+	for _, chunk := range chunks {
+		aggregator.Add(chunk)
+	}
+	return aggregator.ToolCalls()
+}
@@ -0,0 +1,71 @@
+package einox
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试按下标拼接分片到达的工具调用参数
+func TestAggregateStreamToolCalls(t *testing.T) {
+	text := &openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{Content: "我来查一下"},
+		}},
+	}
+	usageOnly := &openai.ChatCompletionStreamResponse{Usage: &openai.Usage{TotalTokens: 42}}
+
+	// 两个工具调用的参数交错到达
+	toolCalls := AggregateStreamToolCalls(
+		text,
+		newToolCallChunk(0, "call_1", "get_weather", `{"ci`),
+		newToolCallChunk(1, "call_2", "search", `{"query": "明`),
+		newToolCallChunk(0, "", "", `ty": "北京", `),
+		newToolCallChunk(1, "", "", `天的天气", "limit": 5}`),
+		newToolCallChunk(0, "", "", `"unit": "celsius"}`),
+		nil,
+		usageOnly,
+	)
+
+	if assert.Len(t, toolCalls, 2) {
+		assert.Equal(t, "call_1", toolCalls[0].ID)
+		assert.Equal(t, "get_weather", toolCalls[0].Function.Name)
+		assert.Equal(t, openai.ToolTypeFunction, toolCalls[0].Type)
+		assert.Nil(t, toolCalls[0].Index)
+		var weather map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(toolCalls[0].Function.Arguments), &weather))
+		assert.Equal(t, map[string]string{"city": "北京", "unit": "celsius"}, weather)
+
+		assert.Equal(t, "call_2", toolCalls[1].ID)
+		assert.Equal(t, "search", toolCalls[1].Function.Name)
+		var search struct {
+			Query string `json:"query"`
+			Limit int    `json:"limit"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(toolCalls[1].Function.Arguments), &search))
+		assert.Equal(t, "明天的天气", search.Query)
+		assert.Equal(t, 5, search.Limit)
+	}
+
+	assert.Empty(t, AggregateStreamToolCalls(text, usageOnly))
+}
+
+// 测试逐块累积文本和工具调用
+func TestStreamAggregator(t *testing.T) {
+	aggregator := NewStreamAggregator()
+	for _, chunk := range []*openai.ChatCompletionStreamResponse{
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "你"}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "好"}}}},
+		newToolCallChunk(0, "call_1", "get_time", `{}`),
+	} {
+		aggregator.Add(chunk)
+	}
+	assert.Equal(t, "你好", aggregator.Content())
+	assert.Equal(t, []openai.ToolCall{{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "get_time", Arguments: `{}`},
+	}}, aggregator.ToolCalls())
+}
@@ -0,0 +1,424 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+)
+
+// StreamEventType 流式事件类型
+type StreamEventType string
+
+const (
+	// StreamEventChunk 增量数据块
+	StreamEventChunk StreamEventType = "chunk"
+	// StreamEventDone 流正常结束，携带结束原因和用量，始终是最后一个事件
+	StreamEventDone StreamEventType = "done"
+	// StreamEventError 流异常结束，始终是最后一个事件
+	StreamEventError StreamEventType = "error"
+)
+
+// StreamEvent 面向非SSE消费者（通道/回调）的流式事件
+type StreamEvent struct {
+	Type StreamEventType `json:"type"` // 事件类型
+
+	// Chunk 增量数据，仅Type为chunk时有值
+	Chunk *openai.ChatCompletionStreamResponse `json:"chunk,omitempty"`
+
+	// 以下字段仅Type为done时有值
+	ID           string              `json:"id,omitempty"`            // 响应ID
+	Model        string              `json:"model,omitempty"`         // 模型名称
+	FinishReason openai.FinishReason `json:"finish_reason,omitempty"` // 结束原因
+	Usage        *openai.Usage       `json:"usage,omitempty"`         // 使用情况，提供商未返回时为nil
+	Latency      *LatencyBreakdown   `json:"latency,omitempty"`       // 耗时分解
+	Note         string              `json:"note,omitempty"`          // 附加说明，例如因超出token预算提前结束
+
+	// CallInfo 实际处理请求的凭证及其端点，仅Type为done或error时有值，未选中凭证时为nil
+	CallInfo *CallInfo `json:"call_info,omitempty"`
+
+	// Err 错误信息，仅Type为error时有值
+	Err error `json:"-"`
+}
+
+// StreamChatCompletionChannel 以通道形式返回流式响应
+// 通道依次收到若干chunk事件，最后收到一个done或error事件后关闭；
+// 不再读取通道时应取消ctx，对供应商的调用随即中止，通道关闭而不再发送done或error事件
+func StreamChatCompletionChannel(ctx context.Context, req ChatRequest) (<-chan StreamEvent, error) {
+	req.ctx = ctx
+	return streamEventChannel(req, ctx.Done())
+}
+
+// streamEventChannel StreamChatCompletionChannel的实现
+// stop被关闭后停止读取并关闭上游流，通道随即关闭而不再发送done或error事件；stop为nil时一直读取到流结束
+func streamEventChannel(req ChatRequest, stop <-chan struct{}) (<-chan StreamEvent, error) {
+	start := time.Now()
+	callInfo := captureCallInfo(&req)
+	streamReader, stopStream, err := openChatCompletionStream(req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent, 10)
+	go func() {
+		defer close(events)
+		// 停止读取后中止上游调用，等待请求结束再关闭通道
+		defer stopStream()
+		acc := pumpStreamEvents(streamReader, start, req.CompletionTokenBudget, func(event StreamEvent) bool {
+			event = withCallInfo(event, callInfo())
+			select {
+			case events <- event:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+		reportLatency(req.Provider, acc.latency)
+	}()
+
+	return events, nil
+}
+
+// StreamChatCompletionWithCallback 以回调形式处理流式响应
+// 回调依次收到若干chunk事件，最后收到一个done或error事件；
+// 回调返回错误时停止读取并返回该错误，若此时已收到工具调用，则返回包装该错误的 *PartialStreamError
+func StreamChatCompletionWithCallback(req ChatRequest, callback func(StreamEvent) error) error {
+	start := time.Now()
+	callInfo := captureCallInfo(&req)
+	streamReader, stop, err := openChatCompletionStream(req)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	return consumeStreamWithCallback(req.Provider, streamReader, start, req.CompletionTokenBudget, func(event StreamEvent) error {
+		return callback(withCallInfo(event, callInfo()))
+	})
+}
+
+// StreamChatCompletionFunc 以回调形式逐块处理流式响应，数据块不经过SSE编码
+// 每个数据块调用一次fn；fn返回错误时停止读取并关闭上游流，返回该错误，若此时已收到工具调用，则返回包装该错误的 *PartialStreamError。
+// 流异常结束时返回流的错误；ctx被取消或超时后，对供应商的调用会被中止
+func StreamChatCompletionFunc(ctx context.Context, req ChatRequest, fn func(chunk *openai.ChatCompletionStreamResponse) error) error {
+	req.ctx = ctx
+	return StreamChatCompletionWithCallback(req, func(event StreamEvent) error {
+		if event.Type != StreamEventChunk {
+			return nil
+		}
+		return fn(event.Chunk)
+	})
+}
+
+// withCallInfo 为done和error事件附加实际处理请求的凭证
+func withCallInfo(event StreamEvent, info CallInfo) StreamEvent {
+	if event.Type != StreamEventChunk {
+		event.CallInfo = callInfoOrNil(info)
+	}
+	return event
+}
+
+// consumeStreamWithCallback 读取流并依次回调事件
+func consumeStreamWithCallback(provider string, streamReader *schema.StreamReader[*openai.ChatCompletionStreamResponse],
+	start time.Time, budget int, callback func(StreamEvent) error) error {
+	var callbackErr, streamErr error
+	acc := pumpStreamEvents(streamReader, start, budget, func(event StreamEvent) bool {
+		if event.Type == StreamEventError {
+			streamErr = event.Err
+		}
+		if err := callback(event); err != nil {
+			callbackErr = err
+			return false
+		}
+		return true
+	})
+	reportLatency(provider, acc.latency)
+
+	if callbackErr != nil {
+		// 回调中途取消时，通过PartialStreamError返回已累积的工具调用
+		return acc.partialError(callbackErr)
+	}
+	return streamErr
+}
+
+// pumpStreamEvents 读取流并转换为事件，emit返回false时停止
+// 正常结束时最后发送一个done事件，汇总最后出现的结束原因和用量；
+// 流中断时error事件的Err为携带已累积工具调用的 *PartialStreamError。
+// start为发起请求的时间，用于计算首个token耗时和生成耗时。
+// budget大于0时，累计的补全token超过预算后关闭上游流，done事件的结束原因为length并附带说明。
+// 返回已累积的内容，供调用方在取消时恢复部分结果
+func pumpStreamEvents(streamReader *schema.StreamReader[*openai.ChatCompletionStreamResponse], start time.Time,
+	budget int, emit func(StreamEvent) bool) *streamAccumulator {
+	defer streamReader.Close()
+
+	acc := newStreamAccumulator()
+	tokens := newCompletionBudget(budget)
+	var firstTokenAt time.Time
+	done := StreamEvent{Type: StreamEventDone}
+	for {
+		chunk, err := streamReader.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			emit(StreamEvent{Type: StreamEventError, Err: acc.partialError(err)})
+			return acc
+		}
+		if chunk == nil {
+			continue
+		}
+		if firstTokenAt.IsZero() && hasStreamOutput(chunk) {
+			firstTokenAt = time.Now()
+		}
+		acc.add(chunk)
+
+		if done.ID == "" {
+			done.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			done.Model = chunk.Model
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				done.FinishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			done.Usage = chunk.Usage
+		}
+
+		if !emit(StreamEvent{Type: StreamEventChunk, Chunk: chunk}) {
+			return acc
+		}
+
+		// 超出预算时提前结束，关闭上游流由defer完成
+		if tokens.add(chunk) {
+			done.FinishReason = openai.FinishReasonLength
+			done.Note = budgetExceededNote
+			break
+		}
+	}
+
+	acc.latency = newLatencyBreakdown(start, firstTokenAt, time.Now())
+	done.Latency = acc.latency
+	emit(done)
+	return acc
+}
+
+// errStreamReaderClosed 调用方关闭了openChatCompletionStream返回的流，不再读取
+var errStreamReaderClosed = fmt.Errorf("调用方已停止读取流式响应: %w", context.Canceled)
+
+// openChatCompletionStream 发起流式请求，统一为openai的流式响应结构
+// 与CreateChatCompletion使用相同的流程：登记进行中的流以便Shutdown时等待或强制结束，尚未输出内容时按重试策略重试和故障转移，
+// 每次请求占用凭证并发槽位，并记录日志、指标和span。
+// 开启DedupeStreamDeltas时会丢弃重复的连续增量，开启EmitRoleChunk时首个数据块只携带角色。
+// 成功建立流后返回，之后的错误通过流返回；不再读取时调用stop，stop会中止上游调用并等待请求结束
+func openChatCompletionStream(req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], func(), error) {
+	ctx, cancel := context.WithCancel(requestContext(req.ctx))
+	req.ctx = ctx
+	run, err := beginChatCompletion(req, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	var opener ProviderStreamOpener
+	var stream *trackedStream
+	handler, err := lookupProvider(run.provider)
+	if err == nil {
+		var ok bool
+		if opener, ok = handler.(ProviderStreamOpener); !ok {
+			err = fmt.Errorf("供应商 %s 未实现ProviderStreamOpener，不支持StreamChatCompletionChannel等流式接口", run.provider)
+		}
+	}
+	if err == nil {
+		// 登记进行中的流，以便Shutdown时等待或强制结束，强制结束时中止对供应商的调用
+		stream, err = defaultStreamTracker.track(nil, cancel)
+	}
+	if err != nil {
+		cancel()
+		run.finish(nil, err)
+		return nil, nil, err
+	}
+
+	// 不使用缓冲，调用方停止读取后不再从上游读取，请求结果按调用方实际读取到的内容判断
+	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](0)
+	// opened 成功建立流或请求失败时收到结果
+	opened := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		var established bool
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				getLogger().Error("流式请求的goroutine发生异常", "panic", panicErr)
+				if !established {
+					opened <- fmt.Errorf("流式请求发生异常: %v", panicErr)
+				}
+			}
+			resultWriter.Close()
+			defaultStreamTracker.done(stream)
+			close(finished)
+		}()
+
+		var written bool
+		var firstTokenAt time.Time
+		var usage *openai.Usage
+		tokens := newCompletionBudget(run.req.CompletionTokenBudget)
+		err := run.stream(func() bool { return written }, func(ctx context.Context, req ChatRequest) error {
+			streamReader, err := opener.OpenStream(ctx, req)
+			if err != nil {
+				return err
+			}
+			if !established {
+				established = true
+				opened <- nil
+			}
+			if req.EmitRoleChunk {
+				streamReader = primeRoleStreamReader(streamReader)
+			}
+			if req.DedupeStreamDeltas {
+				streamReader = dedupeStreamReader(streamReader)
+			}
+			defer streamReader.Close()
+
+			for {
+				chunk, err := streamReader.Recv()
+				if stream.forceClosed() {
+					// 被强制结束时上游返回的是ctx取消的错误
+					return errStreamForceClosed
+				}
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if chunk == nil {
+					continue
+				}
+				if firstTokenAt.IsZero() && hasStreamOutput(chunk) {
+					firstTokenAt = time.Now()
+					run.span.AddEvent(SpanEventFirstToken)
+				}
+				if chunk.Usage != nil {
+					usage = chunk.Usage
+				}
+				written = true
+				if closed := resultWriter.Send(chunk, nil); closed {
+					return errStreamReaderClosed
+				}
+				// 超出预算时停止读取上游，结束原因和说明由pumpStreamEvents按同样的计数补充
+				if tokens.add(chunk) {
+					return errCompletionBudgetReached
+				}
+			}
+		})
+		if err == nil && usage != nil {
+			recordUsage(run.provider, run.req.Model, run.credential(), *usage, true)
+		}
+		if err == nil && !firstTokenAt.IsZero() {
+			reportTimeToFirstToken(run.provider, run.req.Model, firstTokenAt.Sub(run.start))
+		}
+		run.finish(usage, err)
+		if !established {
+			// 尚未成功建立流时直接返回错误
+			opened <- err
+			return
+		}
+		if err != nil {
+			var started *outputStartedError
+			if errors.As(err, &started) {
+				err = started.err
+			}
+			_ = resultWriter.Send(nil, err)
+		}
+	}()
+
+	if err := <-opened; err != nil {
+		cancel()
+		<-finished
+		return nil, nil, err
+	}
+	stop := func() {
+		resultReader.Close()
+		cancel()
+		<-finished
+	}
+	return resultReader, stop, nil
+}
+
+// providerOrDefault 未指定供应商时使用默认的bedrock，与CreateChatCompletion保持一致
+func providerOrDefault(provider string) string {
+	if provider == "" {
+		return "bedrock"
+	}
+	return provider
+}
+
+// convertLocalStreamReader 将本地流式响应结构转换为openai的流式响应结构
+func convertLocalStreamReader(streamReader *schema.StreamReader[*ChatCompletionStreamResponse]) *schema.StreamReader[*openai.ChatCompletionStreamResponse] {
+	resultReader, resultWriter := schema.Pipe[*openai.ChatCompletionStreamResponse](10)
+
+	go func() {
+		defer func() {
+			if panicErr := recover(); panicErr != nil {
+				getLogger().Error("转换流式响应的goroutine发生异常", "panic", panicErr)
+			}
+			streamReader.Close()
+			resultWriter.Close()
+		}()
+
+		for {
+			response, err := streamReader.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				_ = resultWriter.Send(nil, err)
+				return
+			}
+			if closed := resultWriter.Send(convertLocalStreamResponse(response), nil); closed {
+				return
+			}
+		}
+	}()
+
+	return resultReader
+}
+
+// convertLocalStreamResponse 转换单个本地流式响应
+func convertLocalStreamResponse(response *ChatCompletionStreamResponse) *openai.ChatCompletionStreamResponse {
+	if response == nil {
+		return nil
+	}
+
+	choices := make([]openai.ChatCompletionStreamChoice, 0, len(response.Choices))
+	for _, choice := range response.Choices {
+		choices = append(choices, openai.ChatCompletionStreamChoice{
+			Index: choice.Index,
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				Role:    choice.Delta.Role,
+				Content: choice.Delta.Content,
+			},
+			FinishReason: openai.FinishReason(choice.FinishReason),
+		})
+	}
+
+	converted := &openai.ChatCompletionStreamResponse{
+		ID:      response.ID,
+		Object:  response.Object,
+		Created: response.Created,
+		Model:   response.Model,
+		Choices: choices,
+	}
+	if response.Usage != nil {
+		converted.Usage = &openai.Usage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		}
+	}
+	return converted
+}
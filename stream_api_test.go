@@ -0,0 +1,311 @@
+package einox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造测试用的流式数据块
+func newTestStreamChunk(content string, finishReason openai.FinishReason) *openai.ChatCompletionStreamResponse {
+	return &openai.ChatCompletionStreamResponse{
+		ID:     "chatcmpl-test",
+		Object: "chat.completion.chunk",
+		Model:  "gpt-4o",
+		Choices: []openai.ChatCompletionStreamChoice{
+			{
+				Index:        0,
+				Delta:        openai.ChatCompletionStreamChoiceDelta{Content: content},
+				FinishReason: finishReason,
+			},
+		},
+	}
+}
+
+// 测试正常结束时只有一个done事件且位于最后
+func TestPumpStreamEventsDone(t *testing.T) {
+	last := newTestStreamChunk("", openai.FinishReasonStop)
+	last.Usage = &openai.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+	reader := schema.StreamReaderFromArray([]*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你", ""),
+		newTestStreamChunk("好", ""),
+		last,
+	})
+
+	var events []StreamEvent
+	pumpStreamEvents(reader, time.Now(), 0, func(event StreamEvent) bool {
+		events = append(events, event)
+		return true
+	})
+
+	assert.Len(t, events, 4)
+	doneCount := 0
+	for _, event := range events {
+		if event.Type == StreamEventDone {
+			doneCount++
+		}
+	}
+	assert.Equal(t, 1, doneCount, "应只有一个done事件")
+
+	done := events[len(events)-1]
+	assert.Equal(t, StreamEventDone, done.Type, "done事件应位于最后")
+	assert.Equal(t, openai.FinishReasonStop, done.FinishReason)
+	assert.Equal(t, "chatcmpl-test", done.ID)
+	assert.Equal(t, "gpt-4o", done.Model)
+	if assert.NotNil(t, done.Usage) {
+		assert.Equal(t, 5, done.Usage.TotalTokens)
+	}
+}
+
+// 测试流出错时以error事件结束且没有done事件
+func TestPumpStreamEventsError(t *testing.T) {
+	reader, writer := schema.Pipe[*openai.ChatCompletionStreamResponse](3)
+	writer.Send(newTestStreamChunk("你", ""), nil)
+	writer.Send(nil, errors.New("连接中断"))
+	writer.Close()
+
+	var events []StreamEvent
+	pumpStreamEvents(reader, time.Now(), 0, func(event StreamEvent) bool {
+		events = append(events, event)
+		return true
+	})
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, StreamEventChunk, events[0].Type)
+	assert.Equal(t, StreamEventError, events[1].Type)
+	assert.EqualError(t, events[1].Err, "连接中断")
+}
+
+// 测试本地流式响应结构的转换
+func TestConvertLocalStreamResponse(t *testing.T) {
+	resp := convertLocalStreamResponse(&ChatCompletionStreamResponse{
+		ID:    "local-1",
+		Model: "deepseek-chat",
+		Choices: []ChatCompletionStreamChoice{
+			{Index: 0, Delta: ChatCompletionStreamDelta{Role: "assistant", Content: "hi"}, FinishReason: "stop"},
+		},
+	})
+
+	assert.Equal(t, "local-1", resp.ID)
+	assert.Equal(t, "hi", resp.Choices[0].Delta.Content)
+	assert.Equal(t, openai.FinishReasonStop, resp.Choices[0].FinishReason)
+}
+
+// chunkProvider 测试用的供应商，OpenStream返回预设的数据块
+type chunkProvider struct {
+	fakeProvider
+	chunks []*openai.ChatCompletionStreamResponse
+	err    error
+}
+
+func (p *chunkProvider) OpenStream(ctx context.Context, req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	p.ctx, p.req = ctx, req
+	reader, writer := schema.Pipe[*openai.ChatCompletionStreamResponse](len(p.chunks) + 1)
+	for _, chunk := range p.chunks {
+		writer.Send(chunk, nil)
+	}
+	if p.err != nil {
+		writer.Send(nil, p.err)
+	}
+	writer.Close()
+	return reader, nil
+}
+
+// registerChunkProvider 注册返回预设数据块的供应商，测试结束后移除
+func registerChunkProvider(t *testing.T, chunks []*openai.ChatCompletionStreamResponse, err error) *chunkProvider {
+	provider := &chunkProvider{chunks: chunks, err: err}
+	RegisterProvider("chunks", provider)
+	t.Cleanup(func() {
+		providerRegistryMu.Lock()
+		defer providerRegistryMu.Unlock()
+		delete(providerRegistry, "chunks")
+	})
+	return provider
+}
+
+// 测试逐块回调流式响应
+func TestStreamChatCompletionFunc(t *testing.T) {
+	provider := registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你", ""),
+		newTestStreamChunk("好", ""),
+		newTestStreamChunk("", openai.FinishReasonStop),
+	}, nil)
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	req := ChatRequest{
+		Provider: "chunks",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+		},
+	}
+
+	var content string
+	var finishReason openai.FinishReason
+	err := StreamChatCompletionFunc(ctx, req, func(chunk *openai.ChatCompletionStreamResponse) error {
+		content += chunk.Choices[0].Delta.Content
+		finishReason = chunk.Choices[0].FinishReason
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "你好", content)
+	assert.Equal(t, openai.FinishReasonStop, finishReason)
+	assert.Equal(t, "value", provider.ctx.Value(ctxKey{}), "请求的上下文应传给供应商")
+
+	// 回调返回错误时停止读取
+	stop := errors.New("停止")
+	calls := 0
+	err = StreamChatCompletionFunc(ctx, req, func(chunk *openai.ChatCompletionStreamResponse) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+// 测试流异常结束时返回流的错误
+func TestStreamChatCompletionFuncStreamError(t *testing.T) {
+	streamErr := errors.New("连接中断")
+	registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{newTestStreamChunk("你", "")}, streamErr)
+
+	calls := 0
+	err := StreamChatCompletionFunc(context.Background(), ChatRequest{
+		Provider:              "chunks",
+		ChatCompletionRequest: openai.ChatCompletionRequest{Model: "gpt-4o"},
+	}, func(chunk *openai.ChatCompletionStreamResponse) error {
+		calls++
+		return nil
+	})
+	assert.ErrorIs(t, err, streamErr)
+	assert.Equal(t, 1, calls)
+}
+
+// flakyChunkProvider 测试用的供应商，前failures次OpenStream返回503
+type flakyChunkProvider struct {
+	chunkProvider
+	failures int
+	calls    int
+}
+
+func (p *flakyChunkProvider) OpenStream(ctx context.Context, req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+	}
+	return p.chunkProvider.OpenStream(ctx, req)
+}
+
+// 测试通道和回调形式的流式接口与CreateChatCompletion一样按重试策略重试
+func TestStreamChatCompletionFuncRetry(t *testing.T) {
+	provider := &flakyChunkProvider{
+		chunkProvider: chunkProvider{chunks: []*openai.ChatCompletionStreamResponse{newTestStreamChunk("你好", openai.FinishReasonStop)}},
+		failures:      1,
+	}
+	RegisterProvider("flaky-chunks", provider)
+	t.Cleanup(func() { unregisterTestProvider("flaky-chunks") })
+
+	req := ChatRequest{Provider: "flaky-chunks", RetryPolicy: &RetryPolicy{MaxRetries: 1, BaseDelayMs: 1}}
+	var content string
+	err := StreamChatCompletionFunc(context.Background(), req, func(chunk *openai.ChatCompletionStreamResponse) error {
+		content += chunk.Choices[0].Delta.Content
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "你好", content)
+	assert.Equal(t, 2, provider.calls)
+
+	// 重试次数用完时直接返回错误
+	provider.calls, provider.failures = 0, 2
+	_, err = StreamChatCompletionChannel(context.Background(), req)
+	var apiErr *openai.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 2, provider.calls)
+}
+
+// slowChunkProvider 测试用的供应商，每隔interval发送一个数据块，直到ctx被取消
+type slowChunkProvider struct {
+	fakeProvider
+	interval time.Duration
+}
+
+func (p *slowChunkProvider) OpenStream(ctx context.Context, req ChatRequest) (*schema.StreamReader[*openai.ChatCompletionStreamResponse], error) {
+	reader, writer := schema.Pipe[*openai.ChatCompletionStreamResponse](0)
+	go func() {
+		defer writer.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				writer.Send(nil, ctx.Err())
+				return
+			case <-time.After(p.interval):
+			}
+			if closed := writer.Send(newTestStreamChunk("块", ""), nil); closed {
+				return
+			}
+		}
+	}()
+	return reader, nil
+}
+
+// 测试Shutdown等待通道形式的流，超时后中止上游调用并发送ErrShuttingDown错误事件
+func TestStreamChatCompletionChannelShutdown(t *testing.T) {
+	previous := defaultStreamTracker
+	defaultStreamTracker = newStreamTracker()
+	t.Cleanup(func() { defaultStreamTracker = previous })
+	// 上游迟迟没有数据，只有中止调用才能结束
+	RegisterProvider("slow-chunks", &slowChunkProvider{interval: time.Hour})
+	t.Cleanup(func() { unregisterTestProvider("slow-chunks") })
+
+	events, err := StreamChatCompletionChannel(context.Background(), ChatRequest{Provider: "slow-chunks"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Shutdown(ctx), context.DeadlineExceeded)
+
+	var last StreamEvent
+	for event := range events {
+		last = event
+	}
+	assert.Equal(t, StreamEventError, last.Type)
+	assert.ErrorIs(t, last.Err, ErrShuttingDown)
+
+	_, err = StreamChatCompletionChannel(context.Background(), ChatRequest{Provider: "slow-chunks"})
+	assert.ErrorIs(t, err, ErrShuttingDown, "关闭期间不再接受新的流式请求")
+}
+
+// 测试调用方不再读取通道时取消ctx，后台读取结束并中止上游调用，通道随即关闭
+func TestStreamChatCompletionChannelContextCancel(t *testing.T) {
+	RegisterProvider("slow-chunks", &slowChunkProvider{interval: time.Millisecond})
+	t.Cleanup(func() { unregisterTestProvider("slow-chunks") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := StreamChatCompletionChannel(ctx, ChatRequest{Provider: "slow-chunks"})
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+	event := <-events
+	assert.Equal(t, StreamEventChunk, event.Type)
+
+	// 停止读取并取消ctx，通道应在上游调用结束后关闭
+	cancel()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for range events {
+		}
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消ctx后通道未关闭")
+	}
+}
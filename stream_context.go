@@ -0,0 +1,33 @@
+package einox
+
+import (
+	"context"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// streamRecv 从流中读取一次的结果
+type streamRecv[T any] struct {
+	value T
+	err   error
+}
+
+// recvWithContext 在后台协程中读取流，结果通过通道返回，使调用方可以同时等待ctx.Done()
+// 读到错误（包括io.EOF）后停止读取；ctx取消后不再投递结果，后台协程在当前Recv返回后退出
+func recvWithContext[T any](ctx context.Context, streamReader *schema.StreamReader[T]) <-chan streamRecv[T] {
+	results := make(chan streamRecv[T])
+	go func() {
+		for {
+			value, err := streamReader.Recv()
+			select {
+			case results <- streamRecv[T]{value: value, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,298 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// StreamFormat 流式响应的输出格式
+type StreamFormat string
+
+const (
+	// StreamFormatChatCompletions 默认格式，输出chat.completion.chunk帧并以[DONE]结束
+	StreamFormatChatCompletions StreamFormat = "chat_completions"
+	// StreamFormatResponses OpenAI Responses API的事件格式，如response.output_text.delta
+	StreamFormatResponses StreamFormat = "responses"
+)
+
+// Responses API的流式事件类型
+const (
+	responsesEventCreated          = "response.created"
+	responsesEventOutputItemAdded  = "response.output_item.added"
+	responsesEventContentPartAdded = "response.content_part.added"
+	responsesEventOutputTextDelta  = "response.output_text.delta"
+	responsesEventOutputTextDone   = "response.output_text.done"
+	responsesEventContentPartDone  = "response.content_part.done"
+	responsesEventOutputItemDone   = "response.output_item.done"
+	responsesEventCompleted        = "response.completed"
+	responsesEventIncomplete       = "response.incomplete"
+	responsesEventError            = "error"
+)
+
+// responsesUsage Responses API的使用情况
+type responsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// responsesIncompleteDetails 响应未完成的原因
+type responsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// responsesContentPart 输出消息中的内容
+type responsesContentPart struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// responsesOutputItem 响应中的输出项，目前只有assistant消息
+type responsesOutputItem struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"`
+	Role    string                 `json:"role"`
+	Status  string                 `json:"status"`
+	Content []responsesContentPart `json:"content"`
+}
+
+// responsesObject Responses API的响应对象
+type responsesObject struct {
+	ID                string                      `json:"id"`
+	Object            string                      `json:"object"`
+	CreatedAt         int64                       `json:"created_at"`
+	Model             string                      `json:"model"`
+	Status            string                      `json:"status"`
+	IncompleteDetails *responsesIncompleteDetails `json:"incomplete_details,omitempty"`
+	Output            []responsesOutputItem       `json:"output"`
+	Usage             *responsesUsage             `json:"usage,omitempty"`
+}
+
+// responsesEvent Responses API的流式事件，按事件类型只填写部分字段
+type responsesEvent struct {
+	Type           string                `json:"type"`
+	SequenceNumber int                   `json:"sequence_number"`
+	Response       *responsesObject      `json:"response,omitempty"`
+	OutputIndex    *int                  `json:"output_index,omitempty"`
+	ContentIndex   *int                  `json:"content_index,omitempty"`
+	ItemID         string                `json:"item_id,omitempty"`
+	Item           *responsesOutputItem  `json:"item,omitempty"`
+	Part           *responsesContentPart `json:"part,omitempty"`
+	Delta          string                `json:"delta,omitempty"`
+	Text           *string               `json:"text,omitempty"`
+	Message        string                `json:"message,omitempty"`
+	Code           string                `json:"code,omitempty"`
+}
+
+// newStreamFormatWriter 按输出格式包装writer，默认格式原样返回
+func newStreamFormatWriter(w io.Writer, format StreamFormat) io.Writer {
+	if format != StreamFormatResponses {
+		return w
+	}
+	return &responsesWriter{w: w}
+}
+
+// responsesWriter 将chat.completion.chunk帧改写为Responses API的事件
+// 首个数据块前依次输出response.created、response.output_item.added和response.content_part.added，
+// 文本增量输出为response.output_text.delta，收到[DONE]时输出各项的done事件和response.completed
+type responsesWriter struct {
+	w        io.Writer
+	pending  []byte
+	seq      int
+	started  bool
+	finished bool
+
+	response     responsesObject
+	text         strings.Builder
+	finishReason openai.FinishReason
+}
+
+// Write 实现io.Writer接口，返回值为输入的字节数
+func (r *responsesWriter) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+	for {
+		end := bytes.Index(r.pending, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		frame := r.pending[:end]
+		r.pending = r.pending[end+2:]
+		if err := r.writeFrame(frame); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// writeFrame 转换单个SSE帧
+func (r *responsesWriter) writeFrame(frame []byte) error {
+	trimmed := bytes.TrimSpace(frame)
+	data, ok := bytes.CutPrefix(trimmed, []byte("data:"))
+	if !ok {
+		// 注释等非数据帧原样输出
+		if len(trimmed) == 0 {
+			return nil
+		}
+		_, err := fmt.Fprintf(r.w, "%s\n\n", trimmed)
+		return err
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("[DONE]")) {
+		return r.finish()
+	}
+
+	var errResp ErrorResponse
+	if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error.Message != "" {
+		return r.writeEvent(responsesEvent{Type: responsesEventError, Message: errResp.Error.Message, Code: errResp.Error.Code})
+	}
+
+	var chunk openai.ChatCompletionStreamResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		// 无法识别的数据帧不转换，避免丢失内容
+		_, err = fmt.Fprintf(r.w, "%s\n\n", trimmed)
+		return err
+	}
+	return r.writeChunk(&chunk)
+}
+
+// writeChunk 转换单个数据块
+func (r *responsesWriter) writeChunk(chunk *openai.ChatCompletionStreamResponse) error {
+	if !r.started {
+		if err := r.start(chunk); err != nil {
+			return err
+		}
+	}
+	if chunk.Usage != nil {
+		r.response.Usage = &responsesUsage{
+			InputTokens:  chunk.Usage.PromptTokens,
+			OutputTokens: chunk.Usage.CompletionTokens,
+			TotalTokens:  chunk.Usage.TotalTokens,
+		}
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != "" {
+			r.finishReason = choice.FinishReason
+		}
+		if choice.Delta.Content == "" {
+			continue
+		}
+		r.text.WriteString(choice.Delta.Content)
+		if err := r.writeEvent(responsesEvent{
+			Type:         responsesEventOutputTextDelta,
+			ItemID:       r.itemID(),
+			OutputIndex:  intPtr(0),
+			ContentIndex: intPtr(0),
+			Delta:        choice.Delta.Content,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start 输出响应开始的事件
+func (r *responsesWriter) start(chunk *openai.ChatCompletionStreamResponse) error {
+	r.started = true
+	r.response = responsesObject{
+		ID:        chunk.ID,
+		Object:    "response",
+		CreatedAt: chunk.Created,
+		Model:     chunk.Model,
+		Status:    "in_progress",
+		Output:    []responsesOutputItem{},
+	}
+
+	created := r.response
+	item := r.outputItem("in_progress", nil)
+	part := responsesContentPart{Type: "output_text", Annotations: []any{}}
+	events := []responsesEvent{
+		{Type: responsesEventCreated, Response: &created},
+		{Type: responsesEventOutputItemAdded, OutputIndex: intPtr(0), Item: &item},
+		{Type: responsesEventContentPartAdded, ItemID: r.itemID(), OutputIndex: intPtr(0), ContentIndex: intPtr(0), Part: &part},
+	}
+	for _, event := range events {
+		if err := r.writeEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish 输出响应结束的事件，只输出一次
+func (r *responsesWriter) finish() error {
+	if r.finished || !r.started {
+		return nil
+	}
+	r.finished = true
+
+	text := r.text.String()
+	part := responsesContentPart{Type: "output_text", Text: text, Annotations: []any{}}
+	item := r.outputItem("completed", []responsesContentPart{part})
+
+	final := r.response
+	final.Status = "completed"
+	final.Output = []responsesOutputItem{item}
+	completedType := responsesEventCompleted
+	if r.finishReason == openai.FinishReasonLength {
+		final.Status = "incomplete"
+		final.IncompleteDetails = &responsesIncompleteDetails{Reason: "max_output_tokens"}
+		completedType = responsesEventIncomplete
+	}
+
+	events := []responsesEvent{
+		{Type: responsesEventOutputTextDone, ItemID: r.itemID(), OutputIndex: intPtr(0), ContentIndex: intPtr(0), Text: &text},
+		{Type: responsesEventContentPartDone, ItemID: r.itemID(), OutputIndex: intPtr(0), ContentIndex: intPtr(0), Part: &part},
+		{Type: responsesEventOutputItemDone, OutputIndex: intPtr(0), Item: &item},
+		{Type: completedType, Response: &final},
+	}
+	for _, event := range events {
+		if err := r.writeEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemID 输出消息的ID，由响应ID派生
+func (r *responsesWriter) itemID() string {
+	return "msg_" + r.response.ID
+}
+
+// outputItem 构造输出消息
+func (r *responsesWriter) outputItem(status string, content []responsesContentPart) responsesOutputItem {
+	if content == nil {
+		content = []responsesContentPart{}
+	}
+	return responsesOutputItem{
+		ID:      r.itemID(),
+		Type:    "message",
+		Role:    openai.ChatMessageRoleAssistant,
+		Status:  status,
+		Content: content,
+	}
+}
+
+// writeEvent 以SSE事件的形式写出，event行为事件类型
+func (r *responsesWriter) writeEvent(event responsesEvent) error {
+	event.SequenceNumber = r.seq
+	r.seq++
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化Responses事件失败: %v", err)
+	}
+	if _, err := fmt.Fprintf(r.w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return fmt.Errorf("写入Responses事件失败: %v", err)
+	}
+	return nil
+}
+
+// intPtr 返回int的指针
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,133 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 写入chat.completion.chunk帧
+func writeTestChunk(t *testing.T, w *bytes.Buffer, chunk *openai.ChatCompletionStreamResponse) []byte {
+	data, err := json.Marshal(chunk)
+	assert.NoError(t, err)
+	frame := []byte("data: " + string(data) + "\n\n")
+	w.Write(frame)
+	return frame
+}
+
+// 解析输出中的事件名称和数据
+func parseResponsesEvents(t *testing.T, output string) ([]string, []map[string]any) {
+	var names []string
+	var payloads []map[string]any
+	for _, frame := range strings.Split(strings.TrimSpace(output), "\n\n") {
+		lines := strings.SplitN(frame, "\n", 2)
+		if !assert.Len(t, lines, 2, "帧应包含event行和data行: %s", frame) {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(lines[0], "event: "))
+		var payload map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &payload))
+		payloads = append(payloads, payload)
+	}
+	return names, payloads
+}
+
+// 测试chat.completion.chunk流被改写为Responses API的事件
+func TestResponsesStreamFormat(t *testing.T) {
+	var input bytes.Buffer
+	writeTestChunk(t, &input, newTestStreamChunk("你", ""))
+	writeTestChunk(t, &input, newTestStreamChunk("好", ""))
+	last := newTestStreamChunk("", openai.FinishReasonStop)
+	last.Usage = &openai.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+	writeTestChunk(t, &input, last)
+	input.WriteString("data: [DONE]\n\n")
+
+	var output bytes.Buffer
+	writer := newStreamFormatWriter(&output, StreamFormatResponses)
+	// 按任意位置切分写入，模拟帧跨多次写入的情况
+	data := input.Bytes()
+	for len(data) > 0 {
+		n := min(7, len(data))
+		written, err := writer.Write(data[:n])
+		assert.NoError(t, err)
+		assert.Equal(t, n, written)
+		data = data[n:]
+	}
+
+	names, payloads := parseResponsesEvents(t, output.String())
+	assert.Equal(t, []string{
+		"response.created",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.completed",
+	}, names)
+	for i, payload := range payloads {
+		assert.Equal(t, names[i], payload["type"])
+		assert.EqualValues(t, i, payload["sequence_number"])
+	}
+	assert.Equal(t, "你", payloads[3]["delta"])
+	assert.Equal(t, "你好", payloads[5]["text"])
+
+	completed := payloads[8]["response"].(map[string]any)
+	assert.Equal(t, "completed", completed["status"])
+	assert.Equal(t, "chatcmpl-test", completed["id"])
+	assert.Equal(t, map[string]any{"input_tokens": 3.0, "output_tokens": 2.0, "total_tokens": 5.0}, completed["usage"])
+	assert.NotContains(t, output.String(), "[DONE]")
+}
+
+// 测试因长度截断结束时输出response.incomplete
+func TestResponsesStreamFormatIncomplete(t *testing.T) {
+	var output bytes.Buffer
+	writer := newStreamFormatWriter(&output, StreamFormatResponses)
+	var input bytes.Buffer
+	writeTestChunk(t, &input, newTestStreamChunk("你", openai.FinishReasonLength))
+	input.WriteString(": 说明\n\ndata: [DONE]\n\n")
+	_, err := writer.Write(input.Bytes())
+	assert.NoError(t, err)
+
+	assert.Contains(t, output.String(), ": 说明\n\n")
+	assert.Contains(t, output.String(), "event: response.incomplete\n")
+	assert.Contains(t, output.String(), `"incomplete_details":{"reason":"max_output_tokens"}`)
+}
+
+// 测试默认格式原样输出
+func TestDefaultStreamFormat(t *testing.T) {
+	var output bytes.Buffer
+	assert.Same(t, &output, newStreamFormatWriter(&output, "").(*bytes.Buffer))
+	assert.Same(t, &output, newStreamFormatWriter(&output, StreamFormatChatCompletions).(*bytes.Buffer))
+}
+
+// 测试Responses格式下的错误帧和使用情况trailer
+func TestStreamToHTTPResponsesFormat(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := StreamToHTTP(recorder, ChatRequest{Provider: "unknown", StreamFormat: StreamFormatResponses})
+	assert.Error(t, err)
+	assert.Equal(t,
+		"event: error\ndata: {\"type\":\"error\",\"sequence_number\":0,\"message\":\"不支持的AI供应商: unknown\"}\n\n",
+		recorder.Body.String())
+
+	var output bytes.Buffer
+	sniffer := newUsageSniffer(&output)
+	writer := newStreamFormatWriter(sniffer, StreamFormatResponses)
+	var input bytes.Buffer
+	last := newTestStreamChunk("hi", openai.FinishReasonStop)
+	last.Usage = &openai.Usage{PromptTokens: 4, CompletionTokens: 1, TotalTokens: 5}
+	writeTestChunk(t, &input, last)
+	input.WriteString("data: [DONE]\n\n")
+	_, err = writer.Write(input.Bytes())
+	assert.NoError(t, err)
+	if assert.NotNil(t, sniffer.usage) {
+		assert.Equal(t, 5, sniffer.usage.TotalTokens)
+		assert.Equal(t, 4, sniffer.usage.PromptTokens)
+	}
+}
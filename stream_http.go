@@ -0,0 +1,141 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// StreamToHTTP 将流式聊天响应直接写入http.ResponseWriter
+// 会设置SSE所需的响应头（Content-Type、Cache-Control、Connection、CORS），并在每次写入后立即flush。
+// 调用方事先设置的同名响应头不会被覆盖。
+// req.UsageTrailers为true时，token使用情况会同时以HTTP trailer的形式返回。
+// 流式过程中出错时会写入一个SSE错误帧，格式与OpenAI的错误响应一致，同时返回该错误
+func StreamToHTTP(w http.ResponseWriter, req ChatRequest) error {
+	return streamToHTTP(w, req, func(r ChatRequest, writer io.Writer) error {
+		_, err := CreateChatCompletion(r, writer)
+		return err
+	})
+}
+
+// streamToHTTP StreamToHTTP的实现，stream负责将流式响应写入writer
+func streamToHTTP(w http.ResponseWriter, req ChatRequest, stream func(ChatRequest, io.Writer) error) error {
+	// trailer需要在写入响应头之前声明
+	if req.UsageTrailers {
+		declareUsageTrailers(w.Header())
+	}
+	setSSEHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+
+	req.Stream = true
+	var writer io.Writer = newFlushWriter(w)
+	if req.UsageTrailers {
+		sniffer := newUsageSniffer(writer)
+		defer sniffer.setTrailers(w.Header())
+		writer = sniffer
+	}
+	if err := stream(req, writer); err != nil {
+		// 关闭时被强制结束的流、供应商中途出错的流已经写出了错误帧
+		var written *streamErrorWritten
+		if errors.Is(err, errStreamForceClosed) || errors.As(err, &written) {
+			return err
+		}
+		// Responses格式下错误帧同样改写为error事件
+		if writeErr := writeSSEError(newStreamFormatWriter(writer, req.StreamFormat), err); writeErr != nil {
+			return fmt.Errorf("%v (写入SSE错误帧失败: %v)", err, writeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// setSSEHeaders 设置SSE响应头，已存在的响应头保持不变
+func setSSEHeaders(header http.Header) {
+	defaults := map[string]string{
+		"Content-Type":                "text/event-stream",
+		"Cache-Control":               "no-cache",
+		"Connection":                  "keep-alive",
+		"Access-Control-Allow-Origin": "*",
+		// 关闭Nginx等反向代理的响应缓冲
+		"X-Accel-Buffering": "no",
+	}
+	for key, value := range defaults {
+		if header.Get(key) == "" {
+			header.Set(key, value)
+		}
+	}
+}
+
+// writeSSEError 写入SSE错误帧，格式与OpenAI流式接口的错误一致：data: {"error":{"message":...,"type":...,"param":null,"code":...}}
+// 供应商返回的错误（ProviderError）使用其错误类型和错误码
+func writeSSEError(writer io.Writer, err error) error {
+	var errResp ErrorResponse
+	errResp.Error.Message = err.Error()
+	errResp.Error.Type = "stream_error"
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		if providerErr.Type != "" {
+			errResp.Error.Type = providerErr.Type
+		}
+		errResp.Error.Code = providerErr.Code
+	}
+
+	data, marshalErr := json.Marshal(errResp)
+	if marshalErr != nil {
+		return fmt.Errorf("序列化错误响应失败: %v", marshalErr)
+	}
+	if _, writeErr := fmt.Fprintf(writer, "data: %s\n\n", data); writeErr != nil {
+		return fmt.Errorf("写入错误响应失败: %v", writeErr)
+	}
+	return nil
+}
+
+// streamErrorWritten 流式响应中途出错且错误帧和结束标记已经写出，StreamToHTTP不再重复写入错误帧
+type streamErrorWritten struct {
+	err error
+}
+
+// Error 实现error接口
+func (e *streamErrorWritten) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *streamErrorWritten) Unwrap() error {
+	return e.err
+}
+
+// writeStreamError 流式响应中途出错时写入错误帧和结束标记，使EventSource等客户端收到结构化的错误而不是被截断的流
+// 返回包装了err的错误，写入失败时一并说明
+func writeStreamError(writer io.Writer, err error) error {
+	if writeErr := writeSSEError(writer, err); writeErr != nil {
+		return fmt.Errorf("%w (写入SSE错误帧失败: %v)", err, writeErr)
+	}
+	if _, writeErr := writer.Write([]byte("data: [DONE]\n\n")); writeErr != nil {
+		return fmt.Errorf("%w (写入流式响应结束标记失败: %v)", err, writeErr)
+	}
+	return &streamErrorWritten{err: err}
+}
+
+// flushWriter 每次写入后立即flush的Writer，使SSE帧能及时到达客户端
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// newFlushWriter 包装ResponseWriter，不支持flush时退化为普通写入
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	flusher, _ := w.(http.Flusher)
+	return &flushWriter{w: w, flusher: flusher}
+}
+
+// Write 实现io.Writer接口
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil && f.flusher != nil {
+		f.flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+package einox
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试正常流式输出时的响应头和响应体
+func TestStreamToHTTP(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := streamToHTTP(recorder, ChatRequest{Provider: "azure"}, func(req ChatRequest, writer io.Writer) error {
+		assert.True(t, req.Stream)
+		_, err := writer.Write([]byte("data: {\"id\":\"1\"}\n\n"))
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write([]byte("data: [DONE]\n\n"))
+		return err
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, "keep-alive", recorder.Header().Get("Connection"))
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "data: {\"id\":\"1\"}\n\ndata: [DONE]\n\n", recorder.Body.String())
+}
+
+// 测试出错时写入SSE错误帧
+func TestStreamToHTTPError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	// 调用方设置的CORS响应头不会被覆盖
+	recorder.Header().Set("Access-Control-Allow-Origin", "https://example.com")
+
+	err := StreamToHTTP(recorder, ChatRequest{Provider: "unknown"})
+	assert.EqualError(t, err, "不支持的AI供应商: unknown")
+
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "https://example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t,
+		"data: {\"error\":{\"message\":\"不支持的AI供应商: unknown\",\"type\":\"stream_error\",\"param\":null,\"code\":\"\"}}\n\n",
+		recorder.Body.String())
+}
+
+// 测试流中途出错时保留已写入的内容并追加错误帧
+func TestStreamToHTTPPartialError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := streamToHTTP(recorder, ChatRequest{}, func(req ChatRequest, writer io.Writer) error {
+		_, _ = writer.Write([]byte("data: {\"id\":\"1\"}\n\n"))
+		return errors.New("连接中断")
+	})
+	assert.EqualError(t, err, "连接中断")
+	assert.Contains(t, recorder.Body.String(), "data: {\"id\":\"1\"}\n\n")
+	assert.Contains(t, recorder.Body.String(), "\"message\":\"连接中断\"")
+}
+
+// 测试供应商流中途出错时写入OpenAI格式的错误帧和结束标记，StreamToHTTP不再重复写入
+func TestStreamErrorFrame(t *testing.T) {
+	reader, writer := schema.Pipe[*openai.ChatCompletionStreamResponse](3)
+	writer.Send(&openai.ChatCompletionStreamResponse{
+		ID:      "chatcmpl-1",
+		Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "你好"}}},
+	}, nil)
+	upstreamErr := newProviderError("azure", &openai.APIError{
+		HTTPStatusCode: http.StatusInternalServerError,
+		Type:           "server_error",
+		Code:           "internal_error",
+		Message:        "The server had an error while processing your request.",
+	})
+	writer.Send(nil, upstreamErr)
+	writer.Close()
+
+	recorder := httptest.NewRecorder()
+	err := streamToHTTP(recorder, ChatRequest{}, func(req ChatRequest, w io.Writer) error {
+		return writeOpenAIStreamToChat(req, "Azure", reader, w)
+	})
+	assert.ErrorIs(t, err, upstreamErr)
+
+	frames := strings.Split(strings.TrimSuffix(recorder.Body.String(), "\n\n"), "\n\n")
+	if assert.Len(t, frames, 3, "数据帧、错误帧和结束标记各一个") {
+		assert.Contains(t, frames[0], "你好")
+		var errResp map[string]map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frames[1], "data: ")), &errResp))
+		assert.Equal(t, "server_error", errResp["error"]["type"])
+		assert.Equal(t, "internal_error", errResp["error"]["code"])
+		assert.Contains(t, errResp["error"], "param")
+		assert.Nil(t, errResp["error"]["param"])
+		assert.Contains(t, errResp["error"]["message"], "接收Azure流式响应失败")
+		assert.Equal(t, "data: [DONE]", frames[2])
+	}
+}
@@ -0,0 +1,30 @@
+package einox
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	systemFingerprintsMu sync.Mutex
+	// lastSystemFingerprints 各模型最近一次带seed的请求返回的system_fingerprint，键为"供应商:模型"
+	lastSystemFingerprints = map[string]string{}
+)
+
+// recordSystemFingerprint 记录带seed的请求返回的system_fingerprint，返回同一模型上一次记录的值
+func recordSystemFingerprint(provider, model, fingerprint string) string {
+	key := provider + ":" + model
+	systemFingerprintsMu.Lock()
+	defer systemFingerprintsMu.Unlock()
+	previous := lastSystemFingerprints[key]
+	lastSystemFingerprints[key] = fingerprint
+	return previous
+}
+
+// systemFingerprintWarning system_fingerprint变化时返回警告，说明后端配置已变化，相同seed的输出可能不同
+func systemFingerprintWarning(previous, current string) string {
+	if previous == "" || current == "" || previous == current {
+		return ""
+	}
+	return fmt.Sprintf("供应商的system_fingerprint由%s变为%s，相同seed的输出可能不可复现", previous, current)
+}
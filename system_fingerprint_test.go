@@ -0,0 +1,56 @@
+package einox
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFingerprintResult 构造带有system_fingerprint的响应
+func newFingerprintResult(model, fingerprint string) *ChatCompletionResult {
+	return &ChatCompletionResult{
+		ChatCompletionResponse: &openai.ChatCompletionResponse{Model: model, SystemFingerprint: fingerprint},
+		ResolvedConfig:         &ResolvedConfig{Provider: "azure", Model: model},
+	}
+}
+
+// 测试带seed的请求在system_fingerprint变化时给出警告
+func TestSystemFingerprintChangeWarning(t *testing.T) {
+	seed := 42
+	model := "gpt-4o-fingerprint-test"
+
+	result := newFingerprintResult(model, "fp_a")
+	result.applySystemFingerprint(&seed, true)
+	assert.Empty(t, result.Warnings, "首次请求没有可比较的值")
+
+	result = newFingerprintResult(model, "fp_a")
+	result.applySystemFingerprint(&seed, true)
+	assert.Empty(t, result.Warnings)
+
+	result = newFingerprintResult(model, "fp_b")
+	result.applySystemFingerprint(&seed, true)
+	assert.Equal(t, []string{"供应商的system_fingerprint由fp_a变为fp_b，相同seed的输出可能不可复现"}, result.Warnings)
+
+	// 未开启警告时只记录，没有seed的请求不参与比较
+	result = newFingerprintResult(model, "fp_c")
+	result.applySystemFingerprint(&seed, false)
+	assert.Empty(t, result.Warnings)
+	result = newFingerprintResult(model, "fp_d")
+	result.applySystemFingerprint(nil, true)
+	assert.Empty(t, result.Warnings)
+	assert.Equal(t, "fp_c", recordSystemFingerprint("azure", model, "fp_c"))
+}
+
+// 测试从原始响应体中读取system_fingerprint
+func TestSystemFingerprintFromRawResponse(t *testing.T) {
+	var raw rawChatResponse
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":"chatcmpl-1","system_fingerprint":"fp_44709d6fcb","choices":[]}`), &raw))
+	assert.Equal(t, "fp_44709d6fcb", raw.systemFingerprint())
+
+	var missing *rawChatResponse
+	assert.Empty(t, missing.systemFingerprint())
+	assert.Empty(t, systemFingerprintWarning("", "fp_a"))
+	assert.Empty(t, systemFingerprintWarning("fp_a", ""))
+}
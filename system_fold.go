@@ -0,0 +1,93 @@
+package einox
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// systemFoldTemplate 系统消息合并到用户消息时使用的格式，第一个参数为系统消息，第二个为原用户消息
+const systemFoldTemplate = "[系统指令]\n%s\n[/系统指令]\n\n%s"
+
+var (
+	systemFoldModelsMu sync.RWMutex
+	// systemFoldModels 不支持system角色的模型，键的匹配规则与SetModelStopDefaults相同
+	systemFoldModels = map[string]bool{}
+)
+
+// SetSystemMessageFoldModels 设置不支持system角色的模型
+// 对这些模型，系统消息会合并到第一条用户消息的开头（以[系统指令]分隔），其他模型保持不变。
+// 模型名称以 "*" 结尾时按前缀匹配
+func SetSystemMessageFoldModels(models ...string) {
+	folded := make(map[string]bool, len(models))
+	for _, model := range models {
+		folded[model] = true
+	}
+
+	systemFoldModelsMu.Lock()
+	defer systemFoldModelsMu.Unlock()
+	systemFoldModels = folded
+}
+
+// shouldFoldSystemMessages 判断模型是否需要合并系统消息
+func shouldFoldSystemMessages(model string) bool {
+	systemFoldModelsMu.RLock()
+	defer systemFoldModelsMu.RUnlock()
+	fold, _ := lookupModelSetting(systemFoldModels, model)
+	return fold
+}
+
+// foldSystemMessages 对不支持system角色的模型，将系统消息合并到第一条用户消息中
+// 多条系统消息按顺序以空行拼接；没有用户消息时，系统消息改为用户消息
+func foldSystemMessages(req ChatRequest) ChatRequest {
+	if !shouldFoldSystemMessages(req.Model) {
+		return req
+	}
+
+	var systemParts []string
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			if msg.Content != "" {
+				systemParts = append(systemParts, msg.Content)
+			}
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	if len(systemParts) == 0 {
+		return req
+	}
+	system := strings.Join(systemParts, "\n\n")
+
+	folded := false
+	for i, msg := range messages {
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if len(msg.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, 0, len(msg.MultiContent)+1)
+			parts = append(parts, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: fmt.Sprintf(systemFoldTemplate, system, ""),
+			})
+			msg.MultiContent = append(parts, msg.MultiContent...)
+		} else {
+			msg.Content = fmt.Sprintf(systemFoldTemplate, system, msg.Content)
+		}
+		messages[i] = msg
+		folded = true
+		break
+	}
+	if !folded {
+		messages = append([]openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleUser,
+			Content: fmt.Sprintf(systemFoldTemplate, system, ""),
+		}}, messages...)
+	}
+
+	req.Messages = messages
+	return req
+}
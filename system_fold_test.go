@@ -0,0 +1,61 @@
+package einox
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造包含系统消息的请求
+func newSystemFoldRequest(model string) ChatRequest {
+	return ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "你是一个翻译助手"},
+			{Role: openai.ChatMessageRoleUser, Content: "hello"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "你好"},
+			{Role: openai.ChatMessageRoleUser, Content: "world"},
+		},
+	}}
+}
+
+// 测试配置的模型会将系统消息合并到第一条用户消息
+func TestFoldSystemMessages(t *testing.T) {
+	SetSystemMessageFoldModels("gemma-*")
+	defer SetSystemMessageFoldModels()
+
+	req := newSystemFoldRequest("gemma-2b")
+	folded := foldSystemMessages(req)
+
+	if assert.Len(t, folded.Messages, 3) {
+		assert.Equal(t, openai.ChatMessageRoleUser, folded.Messages[0].Role)
+		assert.Equal(t, "[系统指令]\n你是一个翻译助手\n[/系统指令]\n\nhello", folded.Messages[0].Content)
+		assert.Equal(t, "world", folded.Messages[2].Content)
+	}
+	// 不修改调用方的消息
+	assert.Len(t, req.Messages, 4)
+	assert.Equal(t, "hello", req.Messages[1].Content)
+}
+
+// 测试没有用户消息时系统消息转为用户消息
+func TestFoldSystemMessagesWithoutUser(t *testing.T) {
+	SetSystemMessageFoldModels("gemma-2b")
+	defer SetSystemMessageFoldModels()
+
+	req := ChatRequest{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Model:    "gemma-2b",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "只回答是或否"}},
+	}}
+	folded := foldSystemMessages(req)
+	if assert.Len(t, folded.Messages, 1) {
+		assert.Equal(t, openai.ChatMessageRoleUser, folded.Messages[0].Role)
+		assert.Contains(t, folded.Messages[0].Content, "只回答是或否")
+	}
+}
+
+// 测试默认保持系统消息不变
+func TestFoldSystemMessagesDefault(t *testing.T) {
+	req := newSystemFoldRequest("gpt-4o")
+	assert.Equal(t, req, foldSystemMessages(req))
+}
@@ -0,0 +1,93 @@
+package einox
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// CredentialTLS 凭证级别的TLS配置
+// 用于TLS拦截代理或私有端点场景下的自定义根证书和客户端证书
+type CredentialTLS struct {
+	CACertFile     string `yaml:"ca_cert_file"`     // 自定义CA证书文件(PEM)，会追加到系统根证书之后
+	ClientCertFile string `yaml:"client_cert_file"` // 客户端证书文件(PEM)，需与ClientKeyFile同时配置
+	ClientKeyFile  string `yaml:"client_key_file"`  // 客户端私钥文件(PEM)
+}
+
+// IsEmpty 判断是否未配置任何TLS选项
+func (t CredentialTLS) IsEmpty() bool {
+	return t.CACertFile == "" && t.ClientCertFile == "" && t.ClientKeyFile == ""
+}
+
+// Validate 校验证书文件是否存在且可以解析
+func (t CredentialTLS) Validate() error {
+	_, err := t.buildTLSConfig()
+	return err
+}
+
+// buildTLSConfig 根据配置构建tls.Config，未配置时返回nil
+func (t CredentialTLS) buildTLSConfig() (*tls.Config, error) {
+	if t.IsEmpty() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if t.CACertFile != "" {
+		caPEM, err := os.ReadFile(t.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书文件失败: %v", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA证书文件 %s 中没有有效的PEM证书", t.CACertFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		if t.ClientCertFile == "" || t.ClientKeyFile == "" {
+			return nil, fmt.Errorf("客户端证书和私钥必须同时配置")
+		}
+		cert, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// newCredentialTransport 根据凭证的代理和TLS配置创建Transport
+// 两者都未配置时返回nil，表示使用默认Transport
+func newCredentialTransport(proxy string, tlsConf CredentialTLS) (*http.Transport, error) {
+	if proxy == "" && tlsConf.IsEmpty() {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("解析代理地址失败: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := tlsConf.buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
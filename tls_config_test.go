@@ -0,0 +1,100 @@
+package einox
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试使用自定义CA构建的Transport可以访问自签名证书的服务
+func TestNewCredentialTransportCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// 将测试服务的自签名证书写入CA文件
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, caPEM, 0644))
+
+	tlsConf := CredentialTLS{CACertFile: caFile}
+	assert.NoError(t, tlsConf.Validate())
+
+	transport, err := newCredentialTransport("", tlsConf)
+	assert.NoError(t, err)
+	if assert.NotNil(t, transport) && assert.NotNil(t, transport.TLSClientConfig) {
+		assert.NotNil(t, transport.TLSClientConfig.RootCAs, "应设置自定义根证书")
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if assert.NoError(t, err, "使用自定义CA应能通过证书校验") {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "ok", string(body))
+	}
+
+	// 未配置自定义CA时证书校验失败
+	_, err = (&http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}).Get(server.URL)
+	assert.Error(t, err)
+}
+
+// 测试无效的TLS配置
+func TestCredentialTLSValidate(t *testing.T) {
+	dir := t.TempDir()
+	invalidCA := filepath.Join(dir, "invalid.pem")
+	assert.NoError(t, os.WriteFile(invalidCA, []byte("not a certificate"), 0644))
+
+	assert.NoError(t, CredentialTLS{}.Validate(), "未配置时不应报错")
+	assert.Error(t, CredentialTLS{CACertFile: filepath.Join(dir, "missing.pem")}.Validate())
+	assert.Error(t, CredentialTLS{CACertFile: invalidCA}.Validate())
+	assert.Error(t, CredentialTLS{ClientCertFile: invalidCA}.Validate(), "客户端证书和私钥必须同时配置")
+
+	// 未配置代理和TLS时使用默认Transport
+	transport, err := newCredentialTransport("", CredentialTLS{})
+	assert.NoError(t, err)
+	assert.Nil(t, transport)
+}
+
+// 测试请求时只校验选中凭证的TLS配置，其他凭证的证书文件无效不影响请求
+func TestGetQwenConfigValidatesSelectedCredentialTLS(t *testing.T) {
+	t.Setenv(RSAKeysEnvVar, t.TempDir())
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+	ENV = "development"
+
+	encryptFunc, _, err := InitRSAKeyManagerForEnv(ENV)
+	assert.NoError(t, err)
+	cipher, err := encryptFunc("sk-qwen")
+	assert.NoError(t, err)
+
+	configContent := fmt.Sprintf(`
+environments:
+  development:
+    credentials:
+      - name: healthy
+        api_key: %[1]s
+        enabled: true
+      - name: broken
+        api_key: %[1]s
+        enabled: true
+        ca_cert_file: %[2]s
+`, cipher, filepath.Join(configDir, "missing.pem"))
+	assert.NoError(t, os.WriteFile(filepath.Join(configDir, "qwen.yaml"), []byte(configContent), 0644))
+
+	_, err = (&Config{Vendor: "qwen", Model: "qwen-max", CredentialName: "healthy"}).getQwenConfig()
+	assert.NoError(t, err)
+
+	_, err = (&Config{Vendor: "qwen", Model: "qwen-max", CredentialName: "broken"}).getQwenConfig()
+	assert.ErrorContains(t, err, "凭证 broken 的TLS配置无效")
+}
@@ -0,0 +1,148 @@
+package einox
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// openAITokensPerMessage OpenAI聊天格式中每条消息的固定开销（角色和分隔符）
+	openAITokensPerMessage = 3
+	// openAITokensPerName 消息带有name时的额外开销
+	openAITokensPerName = 1
+	// openAIReplyPrimingTokens 每次回复前的固定开销（<|start|>assistant<|message|>）
+	openAIReplyPrimingTokens = 3
+	// imagePartTokens 图片按OpenAI低细节图片的固定token数估算
+	imagePartTokens = 85
+)
+
+// Tokenizer 计算文本的token数
+// 库本身不内置BPE词表，可将tiktoken等分词器包装后通过RegisterTokenizer注册以获得精确结果
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc 将函数适配为Tokenizer
+type TokenizerFunc func(text string) int
+
+// CountTokens 实现Tokenizer
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+var (
+	tokenizersMu sync.RWMutex
+	// tokenizers 模型的分词器，键的匹配规则与SetModelStopDefaults相同
+	tokenizers = map[string]Tokenizer{}
+)
+
+// RegisterTokenizer 为模型注册分词器，tokenizer为nil时取消注册
+// 模型名称以 "*" 结尾时按前缀匹配（如 "gpt-4o*"）；未注册分词器的模型按字符数近似估算
+func RegisterTokenizer(model string, tokenizer Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if tokenizer == nil {
+		delete(tokenizers, model)
+		return
+	}
+	tokenizers[model] = tokenizer
+}
+
+// lookupTokenizer 查找模型的分词器，未注册时返回近似估算的分词器
+func lookupTokenizer(model string) (Tokenizer, bool) {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	if tokenizer, ok := lookupModelSetting(tokenizers, model); ok {
+		return tokenizer, true
+	}
+	return TokenizerFunc(estimateTokens), false
+}
+
+// TokenCount 请求的token数统计
+type TokenCount struct {
+	Total     int   `json:"total"`     // 总token数，包含消息、工具定义和固定开销
+	Messages  []int `json:"messages"`  // 每条消息的token数，下标与请求的Messages一致
+	Tools     int   `json:"tools"`     // 工具定义的token数
+	Estimated bool  `json:"estimated"` // 是否为近似估算（模型没有注册分词器）
+}
+
+// CountTokens 在发送前计算请求的输入token数，用于估算费用或避免超出上下文窗口
+// 使用为模型注册的分词器，未注册时按字符数近似估算（Claude等没有公开分词器的模型只能近似）
+func CountTokens(req ChatRequest) (int, error) {
+	count, err := CountTokensDetailed(req)
+	if err != nil {
+		return 0, err
+	}
+	return count.Total, nil
+}
+
+// CountTokensDetailed 与CountTokens相同，同时返回每条消息和工具定义的token数，便于调用方裁剪历史消息
+func CountTokensDetailed(req ChatRequest) (*TokenCount, error) {
+	model := normalizeModelName(req.Model)
+	if model == "" {
+		return nil, ErrModelNotSpecified
+	}
+	tokenizer, exact := lookupTokenizer(model)
+
+	count := &TokenCount{
+		Messages:  make([]int, len(req.Messages)),
+		Estimated: !exact,
+	}
+	for i, msg := range req.Messages {
+		tokens, err := countMessageTokens(tokenizer, msg)
+		if err != nil {
+			return nil, fmt.Errorf("计算第%d条消息的token数失败: %w", i+1, err)
+		}
+		count.Messages[i] = tokens
+		count.Total += tokens
+	}
+
+	if len(req.Tools) > 0 {
+		tools, err := json.Marshal(req.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("序列化工具定义失败: %w", err)
+		}
+		count.Tools = tokenizer.CountTokens(string(tools))
+		count.Total += count.Tools
+	}
+
+	count.Total += openAIReplyPrimingTokens
+	return count, nil
+}
+
+// countMessageTokens 计算单条消息的token数，包含角色、name、内容、工具调用和固定开销
+func countMessageTokens(tokenizer Tokenizer, msg openai.ChatCompletionMessage) (int, error) {
+	tokens := openAITokensPerMessage + tokenizer.CountTokens(normalizeMessageRole(msg))
+	if msg.Name != "" {
+		tokens += openAITokensPerName + tokenizer.CountTokens(msg.Name)
+	}
+
+	tokens += tokenizer.CountTokens(msg.Content)
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			tokens += tokenizer.CountTokens(part.Text)
+		case openai.ChatMessagePartTypeImageURL:
+			tokens += imagePartTokens
+		default:
+			// 音频、文件等按序列化后的内容近似估算
+			data, err := json.Marshal(part)
+			if err != nil {
+				return 0, err
+			}
+			tokens += tokenizer.CountTokens(string(data))
+		}
+	}
+
+	for _, call := range msg.ToolCalls {
+		tokens += tokenizer.CountTokens(strings.Join([]string{call.ID, call.Function.Name, call.Function.Arguments}, " "))
+	}
+	if msg.ToolCallID != "" {
+		tokens += tokenizer.CountTokens(msg.ToolCallID)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,85 @@
+package einox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试按注册的分词器计算每条消息和工具定义的token数
+func TestCountTokensWithTokenizer(t *testing.T) {
+	// 按空格分词的测试分词器
+	RegisterTokenizer("gpt-4o*", TokenizerFunc(func(text string) int { return len(strings.Fields(text)) }))
+	t.Cleanup(func() { RegisterTokenizer("gpt-4o*", nil) })
+
+	req := ChatRequest{}
+	req.Model = "gpt-4o-mini"
+	req.Messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "you are helpful"},
+		{Role: openai.ChatMessageRoleUser, Name: "alice", MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "what is this"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png"}},
+		}},
+	}
+	req.Tools = []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get_weather"}}}
+
+	count, err := CountTokensDetailed(req)
+	if assert.NoError(t, err) {
+		assert.False(t, count.Estimated)
+		// 3(固定开销) + 1(角色) + 3(内容)
+		assert.Equal(t, 7, count.Messages[0])
+		// 3(固定开销) + 1(角色) + 1+1(name) + 3(文本) + 85(图片)
+		assert.Equal(t, 94, count.Messages[1])
+		assert.Equal(t, 1, count.Tools)
+		assert.Equal(t, 7+94+1+openAIReplyPrimingTokens, count.Total)
+	}
+
+	total, err := CountTokens(req)
+	assert.NoError(t, err)
+	assert.Equal(t, count.Total, total)
+}
+
+// 测试未注册分词器的模型按字符数近似估算
+func TestCountTokensEstimated(t *testing.T) {
+	req := ChatRequest{}
+	req.Model = "claude-3-5-sonnet"
+	req.Messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "北京天气如何"},
+		{
+			Role: openai.ChatMessageRoleAssistant,
+			ToolCalls: []openai.ToolCall{{
+				ID:       "call_1",
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`},
+			}},
+		},
+		{ToolCallID: "call_1", Content: "晴"},
+	}
+
+	count, err := CountTokensDetailed(req)
+	if assert.NoError(t, err) {
+		assert.True(t, count.Estimated)
+		assert.Len(t, count.Messages, 3)
+		// 3(固定开销) + 1(角色"user") + 6(中文每字1个)
+		assert.Equal(t, 10, count.Messages[0])
+		assert.Greater(t, count.Messages[1], openAITokensPerMessage+1)
+		assert.Greater(t, count.Messages[2], openAITokensPerMessage+1, "只设置了ToolCallID的消息按工具消息计算")
+		assert.Zero(t, count.Tools)
+	}
+
+	// 历史越长token数越多，便于调用方裁剪
+	longer := req
+	longer.Messages = append(append([]openai.ChatCompletionMessage(nil), req.Messages...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: strings.Repeat("hello ", 100)})
+	short, _ := CountTokens(req)
+	long, _ := CountTokens(longer)
+	assert.Greater(t, long, short+100)
+}
+
+// 测试未指定模型时返回错误
+func TestCountTokensRequiresModel(t *testing.T) {
+	_, err := CountTokens(ChatRequest{})
+	assert.ErrorIs(t, err, ErrModelNotSpecified)
+}
@@ -395,59 +395,80 @@ func InitRSAKeyManager() (
 	decryptFunc func(string) (string, error),
 	err error) {
 
+	// 设置了外部密钥来源时不读写密钥目录，见SetRSAKeyProvider
+	if provider, _ := activeRSAKeyProvider(); provider != nil {
+		return initRSAKeyManagerFromProvider(provider, "")
+	}
+
 	//InitializationSettings()
 	//初始化设置
 	InitializationSettings()
 
-	// 确保使用绝对路径
-	privateKeyPath := DefaultPrivateKeyPath
-	publicKeyPath := DefaultPublicKeyPath
+	return initRSAKeyManagerInDir(DefaultRSAKeysDir)
+}
 
-	// 检查公钥和私钥文件是否都存在
-	privateKeyExists := true
-	publicKeyExists := true
+// RSAKeysDirForEnv 返回指定环境使用的RSA密钥目录
+// 若 <密钥目录>/<env> 子目录存在，则该环境使用独立的密钥对，
+// 否则回退到共享的默认密钥目录，以兼容未区分环境的旧部署
+func RSAKeysDirForEnv(env string) string {
+	InitializationSettings()
 
-	if _, err := os.Stat(privateKeyPath); os.IsNotExist(err) {
-		privateKeyExists = false
+	if env != "" {
+		envDir := filepath.Join(DefaultRSAKeysDir, env)
+		if info, err := os.Stat(envDir); err == nil && info.IsDir() {
+			return envDir
+		}
 	}
+	return DefaultRSAKeysDir
+}
+
+// InitRSAKeyManagerForEnv 按环境初始化RSA密钥管理器
+// 不同环境（如staging和production）使用各自目录下的密钥对，
+// 避免某一环境的私钥泄露后可以解密其他环境的凭证；设置了外部密钥来源时使用其提供的密钥，见SetRSAKeyProvider
+func InitRSAKeyManagerForEnv(env string) (
+	encryptFunc func(string) (string, error),
+	decryptFunc func(string) (string, error),
+	err error) {
 
-	if _, err := os.Stat(publicKeyPath); os.IsNotExist(err) {
-		publicKeyExists = false
+	if provider, _ := activeRSAKeyProvider(); provider != nil {
+		return initRSAKeyManagerFromProvider(provider, env)
 	}
+	return initRSAKeyManagerInDir(RSAKeysDirForEnv(env))
+}
 
-	var keyPair *RSAKeyPair
+// initRSAKeyManagerInDir 从指定目录加载所有版本的RSA密钥对，目录中没有任何密钥时生成并保存
+// 返回的加密函数使用最新版本的密钥，解密函数根据密文中的版本号选择密钥，见RotateRSAKey
+func initRSAKeyManagerInDir(keysDir string) (
+	encryptFunc func(string) (string, error),
+	decryptFunc func(string) (string, error),
+	err error) {
 
-	// 如果任一密钥文件不存在，则生成新的密钥对
-	if !privateKeyExists || !publicKeyExists {
+	keyIDs, err := listRSAKeyIDs(keysDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 如果目录中没有任何密钥对，则生成新的密钥对
+	if len(keyIDs) == 0 {
 		// 确保目录存在
-		if err := os.MkdirAll(DefaultRSAKeysDir, 0755); err != nil {
+		if err := os.MkdirAll(keysDir, 0755); err != nil {
 			return nil, nil, fmt.Errorf("创建密钥目录失败: %v", err)
 		}
 
-		// 生成新的RSA密钥对
-		keyPair, err = GenerateRSAKeyPair()
-		if err != nil {
+		// 生成新的RSA密钥对并保存到文件
+		privateKeyPath, publicKeyPath := rsaKeyPaths(keysDir, legacyRSAKeyID)
+		if err := GenerateAndSaveRSAKeyPair(privateKeyPath, publicKeyPath); err != nil {
 			return nil, nil, fmt.Errorf("生成RSA密钥对失败: %v", err)
 		}
+	}
 
-		// 保存到文件
-		err = SaveRSAKeyPair(keyPair, privateKeyPath, publicKeyPath)
-		if err != nil {
-			return nil, nil, fmt.Errorf("保存RSA密钥对失败: %v", err)
-		}
-	} else {
-		// 如果密钥文件已存在，则加载它们
-		keyPair, err = LoadRSAKeyPair(privateKeyPath, publicKeyPath)
-		if err != nil {
-			return nil, nil, fmt.Errorf("加载RSA密钥对失败: %v", err)
-		}
+	ring, err := loadRSAKeyRing(keysDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("加载RSA密钥对失败: %v", err)
 	}
 
 	// 创建加密和解密函数
-	encryptFunc = SetRSAEncryptFunc(keyPair.PublicKey)
-	decryptFunc = SetRSADecryptFunc(keyPair.PrivateKey)
-
-	return encryptFunc, decryptFunc, nil
+	return ring.encrypt, ring.decrypt, nil
 }
 
 // InitRSAKeyManagerWithEncryption 初始化RSA密钥管理器并立即加密指定的数据
@@ -470,7 +491,7 @@ func InitRSAKeyManagerWithEncryption(dataToEncrypt string) (
 		return "", nil, fmt.Errorf("加密数据失败: %v", err)
 	}
 
-	fmt.Printf("密钥文件应该存储在: 私钥=%s, 公钥=%s\n", DefaultPrivateKeyPath, DefaultPublicKeyPath)
+	getLogger().Debug("密钥文件存储位置", "private_key", DefaultPrivateKeyPath, "public_key", DefaultPublicKeyPath)
 
 	return encryptedData, decryptFunc, nil
 }
@@ -499,19 +520,7 @@ func InitRSAKeyManagerWithDecryption(encryptedData string) (
 }
 
 // EncryptKey 从命令行加密字符串
-// 用于命令行工具调用，加密给定的key
+// 用于命令行工具调用，使用密钥目录下的共享密钥对加密给定的key，见EncryptSecretForEnv
 func EncryptKey(key string) (string, error) {
-	// 初始化RSA密钥管理器
-	encryptFunc, _, err := InitRSAKeyManager()
-	if err != nil {
-		return "", fmt.Errorf("初始化RSA密钥管理器失败: %v", err)
-	}
-
-	// 使用加密函数加密数据
-	encryptedKey, err := encryptFunc(key)
-	if err != nil {
-		return "", fmt.Errorf("加密key失败: %v", err)
-	}
-
-	return encryptedKey, nil
+	return EncryptSecretForEnv("", key)
 }
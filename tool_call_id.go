@@ -0,0 +1,61 @@
+package einox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// syntheticToolCallID 为缺少ID的工具调用生成稳定的ID
+// 同一响应中同一位置的工具调用总是得到相同的ID，格式为 call_<供应商>_<哈希>
+func syntheticToolCallID(provider, responseID string, index int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", provider, responseID, index)))
+	return fmt.Sprintf("call_%s_%s", provider, hex.EncodeToString(sum[:])[:16])
+}
+
+// ensureToolCallIDs 为非流式响应中缺少ID的工具调用补充ID
+// 供应商偶尔返回没有ID的工具调用，导致下一轮无法用ToolCallID对应工具结果
+func ensureToolCallIDs(provider, responseID string, toolCalls []openai.ToolCall) {
+	for i := range toolCalls {
+		if toolCalls[i].ID == "" {
+			toolCalls[i].ID = syntheticToolCallID(provider, responseID, i)
+		}
+	}
+}
+
+// streamToolCallIDs 为流式响应中缺少ID的工具调用补充ID
+// 流式响应中只有每个工具调用的第一个增量携带ID，后续增量的ID为空属于正常情况，
+// 因此只在某个下标第一次出现且没有ID时补充
+type streamToolCallIDs struct {
+	provider   string
+	responseID string
+	seen       map[int]bool
+}
+
+func newStreamToolCallIDs(provider, responseID string) *streamToolCallIDs {
+	return &streamToolCallIDs{provider: provider, responseID: responseID, seen: map[int]bool{}}
+}
+
+// fill 补充增量中缺少的ID
+func (s *streamToolCallIDs) fill(toolCalls []openai.ToolCall) {
+	for i := range toolCalls {
+		index := i
+		if toolCalls[i].Index != nil {
+			index = *toolCalls[i].Index
+		}
+		if s.seen[index] {
+			continue
+		}
+		s.seen[index] = true
+		if toolCalls[i].ID == "" {
+			toolCalls[i].ID = syntheticToolCallID(s.provider, s.responseID, index)
+		}
+	}
+}
+
+// hasToolCalls 返回流中是否已出现过工具调用
+func (s *streamToolCallIDs) hasToolCalls() bool {
+	return len(s.seen) > 0
+}
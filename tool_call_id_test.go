@@ -0,0 +1,55 @@
+package einox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试非流式响应中空ID的工具调用会得到稳定的合成ID
+func TestEnsureToolCallIDs(t *testing.T) {
+	newCalls := func() []openai.ToolCall {
+		return []openai.ToolCall{
+			{ID: "call_original", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather"}},
+			{ID: "", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_time"}},
+		}
+	}
+
+	calls := newCalls()
+	ensureToolCallIDs("azure", "azure-123", calls)
+	assert.Equal(t, "call_original", calls[0].ID, "已有ID不应被修改")
+	assert.True(t, strings.HasPrefix(calls[1].ID, "call_azure_"))
+
+	// 同一响应重复处理得到相同的ID
+	again := newCalls()
+	ensureToolCallIDs("azure", "azure-123", again)
+	assert.Equal(t, calls[1].ID, again[1].ID)
+
+	// 不同响应得到不同的ID
+	other := newCalls()
+	ensureToolCallIDs("azure", "azure-456", other)
+	assert.NotEqual(t, calls[1].ID, other[1].ID)
+}
+
+// 测试流式响应只为每个工具调用的第一个增量补充ID
+func TestStreamToolCallIDs(t *testing.T) {
+	ids := newStreamToolCallIDs("azure", "azure-stream-1")
+	index := 0
+
+	first := []openai.ToolCall{{Index: &index, Function: openai.FunctionCall{Name: "get_weather"}}}
+	ids.fill(first)
+	assert.Equal(t, syntheticToolCallID("azure", "azure-stream-1", 0), first[0].ID)
+
+	// 后续增量只携带参数片段，ID保持为空
+	next := []openai.ToolCall{{Index: &index, Function: openai.FunctionCall{Arguments: `{"city":`}}}
+	ids.fill(next)
+	assert.Empty(t, next[0].ID)
+
+	// 累积后的工具调用使用第一个增量补充的ID
+	acc := newStreamAccumulator()
+	acc.add(&openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{ToolCalls: first}}}})
+	acc.add(&openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{ToolCalls: next}}}})
+	assert.Equal(t, first[0].ID, acc.partialToolCalls()[0].ID)
+}
@@ -0,0 +1,110 @@
+package einox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ToolOutputHandling 工具结果不符合输出结构时的处理方式
+type ToolOutputHandling string
+
+const (
+	// ToolOutputHandlingError 默认方式：返回 *ToolOutputError，不发送请求
+	ToolOutputHandlingError ToolOutputHandling = "error"
+	// ToolOutputHandlingCorrect 将工具结果替换为说明校验失败的纠正消息，由模型决定如何处理
+	ToolOutputHandlingCorrect ToolOutputHandling = "correct"
+)
+
+// toolOutputCorrectionTemplate 纠正消息的格式，参数依次为工具名称、校验错误、原始结果
+const toolOutputCorrectionTemplate = "工具 %s 的返回结果不符合其输出结构定义: %v\n原始结果: %s"
+
+// ToolOutputError 工具结果不符合输出结构时返回的错误
+type ToolOutputError struct {
+	ToolName   string // 工具名称
+	ToolCallID string // 工具调用ID
+	Err        error  // 校验错误
+}
+
+func (e *ToolOutputError) Error() string {
+	return fmt.Sprintf("工具 %s (ToolCallID=%s) 的返回结果不符合输出结构定义: %v", e.ToolName, e.ToolCallID, e.Err)
+}
+
+func (e *ToolOutputError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	toolOutputSchemasMu sync.RWMutex
+	// toolOutputSchemas 工具的输出结构，键为工具名称
+	toolOutputSchemas = map[string]*openapi3.Schema{}
+)
+
+// RegisterToolOutputSchema 为工具注册输出结构
+// 注册后，请求中该工具的结果（Role为tool的消息）会在发送前按结构校验，schema为nil时取消注册
+func RegisterToolOutputSchema(toolName string, schema *openapi3.Schema) {
+	toolOutputSchemasMu.Lock()
+	defer toolOutputSchemasMu.Unlock()
+	if schema == nil {
+		delete(toolOutputSchemas, toolName)
+		return
+	}
+	toolOutputSchemas[toolName] = schema
+}
+
+// getToolOutputSchema 获取工具的输出结构
+func getToolOutputSchema(toolName string) *openapi3.Schema {
+	toolOutputSchemasMu.RLock()
+	defer toolOutputSchemasMu.RUnlock()
+	return toolOutputSchemas[toolName]
+}
+
+// validateToolOutputs 按注册的输出结构校验请求中的工具结果
+// 工具结果按ToolCallID对应到前面助手消息中的工具调用以确定工具名称，未注册结构的工具不校验
+func validateToolOutputs(req ChatRequest) (ChatRequest, error) {
+	toolNames := make(map[string]string)
+	var messages []openai.ChatCompletionMessage
+	for i, msg := range req.Messages {
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+		}
+		if normalizeMessageRole(msg) != openai.ChatMessageRoleTool {
+			continue
+		}
+
+		toolName := toolNames[msg.ToolCallID]
+		schema := getToolOutputSchema(toolName)
+		if schema == nil {
+			continue
+		}
+		err := validateToolOutput(schema, msg.Content)
+		if err == nil {
+			continue
+		}
+		if req.ToolOutputHandling != ToolOutputHandlingCorrect {
+			return req, &ToolOutputError{ToolName: toolName, ToolCallID: msg.ToolCallID, Err: err}
+		}
+
+		// 复制消息列表，避免修改调用方的请求
+		if messages == nil {
+			messages = append([]openai.ChatCompletionMessage(nil), req.Messages...)
+		}
+		messages[i].Content = fmt.Sprintf(toolOutputCorrectionTemplate, toolName, err, msg.Content)
+	}
+	if messages != nil {
+		req.Messages = messages
+	}
+	return req, nil
+}
+
+// validateToolOutput 校验单个工具结果，结果必须是符合结构的JSON
+func validateToolOutput(schema *openapi3.Schema, content string) error {
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("结果不是有效的JSON: %w", err)
+	}
+	return schema.VisitJSON(value)
+}
@@ -0,0 +1,86 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 注册get_weather的输出结构，测试结束后取消注册
+func registerWeatherOutputSchema(t *testing.T) {
+	schema := openapi3.NewObjectSchema()
+	schema.Properties["city"] = openapi3.NewSchemaRef("", &openapi3.Schema{Type: openapi3.TypeString})
+	schema.Properties["temperature"] = openapi3.NewSchemaRef("", &openapi3.Schema{Type: openapi3.TypeNumber})
+	schema.Required = []string{"city", "temperature"}
+	RegisterToolOutputSchema("get_weather", schema)
+	t.Cleanup(func() { RegisterToolOutputSchema("get_weather", nil) })
+}
+
+// 构造包含工具结果的请求
+func newToolOutputRequest(result string) ChatRequest {
+	return ChatRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "北京天气如何"},
+				{
+					Role: openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{{
+						ID:       "call_1",
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`},
+					}},
+				},
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: result},
+			},
+		},
+	}
+}
+
+// 测试符合结构的工具结果保持不变
+func TestValidateToolOutputsValid(t *testing.T) {
+	registerWeatherOutputSchema(t)
+
+	req := newToolOutputRequest(`{"city":"北京","temperature":25}`)
+	validated, err := validateToolOutputs(req)
+	assert.NoError(t, err)
+	assert.Equal(t, req.Messages, validated.Messages)
+}
+
+// 测试不符合结构的工具结果默认返回错误
+func TestValidateToolOutputsInvalid(t *testing.T) {
+	registerWeatherOutputSchema(t)
+
+	for _, result := range []string{`{"city":"北京"}`, `{"city":"北京","temperature":"25度"}`, `晴，25度`} {
+		_, err := validateToolOutputs(newToolOutputRequest(result))
+		var outputErr *ToolOutputError
+		if assert.True(t, errors.As(err, &outputErr), result) {
+			assert.Equal(t, "get_weather", outputErr.ToolName)
+			assert.Equal(t, "call_1", outputErr.ToolCallID)
+		}
+	}
+}
+
+// 测试纠正模式下工具结果被替换为纠正消息
+func TestValidateToolOutputsCorrect(t *testing.T) {
+	registerWeatherOutputSchema(t)
+
+	req := newToolOutputRequest(`{"city":"北京"}`)
+	req.ToolOutputHandling = ToolOutputHandlingCorrect
+	validated, err := validateToolOutputs(req)
+	assert.NoError(t, err)
+
+	content := validated.Messages[2].Content
+	assert.Contains(t, content, "工具 get_weather 的返回结果不符合其输出结构定义")
+	assert.Contains(t, content, `原始结果: {"city":"北京"}`)
+	assert.Equal(t, `{"city":"北京"}`, req.Messages[2].Content, "不应修改调用方的请求")
+}
+
+// 测试未注册结构的工具不校验
+func TestValidateToolOutputsUnregistered(t *testing.T) {
+	_, err := validateToolOutputs(newToolOutputRequest("晴，25度"))
+	assert.NoError(t, err)
+}
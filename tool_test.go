@@ -401,3 +401,119 @@ func TestInitRSAKeyManagerWithDecryption(t *testing.T) {
 		t.Errorf("解密后的数据与原数据不匹配\n原数据: %s\n解密后: %s", testData, newDecryptedData)
 	}
 }
+
+func TestInitRSAKeyManagerForEnv(t *testing.T) {
+	// 使用临时目录作为密钥根目录，并为两个环境分别创建独立子目录
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+	for _, env := range []string{"staging", "production"} {
+		if err := os.MkdirAll(filepath.Join(keysDir, env), 0755); err != nil {
+			t.Fatalf("创建环境密钥目录失败: %v", err)
+		}
+	}
+
+	// 不同环境应解析到各自的密钥目录，未配置的环境回退到共享目录
+	if dir := RSAKeysDirForEnv("staging"); dir != filepath.Join(keysDir, "staging") {
+		t.Errorf("staging环境密钥目录错误: %s", dir)
+	}
+	if dir := RSAKeysDirForEnv("development"); dir != keysDir {
+		t.Errorf("未配置独立密钥的环境应回退到共享目录，实际: %s", dir)
+	}
+
+	stagingEncrypt, stagingDecrypt, err := InitRSAKeyManagerForEnv("staging")
+	if err != nil {
+		t.Fatalf("初始化staging密钥管理器失败: %v", err)
+	}
+	prodEncrypt, prodDecrypt, err := InitRSAKeyManagerForEnv("production")
+	if err != nil {
+		t.Fatalf("初始化production密钥管理器失败: %v", err)
+	}
+
+	testData := "sk-per-env-secret"
+
+	// 同环境加解密正常
+	stagingCipher, err := stagingEncrypt(testData)
+	if err != nil {
+		t.Fatalf("staging加密失败: %v", err)
+	}
+	decrypted, err := stagingDecrypt(stagingCipher)
+	if err != nil || decrypted != testData {
+		t.Fatalf("staging解密失败: %v, 结果: %s", err, decrypted)
+	}
+
+	// 交叉解密必须失败
+	if _, err := prodDecrypt(stagingCipher); err == nil {
+		t.Error("production密钥不应能解密staging的数据")
+	}
+	prodCipher, err := prodEncrypt(testData)
+	if err != nil {
+		t.Fatalf("production加密失败: %v", err)
+	}
+	if _, err := stagingDecrypt(prodCipher); err == nil {
+		t.Error("staging密钥不应能解密production的数据")
+	}
+}
+
+func TestGetAzureConfigPerEnvKeys(t *testing.T) {
+	keysDir := t.TempDir()
+	t.Setenv(RSAKeysEnvVar, keysDir)
+	configDir := t.TempDir()
+	t.Setenv("LLM_CONFIG_PATH", configDir)
+
+	originalEnv := ENV
+	defer func() { ENV = originalEnv }()
+
+	// 为两个环境生成独立密钥，并各自加密凭证
+	ciphers := map[string]string{}
+	for _, env := range []string{"staging", "production"} {
+		if err := os.MkdirAll(filepath.Join(keysDir, env), 0755); err != nil {
+			t.Fatalf("创建环境密钥目录失败: %v", err)
+		}
+		encryptFunc, _, err := InitRSAKeyManagerForEnv(env)
+		if err != nil {
+			t.Fatalf("初始化%s密钥管理器失败: %v", env, err)
+		}
+		ciphers[env], err = encryptFunc("key-" + env)
+		if err != nil {
+			t.Fatalf("%s加密失败: %v", env, err)
+		}
+	}
+
+	// production环境误用了staging密钥加密的凭证
+	configContent := fmt.Sprintf(`
+environments:
+  staging:
+    credentials:
+      - name: staging
+        api_key: %s
+        endpoint: https://staging.example.com
+        enabled: true
+        weight: 1
+  production:
+    credentials:
+      - name: production
+        api_key: %s
+        endpoint: https://production.example.com
+        enabled: true
+        weight: 1
+`, ciphers["staging"], ciphers["staging"])
+	if err := os.WriteFile(filepath.Join(configDir, "azure.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	// staging环境使用自己的密钥解密成功
+	ENV = "staging"
+	conf, err := (&Config{}).getAzureConfig()
+	if err != nil {
+		t.Fatalf("staging环境获取配置失败: %v", err)
+	}
+	if conf.APIKey != "key-staging" {
+		t.Errorf("staging环境解密结果错误: %s", conf.APIKey)
+	}
+
+	// production环境无法解密staging密钥加密的凭证
+	ENV = "production"
+	if _, err := (&Config{}).getAzureConfig(); err == nil {
+		t.Error("production环境不应能解密staging密钥加密的凭证")
+	}
+}
@@ -0,0 +1,52 @@
+package einox
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrUnsupportedToolType 严格模式下遇到非function类型的工具或工具调用时返回
+var ErrUnsupportedToolType = errors.New("不支持的工具类型")
+
+// ToolTypePolicy 遇到非function类型的工具时的处理方式
+type ToolTypePolicy string
+
+const (
+	// ToolTypePolicyLenient 按function类型处理并打印警告（默认）
+	ToolTypePolicyLenient ToolTypePolicy = "lenient"
+	// ToolTypePolicyStrict 返回ErrUnsupportedToolType
+	ToolTypePolicyStrict ToolTypePolicy = "strict"
+)
+
+// toolTypeStrict 是否使用严格模式，默认宽松模式
+var toolTypeStrict atomic.Bool
+
+// SetToolTypePolicy 设置非function类型工具的处理方式
+func SetToolTypePolicy(policy ToolTypePolicy) error {
+	switch policy {
+	case ToolTypePolicyLenient:
+		toolTypeStrict.Store(false)
+	case ToolTypePolicyStrict:
+		toolTypeStrict.Store(true)
+	default:
+		return fmt.Errorf("未知的工具类型处理方式: %s", policy)
+	}
+	return nil
+}
+
+// resolveToolType 统一判断工具类型，返回转换后应使用的类型
+// 空类型视为function；其他非function类型在严格模式下返回错误，宽松模式下按function处理并打印警告。
+// subject用于日志和错误信息，描述是哪个工具或工具调用
+func resolveToolType(toolType, subject string) (openai.ToolType, error) {
+	if toolType == "" || toolType == string(openai.ToolTypeFunction) {
+		return openai.ToolTypeFunction, nil
+	}
+	if toolTypeStrict.Load() {
+		return "", fmt.Errorf("%w: %s(%s)", ErrUnsupportedToolType, toolType, subject)
+	}
+	getLogger().Warn("未知的工具类型，按function处理", "type", toolType, "subject", subject)
+	return openai.ToolTypeFunction, nil
+}
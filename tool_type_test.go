@@ -0,0 +1,62 @@
+package einox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 构造一个非function类型的工具定义
+func newCodeInterpreterTool() openai.Tool {
+	return openai.Tool{
+		Type:     openai.ToolType("code_interpreter"),
+		Function: &openai.FunctionDefinition{Name: "run_code", Description: "执行代码"},
+	}
+}
+
+// 测试宽松模式下非function类型按function处理
+func TestUnknownToolTypeLenient(t *testing.T) {
+	assert.NoError(t, SetToolTypePolicy(ToolTypePolicyLenient))
+
+	tools, err := convertOpenAIToolsToSchemaTools([]openai.Tool{newCodeInterpreterTool()})
+	assert.NoError(t, err)
+	if assert.Len(t, tools, 1) {
+		assert.Equal(t, "run_code", tools[0].Name)
+	}
+
+	calls, err := convertSchemaToolCallsToOpenAI([]schema.ToolCall{
+		{ID: "call_1", Type: "code_interpreter", Function: schema.FunctionCall{Name: "run_code"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, openai.ToolTypeFunction, calls[0].Type)
+	}
+}
+
+// 测试严格模式下非function类型返回ErrUnsupportedToolType
+func TestUnknownToolTypeStrict(t *testing.T) {
+	assert.NoError(t, SetToolTypePolicy(ToolTypePolicyStrict))
+	defer SetToolTypePolicy(ToolTypePolicyLenient)
+
+	_, err := convertOpenAIToolsToSchemaTools([]openai.Tool{newCodeInterpreterTool()})
+	assert.True(t, errors.Is(err, ErrUnsupportedToolType))
+
+	_, err = convertSchemaToolCallsToOpenAI([]schema.ToolCall{{ID: "call_1", Type: "code_interpreter"}})
+	assert.True(t, errors.Is(err, ErrUnsupportedToolType))
+
+	_, err = convertSchemaStreamToolCallsToOpenAI([]schema.ToolCall{{ID: "call_1", Type: "code_interpreter"}})
+	assert.True(t, errors.Is(err, ErrUnsupportedToolType))
+
+	// function类型不受影响
+	calls, err := convertSchemaToolCallsToOpenAI([]schema.ToolCall{{ID: "call_2", Type: "function"}})
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+}
+
+// 测试未知的处理方式返回错误
+func TestSetToolTypePolicyUnknown(t *testing.T) {
+	assert.Error(t, SetToolTypePolicy("ignore"))
+}
@@ -0,0 +1,118 @@
+package einox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 链路追踪的span名称
+const (
+	// SpanChatCompletion 一次CreateChatCompletion调用，包含重试、续写和故障转移
+	SpanChatCompletion = "einox.chat_completion"
+	// SpanProviderCall 对供应商的一次上游请求，是SpanChatCompletion的子span
+	SpanProviderCall = "einox.provider_call"
+	// SpanEventFirstToken 流式请求写出首个数据帧时添加到SpanChatCompletion上的事件
+	SpanEventFirstToken = "first_token"
+)
+
+// 链路追踪的属性名称，token用量和模型沿用OpenTelemetry GenAI语义约定
+const (
+	AttrProvider         = "gen_ai.system"
+	AttrModel            = "gen_ai.request.model"
+	AttrPromptTokens     = "gen_ai.usage.input_tokens"
+	AttrCompletionTokens = "gen_ai.usage.output_tokens"
+	AttrStream           = "einox.stream"
+	AttrCredential       = "einox.credential"
+)
+
+// SpanAttribute span的属性，Value为string、bool、int、int64或float64
+type SpanAttribute struct {
+	Key   string
+	Value any
+}
+
+// Span 链路追踪中的一个span
+type Span interface {
+	// SetAttributes 设置span的属性
+	SetAttributes(attrs ...SpanAttribute)
+	// AddEvent 在当前时间添加事件
+	AddEvent(name string, attrs ...SpanAttribute)
+	// SetError 记录错误并将span标记为失败
+	SetError(err error)
+	// End 结束span
+	End()
+}
+
+// Tracer 创建span，返回的ctx携带新建的span，之后以该ctx创建的span为其子span
+// 库本身不依赖OpenTelemetry，以 -tags otel 编译时可用 NewOTelTracer 适配OpenTelemetry的Tracer
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span)
+}
+
+var (
+	tracerMu sync.RWMutex
+	tracer   Tracer
+)
+
+// SetTracer 设置全局的链路追踪，传入nil表示不追踪
+func SetTracer(t Tracer) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	tracer = t
+}
+
+// getTracer 获取当前的链路追踪
+func getTracer() Tracer {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer
+}
+
+// startSpan 创建span，未设置链路追踪时返回原ctx和不做任何处理的span
+func startSpan(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	t := getTracer()
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(requestContext(ctx), name, attrs...)
+}
+
+// startRequestSpan 为请求创建span，并将携带span的ctx写回请求，供子span和供应商调用使用
+func startRequestSpan(req *ChatRequest, name, provider string) Span {
+	ctx, span := startSpan(req.ctx, name,
+		SpanAttribute{Key: AttrProvider, Value: provider},
+		SpanAttribute{Key: AttrModel, Value: req.Model},
+		SpanAttribute{Key: AttrStream, Value: req.Stream},
+	)
+	if _, ok := span.(noopSpan); !ok {
+		req.ctx = ctx
+	}
+	return span
+}
+
+// endSpan 记录凭证、token用量和错误后结束span，usage为nil表示供应商未返回用量
+func endSpan(span Span, credential string, usage *openai.Usage, err error) {
+	if credential != "" {
+		span.SetAttributes(SpanAttribute{Key: AttrCredential, Value: credential})
+	}
+	if usage != nil {
+		span.SetAttributes(
+			SpanAttribute{Key: AttrPromptTokens, Value: usage.PromptTokens},
+			SpanAttribute{Key: AttrCompletionTokens, Value: usage.CompletionTokens},
+		)
+	}
+	if err != nil {
+		span.SetError(err)
+	}
+	span.End()
+}
+
+// noopSpan 未设置链路追踪时使用的span
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...SpanAttribute)    {}
+func (noopSpan) AddEvent(string, ...SpanAttribute) {}
+func (noopSpan) SetError(error)                    {}
+func (noopSpan) End()                              {}
@@ -0,0 +1,77 @@
+//go:build otel
+
+package einox
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewOTelTracer 将OpenTelemetry的Tracer适配为Tracer，需以 -tags otel 编译
+// 例如：einox.SetTracer(einox.NewOTelTracer(otel.Tracer("einox")))
+func NewOTelTracer(tracer trace.Tracer) Tracer {
+	return otelTracer{tracer: tracer}
+}
+
+// otelTracer 基于OpenTelemetry的Tracer
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// Start 实现Tracer
+func (t otelTracer) Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(otelAttributes(attrs)...))
+	return ctx, otelSpan{span: span}
+}
+
+// otelSpan 基于OpenTelemetry的Span
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttributes 实现Span
+func (s otelSpan) SetAttributes(attrs ...SpanAttribute) {
+	s.span.SetAttributes(otelAttributes(attrs)...)
+}
+
+// AddEvent 实现Span
+func (s otelSpan) AddEvent(name string, attrs ...SpanAttribute) {
+	s.span.AddEvent(name, trace.WithAttributes(otelAttributes(attrs)...))
+}
+
+// SetError 实现Span
+func (s otelSpan) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End 实现Span
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+// otelAttributes 转换为OpenTelemetry的属性，不支持的类型按字符串记录
+func otelAttributes(attrs []SpanAttribute) []attribute.KeyValue {
+	converted := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch value := attr.Value.(type) {
+		case string:
+			converted = append(converted, attribute.String(attr.Key, value))
+		case bool:
+			converted = append(converted, attribute.Bool(attr.Key, value))
+		case int:
+			converted = append(converted, attribute.Int(attr.Key, value))
+		case int64:
+			converted = append(converted, attribute.Int64(attr.Key, value))
+		case float64:
+			converted = append(converted, attribute.Float64(attr.Key, value))
+		default:
+			converted = append(converted, attribute.String(attr.Key, fmt.Sprint(value)))
+		}
+	}
+	return converted
+}
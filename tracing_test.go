@@ -0,0 +1,134 @@
+package einox
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedSpan 测试记录的span
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]any
+	events []string
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...SpanAttribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) AddEvent(name string, attrs ...SpanAttribute) {
+	s.events = append(s.events, name)
+}
+func (s *recordedSpan) SetError(err error) { s.err = err }
+func (s *recordedSpan) End()               { s.ended = true }
+
+type spanKey struct{}
+
+// recordingTracer 记录创建的span，通过ctx中的父span建立父子关系
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// setRecordingTracer 设置测试链路追踪，测试结束后取消
+func setRecordingTracer(t *testing.T) *recordingTracer {
+	tracer := &recordingTracer{}
+	SetTracer(tracer)
+	t.Cleanup(func() { SetTracer(nil) })
+	return tracer
+}
+
+// 测试非流式请求创建请求span和上游调用的子span，并记录token用量
+func TestTracingNonStream(t *testing.T) {
+	tracer := setRecordingTracer(t)
+	provider := &usageProvider{}
+	RegisterProvider("tracing", provider)
+	t.Cleanup(func() { unregisterTestProvider("tracing") })
+
+	req := ChatRequest{Provider: "tracing"}
+	req.Model = "gpt-4o"
+	req.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+	_, err := CreateChatCompletionCtx(context.Background(), req, nil)
+	assert.NoError(t, err)
+
+	if assert.Len(t, tracer.spans, 2) {
+		root, call := tracer.spans[0], tracer.spans[1]
+		assert.Equal(t, SpanChatCompletion, root.name)
+		assert.Equal(t, "tracing", root.attrs[AttrProvider])
+		assert.Equal(t, "gpt-4o", root.attrs[AttrModel])
+		assert.Equal(t, false, root.attrs[AttrStream])
+		assert.Equal(t, 10, root.attrs[AttrPromptTokens])
+		assert.True(t, root.ended)
+
+		assert.Equal(t, SpanProviderCall, call.name)
+		assert.Same(t, root, call.parent)
+		assert.Equal(t, 5, call.attrs[AttrCompletionTokens])
+		assert.NoError(t, call.err)
+		assert.True(t, call.ended)
+	}
+	assert.Equal(t, tracer.spans[1], provider.ctx.Value(spanKey{}), "供应商应收到携带子span的ctx")
+}
+
+// 测试请求失败时span记录错误
+func TestTracingError(t *testing.T) {
+	tracer := setRecordingTracer(t)
+	RegisterProvider("tracing-failing", &failingProvider{})
+	t.Cleanup(func() { unregisterTestProvider("tracing-failing") })
+
+	req := ChatRequest{Provider: "tracing-failing"}
+	req.Model = "gpt-4o"
+	_, err := CreateChatCompletion(req, nil)
+	assert.Error(t, err)
+
+	for _, span := range tracer.spans {
+		assert.EqualError(t, span.err, "上游不可用", span.name)
+		assert.True(t, span.ended, span.name)
+	}
+}
+
+// 测试流式请求在首次写出时添加first_token事件
+func TestTracingStreamFirstToken(t *testing.T) {
+	tracer := setRecordingTracer(t)
+	registerFakeProvider(t, "tracing-stream")
+
+	req := ChatRequest{Provider: "tracing-stream"}
+	req.Model = "gpt-4o"
+	req.Stream = true
+	_, err := CreateChatCompletion(req, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	if assert.Len(t, tracer.spans, 2) {
+		root := tracer.spans[0]
+		assert.Equal(t, true, root.attrs[AttrStream])
+		assert.Equal(t, []string{SpanEventFirstToken}, root.events)
+		assert.Same(t, root, tracer.spans[1].parent)
+	}
+}
+
+// 测试未设置链路追踪时不修改请求的ctx
+func TestTracingDisabled(t *testing.T) {
+	req := ChatRequest{}
+	span := startRequestSpan(&req, SpanChatCompletion, "openai")
+	assert.Nil(t, req.ctx)
+	endSpan(span, "cred", &openai.Usage{}, nil)
+}
@@ -0,0 +1,110 @@
+package einox
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// UsageRecord 单次请求的token使用记录，用于计费等下游处理
+type UsageRecord struct {
+	Provider         string    `json:"provider"`             // 供应商
+	Model            string    `json:"model"`                // 模型名称
+	Credential       string    `json:"credential,omitempty"` // 实际使用的凭证名称
+	PromptTokens     int       `json:"prompt_tokens"`        // 输入token数
+	CompletionTokens int       `json:"completion_tokens"`    // 输出token数
+	TotalTokens      int       `json:"total_tokens"`         // 总token数
+	Cost             float64   `json:"cost"`                 // 按SetModelPricing设置的价格计算的费用，未设置价格时为0
+	Stream           bool      `json:"stream"`               // 是否为流式请求
+	Timestamp        time.Time `json:"timestamp"`            // 请求完成的时间
+}
+
+// UsageRecorder 接收每次请求的使用记录
+// 非流式请求在成功返回后调用，流式请求在流正常结束且供应商返回了使用情况时调用
+type UsageRecorder interface {
+	RecordUsage(record UsageRecord)
+}
+
+// ModelPricing 模型价格，单位为每百万token的费用
+type ModelPricing struct {
+	PromptPerMillion     float64 `yaml:"prompt_per_million" json:"prompt_per_million"`         // 输入价格
+	CompletionPerMillion float64 `yaml:"completion_per_million" json:"completion_per_million"` // 输出价格
+}
+
+var (
+	usageRecorderMu sync.RWMutex
+	usageRecorder   UsageRecorder
+	// modelPricing 模型价格，键的匹配规则与SetModelStopDefaults相同
+	modelPricing = map[string]ModelPricing{}
+)
+
+// SetUsageRecorder 设置全局的使用记录接收者，传入nil表示不记录
+func SetUsageRecorder(recorder UsageRecorder) {
+	usageRecorderMu.Lock()
+	defer usageRecorderMu.Unlock()
+	usageRecorder = recorder
+}
+
+// SetModelPricing 设置模型价格，用于计算使用记录中的费用
+// 键为模型名称，以 "*" 结尾时按前缀匹配
+func SetModelPricing(pricing map[string]ModelPricing) {
+	copied := make(map[string]ModelPricing, len(pricing))
+	for model, price := range pricing {
+		copied[model] = price
+	}
+
+	usageRecorderMu.Lock()
+	defer usageRecorderMu.Unlock()
+	modelPricing = copied
+}
+
+// getUsageRecorder 获取当前的使用记录接收者
+func getUsageRecorder() UsageRecorder {
+	usageRecorderMu.RLock()
+	defer usageRecorderMu.RUnlock()
+	return usageRecorder
+}
+
+// usageCost 按模型价格计算费用
+func usageCost(model string, usage openai.Usage) float64 {
+	usageRecorderMu.RLock()
+	price, ok := lookupModelSetting(modelPricing, model)
+	usageRecorderMu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.PromptPerMillion +
+		float64(usage.CompletionTokens)*price.CompletionPerMillion) / 1e6
+}
+
+// recordUsage 生成使用记录并交给接收者，未设置接收者时不做任何处理
+func recordUsage(provider, model, credential string, usage openai.Usage, stream bool) {
+	recorder := getUsageRecorder()
+	if recorder == nil {
+		return
+	}
+	if provider == "" {
+		provider = "bedrock" // 与CreateChatCompletion保持一致
+	}
+	recorder.RecordUsage(UsageRecord{
+		Provider:         provider,
+		Model:            model,
+		Credential:       credential,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Cost:             usageCost(model, usage),
+		Stream:           stream,
+		Timestamp:        time.Now(),
+	})
+}
+
+// captureCredential 在请求上登记凭证选择回调，返回读取选中凭证名称的函数
+// 请求上原有的回调仍会被调用
+func captureCredential(req *ChatRequest) func() string {
+	callInfo := captureCallInfo(req)
+	return func() string {
+		return callInfo().Credential
+	}
+}
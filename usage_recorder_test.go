@@ -0,0 +1,110 @@
+package einox
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUsageRecorder 记录收到的使用记录
+type fakeUsageRecorder struct {
+	mu      sync.Mutex
+	records []UsageRecord
+}
+
+func (r *fakeUsageRecorder) RecordUsage(record UsageRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+// 注册测试用的记录接收者和价格，测试结束后恢复
+func setupFakeUsageRecorder(t *testing.T) *fakeUsageRecorder {
+	recorder := &fakeUsageRecorder{}
+	SetUsageRecorder(recorder)
+	SetModelPricing(map[string]ModelPricing{
+		"gpt-4o*": {PromptPerMillion: 2.5, CompletionPerMillion: 10},
+	})
+	t.Cleanup(func() {
+		SetUsageRecorder(nil)
+		SetModelPricing(nil)
+	})
+	return recorder
+}
+
+// 测试非流式请求的使用记录
+func TestRecordUsageNonStream(t *testing.T) {
+	recorder := setupFakeUsageRecorder(t)
+
+	before := time.Now()
+	recordUsage("azure", "gpt-4o", "azure-eastus",
+		openai.Usage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200}, false)
+
+	if assert.Len(t, recorder.records, 1) {
+		record := recorder.records[0]
+		assert.Equal(t, "azure", record.Provider)
+		assert.Equal(t, "gpt-4o", record.Model)
+		assert.Equal(t, "azure-eastus", record.Credential)
+		assert.Equal(t, 1000, record.PromptTokens)
+		assert.Equal(t, 200, record.CompletionTokens)
+		assert.Equal(t, 1200, record.TotalTokens)
+		assert.InDelta(t, 0.0045, record.Cost, 1e-9)
+		assert.False(t, record.Stream)
+		assert.False(t, record.Timestamp.Before(before))
+	}
+}
+
+// 测试流式请求在流正常结束时生成使用记录
+func TestRecordUsageStream(t *testing.T) {
+	recorder := setupFakeUsageRecorder(t)
+
+	last := newTestStreamChunk("", openai.FinishReasonStop)
+	last.Usage = &openai.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}
+	RegisterProvider("chunks-cred", &credentialChunkProvider{chunkProvider{chunks: []*openai.ChatCompletionStreamResponse{
+		newTestStreamChunk("你好", ""),
+		last,
+	}}})
+	t.Cleanup(func() { unregisterTestProvider("chunks-cred") })
+
+	req := ChatRequest{Provider: "chunks-cred"}
+	req.Model = "gpt-4o"
+	err := StreamChatCompletionWithCallback(req, func(event StreamEvent) error { return nil })
+	assert.NoError(t, err)
+
+	if assert.Len(t, recorder.records, 1, "只应在流结束时记录一次") {
+		record := recorder.records[0]
+		assert.Equal(t, "chunks-cred", record.Provider)
+		assert.Equal(t, "gpt-4o", record.Model)
+		assert.Equal(t, "eastus", record.Credential)
+		assert.Equal(t, 12, record.TotalTokens)
+		assert.True(t, record.Stream)
+		assert.Greater(t, record.Cost, 0.0)
+	}
+}
+
+// 测试流中没有使用情况或未设置接收者时不记录
+func TestRecordUsageSkipped(t *testing.T) {
+	recorder := setupFakeUsageRecorder(t)
+	registerChunkProvider(t, []*openai.ChatCompletionStreamResponse{newTestStreamChunk("你好", openai.FinishReasonStop)}, nil)
+	err := StreamChatCompletionWithCallback(ChatRequest{Provider: "chunks"}, func(event StreamEvent) error { return nil })
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.records)
+
+	SetUsageRecorder(nil)
+	recordUsage("azure", "gpt-4o", "", openai.Usage{TotalTokens: 1}, false)
+	assert.Empty(t, recorder.records)
+}
+
+// 测试凭证回调会同时通知原有的回调
+func TestCaptureCredential(t *testing.T) {
+	var previous string
+	req := ChatRequest{onCredentialSelected: func(info CallInfo) { previous = info.Credential }}
+	credential := captureCredential(&req)
+
+	req.onCredentialSelected(CallInfo{Credential: "openai-main"})
+	assert.Equal(t, "openai-main", credential())
+	assert.Equal(t, "openai-main", previous)
+}
@@ -0,0 +1,104 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 通过HTTP trailer返回token使用情况时使用的字段名，命名风格与OpenAI的 x-ratelimit-* 响应头一致
+const (
+	TrailerPromptTokens     = "X-Usage-Prompt-Tokens"
+	TrailerCompletionTokens = "X-Usage-Completion-Tokens"
+	TrailerTotalTokens      = "X-Usage-Total-Tokens"
+)
+
+// declareUsageTrailers 在响应头中声明使用情况trailer
+func declareUsageTrailers(header http.Header) {
+	header.Add("Trailer", TrailerPromptTokens)
+	header.Add("Trailer", TrailerCompletionTokens)
+	header.Add("Trailer", TrailerTotalTokens)
+}
+
+// usageSniffer 透传SSE数据的同时从中解析token使用情况
+// 流式写入时一个SSE帧可能被拆成多次Write，因此按空行切分完整的帧后再解析
+type usageSniffer struct {
+	w       io.Writer
+	pending []byte
+	usage   *openai.Usage
+}
+
+func newUsageSniffer(w io.Writer) *usageSniffer {
+	return &usageSniffer{w: w}
+}
+
+// Write 实现io.Writer接口
+func (s *usageSniffer) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.pending = append(s.pending, p[:n]...)
+	for {
+		end := bytes.Index(s.pending, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		s.parseFrame(s.pending[:end])
+		s.pending = s.pending[end+2:]
+	}
+	return n, err
+}
+
+// parseFrame 解析单个SSE帧中的usage字段，保留最后一个非零的使用情况
+func (s *usageSniffer) parseFrame(frame []byte) {
+	data, ok := sseFrameData(frame)
+	if !ok {
+		return
+	}
+	var chunk struct {
+		Usage *openai.Usage `json:"usage"`
+		// Response Responses格式的response.completed事件，使用情况位于response.usage
+		Response *struct {
+			Usage *responsesUsage `json:"usage"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err != nil {
+		return
+	}
+	if chunk.Response != nil && chunk.Response.Usage != nil {
+		chunk.Usage = &openai.Usage{
+			PromptTokens:     chunk.Response.Usage.InputTokens,
+			CompletionTokens: chunk.Response.Usage.OutputTokens,
+			TotalTokens:      chunk.Response.Usage.TotalTokens,
+		}
+	}
+	if chunk.Usage == nil {
+		return
+	}
+	if chunk.Usage.TotalTokens == 0 && chunk.Usage.PromptTokens == 0 && chunk.Usage.CompletionTokens == 0 {
+		return
+	}
+	s.usage = chunk.Usage
+}
+
+// sseFrameData 返回SSE帧中data行的内容，帧中可能带有event行
+func sseFrameData(frame []byte) ([]byte, bool) {
+	for _, line := range bytes.Split(bytes.TrimSpace(frame), []byte("\n")) {
+		if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// setTrailers 将解析到的使用情况写入trailer，流中没有使用情况时不设置
+func (s *usageSniffer) setTrailers(header http.Header) {
+	if s.usage == nil {
+		return
+	}
+	header.Set(TrailerPromptTokens, strconv.Itoa(s.usage.PromptTokens))
+	header.Set(TrailerCompletionTokens, strconv.Itoa(s.usage.CompletionTokens))
+	header.Set(TrailerTotalTokens, strconv.Itoa(s.usage.TotalTokens))
+}
@@ -0,0 +1,52 @@
+package einox
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 写入包含使用情况的测试流，每个帧拆成多次写入
+func writeTestUsageStream(req ChatRequest, writer io.Writer) error {
+	frames := []string{
+		`{"id":"1","choices":[{"delta":{"content":"你好"}}],"usage":{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}}`,
+		`{"id":"1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`,
+	}
+	for _, frame := range frames {
+		for _, part := range []string{"data: ", frame, "\n\n"} {
+			if _, err := writer.Write([]byte(part)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := writer.Write([]byte("data: [DONE]\n\n"))
+	return err
+}
+
+// 测试开启后通过trailer返回使用情况
+func TestStreamToHTTPUsageTrailers(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := streamToHTTP(recorder, ChatRequest{UsageTrailers: true}, writeTestUsageStream)
+	assert.NoError(t, err)
+
+	result := recorder.Result()
+	assert.Equal(t, "12", result.Trailer.Get(TrailerPromptTokens))
+	assert.Equal(t, "3", result.Trailer.Get(TrailerCompletionTokens))
+	assert.Equal(t, "15", result.Trailer.Get(TrailerTotalTokens))
+	// 响应体保持不变
+	assert.Contains(t, recorder.Body.String(), `"total_tokens":15`)
+	assert.Contains(t, recorder.Body.String(), "data: [DONE]\n\n")
+}
+
+// 测试默认不返回trailer
+func TestStreamToHTTPUsageTrailersDisabled(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := streamToHTTP(recorder, ChatRequest{}, writeTestUsageStream)
+	assert.NoError(t, err)
+
+	result := recorder.Result()
+	assert.Empty(t, result.Header.Values("Trailer"))
+	assert.Empty(t, result.Trailer.Get(TrailerTotalTokens))
+}
@@ -1,20 +1,37 @@
 package einox
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/sashabaranov/go-openai" // 确保导入 go-openai 包
 )
 
 // convertChatRequestToSchemaMessages 将ChatRequest中的消息转换为schema.Message格式
-func convertChatRequestToSchemaMessages(req ChatRequest) []*schema.Message {
-	schemaMessages := make([]*schema.Message, len(req.Messages))
-	for i, msg := range req.Messages {
+// 远程图片会按req.MediaOptions的限制下载并编码为base64，超过大小限制时返回ImageTooLargeError
+// 供应商要求时（Bedrock/Claude），为缺少name的工具结果消息按ToolCallID补充对应工具调用的函数名
+func convertChatRequestToSchemaMessages(req ChatRequest) ([]*schema.Message, error) {
+	messages := req.Messages
+	if toolNameRequiredProviders[providerOrDefault(req.Provider)] {
+		// 复制后补充，避免修改调用方的请求
+		messages = make([]openai.ChatCompletionMessage, len(req.Messages))
+		for i, msg := range req.Messages {
+			msg.Role = normalizeMessageRole(msg)
+			messages[i] = msg
+		}
+		fillToolMessageNames(messages)
+	}
+
+	schemaMessages := make([]*schema.Message, len(messages))
+	for i, msg := range messages {
 		// 创建基本消息结构
 		schemaMsg := &schema.Message{
-			Role:       schema.RoleType(msg.Role),
+			Role:       schema.RoleType(normalizeMessageRole(msg)),
 			Name:       msg.Name,
 			ToolCallID: msg.ToolCallID, // 主要用于 'tool' 角色的消息
 			//TODO 待完善
@@ -39,10 +56,15 @@ func convertChatRequestToSchemaMessages(req ChatRequest) []*schema.Message {
 						// 判断是否为URL格式，如果是则转换为BASE64
 						if isURL(part.ImageURL.URL) {
 							// 转换图片URL为BASE64
-							base64Data, mimeType, err := convertImageURLToBase64(part.ImageURL.URL)
+							base64Data, mimeType, err := convertImageURLToBase64(part.ImageURL.URL, req.MediaOptions)
+							var tooLarge *ImageTooLargeError
+							if errors.As(err, &tooLarge) {
+								// 超过大小限制时不再退回原URL，由调用方处理
+								return nil, err
+							}
 							if err != nil {
 								// 记录错误但继续使用原URL结构
-								fmt.Printf("转换图片URL到BASE64失败: %v\n", err)
+								getLogger().Warn("转换图片URL到BASE64失败", "error", err)
 								// 保留原始 ImageURL 结构（如果转换失败）
 								chatPart.ImageURL = &schema.ChatMessageImageURL{
 									URL:    part.ImageURL.URL,
@@ -50,7 +72,8 @@ func convertChatRequestToSchemaMessages(req ChatRequest) []*schema.Message {
 									// MIMEType 可能未知
 								}
 							} else {
-								// 使用转换后的BASE64数据
+								// 使用转换后的BASE64数据，超过供应商尺寸限制时先缩放
+								base64Data, mimeType = resizeImageForProvider(req.Provider, base64Data, mimeType)
 								chatPart.ImageURL = &schema.ChatMessageImageURL{
 									URL:      base64Data,
 									Detail:   schema.ImageURLDetail(part.ImageURL.Detail),
@@ -58,38 +81,47 @@ func convertChatRequestToSchemaMessages(req ChatRequest) []*schema.Message {
 								}
 							}
 						} else {
-							// 默认处理方式，可能已经是BASE64数据
+							// 默认处理方式，可能已经是BASE64数据，超过供应商尺寸限制时先缩放
+							imageURL, mimeType := resizeImageForProvider(req.Provider, part.ImageURL.URL, detectMIMEType(part.ImageURL.URL))
 							chatPart.ImageURL = &schema.ChatMessageImageURL{
-								URL:      part.ImageURL.URL,
+								URL:      imageURL,
 								Detail:   schema.ImageURLDetail(part.ImageURL.Detail),
-								MIMEType: detectMIMEType(part.ImageURL.URL),
+								MIMEType: mimeType,
 							}
 						}
 					}
 				case schema.ChatMessagePartTypeAudioURL:
-					// 处理音频URL (如果API支持)
-					if part.ImageURL != nil { // 临时使用ImageURL字段
+					// 处理音频，由FilePart.AudioPart构造，MIME类型随URL传递或根据扩展名、内容识别
+					if file, ok := parseFilePart(part); ok {
+						audioURL, mimeType := convertMediaPart(file, defaultAudioMIMEType)
 						chatPart.AudioURL = &schema.ChatMessageAudioURL{
-							URL:      part.ImageURL.URL,
-							MIMEType: "audio/mp3", // 默认MIME类型
+							URL:      audioURL,
+							MIMEType: mimeType,
 						}
 					}
 				case schema.ChatMessagePartTypeVideoURL:
-					// 处理视频URL (如果API支持)
-					if part.ImageURL != nil { // 临时使用ImageURL字段
+					// 处理视频，由FilePart.VideoPart构造，MIME类型随URL传递或根据扩展名、内容识别
+					if file, ok := parseFilePart(part); ok {
+						videoURL, mimeType := convertMediaPart(file, defaultVideoMIMEType)
 						chatPart.VideoURL = &schema.ChatMessageVideoURL{
-							URL:      part.ImageURL.URL,
-							MIMEType: "video/mp4", // 默认MIME类型
+							URL:      videoURL,
+							MIMEType: mimeType,
 						}
 					}
 				case schema.ChatMessagePartTypeFileURL:
-					// 处理文件URL (如果API支持)
-					if part.ImageURL != nil { // 临时使用ImageURL字段
-						chatPart.FileURL = &schema.ChatMessageFileURL{
-							URL:      part.ImageURL.URL,
-							MIMEType: "application/pdf", // 默认MIME类型
-							Name:     "file.pdf",        // 默认文件名 TODO 待完善
+					// 处理文件，由FilePart.MessagePart构造，文件名和MIME类型随URL传递
+					if file, ok := parseFilePart(part); ok {
+						fileURL, err := convertFilePart(req.Provider, file)
+						if err != nil {
+							// 记录错误但继续使用原URL，由供应商决定是否接受
+							getLogger().Warn("转换文件为内联内容失败", "error", err)
+							fileURL = &schema.ChatMessageFileURL{
+								URL:      file.URL,
+								MIMEType: file.MIMEType,
+								Name:     file.Name,
+							}
 						}
+						chatPart.FileURL = fileURL
 					}
 				}
 
@@ -117,7 +149,7 @@ func convertChatRequestToSchemaMessages(req ChatRequest) []*schema.Message {
 						// Index 字段通常在非流式请求的转换中不需要设置
 					})
 				} else {
-					fmt.Printf("[DEBUG-UTILS] 警告: 跳过非 function 类型的工具调用: Type=%s, ID=%s\n", tc.Type, tc.ID)
+					getLogger().Debug("跳过非function类型的工具调用", "type", tc.Type, "id", tc.ID)
 				}
 			}
 			// 只有当确实转换了 tool call 时才赋值
@@ -136,7 +168,157 @@ func convertChatRequestToSchemaMessages(req ChatRequest) []*schema.Message {
 		schemaMessages[i] = schemaMsg
 	}
 
-	return schemaMessages
+	// 支持视觉输入的模型可以直接接收工具返回的图片/PDF附件
+	if req.DecodeToolAttachments && isVisionModel(req.Model) {
+		schemaMessages = expandToolAttachments(schemaMessages)
+	}
+
+	return schemaMessages, nil
+}
+
+// toolRoleNormalizationDisabled 是否关闭工具消息的角色补全，默认开启
+var toolRoleNormalizationDisabled atomic.Bool
+
+// SetToolRoleNormalization 设置是否为缺少角色的工具结果消息自动补全 "tool" 角色
+func SetToolRoleNormalization(enabled bool) {
+	toolRoleNormalizationDisabled.Store(!enabled)
+}
+
+// normalizeMessageRole 返回消息的角色
+// 部分客户端发送工具结果时只设置了ToolCallID而没有设置Role，这类消息按 "tool" 角色处理
+func normalizeMessageRole(msg openai.ChatCompletionMessage) string {
+	if msg.Role == "" && msg.ToolCallID != "" && !toolRoleNormalizationDisabled.Load() {
+		return openai.ChatMessageRoleTool
+	}
+	return msg.Role
+}
+
+// visionModelKeywords 支持视觉输入的模型名称关键字
+var visionModelKeywords = []string{
+	"gpt-4o", "gpt-4-turbo", "gpt-4-vision", "gpt-4.1",
+	"claude-3", "claude-sonnet-4", "claude-opus-4",
+	"gemini", "vision", "-vl",
+}
+
+// isVisionModel 根据模型名称判断是否支持视觉输入
+func isVisionModel(model string) bool {
+	model = strings.ToLower(model)
+	for _, keyword := range visionModelKeywords {
+		if strings.Contains(model, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// minToolAttachmentLength 识别裸base64附件的最小长度，避免把普通短文本误判为附件
+const minToolAttachmentLength = 64
+
+// decodeToolAttachment 检测工具结果是否为base64编码的图片或PDF
+// 支持 data URL 与裸base64两种形式，返回data URL和MIME类型
+func decodeToolAttachment(content string) (dataURL string, mimeType string, ok bool) {
+	content = strings.TrimSpace(content)
+
+	// data URL形式: data:<mime>;base64,<payload>
+	if strings.HasPrefix(content, "data:") {
+		header, payload, found := strings.Cut(content, ",")
+		if !found || !strings.HasSuffix(header, ";base64") {
+			return "", "", false
+		}
+		mimeType = strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+		if !isAttachmentMIMEType(mimeType) {
+			return "", "", false
+		}
+		if _, err := base64.StdEncoding.DecodeString(payload); err != nil {
+			return "", "", false
+		}
+		return content, mimeType, true
+	}
+
+	// 裸base64形式，需要通过文件头识别类型
+	if len(content) < minToolAttachmentLength {
+		return "", "", false
+	}
+	payload := strings.NewReplacer("\n", "", "\r", "").Replace(content)
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", false
+	}
+	mimeType, _, _ = strings.Cut(http.DetectContentType(data), ";")
+	if !isAttachmentMIMEType(mimeType) {
+		return "", "", false
+	}
+	return "data:" + mimeType + ";base64," + payload, mimeType, true
+}
+
+// isAttachmentMIMEType 判断MIME类型是否为可转换的附件类型（图片或PDF）
+func isAttachmentMIMEType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/") || mimeType == "application/pdf"
+}
+
+// expandToolAttachments 将工具结果中的附件提取为后续轮次的多模态内容
+// 工具消息本身保留一段文字说明，附件统一放入紧跟在连续工具消息之后的用户消息中，
+// 以免破坏 assistant(tool_calls) -> tool 的消息顺序
+func expandToolAttachments(messages []*schema.Message) []*schema.Message {
+	result := make([]*schema.Message, 0, len(messages))
+	var pendingParts []schema.ChatMessagePart
+
+	flush := func() {
+		if len(pendingParts) == 0 {
+			return
+		}
+		parts := append([]schema.ChatMessagePart{{
+			Type: schema.ChatMessagePartTypeText,
+			Text: "以下是工具返回的附件内容：",
+		}}, pendingParts...)
+		result = append(result, &schema.Message{
+			Role:         schema.User,
+			MultiContent: parts,
+		})
+		pendingParts = nil
+	}
+
+	for _, msg := range messages {
+		if msg.Role != schema.Tool {
+			flush()
+			result = append(result, msg)
+			continue
+		}
+
+		dataURL, mimeType, ok := decodeToolAttachment(msg.Content)
+		if !ok {
+			result = append(result, msg)
+			continue
+		}
+
+		// 复制一份工具消息，避免修改调用方持有的消息
+		toolMsg := *msg
+		toolMsg.Content = fmt.Sprintf("[工具返回了附件(%s)，内容已在后续消息中提供]", mimeType)
+		result = append(result, &toolMsg)
+
+		if mimeType == "application/pdf" {
+			pendingParts = append(pendingParts, schema.ChatMessagePart{
+				Type: schema.ChatMessagePartTypeFileURL,
+				FileURL: &schema.ChatMessageFileURL{
+					URL:      dataURL,
+					MIMEType: mimeType,
+					Name:     "attachment.pdf",
+				},
+			})
+		} else {
+			pendingParts = append(pendingParts, schema.ChatMessagePart{
+				Type: schema.ChatMessagePartTypeImageURL,
+				ImageURL: &schema.ChatMessageImageURL{
+					URL:      dataURL,
+					Detail:   schema.ImageURLDetailAuto,
+					MIMEType: mimeType,
+				},
+			})
+		}
+	}
+	flush()
+
+	return result
 }
 
 // isURL (需要实现或确保存在) - 简单实现
@@ -144,16 +326,18 @@ func isURL(s string) bool {
 	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
 }
 
-// convertImageURLToBase64 (需要实现或确保存在) - 占位符实现
-// 在实际场景中，这里需要获取URL内容、编码为Base64并检测MIME类型
-func convertImageURLToBase64(url string) (string, string, error) {
-	fmt.Printf("[DEBUG-UTILS] 占位符: 需要实现将 URL %s 转换为 base64\n", url)
-	// 暂时返回错误以模拟原始逻辑流程（打印错误但不中断）
-	return "", "", fmt.Errorf("convertImageURLToBase64 未实现")
-}
-
 // detectMIMEType 根据URL或数据检测MIME类型
+// base64编码的data URL优先根据内容开头的字节识别，其次使用声明的类型；URL根据路径的扩展名识别
 func detectMIMEType(urlOrData string) string {
+	if strings.HasPrefix(urlOrData, "data:") {
+		header, payload, _ := strings.Cut(urlOrData, ",")
+		if strings.HasSuffix(header, ";base64") {
+			if mimeType, ok := sniffImageMIMEType(decodeBase64Prefix(payload, sniffLen)); ok {
+				return mimeType
+			}
+		}
+	}
+
 	// 简单检测MIME类型
 	if strings.HasPrefix(urlOrData, "data:image/png;") {
 		return "image/png"
@@ -165,15 +349,51 @@ func detectMIMEType(urlOrData string) string {
 		return "image/webp"
 	} else if strings.HasPrefix(urlOrData, "data:image/") {
 		return "image/png" // 默认图片类型
-	} else if strings.HasSuffix(urlOrData, ".png") {
+	}
+
+	// 去掉查询参数和片段后按扩展名识别
+	urlPath := strings.ToLower(urlOrData)
+	if i := strings.IndexAny(urlPath, "?#"); i >= 0 {
+		urlPath = urlPath[:i]
+	}
+	if strings.HasSuffix(urlPath, ".png") {
 		return "image/png"
-	} else if strings.HasSuffix(urlOrData, ".jpg") || strings.HasSuffix(urlOrData, ".jpeg") {
+	} else if strings.HasSuffix(urlPath, ".jpg") || strings.HasSuffix(urlPath, ".jpeg") {
 		return "image/jpeg"
-	} else if strings.HasSuffix(urlOrData, ".gif") {
+	} else if strings.HasSuffix(urlPath, ".gif") {
 		return "image/gif"
-	} else if strings.HasSuffix(urlOrData, ".webp") {
+	} else if strings.HasSuffix(urlPath, ".webp") {
 		return "image/webp"
 	}
 
 	return "image/jpeg" // 默认MIME类型
 }
+
+// sniffLen http.DetectContentType最多检查的字节数
+const sniffLen = 512
+
+// sniffImageMIMEType 根据内容开头的字节识别图片类型，不是可识别的图片时返回false
+func sniffImageMIMEType(data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", false
+	}
+	return mimeType, true
+}
+
+// decodeBase64Prefix 解码base64数据开头的至多n个字节，无需解码整个内容
+func decodeBase64Prefix(payload string, n int) []byte {
+	encodedLen := base64.StdEncoding.EncodedLen(n)
+	if len(payload) > encodedLen {
+		payload = payload[:encodedLen]
+	}
+	payload = payload[:len(payload)/4*4]
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	return data
+}
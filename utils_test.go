@@ -0,0 +1,283 @@
+package einox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+// 生成一张测试用的PNG图片并返回其base64编码
+func testPNGBase64(t *testing.T) string {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// 构造一个包含工具调用及工具结果的请求
+func newToolResultRequest(model, toolResult string) ChatRequest {
+	return ChatRequest{
+		Provider: "azure",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: model,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "截个图看看"},
+				{
+					Role: openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{{
+						ID:   "call_1",
+						Type: openai.ToolTypeFunction,
+						Function: openai.FunctionCall{
+							Name:      "screenshot",
+							Arguments: "{}",
+						},
+					}},
+				},
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: toolResult},
+			},
+		},
+		DecodeToolAttachments: true,
+	}
+}
+
+// 测试工具返回的base64图片被转换为图片内容
+func TestExpandToolAttachmentsImage(t *testing.T) {
+	req := newToolResultRequest("gpt-4o", testPNGBase64(t))
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 4, "应在工具消息后追加一条附件消息")
+
+	toolMsg := messages[2]
+	assert.Equal(t, schema.Tool, toolMsg.Role)
+	assert.Equal(t, "call_1", toolMsg.ToolCallID)
+	assert.Contains(t, toolMsg.Content, "image/png")
+
+	attachMsg := messages[3]
+	assert.Equal(t, schema.User, attachMsg.Role)
+	assert.Len(t, attachMsg.MultiContent, 2)
+	part := attachMsg.MultiContent[1]
+	assert.Equal(t, schema.ChatMessagePartTypeImageURL, part.Type)
+	assert.Equal(t, "image/png", part.ImageURL.MIMEType)
+	assert.Contains(t, part.ImageURL.URL, "data:image/png;base64,")
+}
+
+// 测试data URL形式的PDF附件
+func TestExpandToolAttachmentsPDF(t *testing.T) {
+	pdf := base64.StdEncoding.EncodeToString([]byte("%PDF-1.4\n%测试文档"))
+	req := newToolResultRequest("claude-3-5-sonnet", "data:application/pdf;base64,"+pdf)
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 4)
+	part := messages[3].MultiContent[1]
+	assert.Equal(t, schema.ChatMessagePartTypeFileURL, part.Type)
+	assert.Equal(t, "application/pdf", part.FileURL.MIMEType)
+}
+
+// 测试普通文本工具结果保持不变
+func TestExpandToolAttachmentsPlainText(t *testing.T) {
+	req := newToolResultRequest("gpt-4o", "今天北京晴，气温25度")
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3)
+	assert.Equal(t, "今天北京晴，气温25度", messages[2].Content)
+}
+
+// 测试非视觉模型及未开启选项时不做转换
+func TestExpandToolAttachmentsDisabled(t *testing.T) {
+	image := testPNGBase64(t)
+
+	req := newToolResultRequest("gpt-3.5-turbo", image)
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3, "非视觉模型不应转换附件")
+	assert.Equal(t, image, messages[2].Content)
+
+	req = newToolResultRequest("gpt-4o", image)
+	req.DecodeToolAttachments = false
+	messages, err = convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 3, "未开启选项时不应转换附件")
+}
+
+// 测试只设置了ToolCallID的消息按工具消息处理
+func TestNormalizeToolMessageRole(t *testing.T) {
+	req := ChatRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "北京天气如何"},
+				{ToolCallID: "call_1", Content: "晴，25度"},
+			},
+		},
+	}
+
+	messages, err := convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Equal(t, schema.Tool, messages[1].Role)
+	assert.Equal(t, "call_1", messages[1].ToolCallID)
+
+	// 关闭后保留原始角色
+	SetToolRoleNormalization(false)
+	defer SetToolRoleNormalization(true)
+	messages, err = convertChatRequestToSchemaMessages(req)
+	assert.NoError(t, err)
+	assert.Equal(t, schema.RoleType(""), messages[1].Role)
+}
+
+// 构造同一轮中两次调用同一工具的请求
+func newRepeatedToolCallRequest() ChatRequest {
+	weatherCall := func(id, city string) openai.ToolCall {
+		return openai.ToolCall{
+			ID:       id,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"` + city + `"}`},
+		}
+	}
+	return ChatRequest{
+		Provider: "azure",
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "北京和上海天气如何"},
+				{
+					Role:      openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{weatherCall("call_bj", "北京"), weatherCall("call_sh", "上海")},
+				},
+				// 结果顺序与调用顺序相反，只能按ToolCallID对应
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "call_sh", Content: "上海：小雨，20度"},
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "call_bj", Content: "北京：晴，25度"},
+			},
+		},
+	}
+}
+
+// 测试同名工具的多次调用按ToolCallID对应各自的结果
+func TestConvertRepeatedToolCalls(t *testing.T) {
+	messages, err := convertChatRequestToSchemaMessages(newRepeatedToolCallRequest())
+	assert.NoError(t, err)
+
+	if assert.Len(t, messages, 4) && assert.Len(t, messages[1].ToolCalls, 2) {
+		assert.Equal(t, "call_bj", messages[1].ToolCalls[0].ID)
+		assert.Equal(t, "call_sh", messages[1].ToolCalls[1].ID)
+		assert.Equal(t, "get_weather", messages[1].ToolCalls[1].Function.Name)
+
+		assert.Equal(t, "call_sh", messages[2].ToolCallID)
+		assert.Equal(t, "上海：小雨，20度", messages[2].Content)
+		assert.Equal(t, "call_bj", messages[3].ToolCallID)
+		assert.Equal(t, "北京：晴，25度", messages[3].Content)
+	}
+}
+
+// 测试Bedrock/Claude请求中的工具结果按ToolCallID补充工具名称
+func TestConvertToolResultNames(t *testing.T) {
+	req := newRepeatedToolCallRequest()
+	req.Messages[1].ToolCalls[1].Function.Name = "get_air_quality"
+
+	// OpenAI/Azure不需要工具名称
+	messages, err := convertChatRequestToSchemaMessages(req)
+	if assert.NoError(t, err) {
+		assert.Empty(t, messages[2].Name)
+		assert.Empty(t, messages[3].Name)
+	}
+
+	for _, provider := range []string{"bedrock", "claude", ""} {
+		req.Provider = provider
+		// 只设置了ToolCallID的工具结果同样补充
+		req.Messages[3].Role = ""
+		messages, err := convertChatRequestToSchemaMessages(req)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "get_air_quality", messages[2].Name, provider)
+			assert.Equal(t, "get_weather", messages[3].Name, provider)
+			assert.Equal(t, schema.Tool, messages[3].Role, provider)
+		}
+		assert.Empty(t, req.Messages[2].Name, "原请求不应被修改")
+	}
+}
+
+// 测试流式数据块中缺少索引的多个同名工具调用不会被合并
+func TestConvertStreamToolCallsWithoutIndex(t *testing.T) {
+	calls, err := convertSchemaStreamToolCallsToOpenAI([]schema.ToolCall{
+		{ID: "call_bj", Type: "function", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+		{ID: "call_sh", Type: "function", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"上海"}`}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, 0, *calls[0].Index)
+		assert.Equal(t, 1, *calls[1].Index)
+	}
+}
+
+// 测试非流式响应中的并行工具调用保持顺序并依次分配索引
+func TestConvertParallelToolCalls(t *testing.T) {
+	calls, err := convertSchemaToolCallsToOpenAI([]schema.ToolCall{
+		{ID: "call_bj", Type: "function", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+		{ID: "call_sh", Type: "function", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"上海"}`}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, 0, *calls[0].Index)
+		assert.Equal(t, "call_bj", calls[0].ID)
+		assert.Equal(t, 1, *calls[1].Index)
+		assert.Equal(t, "call_sh", calls[1].ID)
+	}
+
+	// 供应商给出索引时按索引排序
+	first, second := 0, 1
+	calls, err = convertSchemaToolCallsToOpenAI([]schema.ToolCall{
+		{Index: &second, ID: "call_sh", Function: schema.FunctionCall{Name: "get_weather"}},
+		{Index: &first, ID: "call_bj", Function: schema.FunctionCall{Name: "get_weather"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "call_bj", calls[0].ID)
+		assert.Equal(t, 0, *calls[0].Index)
+		assert.Equal(t, "call_sh", calls[1].ID)
+		assert.Equal(t, 1, *calls[1].Index)
+	}
+}
+
+// 各图片格式开头的特征字节
+var imageMagicBytes = map[string][]byte{
+	"image/png":  []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+	"image/jpeg": []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"),
+	"image/webp": []byte("RIFF\x24\x00\x00\x00WEBPVP8 "),
+	"image/gif":  []byte("GIF89a\x01\x00\x01\x00"),
+}
+
+// 测试根据data URL内容开头的字节识别图片类型
+func TestDetectMIMETypeFromMagicBytes(t *testing.T) {
+	for expected, magic := range imageMagicBytes {
+		payload := base64.StdEncoding.EncodeToString(append(magic, bytes.Repeat([]byte{0}, 1024)...))
+		// 声明的类型与内容不一致时以内容为准
+		assert.Equal(t, expected, detectMIMEType("data:image/jpeg;base64,"+payload), expected)
+		assert.Equal(t, expected, detectMIMEType("data:application/octet-stream;base64,"+payload), expected)
+	}
+
+	// 无法识别内容时使用声明的类型
+	assert.Equal(t, "image/webp", detectMIMEType("data:image/webp;base64,"+base64.StdEncoding.EncodeToString([]byte("unknown"))))
+}
+
+// 测试URL按扩展名识别，忽略查询参数
+func TestDetectMIMETypeFromURL(t *testing.T) {
+	assert.Equal(t, "image/png", detectMIMEType("https://cdn.example.com/a.png?size=large"))
+	assert.Equal(t, "image/gif", detectMIMEType("https://cdn.example.com/a.GIF"))
+	assert.Equal(t, "image/jpeg", detectMIMEType("https://cdn.example.com/image?id=123"))
+}
+
+// 测试下载的图片根据内容识别类型
+func TestImageMIMETypeFromFetchedBytes(t *testing.T) {
+	for expected, magic := range imageMagicBytes {
+		assert.Equal(t, expected, imageMIMEType(magic, "application/octet-stream", "https://cdn.example.com/image?id=123"), expected)
+	}
+	assert.Equal(t, "image/webp", imageMIMEType([]byte("unknown"), "image/webp", "https://cdn.example.com/image?id=123"))
+	assert.Equal(t, "image/png", imageMIMEType(nil, "", "https://cdn.example.com/a.png"))
+}